@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"shop-microservice/internal/domain/repositories"
+	"time"
+)
+
+// runArchive - подкоманда `archive [-older-than D | -before T] [-o file] [-batch N]`.
+// Переносит заказы старше окна хранения в архивные партиции базы, а с -o
+// дописывает их в NDJSON-файл (холодное хранилище) и удаляет из базы. В файл
+// заказы пишутся так же, как в архивные партиции: с настроенным шифрованием данные
+// получателя зашифрованы, рядом лежат key_id, dek и слепые индексы.
+// Рассчитана на запуск по расписанию.
+func runArchive(args []string) error {
+	fs := flag.NewFlagSet("archive", flag.ExitOnError)
+	olderThan := fs.Duration("older-than", 365*24*time.Hour, "archive orders created earlier than this long ago")
+	before := fs.String("before", "", "archive orders created before (RFC3339 or YYYY-MM-DD), overrides -older-than")
+	output := fs.String("o", "", "NDJSON cold store file to append to instead of archive partitions")
+	batchSize := fs.Int("batch", 500, "orders per transaction")
+	fs.Parse(args)
+
+	cutoff, err := parseDateFlag("before", *before)
+	if err != nil {
+		return err
+	}
+	if cutoff.IsZero() {
+		if *olderThan <= 0 {
+			return fmt.Errorf("archive: -older-than must be positive")
+		}
+		cutoff = time.Now().Add(-*olderThan)
+	}
+
+	opts := repositories.ArchiveOptions{Before: cutoff, BatchSize: *batchSize}
+	if *output != "" {
+		file, err := os.OpenFile(*output, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+		if err != nil {
+			return fmt.Errorf("archive: %w", err)
+		}
+		defer file.Close()
+		opts.ColdStore = coldStore(file)
+	}
+
+	ctx, stop := commandContext()
+	defer stop()
+
+	db := openDB(psqlInfoFromEnv(), false)
+	defer db.Close()
+
+	archived, err := newOrderRepository(db).Archive(ctx, opts)
+	if err != nil {
+		return fmt.Errorf("archive: %d orders archived: %w", archived, err)
+	}
+
+	fmt.Fprintf(os.Stderr, "archived %d orders created before %s\n", archived, cutoff.Format(time.RFC3339))
+	return nil
+}
+
+// coldStore дописывает пачку в файл и сбрасывает его на диск до того,
+// как заказы будут удалены из базы
+func coldStore(file *os.File) func(ctx context.Context, batch []repositories.SealedOrder) error {
+	return func(ctx context.Context, batch []repositories.SealedOrder) error {
+		buffered := bufio.NewWriter(file)
+		encoder := json.NewEncoder(buffered)
+		for _, sealed := range batch {
+			if err := encoder.Encode(sealed); err != nil {
+				return err
+			}
+		}
+		if err := buffered.Flush(); err != nil {
+			return err
+		}
+		return file.Sync()
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"shop-microservice/internal/app/orderio"
+	"shop-microservice/internal/domain/repositories"
+	"shop-microservice/internal/infrastructure/postgresql"
+	"strings"
+)
+
+// runBackup - подкоманда `backup [-o file]`: архив tar.gz с действующими заказами и
+// манифестом. Удаленные и архивные заказы, история статусов и аудит не копируются.
+func runBackup(args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	output := fs.String("o", "-", "archive file, - for stdout")
+	fs.Parse(args)
+
+	ctx, stop := commandContext()
+	defer stop()
+
+	db := openDB(psqlInfoFromEnv(), false)
+	defer db.Close()
+
+	schemaVersion, dirty, err := postgresql.SchemaVersion(ctx, db)
+	if err != nil {
+		return fmt.Errorf("backup: %w", err)
+	}
+	if dirty {
+		return fmt.Errorf("backup: schema version %d is dirty", schemaVersion)
+	}
+
+	var out io.Writer = os.Stdout
+	if *output != "-" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("backup: %w", err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	manifest, err := orderio.Backup(ctx, newOrderRepository(db), out, schemaVersion)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "backed up %d orders (%d items), schema version %d; not included: %s\n",
+		manifest.Orders, manifest.Items, manifest.SchemaVersion, strings.Join(manifest.Excludes, ", "))
+	return nil
+}
+
+// runRestore - подкоманда `restore [-policy fail|skip|overwrite] [-batch N] file|-`.
+// Схема базы создается миграциями, поэтому восстанавливать можно и в пустую базу.
+func runRestore(args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	policy := fs.String("policy", string(repositories.RestoreFail), "existing orders: fail, skip or overwrite")
+	batchSize := fs.Int("batch", orderio.DefaultImportBatchSize, "orders per transaction")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: restore [-policy fail|skip|overwrite] [-batch N] file|-")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("restore: archive file is required")
+	}
+	if !repositories.RestorePolicy(*policy).Valid() {
+		return fmt.Errorf("restore: unknown policy %q", *policy)
+	}
+
+	var input io.Reader = os.Stdin
+	if path := fs.Arg(0); path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("restore: %w", err)
+		}
+		defer file.Close()
+		input = file
+	}
+
+	ctx, stop := commandContext()
+	defer stop()
+
+	db := openDB(psqlInfoFromEnv(), true)
+	defer db.Close()
+
+	schemaVersion, dirty, err := postgresql.SchemaVersion(ctx, db)
+	if err != nil {
+		return fmt.Errorf("restore: %w", err)
+	}
+	if dirty {
+		return fmt.Errorf("restore: schema version %d is dirty", schemaVersion)
+	}
+
+	report, err := orderio.Restore(ctx, input, newOrderRepository(db), orderio.RestoreOptions{
+		Policy:        repositories.RestorePolicy(*policy),
+		SchemaVersion: schemaVersion,
+		BatchSize:     *batchSize,
+	})
+	if report != nil {
+		fmt.Fprintf(os.Stderr, "restored: %d, skipped: %d, took %s\n", report.Restored, report.Skipped, report.Duration)
+	}
+	return err
+}
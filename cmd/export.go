@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"shop-microservice/internal/app/orderio"
+	"shop-microservice/internal/domain/model"
+	"shop-microservice/internal/domain/repositories"
+	"time"
+)
+
+// runExport - подкоманда `export [-format ndjson|csv] [-from T] [-to T] [-customer ID] [-status S] [-archived] [-o file]`.
+// Границы периода - RFC3339 или дата в формате 2006-01-02.
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("format", string(orderio.FormatNDJSON), "output format: ndjson or csv")
+	from := fs.String("from", "", "created at or after (RFC3339 or YYYY-MM-DD)")
+	to := fs.String("to", "", "created before (RFC3339 or YYYY-MM-DD)")
+	customer := fs.String("customer", "", "customer id")
+	status := fs.String("status", "", "order status")
+	archived := fs.Bool("archived", false, "include orders from archive partitions")
+	output := fs.String("o", "-", "output file, - for stdout")
+	batchSize := fs.Int("batch", orderio.DefaultExportBatchSize, "orders per database query")
+	fs.Parse(args)
+
+	if f := orderio.Format(*format); f != orderio.FormatNDJSON && f != orderio.FormatCSV {
+		return fmt.Errorf("export: format must be ndjson or csv")
+	}
+
+	filter := repositories.OrderFilter{
+		CustomerID:      *customer,
+		Status:          model.OrderStatus(*status),
+		IncludeArchived: *archived,
+	}
+	if filter.Status != "" && !filter.Status.Valid() {
+		return fmt.Errorf("export: unknown status %q", *status)
+	}
+
+	var err error
+	if filter.CreatedFrom, err = parseDateFlag("from", *from); err != nil {
+		return err
+	}
+	if filter.CreatedTo, err = parseDateFlag("to", *to); err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if *output != "-" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("export: %w", err)
+		}
+		defer file.Close()
+		out = file
+	}
+	buffered := bufio.NewWriter(out)
+
+	ctx, stop := commandContext()
+	defer stop()
+
+	db := openDB(psqlInfoFromEnv(), false)
+	defer db.Close()
+
+	exporter := orderio.NewExporter(newOrderRepository(db), *batchSize)
+	count, err := exporter.Export(ctx, buffered, orderio.Format(*format), filter)
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if err != nil {
+		return fmt.Errorf("export: %d orders written: %w", count, err)
+	}
+
+	fmt.Fprintf(os.Stderr, "exported %d orders\n", count)
+	return nil
+}
+
+func parseDateFlag(name, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("export: -%s must be RFC3339 or YYYY-MM-DD", name)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"shop-microservice/internal/app/orderio"
+)
+
+// runImport - подкоманда `import [-format ndjson|json] [-batch N] file|-`.
+// Пишет напрямую в базу, минуя кэш сервиса: запущенные экземпляры узнают
+// об изменениях через LISTEN/NOTIFY.
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	format := fs.String("format", string(orderio.FormatNDJSON), "input format: ndjson or json")
+	batchSize := fs.Int("batch", orderio.DefaultImportBatchSize, "orders per COPY transaction")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: import [-format ndjson|json] [-batch N] file|-")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("import: input file is required")
+	}
+
+	var input io.Reader = os.Stdin
+	if path := fs.Arg(0); path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("import: %w", err)
+		}
+		defer file.Close()
+		input = file
+	}
+
+	ctx, stop := commandContext()
+	defer stop()
+
+	db := openDB(psqlInfoFromEnv(), true)
+	defer db.Close()
+
+	importer := orderio.NewImporter(newOrderRepository(db), *batchSize)
+	report, err := importer.Import(ctx, input, orderio.Format(*format))
+	if report != nil {
+		for _, line := range report.Lines {
+			if line.Result == orderio.ResultRejected {
+				fmt.Fprintf(os.Stderr, "line %d %s: %s\n", line.Line, line.OrderUID, line.Error)
+			}
+		}
+		fmt.Printf("accepted: %d, rejected: %d, took %s\n", report.Accepted, report.Rejected, report.Duration)
+	}
+	if err != nil {
+		return fmt.Errorf("import: %w", err)
+	}
+	return nil
+}
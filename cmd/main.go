@@ -1,17 +1,25 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"shop-microservice/internal/api"
+	"shop-microservice/internal/app/erasure"
+	"shop-microservice/internal/app/retention"
+	"shop-microservice/internal/domain/repositories"
 	"shop-microservice/internal/infrastructure/cash"
+	"shop-microservice/internal/infrastructure/fieldcrypt"
 	"shop-microservice/internal/infrastructure/kafka"
 	"shop-microservice/internal/infrastructure/postgresql"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	_ "github.com/lib/pq"
@@ -25,16 +33,54 @@ func getEnv(key, defaultValue string) string {
 	return value
 }
 
+// commands - служебные подкоманды; без подкоманды (или с serve) запускается сервис
+var commands = map[string]func(args []string) error{
+	"migrate":   runMigrate,
+	"import":    runImport,
+	"export":    runExport,
+	"backup":    runBackup,
+	"restore":   runRestore,
+	"archive":   runArchive,
+	"purge":     runPurge,
+	"reencrypt": runReencrypt,
+}
+
 func main() {
-	dbHost := getEnv("DB_HOST", "postgres")
-	dbPortStr := getEnv("DB_PORT", "5432")
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] == "serve" {
+		args = args[1:]
+	} else if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		run, ok := commands[args[0]]
+		if !ok {
+			log.Fatalf("Unknown command %q", args[0])
+		}
+		if err := run(args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	serve(args)
+}
+
+// commandContext - контекст подкоманды: отменяется по сигналу, изменения
+// записываются в журнал от имени пользователя ОС через канал cli
+func commandContext() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	ctx = repositories.WithActor(ctx, getEnv("USER", repositories.ChannelCLI))
+	ctx = repositories.WithChannel(ctx, repositories.ChannelCLI)
+	return ctx, stop
+}
+
+// psqlInfoFromEnv собирает строку подключения к PostgreSQL из переменных окружения
+func psqlInfoFromEnv() string {
+	return psqlInfoFor(getEnv("DB_HOST", "postgres"), getEnv("DB_PORT", "5432"))
+}
+
+// psqlInfoFor - строка подключения к серверу dbHost:dbPortStr с учетными данными из окружения
+func psqlInfoFor(dbHost, dbPortStr string) string {
 	dbUser := getEnv("DB_USER", "orders_user")
 	dbPassword := getEnv("DB_PASSWORD", "orders_password")
 	dbName := getEnv("DB_NAME", "orders_db")
-	appPort := getEnv("APP_PORT", "8081")
-
-	kafkaBrokers := getEnv("KAFKA_BROKERS", "kafka:9092")
-	kafkaTopic := getEnv("KAFKA_TOPIC", "orders")
 
 	if dbHost == "" || dbPortStr == "" || dbUser == "" || dbPassword == "" || dbName == "" {
 		log.Fatal("Missing required database environment variables")
@@ -45,23 +91,135 @@ func main() {
 		log.Fatal("Invalid DB_PORT:", err)
 	}
 
-	psqlInfo := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
+	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
 		dbHost, dbPort, dbUser, dbPassword, dbName)
+}
 
+// openDB подключается к базе; с migrate применяет недостающие миграции
+func openDB(psqlInfo string, migrate bool) *sql.DB {
 	db, err := sql.Open("postgres", psqlInfo)
 	if err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
-	defer db.Close()
 
 	if err := db.Ping(); err != nil {
 		log.Fatal("Database ping failed:", err)
 	}
 
-	if err := postgresql.RunMigrations(db); err != nil {
-		log.Fatal("Migrations failed:", err)
+	if migrate {
+		if err := postgresql.RunMigrations(db); err != nil {
+			log.Fatal("Migrations failed:", err)
+		}
+	}
+	return db
+}
+
+// openReplicas подключается к репликам из DB_REPLICAS (host[:port] через запятую,
+// учетные данные как у основной базы). Недоступная при старте реплика не мешает
+// запуску: чтения идут в основную базу, пока проверка не вернет реплику.
+// Без DB_REPLICAS возвращает nil.
+func openReplicas(ctx context.Context) (*postgresql.ReplicaSet, func()) {
+	hosts := getEnv("DB_REPLICAS", "")
+	if hosts == "" {
+		return nil, func() {}
+	}
+	maxLag, err := time.ParseDuration(getEnv("DB_REPLICA_MAX_LAG", postgresql.DefaultMaxReplicaLag.String()))
+	if err != nil {
+		log.Fatal("Invalid DB_REPLICA_MAX_LAG:", err)
+	}
+	interval, err := time.ParseDuration(getEnv("DB_REPLICA_CHECK_INTERVAL", "5s"))
+	if err != nil || interval <= 0 {
+		log.Fatalf("Invalid DB_REPLICA_CHECK_INTERVAL: %q", os.Getenv("DB_REPLICA_CHECK_INTERVAL"))
+	}
+
+	var dbs []*sql.DB
+	for _, hostPort := range strings.Split(hosts, ",") {
+		host, port, found := strings.Cut(strings.TrimSpace(hostPort), ":")
+		if !found {
+			port = getEnv("DB_PORT", "5432")
+		}
+		db, err := sql.Open("postgres", psqlInfoFor(host, port))
+		if err != nil {
+			log.Fatal("Invalid DB_REPLICAS:", err)
+		}
+		dbs = append(dbs, db)
+	}
+
+	replicas := postgresql.NewReplicaSet(maxLag, dbs...)
+	log.Printf("Read replicas: %d of %d available", replicas.Check(ctx), len(dbs))
+	go replicas.Run(ctx, interval)
+
+	return replicas, func() {
+		for _, db := range dbs {
+			db.Close()
+		}
+	}
+}
+
+// newOrderRepository создает репозиторий заказов; если задан FIELD_KEYS_FILE,
+// данные получателя хранятся зашифрованными ключами из этого файла
+func newOrderRepository(db *sql.DB, opts ...postgresql.Option) *postgresql.OrderRepository {
+	path := getEnv("FIELD_KEYS_FILE", "")
+	if path == "" {
+		return postgresql.NewOrderRepository(db, opts...)
+	}
+
+	keys, err := fieldcrypt.LoadKeyFile(path)
+	if err != nil {
+		log.Fatal("Invalid FIELD_KEYS_FILE:", err)
+	}
+	cipher, err := fieldcrypt.New(keys)
+	if err != nil {
+		log.Fatal("Invalid FIELD_KEYS_FILE:", err)
+	}
+	return postgresql.NewOrderRepository(db, append(opts, postgresql.WithDeliveryCipher(cipher))...)
+}
+
+// serve запускает HTTP-сервис. Флаг -migrate (по умолчанию AUTO_MIGRATE, иначе true)
+// управляет применением миграций при старте.
+func serve(args []string) {
+	autoMigrate, err := strconv.ParseBool(getEnv("AUTO_MIGRATE", "true"))
+	if err != nil {
+		log.Fatal("Invalid AUTO_MIGRATE:", err)
 	}
 
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	fs.BoolVar(&autoMigrate, "migrate", autoMigrate, "apply pending migrations on start")
+	fs.Parse(args)
+
+	appPort := getEnv("APP_PORT", "8081")
+	adminToken := getEnv("ADMIN_TOKEN", "")
+	reconcileIntervalStr := getEnv("CACHE_RECONCILE_INTERVAL", "5m")
+
+	kafkaBrokers := getEnv("KAFKA_BROKERS", "kafka:9092")
+	kafkaTopic := getEnv("KAFKA_TOPIC", "orders")
+
+	reconcileInterval, err := time.ParseDuration(reconcileIntervalStr)
+	if err != nil {
+		log.Fatal("Invalid CACHE_RECONCILE_INTERVAL:", err)
+	}
+
+	retentionPolicy := retentionPolicyFromEnv()
+	retentionInterval, err := time.ParseDuration(getEnv("RETENTION_INTERVAL", "24h"))
+	if err != nil {
+		log.Fatal("Invalid RETENTION_INTERVAL:", err)
+	}
+	retentionDryRun, err := strconv.ParseBool(getEnv("RETENTION_DRY_RUN", "false"))
+	if err != nil {
+		log.Fatal("Invalid RETENTION_DRY_RUN:", err)
+	}
+	erasureInterval, err := time.ParseDuration(getEnv("ERASURE_POLL_INTERVAL", "10s"))
+	if err != nil {
+		log.Fatal("Invalid ERASURE_POLL_INTERVAL:", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	psqlInfo := psqlInfoFromEnv()
+	db := openDB(psqlInfo, autoMigrate)
+	defer db.Close()
+
 	brokers := strings.Split(kafkaBrokers, ",")
 	kafkaManager := kafka.NewKafkaManager(brokers)
 
@@ -74,8 +232,17 @@ func main() {
 		log.Printf("Warning: failed to create topic: %v", err)
 	}
 
-	repo := postgresql.NewOrderRepository(db)
-	cash := cash.NewCash()
+	// Чтения заказов по возможности идут в реплики, изменения - в основную базу
+	var repoOpts []postgresql.Option
+	replicas, closeReplicas := openReplicas(ctx)
+	defer closeReplicas()
+	if replicas != nil {
+		repoOpts = append(repoOpts, postgresql.WithReplicas(replicas))
+	}
+
+	orderRepo := newOrderRepository(db, repoOpts...)
+	orderCash := cash.NewCash()
+	repo := cash.NewCachedOrderRepository(orderRepo, orderCash)
 
 	kafkaProducer := kafka.NewProducer(kafka.ProducerConfig{
 		Brokers: brokers,
@@ -83,14 +250,51 @@ func main() {
 	})
 	defer kafkaProducer.Close()
 
-	if err := cash.WarmUp(repo); err != nil {
+	if err := orderCash.WarmUp(orderRepo); err != nil {
 		log.Printf("Warning: cache warm-up failed: %v", err)
 	} else {
-		log.Printf("Cache initialized with %d orders", cash.Size())
+		log.Printf("Cache initialized with %d orders", orderCash.Size())
+	}
+
+	handler := api.NewHandler(repo, kafkaProducer, orderCash)
+	reconciler := cash.NewReconciler(orderCash, orderRepo, reconcileInterval)
+	if reconcileInterval > 0 {
+		go reconciler.Run(ctx)
+	}
+
+	// Правила хранения применяются по расписанию, если хотя бы одно включено
+	if retentionInterval > 0 && !retentionPolicy.Empty() {
+		purgeJob := retention.NewJob(orderRepo, retentionPolicy, orderCash, kafkaProducer)
+		go purgeJob.Run(ctx, retentionInterval, retentionDryRun)
+	}
+
+	// Заявки на стирание данных покупателей выполняются через кэширующий
+	// репозиторий, чтобы стертые заказы ушли из кэша
+	if erasureInterval > 0 {
+		go erasure.NewWorker(repo, kafkaProducer).Run(ctx, erasureInterval)
 	}
 
-	handler := api.NewHandler(repo, kafkaProducer, cash)
-	router := api.SetupRouter(handler)
+	changeListener := postgresql.NewChangeListener(psqlInfo)
+	go func() {
+		err := changeListener.Listen(ctx,
+			func(uid string) {
+				if _, err := repo.Refresh(ctx, uid); err != nil {
+					log.Printf("Cache refresh for order %s: %v", uid, err)
+				}
+			},
+			func() {
+				if _, err := reconciler.ReconcileOnce(ctx); err != nil {
+					log.Printf("Warning: cache resync failed: %v", err)
+				}
+			},
+		)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Warning: order change listener stopped: %v", err)
+		}
+	}()
+
+	admin := api.NewAdminHandler(orderCash, orderRepo, reconciler)
+	router := api.SetupRouter(handler, admin, adminToken)
 
 	if appPort == "" {
 		appPort = "8081"
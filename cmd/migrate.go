@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"shop-microservice/internal/infrastructure/postgresql"
+	"strconv"
+
+	"github.com/golang-migrate/migrate/v4"
+)
+
+const migrateUsage = `usage: migrate <command>
+  up         apply all pending migrations
+  down N     roll back N migrations
+  goto V     migrate up or down to version V
+  version    print the current version
+  force V    set version V without running migrations (clears the dirty flag)`
+
+// runMigrate - подкоманда migrate: управление схемой встроенными миграциями
+func runMigrate(args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	number := func() (int, error) {
+		if len(args) != 2 {
+			return 0, fmt.Errorf("migrate %s: exactly one number is required\n%s", args[0], migrateUsage)
+		}
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("migrate %s: %q is not a non-negative number", args[0], args[1])
+		}
+		return n, nil
+	}
+
+	var apply func(m *migrate.Migrate) error
+	switch args[0] {
+	case "up":
+		apply = (*migrate.Migrate).Up
+	case "down":
+		n, err := number()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return errors.New("migrate down: N must be positive")
+		}
+		apply = func(m *migrate.Migrate) error { return m.Steps(-n) }
+	case "goto":
+		v, err := number()
+		if err != nil {
+			return err
+		}
+		apply = func(m *migrate.Migrate) error { return m.Migrate(uint(v)) }
+	case "force":
+		v, err := number()
+		if err != nil {
+			return err
+		}
+		apply = func(m *migrate.Migrate) error { return m.Force(v) }
+	case "version":
+		apply = func(m *migrate.Migrate) error { return nil }
+	default:
+		return fmt.Errorf("migrate: unknown command %q\n%s", args[0], migrateUsage)
+	}
+
+	db := openDB(psqlInfoFromEnv(), false)
+	defer db.Close()
+
+	m, err := postgresql.NewMigrate(context.Background(), db)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	err = apply(m)
+	if errors.Is(err, migrate.ErrNoChange) {
+		fmt.Fprintln(os.Stderr, "no change")
+	} else if err != nil {
+		return fmt.Errorf("migrate %s: %w", args[0], err)
+	}
+
+	version, dirty, err := m.Version()
+	switch {
+	case errors.Is(err, migrate.ErrNilVersion):
+		fmt.Println("no migrations applied")
+	case err != nil:
+		return fmt.Errorf("migrate version: %w", err)
+	case dirty:
+		fmt.Printf("version %d (dirty)\n", version)
+	default:
+		fmt.Printf("version %d\n", version)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"shop-microservice/internal/app/retention"
+	"shop-microservice/internal/domain/repositories"
+	"shop-microservice/internal/infrastructure/kafka"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const day = 24 * time.Hour
+
+// runPurge - подкоманда `purge [-dry-run] [-delivery-days N] [-cancelled-days N] [-deleted-days N]`.
+// Применяет правила хранения один раз и печатает отчет в JSON. Сроки по умолчанию
+// берутся из RETENTION_*_DAYS, 0 отключает правило. Кэши запущенных экземпляров
+// обновляются через LISTEN/NOTIFY, потребителям уходят события в Kafka (-events=false отключает).
+func runPurge(args []string) error {
+	policy := retentionPolicyFromEnv()
+
+	fs := flag.NewFlagSet("purge", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "report what would be purged without changing anything")
+	deliveryDays := fs.Int("delivery-days", int(policy.AnonymizeDeliveryAfter/day), "erase delivery PII of orders created more than N days ago")
+	cancelledDays := fs.Int("cancelled-days", int(policy.DeleteCancelledAfter/day), "delete orders cancelled more than N days ago")
+	deletedDays := fs.Int("deleted-days", int(policy.PurgeDeletedAfter/day), "delete soft-deleted orders after N days")
+	events := fs.Bool("events", true, "publish purge events to Kafka")
+	fs.Parse(args)
+
+	policy = repositories.RetentionPolicy{
+		AnonymizeDeliveryAfter: time.Duration(*deliveryDays) * day,
+		DeleteCancelledAfter:   time.Duration(*cancelledDays) * day,
+		PurgeDeletedAfter:      time.Duration(*deletedDays) * day,
+	}
+	if policy.Empty() {
+		return fmt.Errorf("purge: no retention rule enabled")
+	}
+
+	ctx, stop := commandContext()
+	defer stop()
+
+	db := openDB(psqlInfoFromEnv(), false)
+	defer db.Close()
+
+	var publisher retention.Publisher
+	if *events && !*dryRun {
+		producer := kafka.NewProducer(kafka.ProducerConfig{
+			Brokers: strings.Split(getEnv("KAFKA_BROKERS", "kafka:9092"), ","),
+			Topic:   getEnv("KAFKA_TOPIC", "orders"),
+		})
+		defer producer.Close()
+		publisher = producer
+	}
+
+	job := retention.NewJob(newOrderRepository(db), policy, nil, publisher)
+	report, err := job.RunOnce(ctx, *dryRun)
+	if err != nil {
+		return fmt.Errorf("purge: %w", err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+// retentionPolicyFromEnv читает сроки хранения в днях из RETENTION_DELIVERY_DAYS,
+// RETENTION_CANCELLED_DAYS и RETENTION_DELETED_DAYS; по умолчанию правила отключены
+func retentionPolicyFromEnv() repositories.RetentionPolicy {
+	days := func(key string) time.Duration {
+		n, err := strconv.Atoi(getEnv(key, "0"))
+		if err != nil || n < 0 {
+			log.Fatalf("Invalid %s: %q", key, os.Getenv(key))
+		}
+		return time.Duration(n) * day
+	}
+	return repositories.RetentionPolicy{
+		AnonymizeDeliveryAfter: days("RETENTION_DELIVERY_DAYS"),
+		DeleteCancelledAfter:   days("RETENTION_CANCELLED_DAYS"),
+		PurgeDeletedAfter:      days("RETENTION_DELETED_DAYS"),
+	}
+}
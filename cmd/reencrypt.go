@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"shop-microservice/internal/domain/repositories"
+)
+
+// runReencrypt - подкоманда `reencrypt [-batch N] [-decrypt]`. После ротации ключа
+// в FIELD_KEYS_FILE шифрует данные получателя текущим ключом: открытые записи
+// шифруются, ключи данных старых записей переоборачиваются. С -decrypt данные
+// сохраняются открыто (перед отключением шифрования или откатом миграции).
+func runReencrypt(args []string) error {
+	fs := flag.NewFlagSet("reencrypt", flag.ExitOnError)
+	batchSize := fs.Int("batch", 500, "deliveries per transaction")
+	decrypt := fs.Bool("decrypt", false, "store deliveries, audit entries and archived orders as plaintext instead")
+	fs.Parse(args)
+
+	if getEnv("FIELD_KEYS_FILE", "") == "" {
+		return fmt.Errorf("reencrypt: FIELD_KEYS_FILE is not set")
+	}
+
+	ctx, stop := commandContext()
+	defer stop()
+
+	db := openDB(psqlInfoFromEnv(), false)
+	defer db.Close()
+
+	n, err := newOrderRepository(db).Reencrypt(ctx, repositories.ReencryptOptions{
+		BatchSize: *batchSize,
+		Decrypt:   *decrypt,
+	})
+	if err != nil {
+		return fmt.Errorf("reencrypt: %d deliveries done: %w", n, err)
+	}
+
+	fmt.Fprintf(os.Stderr, "reencrypted %d deliveries\n", n)
+	return nil
+}
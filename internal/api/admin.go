@@ -0,0 +1,136 @@
+package api
+
+import (
+	"net/http"
+	"shop-microservice/internal/infrastructure/cash"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultKeysSample = 100
+
+// AdminHandler обслуживает административные операции над кэшем
+type AdminHandler struct {
+	cash       *cash.Cash
+	source     cash.OrderRepository
+	reconciler *cash.Reconciler
+}
+
+// NewAdminHandler создает обработчик админки; source - репозиторий без кэша,
+// из которого кэш перезаполняется
+func NewAdminHandler(cash *cash.Cash, source cash.OrderRepository, reconciler *cash.Reconciler) *AdminHandler {
+	return &AdminHandler{
+		cash:       cash,
+		source:     source,
+		reconciler: reconciler,
+	}
+}
+
+// InvalidateOrder удаляет из кэша один заказ
+func (h *AdminHandler) InvalidateOrder(c *gin.Context) {
+	orderUID := c.Param("id")
+	h.cash.Invalidate(orderUID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "Order invalidated",
+		"order_uid": orderUID,
+	})
+}
+
+// InvalidateOrders удаляет из кэша заказы по префиксу OrderUID или по покупателю
+func (h *AdminHandler) InvalidateOrders(c *gin.Context) {
+	prefix := c.Query("prefix")
+	customerID := c.Query("customer_id")
+
+	var removed int
+	switch {
+	case prefix != "" && customerID != "":
+		c.JSON(http.StatusBadRequest, gin.H{"error": "use either prefix or customer_id"})
+		return
+	case prefix != "":
+		removed = h.cash.InvalidatePrefix(prefix)
+	case customerID != "":
+		removed = h.cash.InvalidateCustomer(customerID)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "prefix or customer_id is required"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Orders invalidated",
+		"removed": removed,
+	})
+}
+
+// ClearCache полностью очищает кэш
+func (h *AdminHandler) ClearCache(c *gin.Context) {
+	removed := h.cash.Size()
+	h.cash.Clear()
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Cache cleared",
+		"removed": removed,
+	})
+}
+
+// WarmUp перезаполняет кэш из базы
+func (h *AdminHandler) WarmUp(c *gin.Context) {
+	if err := h.cash.WarmUp(h.source); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "cache warm-up failed",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Cache warmed up",
+		"cache_size": h.cash.Size(),
+	})
+}
+
+// Reconcile запускает внеочередную сверку кэша с базой. С ?verify=content
+// заказы сверяются по хэшу содержимого, чтобы найти изменения в обход сервиса;
+// это читает все строки заказов, поэтому периодическая сверка так не делает.
+func (h *AdminHandler) Reconcile(c *gin.Context) {
+	reconcile := h.reconciler.ReconcileOnce
+	switch c.Query("verify") {
+	case "":
+	case "content":
+		reconcile = h.reconciler.VerifyOnce
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "verify must be content"})
+		return
+	}
+
+	report, err := reconcile(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "cache reconciliation failed",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// Keys возвращает выборку ключей кэша
+func (h *AdminHandler) Keys(c *gin.Context) {
+	limit := defaultKeysSample
+	if raw := c.Query("limit"); raw != "" {
+		value, err := strconv.Atoi(raw)
+		if err != nil || value <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+			return
+		}
+		limit = value
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"cache_size":   h.cash.Size(),
+		"cache_loaded": h.cash.Loaded(),
+		"keys":         h.cash.Keys(limit),
+	})
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"net/http"
+	"shop-microservice/internal/app/orderio"
+	"shop-microservice/internal/domain/repositories"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ImportOrders загружает заказы из тела запроса (NDJSON по умолчанию, либо JSON при
+// ?format=json или Content-Type: application/json) и возвращает построчный отчет.
+// Некорректные строки не прерывают загрузку остальных.
+func (h *Handler) ImportOrders(c *gin.Context) {
+	store, ok := h.repo.(repositories.BulkImporter)
+	if !ok {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "bulk import is not supported"})
+		return
+	}
+
+	format := orderio.Format(c.Query("format"))
+	if format == "" {
+		format = orderio.FormatNDJSON
+		if strings.HasPrefix(c.ContentType(), "application/json") {
+			format = orderio.FormatJSON
+		}
+	}
+	if format != orderio.FormatNDJSON && format != orderio.FormatJSON {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be ndjson or json"})
+		return
+	}
+
+	batchSize := 0
+	if raw := c.Query("batch_size"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "batch_size must be a positive integer"})
+			return
+		}
+		batchSize = n
+	}
+
+	report, err := orderio.NewImporter(store, batchSize).Import(c.Request.Context(), c.Request.Body, format)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Import aborted",
+			"details": err.Error(),
+			"report":  report,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"shop-microservice/internal/app/orderio"
+	"shop-microservice/internal/domain/repositories"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ExportCustomer выгружает все заказы покупателя (включая удаленные и архивные)
+// вместе с доставкой и оплатой в архив tar.gz с манифестом
+func (h *Handler) ExportCustomer(c *gin.Context) {
+	customerID := c.Param("customer_id")
+
+	filename := fmt.Sprintf("customer-%s-%s.tar.gz", customerID, time.Now().UTC().Format("20060102T150405Z"))
+	c.Header("Content-Type", "application/gzip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Status(http.StatusOK)
+
+	// Заказы сначала выгружаются во временный файл, поэтому при ошибке
+	// выгрузки в ответ еще ничего не записано
+	if _, err := orderio.ExportCustomer(c.Request.Context(), h.repo, c.Writer, customerID); err != nil {
+		log.Printf("Export of customer %s failed: %v", customerID, err)
+		if !c.Writer.Written() {
+			c.Writer.Header().Del("Content-Disposition")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to export customer data"})
+		}
+	}
+}
+
+// EraseCustomer ставит в очередь стирание персональных данных покупателя и
+// возвращает заявку; состояние заявки доступно по адресу из Location
+func (h *Handler) EraseCustomer(c *gin.Context) {
+	eraser, ok := h.repo.(repositories.CustomerEraser)
+	if !ok {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "customer erasure is not supported"})
+		return
+	}
+
+	job, err := eraser.RequestErasure(c.Request.Context(), c.Param("customer_id"))
+	if err != nil {
+		log.Printf("Failed to request erasure: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to request erasure"})
+		return
+	}
+
+	c.Header("Location", fmt.Sprintf("/api/erasure-jobs/%d", job.ID))
+	c.JSON(http.StatusAccepted, job)
+}
+
+// GetErasureJob возвращает заявку на стирание данных покупателя
+func (h *Handler) GetErasureJob(c *gin.Context) {
+	eraser, ok := h.repo.(repositories.CustomerEraser)
+	if !ok {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "customer erasure is not supported"})
+		return
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "job id must be a positive integer"})
+		return
+	}
+
+	job, err := eraser.ErasureJob(c.Request.Context(), id)
+	if errors.Is(err, repositories.ErrErasureJobNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to get erasure job %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get erasure job"})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"shop-microservice/internal/domain/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AttachDelivery привязывает доставку к заказу (например, к черновику) или заменяет ее
+func (h *Handler) AttachDelivery(c *gin.Context) {
+	var delivery model.Delivery
+	if err := c.ShouldBindJSON(&delivery); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request payload",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	h.updateOrder(c, c.Param("id"), func(order *model.Order) error {
+		order.Delivery = &delivery
+		return validateLengths(order)
+	})
+}
+
+// AttachPayment привязывает оплату к заказу (например, к черновику) или заменяет ее
+func (h *Handler) AttachPayment(c *gin.Context) {
+	var payment model.Payment
+	if err := c.ShouldBindJSON(&payment); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request payload",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	h.updateOrder(c, c.Param("id"), func(order *model.Order) error {
+		order.Payment = &payment
+		return validateLengths(order)
+	})
+}
+
+// validateLengths отклоняет заказ, поля которого не поместятся в столбцы базы (422)
+func validateLengths(order *model.Order) error {
+	if err := order.ValidateLengths(); err != nil {
+		return fmt.Errorf("%w: %w", errInvalidOrder, err)
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setETag выставляет версию заказа как ETag ("<version>")
+func setETag(c *gin.Context, version int64) {
+	if version > 0 {
+		c.Header("ETag", strconv.Quote(strconv.FormatInt(version, 10)))
+	}
+}
+
+// parseIfMatch возвращает ожидаемую версию из заголовка If-Match.
+// Отсутствующий заголовок и "*" означают любую версию (0).
+func parseIfMatch(c *gin.Context) (int64, error) {
+	value := strings.TrimSpace(c.GetHeader("If-Match"))
+	if value == "" || value == "*" {
+		return 0, nil
+	}
+
+	value = strings.TrimPrefix(value, "W/")
+	unquoted, err := strconv.Unquote(value)
+	if err != nil {
+		unquoted = value
+	}
+
+	version, err := strconv.ParseInt(unquoted, 10, 64)
+	if err != nil || version <= 0 {
+		return 0, errors.New("invalid If-Match header")
+	}
+	return version, nil
+}
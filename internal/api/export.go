@@ -0,0 +1,72 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"shop-microservice/internal/app/orderio"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Трейлеры ответа выгрузки: заголовки уже отправлены, поэтому итог и ошибка
+// передаются после тела
+const (
+	exportCountTrailer = "X-Export-Count"
+	exportErrorTrailer = "X-Export-Error"
+)
+
+var exportContentTypes = map[orderio.Format]string{
+	orderio.FormatNDJSON: "application/x-ndjson",
+	orderio.FormatCSV:    "text/csv; charset=utf-8",
+}
+
+// ExportOrders выгружает заказы по фильтру (те же параметры, что у списка заказов)
+// в NDJSON (по умолчанию) или CSV. Ответ передается по частям, в памяти держится
+// одна пачка заказов.
+func (h *Handler) ExportOrders(c *gin.Context) {
+	format := orderio.Format(c.DefaultQuery("format", string(orderio.FormatNDJSON)))
+	contentType, ok := exportContentTypes[format]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be ndjson or csv"})
+		return
+	}
+
+	filter, err := parseOrderFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	batchSize := 0
+	if raw := c.Query("batch_size"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "batch_size must be a positive integer"})
+			return
+		}
+		batchSize = n
+	}
+
+	filename := fmt.Sprintf("orders-%s.%s", time.Now().UTC().Format("20060102T150405Z"), format)
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Header("Trailer", exportCountTrailer+", "+exportErrorTrailer)
+	c.Status(http.StatusOK)
+
+	count, err := orderio.NewExporter(h.repo, batchSize).Export(c.Request.Context(), c.Writer, format, filter)
+	if err != nil {
+		log.Printf("Order export failed after %d orders: %v", count, err)
+		if !c.Writer.Written() {
+			for _, header := range []string{"Content-Type", "Content-Disposition", "Trailer"} {
+				c.Writer.Header().Del(header)
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to export orders"})
+			return
+		}
+		c.Writer.Header().Set(exportErrorTrailer, err.Error())
+	}
+	c.Writer.Header().Set(exportCountTrailer, strconv.Itoa(count))
+}
@@ -2,6 +2,9 @@ package api
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"shop-microservice/internal/domain/model"
@@ -11,6 +14,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 )
 
 type Handler struct {
@@ -31,117 +35,376 @@ func (h *Handler) CreateOrder(c *gin.Context) {
 	var order model.Order
 
 	if err := c.ShouldBindJSON(&order); err != nil {
-		log.Printf("Invalid json payload: %w", err)
+		log.Printf("Invalid json payload: %v", err)
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error":   "Invalid request payload",
 			"details": err.Error(),
 		})
 		return
 	}
-	//limit values
-	if order.OrderUID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "order uid is required"})
+
+	// Черновик (?draft=true) можно создать без доставки и оплаты
+	if err := order.Validate(c.Query("draft") == "true"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := checkItemTransitions(nil, order.Items); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	if order.TrackNumber == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "truck number is required"})
+	ctx := c.Request.Context()
+	err := h.repo.Create(ctx, &order)
+	var conflict *repositories.ConflictError
+	if errors.As(err, &conflict) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":            "Order already exists",
+			"order_uid":        conflict.OrderUID,
+			"existing_version": conflict.Version,
+		})
 		return
 	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.publish(kafka.EventOrderCreated, order.OrderUID, order)
 
-	if order.Entry == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "entry is required"})
+	setETag(c, order.Version)
+	c.JSON(http.StatusCreated, gin.H{
+		"message":   "Order created successfully",
+		"order_uid": order.OrderUID,
+		"order":     order, // Возвращаем созданный заказ
+	})
+}
+
+// ReplaceOrder создает или полностью заменяет заказ (upsert).
+// Предназначен для доверенных источников и закрыт админской авторизацией.
+// Версия для проверки берется из If-Match, иначе из поля version в теле.
+func (h *Handler) ReplaceOrder(c *gin.Context) {
+	orderUID := c.Param("id")
+	var order model.Order
+
+	ifMatch, err := parseIfMatch(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	if order.CustomerID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "customer id is required"})
+	if err := c.ShouldBindJSON(&order); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request payload",
+			"details": err.Error(),
+		})
 		return
 	}
 
-	if len(order.Items) == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "delivery name is required"})
+	if order.OrderUID != orderUID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "order uid in body does not match path"})
 		return
 	}
 
-	if order.Payment.Transaction == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "payment transaction is required"})
+	if err := order.Validate(c.Query("draft") == "true"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	if c.GetHeader("If-Match") != "" {
+		order.Version = ifMatch
+	}
+
 	ctx := c.Request.Context()
-	if err := h.repo.Save(ctx, &order); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if h.writeRepoError(c, orderUID, h.repo.Save(ctx, &order)) {
 		return
 	}
 
-	h.cash.Set(order.OrderUID, &order)
+	h.publish(kafka.EventOrderUpdated, order.OrderUID, order)
 
-	if h.producer != nil {
-		go func() {
-			//ctx := context.Background()
-			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-			defer cancel()
-			if err := h.producer.Produce(ctx, order.OrderUID, order); err != nil {
-				log.Printf("Failed to produce message to Kafka: %v", err)
-			}
-		}()
+	setETag(c, order.Version)
+	c.JSON(http.StatusOK, order)
+}
+
+// UpdateOrder частично изменяет заказ по JSON Merge Patch (RFC 7386)
+func (h *Handler) UpdateOrder(c *gin.Context) {
+	orderUID := c.Param("id")
+
+	contentType := c.ContentType()
+	if contentType != "application/merge-patch+json" && contentType != "application/json" {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{
+			"error": "content type must be application/merge-patch+json",
+		})
+		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
-		"message":   "Order created successfully",
-		"order_uid": order.OrderUID,
-		"order":     order, // Возвращаем созданный заказ
+	patch, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read request body"})
+		return
+	}
+
+	h.updateOrder(c, orderUID, func(order *model.Order) error {
+		return applyOrderPatch(order, patch)
+	})
+}
+
+// updateOrder применяет mutate к заказу с учетом If-Match и отвечает новым состоянием
+func (h *Handler) updateOrder(c *gin.Context, orderUID string, mutate func(order *model.Order) error) {
+	ifMatch, err := parseIfMatch(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	order, err := h.repo.Update(ctx, orderUID, ifMatch, mutate)
+	if h.writeRepoError(c, orderUID, err) {
+		return
+	}
+
+	h.publish(kafka.EventOrderUpdated, order.OrderUID, order)
+
+	setETag(c, order.Version)
+	c.JSON(http.StatusOK, order)
+}
+
+// DeleteOrder удаляет заказ
+func (h *Handler) DeleteOrder(c *gin.Context) {
+	orderUID := c.Param("id")
+
+	ifMatch, err := parseIfMatch(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	err = h.repo.Delete(ctx, orderUID, ifMatch)
+	if h.writeRepoError(c, orderUID, err) {
+		return
+	}
+
+	h.publish(kafka.EventOrderDeleted, orderUID, nil)
+
+	c.Status(http.StatusNoContent)
+}
+
+// statusRequest - тело запроса смены статуса заказа
+type statusRequest struct {
+	Status model.OrderStatus `json:"status" binding:"required"`
+	Reason string            `json:"reason"`
+}
+
+// ChangeOrderStatus переводит заказ в новый статус по графу переходов
+func (h *Handler) ChangeOrderStatus(c *gin.Context) {
+	orderUID := c.Param("id")
+
+	var req statusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request payload",
+			"details": err.Error(),
+		})
+		return
+	}
+	if !req.Status.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown status %q", req.Status)})
+		return
+	}
+
+	ifMatch, err := parseIfMatch(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	order, change, err := h.repo.ChangeStatus(ctx, orderUID, repositories.StatusTransition{
+		To:              req.Status,
+		Reason:          req.Reason,
+		ExpectedVersion: ifMatch,
+	})
+	if h.writeRepoError(c, orderUID, err) {
+		return
+	}
+
+	h.publish(kafka.EventOrderStatusChanged, orderUID, change)
+
+	setETag(c, order.Version)
+	c.JSON(http.StatusOK, order)
+}
+
+// GetOrderStatusHistory возвращает историю статусов заказа
+func (h *Handler) GetOrderStatusHistory(c *gin.Context) {
+	orderUID := c.Param("id")
+
+	history, err := h.repo.StatusHistory(c.Request.Context(), orderUID)
+	if h.writeRepoError(c, orderUID, err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"order_uid": orderUID,
+		"history":   history,
 	})
 }
 
+// maxItemStatusUpdates - сколько товаров можно изменить одним запросом
+const maxItemStatusUpdates = 1000
+
+// itemStatusRequest - тело запроса массовой смены статусов товаров
+type itemStatusRequest struct {
+	Items  []repositories.ItemStatusUpdate `json:"items" binding:"required"`
+	Reason string                          `json:"reason"`
+}
+
+// UpdateItemStatuses меняет статусы товаров (по rid или chrt_id, при необходимости с order_uid)
+// в одном или нескольких заказах. Изменения применяются атомарно.
+func (h *Handler) UpdateItemStatuses(c *gin.Context) {
+	var req itemStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request payload",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if len(req.Items) == 0 || len(req.Items) > maxItemStatusUpdates {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("items must contain from 1 to %d updates", maxItemStatusUpdates),
+		})
+		return
+	}
+	for i, update := range req.Items {
+		if update.Rid == "" && update.ChrtID == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("items[%d]: rid or chrt_id is required", i),
+			})
+			return
+		}
+		if !update.Status.Known() {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("items[%d]: unknown status %d", i, update.Status),
+			})
+			return
+		}
+	}
+
+	ctx := c.Request.Context()
+	result, err := h.repo.UpdateItemStatuses(ctx, req.Items, req.Reason)
+	if h.writeRepoError(c, "", err) {
+		return
+	}
+
+	for _, order := range result.Orders {
+		h.publish(kafka.EventOrderUpdated, order.OrderUID, order)
+	}
+	for _, change := range result.Changes {
+		h.publish(kafka.EventOrderStatusChanged, change.OrderUID, change)
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// GetItemStatuses возвращает каталог статусов товаров с допустимыми переходами
+func (h *Handler) GetItemStatuses(c *gin.Context) {
+	c.JSON(http.StatusOK, model.ItemStatusCatalogue())
+}
+
 // GetOrderByID возвращает заказ по ID (с использованием кэша)
 func (h *Handler) GetOrderByID(c *gin.Context) {
 	orderUID := c.Param("id")
 
-	if order, exists := h.cash.Get(orderUID); exists {
-		c.JSON(http.StatusOK, order)
+	if _, ok := c.GetQuery("as_of"); ok {
+		h.getOrderAsOf(c, orderUID)
+		return
+	}
+	if _, ok := c.GetQuery("include"); ok {
+		h.getOrderIncluding(c, orderUID)
 		return
 	}
 
 	ctx := c.Request.Context()
 	order, err := h.repo.FindByID(ctx, orderUID)
-	if err != nil {
+	if errors.Is(err, repositories.ErrOrderNotFound) {
 		c.JSON(http.StatusNotFound, gin.H{
 			"error": "Order not found",
 			"uid":   orderUID})
 		return
 	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch order"})
+		return
+	}
 
-	h.cash.Set(orderUID, order)
-
+	setETag(c, order.Version)
 	c.JSON(http.StatusOK, order)
 }
 
-// GetAllOrders возвращает все заказы (с использованием кэша)
+// getOrderIncluding ищет заказ с ?include=deleted,archived, минуя кэш:
+// в кэше нет ни удаленных, ни архивных заказов. ETag не выставляется,
+// удаленный или архивный заказ изменить нельзя.
+func (h *Handler) getOrderIncluding(c *gin.Context, orderUID string) {
+	filter := repositories.OrderFilter{}
+	if err := parseInclude(c, &filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filter.OrderUIDs = []string{orderUID}
+
+	page, err := h.repo.List(c.Request.Context(), repositories.ListOptions{Filter: filter, Limit: 1}.Normalize())
+	if err == nil && len(page.Orders) == 0 {
+		err = repositories.ErrOrderNotFound
+	}
+	if h.writeRepoError(c, orderUID, err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, page.Orders[0])
+}
+
+// GetAllOrders возвращает заказы с фильтрами и сортировкой. С limit или
+// cursor ответ - страница {orders, next_cursor}, не больше MaxListLimit заказов.
+// Без них, как и до появления пагинации, - массив всех заказов из кэша, чтобы
+// старые клиенты не сломались; фильтр или сортировка без limit дают 400, чтобы
+// не выгружать из базы неограниченную выборку.
 func (h *Handler) GetAllOrders(c *gin.Context) {
-	orders := h.cash.GetAll()
-	if len(orders) > 0 {
-		log.Printf("Returning orders from cache")
-		c.JSON(http.StatusOK, orders)
+	opts, err := parseListOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	//if cash is empty load from bd
+
 	ctx := c.Request.Context()
-	dbOrders, err := h.repo.FindAll(ctx)
+	if !paginated(c) {
+		if !opts.Filter.Empty() || c.Query("sort") != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit is required with filters or sort"})
+			return
+		}
+		orders, err := h.repo.FindAll(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "failed to fetch orders",
+			})
+			return
+		}
+		c.JSON(http.StatusOK, orders)
+		return
+	}
+
+	page, err := h.repo.List(ctx, opts)
+	if errors.Is(err, repositories.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cursor"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "failed to fetch orders",
 		})
 		return
 	}
-	for _, order := range dbOrders {
-		if order != nil {
-			h.cash.Set(order.OrderUID, order)
-		}
-	}
-	log.Printf("Returning orders from database")
-	c.JSON(http.StatusOK, orders)
+	c.JSON(http.StatusOK, page)
 }
 
 // HealthCheck проверяет соединение с БД и состояние кэша
@@ -149,15 +412,14 @@ func (h *Handler) HealthCheck(c *gin.Context) {
 	health := gin.H{
 		"status":       "healthy",
 		"cache_size":   h.cash.Size(),
-		"cache_loaded": h.cash.Size() > 0,
+		"cache_loaded": h.cash.Loaded(),
 		"timestamp":    time.Now().Format(time.RFC3339),
 	}
 
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
 
-	_, err := h.repo.FindAll(ctx)
-	if err != nil {
+	if err := cash.Ping(ctx, h.repo); err != nil {
 		health["status"] = "unhealthy"
 		health["database_error"] = err.Error()
 		c.JSON(http.StatusServiceUnavailable, health)
@@ -167,3 +429,113 @@ func (h *Handler) HealthCheck(c *gin.Context) {
 	health["database"] = "connected"
 	c.JSON(http.StatusOK, health)
 }
+
+// errInvalidOrder - заказ не прошел проверку
+var errInvalidOrder = errors.New("invalid order")
+
+// checkItemTransitions проверяет, что статусы товаров (сопоставленных по rid)
+// меняются только по графу переходов, а новые товары имеют статус из каталога
+func checkItemTransitions(before, after []model.Item) error {
+	previous := make(map[string]model.ItemStatus, len(before))
+	for _, item := range before {
+		previous[item.Rid] = item.Status
+	}
+	for _, item := range after {
+		status, ok := previous[item.Rid]
+		if !ok {
+			if !item.Status.Known() {
+				return fmt.Errorf("item %s has unknown status %d", item.Rid, item.Status)
+			}
+			continue
+		}
+		if status == item.Status {
+			continue
+		}
+		if !status.CanTransitionTo(item.Status) {
+			return fmt.Errorf("item %s: status %s -> %s is not allowed", item.Rid, status, item.Status)
+		}
+	}
+	return nil
+}
+
+// applyOrderPatch применяет merge patch к заказу и проверяет результат
+func applyOrderPatch(order *model.Order, patch []byte) error {
+	current, err := json.Marshal(order)
+	if err != nil {
+		return err
+	}
+
+	merged, err := applyMergePatch(current, patch)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errInvalidOrder, err)
+	}
+
+	var updated model.Order
+	if err := json.Unmarshal(merged, &updated); err != nil {
+		return fmt.Errorf("%w: %w", errInvalidOrder, err)
+	}
+	if updated.OrderUID != order.OrderUID {
+		return fmt.Errorf("%w: order uid cannot be changed", errInvalidOrder)
+	}
+	// Версией и статусом управляет хранилище, патч их не меняет
+	updated.Status = order.Status
+	updated.Version = order.Version
+	updated.UpdatedAt = order.UpdatedAt
+	if err := binding.Validator.ValidateStruct(&updated); err != nil {
+		return fmt.Errorf("%w: %w", errInvalidOrder, err)
+	}
+	// Черновиком заказ может оставаться только до оплаты
+	if err := updated.Validate(updated.Status == model.OrderStatusCreated); err != nil {
+		return fmt.Errorf("%w: %w", errInvalidOrder, err)
+	}
+	if err := checkItemTransitions(order.Items, updated.Items); err != nil {
+		return fmt.Errorf("%w: %w", errInvalidOrder, err)
+	}
+
+	*order = updated
+	return nil
+}
+
+// writeRepoError отвечает клиенту по ошибке репозитория; возвращает true, если ответ отправлен
+func (h *Handler) writeRepoError(c *gin.Context, orderUID string, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, repositories.ErrItemNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, repositories.ErrRevisionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Order revision not found",
+			"uid":   orderUID})
+	case errors.Is(err, repositories.ErrOrderNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Order not found",
+			"uid":   orderUID})
+	case errors.Is(err, errInvalidOrder), errors.Is(err, repositories.ErrAmbiguousItem):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	case errors.Is(err, repositories.ErrInvalidStatusTransition):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, repositories.ErrVersionConflict):
+		c.JSON(http.StatusPreconditionFailed, gin.H{
+			"error": "Order version mismatch",
+			"uid":   orderUID})
+	default:
+		log.Printf("Order %s: %v", orderUID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to process order"})
+	}
+	return true
+}
+
+// publish асинхронно отправляет событие о заказе в Kafka
+func (h *Handler) publish(eventType string, orderUID string, value any) {
+	if h.producer == nil {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := h.producer.ProduceEvent(ctx, eventType, orderUID, value); err != nil {
+			log.Printf("Failed to produce message to Kafka: %v", err)
+		}
+	}()
+}
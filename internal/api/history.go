@@ -0,0 +1,103 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"shop-microservice/internal/domain/model"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetOrderHistory возвращает журнал изменений заказа: кто, когда, через какой
+// канал и какие поля изменил. Доступен и для удаленного заказа.
+func (h *Handler) GetOrderHistory(c *gin.Context) {
+	orderUID := c.Param("id")
+
+	history, err := h.repo.AuditHistory(c.Request.Context(), orderUID)
+	if h.writeRepoError(c, orderUID, err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"order_uid": orderUID,
+		"history":   history,
+	})
+}
+
+// getOrderAsOf возвращает заказ в состоянии на момент ?as_of=<RFC3339>.
+// ETag не выставляется: прошлая версия не годится для условного обновления.
+func (h *Handler) getOrderAsOf(c *gin.Context, orderUID string) {
+	at, err := parseTimeParam(c, "as_of")
+	if err == nil && at.IsZero() {
+		err = errors.New("as_of must be an RFC3339 timestamp")
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	order, err := h.repo.OrderAsOf(c.Request.Context(), orderUID, at)
+	if h.writeRepoError(c, orderUID, err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+// GetOrderDiff возвращает изменения заказа между версиями ?from= и ?to=
+// (например, from=v1&to=v3). Без to сравнение идет с текущей версией.
+func (h *Handler) GetOrderDiff(c *gin.Context) {
+	orderUID := c.Param("id")
+	ctx := c.Request.Context()
+
+	from, err := parseVersionParam(c, "from")
+	if err == nil && from == 0 {
+		err = errors.New("from is required")
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	to, err := parseVersionParam(c, "to")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var after *model.Order
+	if to == 0 {
+		after, err = h.repo.FindByID(ctx, orderUID)
+	} else {
+		after, err = h.repo.OrderAtVersion(ctx, orderUID, to)
+	}
+	if h.writeRepoError(c, orderUID, err) {
+		return
+	}
+	before, err := h.repo.OrderAtVersion(ctx, orderUID, from)
+	if h.writeRepoError(c, orderUID, err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"order_uid": orderUID,
+		"from":      before.Version,
+		"to":        after.Version,
+		"diff":      model.DiffOrders(before, after),
+	})
+}
+
+// parseVersionParam разбирает номер версии вида "3" или "v3"; пустой параметр - 0
+func parseVersionParam(c *gin.Context, name string) (int64, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return 0, nil
+	}
+	version, err := strconv.ParseInt(strings.TrimPrefix(raw, "v"), 10, 64)
+	if err != nil || version < 1 {
+		return 0, fmt.Errorf("%s must be a version number like v3", name)
+	}
+	return version, nil
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"fmt"
+	"shop-microservice/internal/domain/model"
+	"shop-microservice/internal/domain/repositories"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// parseListOptions разбирает параметры запроса списка заказов
+func parseListOptions(c *gin.Context) (repositories.ListOptions, error) {
+	opts := repositories.ListOptions{
+		Sort:   repositories.OrderSort(c.Query("sort")),
+		Cursor: c.Query("cursor"),
+	}
+
+	if opts.Sort != "" && !opts.Sort.Valid() {
+		return opts, fmt.Errorf("unknown sort %q", opts.Sort)
+	}
+
+	if raw := c.Query("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 || limit > repositories.MaxListLimit {
+			return opts, fmt.Errorf("limit must be between 1 and %d", repositories.MaxListLimit)
+		}
+		opts.Limit = limit
+	}
+
+	filter, err := parseOrderFilter(c)
+	if err != nil {
+		return opts, err
+	}
+	opts.Filter = filter
+
+	return opts.Normalize(), nil
+}
+
+// paginated сообщает, что клиент запросил постраничную выдачу
+func paginated(c *gin.Context) bool {
+	_, limit := c.GetQuery("limit")
+	_, cursor := c.GetQuery("cursor")
+	return limit || cursor
+}
+
+// parseOrderFilter разбирает условия отбора заказов. status - статус заказа
+// (created, paid, ...), item_status - числовой статус товара: заказ подходит,
+// если в нем есть товар с этим статусом.
+func parseOrderFilter(c *gin.Context) (repositories.OrderFilter, error) {
+	filter := repositories.OrderFilter{
+		CustomerID:      c.Query("customer_id"),
+		TrackNumber:     c.Query("track_number"),
+		DeliveryService: c.Query("delivery_service"),
+		Currency:        c.Query("currency"),
+		Brand:           c.Query("brand"),
+		Email:           c.Query("email"),
+		Phone:           c.Query("phone"),
+	}
+
+	var err error
+	if filter.CreatedFrom, err = parseTimeParam(c, "created_from"); err != nil {
+		return filter, err
+	}
+	if filter.CreatedTo, err = parseTimeParam(c, "created_to"); err != nil {
+		return filter, err
+	}
+
+	if raw := c.Query("status"); raw != "" {
+		filter.Status = model.OrderStatus(raw)
+		if !filter.Status.Valid() {
+			return filter, fmt.Errorf("unknown status %q", raw)
+		}
+	}
+
+	if raw := c.Query("item_status"); raw != "" {
+		status, err := strconv.Atoi(raw)
+		if err != nil {
+			return filter, fmt.Errorf("item_status must be an integer")
+		}
+		itemStatus := model.ItemStatus(status)
+		filter.ItemStatus = &itemStatus
+	}
+
+	if err := parseInclude(c, &filter); err != nil {
+		return filter, err
+	}
+
+	return filter, nil
+}
+
+// parseInclude разбирает ?include=deleted,archived: по умолчанию удаленные
+// и архивные заказы не выдаются
+func parseInclude(c *gin.Context, filter *repositories.OrderFilter) error {
+	raw := c.Query("include")
+	if raw == "" {
+		return nil
+	}
+	for _, part := range strings.Split(raw, ",") {
+		switch strings.TrimSpace(part) {
+		case "deleted":
+			filter.IncludeDeleted = true
+		case "archived":
+			filter.IncludeArchived = true
+		default:
+			return fmt.Errorf("unknown include %q, expected deleted or archived", part)
+		}
+	}
+	return nil
+}
+
+func parseTimeParam(c *gin.Context, name string) (time.Time, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	value, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be an RFC3339 timestamp", name)
+	}
+	return value, nil
+}
@@ -6,18 +6,50 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func SetupRouter(handler *Handler) *gin.Engine {
+func SetupRouter(handler *Handler, admin *AdminHandler, adminToken string) *gin.Engine {
 	router := gin.Default()
 
 	// API routes
-	api := router.Group("/api")
+	api := router.Group("/api", RequestActor("api"))
 	{
 		api.POST("/orders", handler.CreateOrder)
+		api.POST("/orders/bulk", AdminAuth(adminToken), handler.ImportOrders)
+		api.GET("/orders/export", AdminAuth(adminToken), handler.ExportOrders)
 		api.GET("/orders/:id", handler.GetOrderByID)
+		api.GET("/orders/:id/status/history", handler.GetOrderStatusHistory)
+		api.GET("/orders/:id/history", handler.GetOrderHistory)
+		api.GET("/orders/:id/diff", handler.GetOrderDiff)
 		api.GET("/orders", handler.GetAllOrders)
+		api.GET("/items/statuses", handler.GetItemStatuses)
+		api.GET("/customers/:customer_id/export", AdminAuth(adminToken), handler.ExportCustomer)
+		api.POST("/customers/:customer_id/erase", AdminAuth(adminToken), handler.EraseCustomer)
+		api.GET("/erasure-jobs/:id", AdminAuth(adminToken), handler.GetErasureJob)
 		api.GET("/health", handler.HealthCheck)
 	}
 
+	// Order mutation routes (admin token required)
+	orders := router.Group("/api", RequestActor("api"), AdminAuth(adminToken))
+	{
+		orders.PUT("/orders/:id", handler.ReplaceOrder)
+		orders.PATCH("/orders/:id", handler.UpdateOrder)
+		orders.DELETE("/orders/:id", handler.DeleteOrder)
+		orders.PUT("/orders/:id/delivery", handler.AttachDelivery)
+		orders.PUT("/orders/:id/payment", handler.AttachPayment)
+		orders.POST("/orders/:id/status", handler.ChangeOrderStatus)
+		orders.POST("/items/status", handler.UpdateItemStatuses)
+	}
+
+	// Admin routes
+	adminGroup := router.Group("/admin", AdminAuth(adminToken))
+	{
+		adminGroup.DELETE("/cache", admin.ClearCache)
+		adminGroup.DELETE("/cache/orders", admin.InvalidateOrders)
+		adminGroup.DELETE("/cache/orders/:id", admin.InvalidateOrder)
+		adminGroup.POST("/cache/warmup", admin.WarmUp)
+		adminGroup.POST("/cache/reconcile", admin.Reconcile)
+		adminGroup.GET("/cache/keys", admin.Keys)
+	}
+
 	router.GET("/", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
 			"message": "order service is running",
@@ -0,0 +1,84 @@
+package erasure
+
+import (
+	"context"
+	"log"
+	"shop-microservice/internal/domain/repositories"
+	"shop-microservice/internal/infrastructure/kafka"
+	"time"
+)
+
+// Publisher - отправка событий о заказах (kafka.Producer)
+type Publisher interface {
+	ProduceEvent(ctx context.Context, eventType string, key string, value any) error
+}
+
+// Worker выполняет заявки на стирание данных покупателей. Заявки берутся из
+// хранилища, поэтому их может обрабатывать любой экземпляр сервиса. Кэш
+// сбрасывает само хранилище (cash.CachedOrderRepository), воркер сообщает
+// потребителям о стертых заказах.
+type Worker struct {
+	store  repositories.CustomerEraser
+	events Publisher
+}
+
+// NewWorker создает воркер; events может быть nil
+func NewWorker(store repositories.CustomerEraser, events Publisher) *Worker {
+	return &Worker{store: store, events: events}
+}
+
+// RunOnce выполняет все ждущие заявки, время которых пришло, и возвращает число
+// обработанных. Неудачная заявка откладывается хранилищем и не мешает остальным.
+func (w *Worker) RunOnce(ctx context.Context) (int, error) {
+	processed := 0
+	for {
+		job, uids, err := w.store.ProcessErasure(ctx)
+		if job == nil {
+			return processed, err
+		}
+		processed++
+		if err != nil {
+			if job.Status == repositories.ErasurePending && job.NextAttemptAt != nil {
+				log.Printf("Erasure job %d for customer %s failed, retry at %s: %v",
+					job.ID, job.CustomerID, job.NextAttemptAt.Format(time.RFC3339), err)
+			} else {
+				log.Printf("Erasure job %d for customer %s failed: %v", job.ID, job.CustomerID, err)
+			}
+			continue
+		}
+
+		for _, uid := range uids {
+			w.publish(ctx, uid)
+		}
+		log.Printf("Erasure job %d: personal data of customer %s erased in %d orders", job.ID, job.CustomerID, job.Orders)
+	}
+}
+
+// Run проверяет очередь заявок с интервалом до отмены контекста
+func (w *Worker) Run(ctx context.Context, interval time.Duration) {
+	ctx = repositories.WithChannel(ctx, repositories.ChannelSystem)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := w.RunOnce(ctx); err != nil {
+				log.Printf("Erasure worker: %v", err)
+			}
+		}
+	}
+}
+
+func (w *Worker) publish(ctx context.Context, uid string) {
+	if w.events == nil {
+		return
+	}
+	err := w.events.ProduceEvent(ctx, kafka.EventOrderAnonymized, uid, map[string]string{"order_uid": uid})
+	if err != nil {
+		log.Printf("Erasure: failed to publish %s for order %s: %v", kafka.EventOrderAnonymized, uid, err)
+	}
+}
@@ -0,0 +1,87 @@
+package erasure
+
+import (
+	"context"
+	"errors"
+	"shop-microservice/internal/domain/repositories"
+	"shop-microservice/internal/infrastructure/kafka"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// queuedResult - итог одной заявки в очереди fakeEraser
+type queuedResult struct {
+	job  *repositories.ErasureJob
+	uids []string
+	err  error
+}
+
+// fakeEraser отдает заявки из очереди по одной
+type fakeEraser struct {
+	queue []queuedResult
+	err   error
+}
+
+func (e *fakeEraser) RequestErasure(ctx context.Context, customerID string) (*repositories.ErasureJob, error) {
+	return nil, errors.New("not used")
+}
+
+func (e *fakeEraser) ErasureJob(ctx context.Context, id int64) (*repositories.ErasureJob, error) {
+	return nil, repositories.ErrErasureJobNotFound
+}
+
+func (e *fakeEraser) ProcessErasure(ctx context.Context) (*repositories.ErasureJob, []string, error) {
+	if len(e.queue) == 0 {
+		return nil, nil, e.err
+	}
+	next := e.queue[0]
+	e.queue = e.queue[1:]
+	return next.job, next.uids, next.err
+}
+
+type event struct {
+	eventType string
+	key       string
+}
+
+// recordingPublisher запоминает отправленные события
+type recordingPublisher struct {
+	events []event
+}
+
+func (p *recordingPublisher) ProduceEvent(ctx context.Context, eventType string, key string, value any) error {
+	p.events = append(p.events, event{eventType, key})
+	return nil
+}
+
+func TestWorker_RunOnce(t *testing.T) {
+	store := &fakeEraser{queue: []queuedResult{
+		{
+			job: &repositories.ErasureJob{ID: 1, CustomerID: "c1", Status: repositories.ErasureFailed},
+			err: errors.New("deadlock detected"),
+		},
+		{
+			job:  &repositories.ErasureJob{ID: 2, CustomerID: "c2", Status: repositories.ErasureDone, Orders: 2},
+			uids: []string{"o1", "o2"},
+		},
+	}}
+	events := &recordingPublisher{}
+
+	processed, err := NewWorker(store, events).RunOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, processed)
+	assert.Equal(t, []event{
+		{kafka.EventOrderAnonymized, "o1"},
+		{kafka.EventOrderAnonymized, "o2"},
+	}, events.events)
+}
+
+func TestWorker_RunOnce_StoreError(t *testing.T) {
+	store := &fakeEraser{err: errors.New("connection refused")}
+
+	processed, err := NewWorker(store, nil).RunOnce(context.Background())
+	require.Error(t, err)
+	assert.Zero(t, processed)
+}
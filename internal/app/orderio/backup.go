@@ -0,0 +1,333 @@
+package orderio
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"shop-microservice/internal/domain/model"
+	"shop-microservice/internal/domain/repositories"
+	"time"
+)
+
+// BackupFormatVersion - версия формата архива; архивы другой версии не восстанавливаются
+const BackupFormatVersion = 1
+
+// Файлы архива. Манифест всегда идет первым, чтобы архив можно было проверить
+// до чтения данных.
+const (
+	manifestFile = "manifest.json"
+	ordersFile   = "orders.ndjson"
+)
+
+// maxManifestSize - ограничение на размер манифеста при восстановлении
+const maxManifestSize = 1 << 20
+
+// Данные, которых нет в архиве; перечисляются в Manifest.Excludes
+const (
+	ExcludesDeletedOrders  = "deleted_orders"
+	ExcludesArchivedOrders = "archived_orders"
+	ExcludesStatusHistory  = "status_history"
+	ExcludesAuditLog       = "audit_log"
+)
+
+// ErrInvalidBackup - архив поврежден или не подходит для восстановления
+var ErrInvalidBackup = errors.New("invalid backup")
+
+// BackupFile - файл данных архива с контрольной суммой
+type BackupFile struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest - описание архива: версия формата и схемы, счетчики и контрольные суммы
+type Manifest struct {
+	FormatVersion int          `json:"format_version"`
+	SchemaVersion uint         `json:"schema_version"`
+	CreatedAt     time.Time    `json:"created_at"`
+	CustomerID    string       `json:"customer_id,omitempty"` // выгрузка данных одного покупателя
+	Orders        int          `json:"orders"`
+	Items         int          `json:"items"`
+	Excludes      []string     `json:"excludes,omitempty"` // что в архив не вошло
+	Files         []BackupFile `json:"files"`
+}
+
+func (m *Manifest) file(name string) (BackupFile, bool) {
+	for _, file := range m.Files {
+		if file.Name == name {
+			return file, true
+		}
+	}
+	return BackupFile{}, false
+}
+
+// Backup пишет в w архив tar.gz с действующими заказами source. Мягко удаленные и
+// архивные заказы, история статусов и журнал аудита в него не входят и перечислены
+// в Manifest.Excludes: это копия рабочих заказов для переноса и восстановления, полную
+// копию базы с историей снимает pg_dump.
+func Backup(ctx context.Context, source OrderSource, w io.Writer, schemaVersion uint) (*Manifest, error) {
+	manifest := &Manifest{
+		FormatVersion: BackupFormatVersion,
+		SchemaVersion: schemaVersion,
+		CreatedAt:     time.Now().UTC(),
+		Excludes:      []string{ExcludesDeletedOrders, ExcludesArchivedOrders, ExcludesStatusHistory, ExcludesAuditLog},
+	}
+	if err := packOrders(ctx, source, repositories.OrderFilter{}, w, manifest); err != nil {
+		return nil, fmt.Errorf("backup: %w", err)
+	}
+	return manifest, nil
+}
+
+// packOrders пишет в w архив с заказами source по фильтру и дополняет manifest.
+// Заказы сначала выгружаются во временный файл: размер и контрольная сумма нужны
+// до записи в tar. До ошибки выгрузки в w ничего не пишется.
+func packOrders(ctx context.Context, source OrderSource, filter repositories.OrderFilter, w io.Writer, manifest *Manifest) error {
+	tmp, err := os.CreateTemp("", "orders-archive-*.ndjson")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hash := sha256.New()
+	buffered := bufio.NewWriter(io.MultiWriter(tmp, hash))
+	encoder := json.NewEncoder(buffered)
+
+	err = source.Stream(ctx, filter, DefaultExportBatchSize, func(batch []*model.Order) error {
+		for _, order := range batch {
+			if err := encoder.Encode(order); err != nil {
+				return err
+			}
+			manifest.Orders++
+			manifest.Items += len(order.Items)
+		}
+		return nil
+	})
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if err != nil {
+		return err
+	}
+
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	manifest.Files = []BackupFile{{Name: ordersFile, Size: size, SHA256: hex.EncodeToString(hash.Sum(nil))}}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return writeArchive(w, manifest, tmp)
+}
+
+func writeArchive(w io.Writer, manifest *Manifest, orders io.Reader) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	raw, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	header := &tar.Header{Name: manifestFile, Mode: 0o644, Size: int64(len(raw)), ModTime: manifest.CreatedAt}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if _, err := tw.Write(raw); err != nil {
+		return err
+	}
+
+	data, _ := manifest.file(ordersFile)
+	header = &tar.Header{Name: ordersFile, Mode: 0o644, Size: data.Size, ModTime: manifest.CreatedAt}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if _, err := io.Copy(tw, orders); err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// RestoreOptions - параметры восстановления.
+// SchemaVersion - версия схемы целевой базы: архив более новой схемы не загружается.
+type RestoreOptions struct {
+	Policy        repositories.RestorePolicy
+	SchemaVersion uint
+	BatchSize     int
+}
+
+// RestoreReport - итог восстановления
+type RestoreReport struct {
+	Manifest *Manifest     `json:"manifest"`
+	Restored int           `json:"restored"`
+	Skipped  int           `json:"skipped"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Restore проверяет архив (версии, счетчики, контрольные суммы) и загружает заказы
+// в target пачками. Данные не пишутся, пока архив не проверен целиком; пачки
+// загружаются в отдельных транзакциях, поэтому при конфликте с политикой fail
+// уже загруженные пачки остаются в базе.
+func Restore(ctx context.Context, r io.Reader, target repositories.OrderRestorer, opts RestoreOptions) (*RestoreReport, error) {
+	start := time.Now()
+	if opts.Policy == "" {
+		opts.Policy = repositories.RestoreFail
+	}
+	if !opts.Policy.Valid() {
+		return nil, fmt.Errorf("restore: unknown policy %q", opts.Policy)
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultImportBatchSize
+	}
+
+	tmp, err := os.CreateTemp("", "orders-restore-*.ndjson")
+	if err != nil {
+		return nil, fmt.Errorf("restore: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	manifest, err := unpackArchive(r, tmp, opts.SchemaVersion)
+	if err != nil {
+		return nil, fmt.Errorf("restore: %w", err)
+	}
+	report := &RestoreReport{Manifest: manifest}
+
+	// Первый проход: каждый заказ разбирается и проверяется, счетчики сверяются с манифестом
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("restore: %w", err)
+	}
+	orders, items := 0, 0
+	err = readNDJSON(tmp, func(line int, raw []byte) error {
+		order, err := decodeBackupOrder(line, raw)
+		if err != nil {
+			return err
+		}
+		orders++
+		items += len(order.Items)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("restore: %w", err)
+	}
+	if orders != manifest.Orders || items != manifest.Items {
+		return nil, fmt.Errorf("restore: %w: archive has %d orders and %d items, manifest says %d and %d",
+			ErrInvalidBackup, orders, items, manifest.Orders, manifest.Items)
+	}
+
+	// Второй проход: загрузка пачками
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("restore: %w", err)
+	}
+	batch := make([]*model.Order, 0, opts.BatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		restored, err := target.Restore(ctx, batch, opts.Policy)
+		if err != nil {
+			return err
+		}
+		report.Restored += restored
+		report.Skipped += len(batch) - restored
+		batch = batch[:0]
+		return nil
+	}
+	err = readNDJSON(tmp, func(line int, raw []byte) error {
+		order, err := decodeBackupOrder(line, raw)
+		if err != nil {
+			return err
+		}
+		batch = append(batch, order)
+		if len(batch) >= opts.BatchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+
+	report.Duration = time.Since(start)
+	if err != nil {
+		return report, fmt.Errorf("restore: %w", err)
+	}
+	return report, nil
+}
+
+// unpackArchive читает манифест, проверяет его и копирует данные заказов в dst,
+// сверяя размер и контрольную сумму
+func unpackArchive(r io.Reader, dst io.Writer, schemaVersion uint) (*Manifest, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+
+	header, err := tr.Next()
+	if err != nil || header.Name != manifestFile {
+		return nil, fmt.Errorf("%w: %s must be the first file", ErrInvalidBackup, manifestFile)
+	}
+	var manifest Manifest
+	if err := json.NewDecoder(io.LimitReader(tr, maxManifestSize)).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("%w: manifest: %v", ErrInvalidBackup, err)
+	}
+	if manifest.FormatVersion != BackupFormatVersion {
+		return nil, fmt.Errorf("%w: format version %d is not supported", ErrInvalidBackup, manifest.FormatVersion)
+	}
+	if manifest.CustomerID != "" {
+		return nil, fmt.Errorf("%w: archive is a data export of customer %s", ErrInvalidBackup, manifest.CustomerID)
+	}
+	if manifest.SchemaVersion > schemaVersion {
+		return nil, fmt.Errorf("%w: backup schema version %d is newer than database schema version %d",
+			ErrInvalidBackup, manifest.SchemaVersion, schemaVersion)
+	}
+	expected, ok := manifest.file(ordersFile)
+	if !ok {
+		return nil, fmt.Errorf("%w: manifest does not list %s", ErrInvalidBackup, ordersFile)
+	}
+
+	header, err = tr.Next()
+	if err != nil || header.Name != ordersFile {
+		return nil, fmt.Errorf("%w: %s is missing", ErrInvalidBackup, ordersFile)
+	}
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(dst, hash), tr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidBackup, ordersFile, err)
+	}
+	if size != expected.Size || hex.EncodeToString(hash.Sum(nil)) != expected.SHA256 {
+		return nil, fmt.Errorf("%w: %s checksum mismatch", ErrInvalidBackup, ordersFile)
+	}
+
+	return &manifest, nil
+}
+
+// decodeBackupOrder разбирает заказ из архива; черновики и статусы допускаются
+func decodeBackupOrder(line int, raw []byte) (*model.Order, error) {
+	var order model.Order
+	if err := json.Unmarshal(raw, &order); err != nil {
+		return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidBackup, line, err)
+	}
+	if err := order.Validate(order.IsDraft()); err != nil {
+		return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidBackup, line, err)
+	}
+	if !order.Status.Valid() {
+		return nil, fmt.Errorf("%w: line %d: unknown status %q", ErrInvalidBackup, line, order.Status)
+	}
+	return &order, nil
+}
@@ -0,0 +1,179 @@
+package orderio
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"shop-microservice/internal/domain/model"
+	"shop-microservice/internal/domain/repositories"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryRestorer - хранилище в памяти с политиками восстановления
+type memoryRestorer struct {
+	orders  map[string]*model.Order
+	batches int
+}
+
+func (m *memoryRestorer) Restore(ctx context.Context, orders []*model.Order, policy repositories.RestorePolicy) (int, error) {
+	m.batches++
+	restored := 0
+	for _, order := range orders {
+		if existing, ok := m.orders[order.OrderUID]; ok {
+			switch policy {
+			case repositories.RestoreFail:
+				return 0, &repositories.ConflictError{OrderUID: order.OrderUID, Version: existing.Version}
+			case repositories.RestoreSkip:
+				continue
+			}
+		}
+		m.orders[order.OrderUID] = order
+		restored++
+	}
+	return restored, nil
+}
+
+func backupOrders() []*model.Order {
+	paid := exportOrder("paid", 2)
+	paid.Status = model.OrderStatusPaid
+	paid.Version = 5
+	draft := exportOrder("draft", 1)
+	draft.Payment = nil
+	return []*model.Order{exportOrder("a", 1), paid, draft}
+}
+
+func TestBackupRestore_RoundTrip(t *testing.T) {
+	var archive bytes.Buffer
+	manifest, err := Backup(context.Background(), &sliceSource{orders: backupOrders()}, &archive, 6)
+	require.NoError(t, err)
+
+	assert.Equal(t, BackupFormatVersion, manifest.FormatVersion)
+	assert.Equal(t, uint(6), manifest.SchemaVersion)
+	assert.Equal(t, 3, manifest.Orders)
+	assert.Equal(t, 4, manifest.Items)
+	require.Len(t, manifest.Files, 1)
+	assert.Len(t, manifest.Files[0].SHA256, 64)
+	assert.Equal(t, []string{"deleted_orders", "archived_orders", "status_history", "audit_log"}, manifest.Excludes)
+
+	target := &memoryRestorer{orders: map[string]*model.Order{}}
+	report, err := Restore(context.Background(), bytes.NewReader(archive.Bytes()), target,
+		RestoreOptions{SchemaVersion: 6, BatchSize: 2})
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, report.Restored)
+	assert.Equal(t, 2, target.batches)
+	assert.Equal(t, manifest.Files, report.Manifest.Files)
+
+	paid := target.orders["paid"]
+	require.NotNil(t, paid)
+	assert.Equal(t, model.OrderStatusPaid, paid.Status)
+	assert.Equal(t, int64(5), paid.Version)
+	assert.Len(t, paid.Items, 2)
+	assert.True(t, target.orders["draft"].IsDraft())
+}
+
+func TestRestore_Policies(t *testing.T) {
+	var archive bytes.Buffer
+	_, err := Backup(context.Background(), &sliceSource{orders: backupOrders()}, &archive, 6)
+	require.NoError(t, err)
+
+	existing := exportOrder("a", 0)
+	existing.Version = 9
+
+	target := &memoryRestorer{orders: map[string]*model.Order{"a": existing}}
+	report, err := Restore(context.Background(), bytes.NewReader(archive.Bytes()), target,
+		RestoreOptions{Policy: repositories.RestoreSkip, SchemaVersion: 6})
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Restored)
+	assert.Equal(t, 1, report.Skipped)
+	assert.Same(t, existing, target.orders["a"])
+
+	target = &memoryRestorer{orders: map[string]*model.Order{"a": existing}}
+	_, err = Restore(context.Background(), bytes.NewReader(archive.Bytes()), target,
+		RestoreOptions{SchemaVersion: 6})
+	require.ErrorIs(t, err, repositories.ErrOrderExists)
+
+	_, err = Restore(context.Background(), bytes.NewReader(archive.Bytes()), target,
+		RestoreOptions{Policy: "merge", SchemaVersion: 6})
+	require.Error(t, err)
+}
+
+func TestRestore_RejectsInvalidArchive(t *testing.T) {
+	var archive bytes.Buffer
+	_, err := Backup(context.Background(), &sliceSource{orders: backupOrders()}, &archive, 6)
+	require.NoError(t, err)
+
+	target := &memoryRestorer{orders: map[string]*model.Order{}}
+
+	_, err = Restore(context.Background(), bytes.NewReader(archive.Bytes()), target, RestoreOptions{SchemaVersion: 5})
+	require.ErrorIs(t, err, ErrInvalidBackup)
+
+	_, err = Restore(context.Background(), bytes.NewReader([]byte("not an archive")), target, RestoreOptions{SchemaVersion: 6})
+	require.ErrorIs(t, err, ErrInvalidBackup)
+
+	tampered := rewriteOrdersFile(t, archive.Bytes(), func(data []byte) []byte {
+		return bytes.Replace(data, []byte(`"paid"`), []byte(`"pa1d"`), 1)
+	})
+	_, err = Restore(context.Background(), bytes.NewReader(tampered), target, RestoreOptions{SchemaVersion: 6})
+	require.ErrorIs(t, err, ErrInvalidBackup)
+	assert.Contains(t, err.Error(), "checksum")
+
+	assert.Empty(t, target.orders)
+	assert.Zero(t, target.batches)
+}
+
+// rewriteOrdersFile пересобирает архив, изменяя данные заказов и сохраняя манифест
+func rewriteOrdersFile(t *testing.T, archive []byte, change func([]byte) []byte) []byte {
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	require.NoError(t, err)
+	tr := tar.NewReader(gz)
+
+	var out bytes.Buffer
+	gw := gzip.NewWriter(&out)
+	tw := tar.NewWriter(gw)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		data, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		if header.Name == ordersFile {
+			data = change(data)
+			header.Size = int64(len(data))
+		}
+		require.NoError(t, tw.WriteHeader(header))
+		_, err = tw.Write(data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gw.Close())
+	return out.Bytes()
+}
+
+func TestExportCustomer(t *testing.T) {
+	source := &sliceSource{orders: backupOrders()}
+
+	var archive bytes.Buffer
+	manifest, err := ExportCustomer(context.Background(), source, &archive, "customer")
+	require.NoError(t, err)
+
+	assert.Equal(t, repositories.OrderFilter{CustomerID: "customer", IncludeDeleted: true, IncludeArchived: true}, source.filter)
+	assert.Equal(t, "customer", manifest.CustomerID)
+	assert.Equal(t, 3, manifest.Orders)
+
+	// Архив проверяется так же, как резервная копия, но не восстанавливается
+	target := &memoryRestorer{orders: map[string]*model.Order{}}
+	_, err = Restore(context.Background(), bytes.NewReader(archive.Bytes()), target, RestoreOptions{SchemaVersion: 6})
+	require.ErrorIs(t, err, ErrInvalidBackup)
+	assert.Empty(t, target.orders)
+
+	_, err = ExportCustomer(context.Background(), source, &archive, "")
+	require.Error(t, err)
+}
@@ -0,0 +1,32 @@
+package orderio
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"shop-microservice/internal/domain/repositories"
+	"time"
+)
+
+// ExportCustomer пишет в w архив в формате резервной копии со всеми заказами
+// покупателя, включая удаленные и архивные, вместе с доставкой и оплатой.
+// Манифест содержит идентификатор покупателя, счетчики и контрольные суммы; история
+// статусов и журнал аудита не выгружаются. Архив предназначен покупателю: Restore его
+// не принимает.
+func ExportCustomer(ctx context.Context, source OrderSource, w io.Writer, customerID string) (*Manifest, error) {
+	if customerID == "" {
+		return nil, fmt.Errorf("customer export: customer id is required")
+	}
+
+	manifest := &Manifest{
+		FormatVersion: BackupFormatVersion,
+		CreatedAt:     time.Now().UTC(),
+		CustomerID:    customerID,
+		Excludes:      []string{ExcludesStatusHistory, ExcludesAuditLog},
+	}
+	filter := repositories.OrderFilter{CustomerID: customerID, IncludeDeleted: true, IncludeArchived: true}
+	if err := packOrders(ctx, source, filter, w, manifest); err != nil {
+		return nil, fmt.Errorf("customer export: %w", err)
+	}
+	return manifest, nil
+}
@@ -0,0 +1,148 @@
+package orderio
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"shop-microservice/internal/domain/model"
+	"shop-microservice/internal/domain/repositories"
+	"strconv"
+	"time"
+)
+
+// DefaultExportBatchSize - сколько заказов читается из базы за один запрос
+const DefaultExportBatchSize = 500
+
+// CSVHeader - колонки CSV-выгрузки. Каждая строка описывает один товар вместе
+// с полями его заказа, доставки и оплаты; заказ без товаров дает одну строку
+// с пустыми колонками товара.
+var CSVHeader = []string{
+	"order_uid", "track_number", "entry", "locale", "internal_signature", "customer_id",
+	"delivery_service", "shardkey", "sm_id", "date_created", "oof_shard", "status", "version",
+	"delivery_name", "delivery_phone", "delivery_zip", "delivery_city", "delivery_address",
+	"delivery_region", "delivery_email",
+	"payment_transaction", "payment_request_id", "payment_currency", "payment_provider",
+	"payment_amount", "payment_dt", "payment_bank", "payment_delivery_cost",
+	"payment_goods_total", "payment_custom_fee",
+	"item_chrt_id", "item_track_number", "item_price", "item_rid", "item_name", "item_sale",
+	"item_size", "item_total_price", "item_nm_id", "item_brand", "item_status",
+}
+
+// OrderSource - источник заказов для выгрузки
+type OrderSource interface {
+	Stream(ctx context.Context, filter repositories.OrderFilter, batchSize int, fn func(batch []*model.Order) error) error
+}
+
+// flusher - получатель, который умеет отправлять накопленные данные (http.Flusher)
+type flusher interface {
+	Flush()
+}
+
+// Exporter выгружает заказы пачками, не держа в памяти больше одной пачки
+type Exporter struct {
+	source    OrderSource
+	batchSize int
+}
+
+func NewExporter(source OrderSource, batchSize int) *Exporter {
+	if batchSize <= 0 {
+		batchSize = DefaultExportBatchSize
+	}
+	return &Exporter{
+		source:    source,
+		batchSize: batchSize,
+	}
+}
+
+// Export пишет в w заказы, подходящие под filter, и возвращает их количество.
+// После каждой пачки данные отправляются получателю, если w поддерживает Flush.
+func (e *Exporter) Export(ctx context.Context, w io.Writer, format Format, filter repositories.OrderFilter) (int, error) {
+	var write func(order *model.Order) error
+	var flush func() error
+
+	switch format {
+	case FormatNDJSON, "":
+		encoder := json.NewEncoder(w)
+		write = func(order *model.Order) error { return encoder.Encode(order) }
+		flush = func() error { return nil }
+	case FormatCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(CSVHeader); err != nil {
+			return 0, err
+		}
+		write = func(order *model.Order) error { return writeCSVOrder(writer, order) }
+		flush = func() error {
+			writer.Flush()
+			return writer.Error()
+		}
+	default:
+		return 0, fmt.Errorf("unsupported export format %q", format)
+	}
+
+	count := 0
+	err := e.source.Stream(ctx, filter, e.batchSize, func(batch []*model.Order) error {
+		for _, order := range batch {
+			if err := write(order); err != nil {
+				return err
+			}
+			count++
+		}
+		if err := flush(); err != nil {
+			return err
+		}
+		if f, ok := w.(flusher); ok {
+			f.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return count, err
+	}
+
+	// Заголовок CSV пишется и при пустой выгрузке
+	return count, flush()
+}
+
+func writeCSVOrder(w *csv.Writer, order *model.Order) error {
+	row := make([]string, 0, len(CSVHeader))
+	row = append(row,
+		order.OrderUID, order.TrackNumber, order.Entry, order.Locale, order.InternalSignature, order.CustomerID,
+		order.DeliveryService, order.Shardkey, strconv.Itoa(order.SmID), order.DateCreated.Format(time.RFC3339),
+		order.OofShard, string(order.Status), strconv.FormatInt(order.Version, 10),
+	)
+
+	if d := order.Delivery; d != nil {
+		row = append(row, d.Name, d.Phone, d.Zip, d.City, d.Address, d.Region, d.Email)
+	} else {
+		row = append(row, make([]string, 7)...)
+	}
+
+	if p := order.Payment; p != nil {
+		row = append(row,
+			p.Transaction, p.RequestID, p.Currency, p.Provider, strconv.Itoa(p.Amount),
+			strconv.FormatInt(p.PaymentDt, 10), p.Bank, strconv.Itoa(p.DeliveryCost),
+			strconv.Itoa(p.GoodsTotal), strconv.Itoa(p.CustomFee),
+		)
+	} else {
+		row = append(row, make([]string, 10)...)
+	}
+
+	orderColumns := len(row)
+	if len(order.Items) == 0 {
+		return w.Write(append(row, make([]string, len(CSVHeader)-orderColumns)...))
+	}
+
+	for _, item := range order.Items {
+		row = append(row[:orderColumns],
+			strconv.Itoa(item.ChrtID), item.TrackNumber, strconv.Itoa(item.Price), item.Rid, item.Name,
+			strconv.Itoa(item.Sale), item.Size, strconv.Itoa(item.TotalPrice), strconv.Itoa(item.NmID),
+			item.Brand, strconv.Itoa(int(item.Status)),
+		)
+		if err := w.Write(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package orderio
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"shop-microservice/internal/domain/model"
+	"shop-microservice/internal/domain/repositories"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sliceSource отдает заказы пачками и проверяет, что фильтр передан дальше
+type sliceSource struct {
+	orders  []*model.Order
+	filter  repositories.OrderFilter
+	batches int
+	err     error
+}
+
+func (s *sliceSource) Stream(ctx context.Context, filter repositories.OrderFilter, batchSize int, fn func(batch []*model.Order) error) error {
+	s.filter = filter
+	for start := 0; start < len(s.orders); start += batchSize {
+		end := min(start+batchSize, len(s.orders))
+		s.batches++
+		if err := fn(s.orders[start:end]); err != nil {
+			return err
+		}
+	}
+	return s.err
+}
+
+// flushCounter считает вызовы Flush, как http.Flusher у ответа
+type flushCounter struct {
+	bytes.Buffer
+	flushes int
+}
+
+func (f *flushCounter) Flush() { f.flushes++ }
+
+func exportOrder(uid string, items int) *model.Order {
+	order := &model.Order{
+		OrderUID:    uid,
+		TrackNumber: "TRACK",
+		Entry:       "WBIL",
+		CustomerID:  "customer",
+		DateCreated: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC),
+		Status:      model.OrderStatusCreated,
+		Version:     1,
+		Delivery:    &model.Delivery{Name: "Test, Testov", City: "Kiryat Mozkin"},
+		Payment:     &model.Payment{Transaction: uid, Currency: "USD", Amount: 1817},
+	}
+	for i := 0; i < items; i++ {
+		order.Items = append(order.Items, model.Item{ChrtID: i + 1, Rid: uid + "-rid", Brand: "Vivienne", Status: model.ItemStatusNew})
+	}
+	return order
+}
+
+func TestExporter_NDJSON(t *testing.T) {
+	source := &sliceSource{orders: []*model.Order{exportOrder("a", 1), exportOrder("b", 2), exportOrder("c", 0)}}
+	filter := repositories.OrderFilter{CustomerID: "customer"}
+	out := &flushCounter{}
+
+	count, err := NewExporter(source, 2).Export(context.Background(), out, FormatNDJSON, filter)
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, count)
+	assert.Equal(t, filter, source.filter)
+	assert.Equal(t, 2, out.flushes)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 3)
+	var decoded model.Order
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &decoded))
+	assert.Equal(t, "b", decoded.OrderUID)
+	assert.Len(t, decoded.Items, 2)
+}
+
+func TestExporter_CSV(t *testing.T) {
+	draft := exportOrder("draft", 1)
+	draft.Delivery = nil
+	draft.Payment = nil
+	source := &sliceSource{orders: []*model.Order{exportOrder("a", 2), exportOrder("empty", 0), draft}}
+	var out bytes.Buffer
+
+	count, err := NewExporter(source, 0).Export(context.Background(), &out, FormatCSV, repositories.OrderFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	records, err := csv.NewReader(&out).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 5)
+	assert.Equal(t, CSVHeader, records[0])
+
+	column := func(name string) int {
+		for i, header := range CSVHeader {
+			if header == name {
+				return i
+			}
+		}
+		t.Fatalf("no column %s", name)
+		return -1
+	}
+
+	assert.Equal(t, "a", records[1][column("order_uid")])
+	assert.Equal(t, "Test, Testov", records[1][column("delivery_name")])
+	assert.Equal(t, "1817", records[1][column("payment_amount")])
+	assert.Equal(t, "1", records[1][column("item_chrt_id")])
+	assert.Equal(t, "2", records[2][column("item_chrt_id")])
+	assert.Equal(t, "101", records[2][column("item_status")])
+	assert.Equal(t, "2024-03-01T10:00:00Z", records[2][column("date_created")])
+
+	assert.Equal(t, "empty", records[3][column("order_uid")])
+	assert.Empty(t, records[3][column("item_chrt_id")])
+
+	assert.Equal(t, "draft", records[4][column("order_uid")])
+	assert.Empty(t, records[4][column("delivery_name")])
+	assert.Empty(t, records[4][column("payment_transaction")])
+	assert.Equal(t, "1", records[4][column("item_chrt_id")])
+}
+
+func TestExporter_EmptyCSVHasHeader(t *testing.T) {
+	var out bytes.Buffer
+	count, err := NewExporter(&sliceSource{}, 0).Export(context.Background(), &out, FormatCSV, repositories.OrderFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+	assert.Equal(t, strings.Join(CSVHeader, ",")+"\n", out.String())
+}
+
+func TestExporter_SourceError(t *testing.T) {
+	source := &sliceSource{orders: []*model.Order{exportOrder("a", 1)}, err: errors.New("connection reset")}
+	var out bytes.Buffer
+
+	count, err := NewExporter(source, 10).Export(context.Background(), &out, FormatNDJSON, repositories.OrderFilter{})
+	require.Error(t, err)
+	assert.Equal(t, 1, count)
+
+	_, err = NewExporter(source, 10).Export(context.Background(), &out, Format("xml"), repositories.OrderFilter{})
+	require.Error(t, err)
+}
@@ -0,0 +1,278 @@
+// Package orderio - массовая загрузка и выгрузка заказов в потоковых форматах
+package orderio
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"shop-microservice/internal/domain/model"
+	"shop-microservice/internal/domain/repositories"
+	"time"
+)
+
+// Format - формат потока заказов
+type Format string
+
+const (
+	// FormatNDJSON - по одному заказу в строке
+	FormatNDJSON Format = "ndjson"
+	// FormatJSON - JSON-массив заказов или один заказ (как test.json)
+	FormatJSON Format = "json"
+	// FormatCSV - плоская таблица: строка на каждый товар (только выгрузка)
+	FormatCSV Format = "csv"
+)
+
+// DefaultImportBatchSize - сколько заказов загружается одной транзакцией
+const DefaultImportBatchSize = 1000
+
+// maxLineSize - максимальный размер одной строки NDJSON
+const maxLineSize = 16 << 20
+
+// Результат обработки строки
+const (
+	ResultAccepted = "accepted"
+	ResultRejected = "rejected"
+)
+
+// LineResult - итог по одной записи входного потока.
+// Line - номер строки для NDJSON или порядковый номер заказа для JSON.
+type LineResult struct {
+	Line     int    `json:"line"`
+	OrderUID string `json:"order_uid,omitempty"`
+	Result   string `json:"result"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ImportReport - отчет об импорте
+type ImportReport struct {
+	Accepted int           `json:"accepted"`
+	Rejected int           `json:"rejected"`
+	Lines    []LineResult  `json:"lines"`
+	Duration time.Duration `json:"duration"`
+}
+
+func (r *ImportReport) add(result LineResult) {
+	if result.Result == ResultAccepted {
+		r.Accepted++
+	} else {
+		r.Rejected++
+	}
+	r.Lines = append(r.Lines, result)
+}
+
+// Importer разбирает поток заказов, проверяет их и загружает пачками
+type Importer struct {
+	store     repositories.BulkImporter
+	batchSize int
+}
+
+func NewImporter(store repositories.BulkImporter, batchSize int) *Importer {
+	if batchSize <= 0 {
+		batchSize = DefaultImportBatchSize
+	}
+	return &Importer{
+		store:     store,
+		batchSize: batchSize,
+	}
+}
+
+// importBatch - заказы, ожидающие загрузки, с номерами их строк
+type importBatch struct {
+	orders []*model.Order
+	lines  []int
+	uids   map[string]struct{}
+}
+
+func (b *importBatch) reset() {
+	b.orders = b.orders[:0]
+	b.lines = b.lines[:0]
+	b.uids = make(map[string]struct{})
+}
+
+// Import читает заказы из r и загружает их пачками. Некорректные записи попадают в отчет
+// как отклоненные; если пачку не удалось загрузить, она делится пополам, пока не
+// останутся только строки, которые база не принимает. Ошибка возвращается только если
+// продолжать чтение невозможно (ошибка ввода или отмена контекста).
+func (im *Importer) Import(ctx context.Context, r io.Reader, format Format) (*ImportReport, error) {
+	start := time.Now()
+	report := &ImportReport{Lines: make([]LineResult, 0)}
+	batch := &importBatch{}
+	batch.reset()
+
+	flush := func() error {
+		if len(batch.orders) == 0 {
+			return nil
+		}
+		errs := make([]error, len(batch.orders))
+		if err := im.load(ctx, batch.orders, errs); err != nil {
+			return err
+		}
+		for i, order := range batch.orders {
+			result := LineResult{Line: batch.lines[i], OrderUID: order.OrderUID, Result: ResultAccepted}
+			if errs[i] != nil {
+				result.Result = ResultRejected
+				result.Error = errs[i].Error()
+			}
+			report.add(result)
+		}
+		batch.reset()
+		return nil
+	}
+
+	err := readRecords(r, format, func(line int, raw []byte) error {
+		var order model.Order
+		if err := json.Unmarshal(raw, &order); err != nil {
+			report.add(LineResult{Line: line, Result: ResultRejected, Error: err.Error()})
+			return nil
+		}
+		if err := validateImported(&order); err != nil {
+			report.add(LineResult{Line: line, OrderUID: order.OrderUID, Result: ResultRejected, Error: err.Error()})
+			return nil
+		}
+
+		// Повтор uid внутри пачки: сначала загружаем предыдущую версию, последняя строка побеждает
+		if _, dup := batch.uids[order.OrderUID]; dup {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+
+		batch.orders = append(batch.orders, &order)
+		batch.lines = append(batch.lines, line)
+		batch.uids[order.OrderUID] = struct{}{}
+
+		if len(batch.orders) >= im.batchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+
+	report.Duration = time.Since(start)
+	return report, err
+}
+
+// load загружает заказы и записывает в errs ошибку каждого отклоненного. Пачка, которую
+// база не приняла, делится пополам и загружается по частям, так что отклоняются только
+// сами ошибочные заказы. Возвращает ошибку только при отмене контекста.
+func (im *Importer) load(ctx context.Context, orders []*model.Order, errs []error) error {
+	err := im.store.Import(ctx, orders)
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if len(orders) == 1 {
+		errs[0] = err
+		return nil
+	}
+
+	middle := len(orders) / 2
+	if err := im.load(ctx, orders[:middle], errs[:middle]); err != nil {
+		return err
+	}
+	return im.load(ctx, orders[middle:], errs[middle:])
+}
+
+// validateImported проверяет заказ до загрузки: обязательные поля, длины полей и статусы
+// товаров по каталогу, как при создании заказа через API
+func validateImported(order *model.Order) error {
+	if err := order.Validate(false); err != nil {
+		return err
+	}
+	if err := order.ValidateLengths(); err != nil {
+		return err
+	}
+	for _, item := range order.Items {
+		if !item.Status.Known() {
+			return fmt.Errorf("item %s has unknown status %d", item.Rid, item.Status)
+		}
+	}
+	return nil
+}
+
+// readRecords передает в fn каждую запись потока вместе с ее номером
+func readRecords(r io.Reader, format Format, fn func(line int, raw []byte) error) error {
+	switch format {
+	case FormatNDJSON, "":
+		return readNDJSON(r, fn)
+	case FormatJSON:
+		return readJSON(r, fn)
+	}
+	return fmt.Errorf("unsupported format %q", format)
+}
+
+func readNDJSON(r io.Reader, fn func(line int, raw []byte) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+		if err := fn(line, raw); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func readJSON(r io.Reader, fn func(line int, raw []byte) error) error {
+	reader := bufio.NewReader(r)
+	first, err := peekNonSpace(reader)
+	if err != nil {
+		return fmt.Errorf("read json: %w", err)
+	}
+
+	decoder := json.NewDecoder(reader)
+
+	// Один заказ, как в test.json
+	if first != '[' {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			return fmt.Errorf("read json: %w", err)
+		}
+		return fn(1, raw)
+	}
+
+	if _, err := decoder.Token(); err != nil {
+		return fmt.Errorf("read json: %w", err)
+	}
+	for record := 1; decoder.More(); record++ {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			return fmt.Errorf("read json: order %d: %w", record, err)
+		}
+		if err := fn(record, raw); err != nil {
+			return err
+		}
+	}
+	if _, err := decoder.Token(); err != nil {
+		return fmt.Errorf("read json: %w", err)
+	}
+	return nil
+}
+
+func peekNonSpace(r *bufio.Reader) (byte, error) {
+	for {
+		b, err := r.Peek(1)
+		if err != nil {
+			return 0, err
+		}
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			r.ReadByte()
+		default:
+			return b[0], nil
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package orderio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"shop-microservice/internal/domain/model"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingStore запоминает загруженные пачки
+type recordingStore struct {
+	batches [][]string
+	failOn  string
+}
+
+func (s *recordingStore) Import(ctx context.Context, orders []*model.Order) error {
+	uids := make([]string, len(orders))
+	for i, order := range orders {
+		uids[i] = order.OrderUID
+		if order.OrderUID == s.failOn {
+			return errors.New("copy failed")
+		}
+	}
+	s.batches = append(s.batches, uids)
+	return nil
+}
+
+func orderLine(uid string) string {
+	return fmt.Sprintf(`{"order_uid":%q,"track_number":"T","entry":"WBIL","customer_id":"c",`+
+		`"delivery":{"name":"n"},"payment":{"transaction":%q},"items":[{"rid":"r","status":202}]}`, uid, uid)
+}
+
+func TestImporter_NDJSON(t *testing.T) {
+	store := &recordingStore{}
+	importer := NewImporter(store, 2)
+
+	input := strings.Join([]string{
+		orderLine("order-1"),
+		"",
+		"{not json",
+		`{"order_uid":"no-items","track_number":"T","entry":"E","customer_id":"c"}`,
+		orderLine("order-2"),
+		orderLine("order-3"),
+		orderLine("order-1"),
+	}, "\n")
+
+	report, err := importer.Import(context.Background(), strings.NewReader(input), FormatNDJSON)
+	require.NoError(t, err)
+
+	assert.Equal(t, 4, report.Accepted)
+	assert.Equal(t, 2, report.Rejected)
+	assert.Equal(t, [][]string{{"order-1", "order-2"}, {"order-3", "order-1"}}, store.batches)
+
+	rejected := map[int]string{}
+	for _, line := range report.Lines {
+		if line.Result == ResultRejected {
+			rejected[line.Line] = line.Error
+		}
+	}
+	assert.Contains(t, rejected, 3)
+	assert.Equal(t, "items are required", rejected[4])
+}
+
+func TestImporter_DuplicateInBatchIsFlushedFirst(t *testing.T) {
+	store := &recordingStore{}
+	importer := NewImporter(store, 10)
+
+	input := orderLine("order-1") + "\n" + orderLine("order-1") + "\n"
+	report, err := importer.Import(context.Background(), strings.NewReader(input), FormatNDJSON)
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, report.Accepted)
+	assert.Equal(t, [][]string{{"order-1"}, {"order-1"}}, store.batches)
+}
+
+func TestImporter_BatchFailureRejectsOnlyBadOrders(t *testing.T) {
+	store := &recordingStore{failOn: "bad"}
+	importer := NewImporter(store, 4)
+
+	input := strings.Join([]string{orderLine("first"), orderLine("second"), orderLine("bad"), orderLine("last")}, "\n")
+	report, err := importer.Import(context.Background(), strings.NewReader(input), FormatNDJSON)
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, report.Accepted)
+	assert.Equal(t, 1, report.Rejected)
+	assert.Equal(t, ResultRejected, report.Lines[2].Result)
+	assert.Equal(t, "copy failed", report.Lines[2].Error)
+	// Пачка делится пополам, пока ошибочный заказ не останется один
+	assert.Equal(t, [][]string{{"first", "second"}, {"last"}}, store.batches)
+}
+
+func TestImporter_RejectsLongFieldsAndUnknownItemStatuses(t *testing.T) {
+	store := &recordingStore{}
+	importer := NewImporter(store, 10)
+
+	input := strings.Join([]string{
+		orderLine(strings.Repeat("x", 51)),
+		strings.Replace(orderLine("unknown-status"), `"status":202`, `"status":999`, 1),
+		orderLine("fine"),
+	}, "\n")
+	report, err := importer.Import(context.Background(), strings.NewReader(input), FormatNDJSON)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, report.Accepted)
+	assert.Equal(t, "order_uid is longer than 50 characters", report.Lines[0].Error)
+	assert.Equal(t, "item r has unknown status 999", report.Lines[1].Error)
+	assert.Equal(t, [][]string{{"fine"}}, store.batches)
+}
+
+func TestImporter_JSON(t *testing.T) {
+	store := &recordingStore{}
+	importer := NewImporter(store, 0)
+
+	array := "[\n" + orderLine("a") + ",\n" + orderLine("b") + "\n]"
+	report, err := importer.Import(context.Background(), strings.NewReader(array), FormatJSON)
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Accepted)
+
+	// Один заказ с переносами строк, как в test.json
+	single := strings.ReplaceAll(orderLine("c"), ",", ",\n  ")
+	report, err = importer.Import(context.Background(), strings.NewReader(single), FormatJSON)
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Accepted)
+	assert.Equal(t, []string{"c"}, store.batches[len(store.batches)-1])
+}
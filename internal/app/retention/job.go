@@ -0,0 +1,117 @@
+package retention
+
+import (
+	"context"
+	"log"
+	"shop-microservice/internal/domain/repositories"
+	"shop-microservice/internal/infrastructure/kafka"
+	"time"
+)
+
+// Actor - от чьего имени задача пишет журнал аудита при запуске по расписанию
+const Actor = "retention"
+
+// Cache - локальный кэш заказов (cash.Cash)
+type Cache interface {
+	Delete(uid string)
+	Invalidate(uid string)
+}
+
+// Publisher - отправка событий о заказах (kafka.Producer)
+type Publisher interface {
+	ProduceEvent(ctx context.Context, eventType string, key string, value any) error
+}
+
+// Job применяет правила хранения и распространяет результат: сбрасывает
+// затронутые заказы в локальном кэше и публикует события, чтобы стертые
+// данные пропали и у потребителей. Кэши других экземпляров сервиса
+// обновляются через LISTEN/NOTIFY.
+type Job struct {
+	store  repositories.OrderPurger
+	policy repositories.RetentionPolicy
+	cache  Cache
+	events Publisher
+}
+
+// NewJob создает задачу; cache и events могут быть nil
+func NewJob(store repositories.OrderPurger, policy repositories.RetentionPolicy, cache Cache, events Publisher) *Job {
+	return &Job{
+		store:  store,
+		policy: policy,
+		cache:  cache,
+		events: events,
+	}
+}
+
+// RunOnce применяет правила один раз. С dryRun ничего не меняется,
+// отчет показывает, что было бы стерто.
+func (j *Job) RunOnce(ctx context.Context, dryRun bool) (*repositories.PurgeReport, error) {
+	report, err := j.store.Purge(ctx, j.policy, time.Now(), dryRun)
+	if err != nil {
+		return nil, err
+	}
+	if !dryRun {
+		j.propagate(ctx, report)
+	}
+	return report, nil
+}
+
+// Run применяет правила сразу при запуске и затем по таймеру до отмены
+// контекста, отчет пишется в лог. С dryRun задача только сообщает, что было бы стерто.
+func (j *Job) Run(ctx context.Context, interval time.Duration, dryRun bool) {
+	ctx = repositories.WithActor(ctx, Actor)
+	ctx = repositories.WithChannel(ctx, repositories.ChannelSystem)
+
+	// Первый проход не ждет полного интервала: при редком расписании
+	// и частых перезапусках правила иначе не применялись бы вовсе
+	j.runAndLog(ctx, dryRun)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			j.runAndLog(ctx, dryRun)
+		}
+	}
+}
+
+// runAndLog выполняет один проход и пишет его итог в лог
+func (j *Job) runAndLog(ctx context.Context, dryRun bool) {
+	report, err := j.RunOnce(ctx, dryRun)
+	if err != nil {
+		log.Printf("Retention purge failed: %v", err)
+		return
+	}
+	if len(report.Anonymized) > 0 || len(report.Deleted) > 0 {
+		log.Printf("Retention purge (dry run: %t): %d orders anonymized, %d deleted",
+			dryRun, len(report.Anonymized), len(report.Deleted))
+	}
+}
+
+func (j *Job) propagate(ctx context.Context, report *repositories.PurgeReport) {
+	for _, uid := range report.Anonymized {
+		if j.cache != nil {
+			j.cache.Invalidate(uid)
+		}
+		j.publish(ctx, kafka.EventOrderAnonymized, uid, map[string]string{"order_uid": uid})
+	}
+	for _, uid := range report.Deleted {
+		if j.cache != nil {
+			j.cache.Delete(uid)
+		}
+		j.publish(ctx, kafka.EventOrderDeleted, uid, nil)
+	}
+}
+
+func (j *Job) publish(ctx context.Context, eventType string, uid string, value any) {
+	if j.events == nil {
+		return
+	}
+	if err := j.events.ProduceEvent(ctx, eventType, uid, value); err != nil {
+		log.Printf("Retention: failed to publish %s for order %s: %v", eventType, uid, err)
+	}
+}
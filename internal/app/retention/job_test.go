@@ -0,0 +1,138 @@
+package retention
+
+import (
+	"context"
+	"errors"
+	"shop-microservice/internal/domain/repositories"
+	"shop-microservice/internal/infrastructure/kafka"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePurger возвращает заранее заданный отчет и запоминает аргументы
+type fakePurger struct {
+	report *repositories.PurgeReport
+	err    error
+	policy repositories.RetentionPolicy
+	now    time.Time
+	dryRun bool
+	calls  int
+	// onPurge вызывается при каждом проходе, если задан
+	onPurge func()
+}
+
+func (p *fakePurger) Purge(ctx context.Context, policy repositories.RetentionPolicy, now time.Time, dryRun bool) (*repositories.PurgeReport, error) {
+	p.policy, p.now, p.dryRun = policy, now, dryRun
+	p.calls++
+	if p.onPurge != nil {
+		p.onPurge()
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+	report := *p.report
+	report.DryRun = dryRun
+	return &report, nil
+}
+
+// recordingCache запоминает сброшенные и удаленные ключи
+type recordingCache struct {
+	deleted     []string
+	invalidated []string
+}
+
+func (c *recordingCache) Delete(uid string)     { c.deleted = append(c.deleted, uid) }
+func (c *recordingCache) Invalidate(uid string) { c.invalidated = append(c.invalidated, uid) }
+
+type event struct {
+	eventType string
+	key       string
+	value     any
+}
+
+// recordingPublisher запоминает отправленные события
+type recordingPublisher struct {
+	events []event
+}
+
+func (p *recordingPublisher) ProduceEvent(ctx context.Context, eventType string, key string, value any) error {
+	p.events = append(p.events, event{eventType, key, value})
+	return nil
+}
+
+func TestJob_RunOnce_Propagates(t *testing.T) {
+	store := &fakePurger{report: &repositories.PurgeReport{
+		Anonymized: []string{"old"},
+		Deleted:    []string{"cancelled"},
+	}}
+	cache := &recordingCache{}
+	events := &recordingPublisher{}
+	policy := repositories.RetentionPolicy{AnonymizeDeliveryAfter: time.Hour, DeleteCancelledAfter: 2 * time.Hour}
+
+	report, err := NewJob(store, policy, cache, events).RunOnce(context.Background(), false)
+	require.NoError(t, err)
+
+	assert.False(t, report.DryRun)
+	assert.Equal(t, policy, store.policy)
+	assert.WithinDuration(t, time.Now(), store.now, time.Minute)
+	assert.Equal(t, []string{"old"}, cache.invalidated)
+	assert.Equal(t, []string{"cancelled"}, cache.deleted)
+	require.Len(t, events.events, 2)
+	assert.Equal(t, kafka.EventOrderAnonymized, events.events[0].eventType)
+	assert.Equal(t, "old", events.events[0].key)
+	assert.Equal(t, kafka.EventOrderDeleted, events.events[1].eventType)
+	assert.Equal(t, "cancelled", events.events[1].key)
+	assert.Nil(t, events.events[1].value, "deletion is published as a tombstone")
+}
+
+func TestJob_RunOnce_DryRun(t *testing.T) {
+	store := &fakePurger{report: &repositories.PurgeReport{
+		Anonymized: []string{"old"},
+		Deleted:    []string{"cancelled"},
+	}}
+	cache := &recordingCache{}
+	events := &recordingPublisher{}
+
+	report, err := NewJob(store, repositories.RetentionPolicy{PurgeDeletedAfter: time.Hour}, cache, events).
+		RunOnce(context.Background(), true)
+	require.NoError(t, err)
+
+	assert.True(t, store.dryRun)
+	assert.True(t, report.DryRun)
+	assert.Equal(t, []string{"cancelled"}, report.Deleted)
+	assert.Empty(t, cache.deleted)
+	assert.Empty(t, cache.invalidated)
+	assert.Empty(t, events.events)
+}
+
+func TestJob_RunOnce_Error(t *testing.T) {
+	store := &fakePurger{err: errors.New("db down")}
+	cache := &recordingCache{}
+
+	_, err := NewJob(store, repositories.RetentionPolicy{PurgeDeletedAfter: time.Hour}, cache, nil).
+		RunOnce(context.Background(), false)
+	require.Error(t, err)
+	assert.Empty(t, cache.deleted)
+}
+
+func TestJob_Run_PurgesAtStartup(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	store := &fakePurger{report: &repositories.PurgeReport{}, onPurge: cancel}
+
+	done := make(chan struct{})
+	go func() {
+		NewJob(store, repositories.RetentionPolicy{PurgeDeletedAfter: time.Hour}, nil, nil).
+			Run(ctx, time.Hour, false)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("first purge did not run before the interval elapsed")
+	}
+	assert.Equal(t, 1, store.calls)
+}
@@ -0,0 +1,33 @@
+package model
+
+import "time"
+
+// AuditAction - вид изменения заказа в журнале аудита
+type AuditAction string
+
+const (
+	AuditCreate  AuditAction = "create"
+	AuditUpdate  AuditAction = "update"
+	AuditDelete  AuditAction = "delete"
+	AuditStatus  AuditAction = "status"
+	AuditImport  AuditAction = "import"
+	AuditRestore AuditAction = "restore"
+
+	AuditAnonymize AuditAction = "anonymize" // персональные данные доставки стерты по сроку хранения
+	AuditPurge     AuditAction = "purge"     // заказ окончательно удален по сроку хранения
+)
+
+// AuditEntry - запись журнала аудита: кто, когда, через какой канал и что изменил.
+// Snapshot - состояние заказа после изменения (nil после удаления).
+// У массовой загрузки Changes не заполняется, сохраняется только снимок.
+type AuditEntry struct {
+	ID        int64       `json:"id"`
+	OrderUID  string      `json:"order_uid"`
+	Version   int64       `json:"version"`
+	Action    AuditAction `json:"action"`
+	Actor     string      `json:"actor"`
+	Channel   string      `json:"channel"`
+	ChangedAt time.Time   `json:"changed_at"`
+	Changes   *OrderDiff  `json:"changes,omitempty"`
+	Snapshot  *Order      `json:"snapshot,omitempty"`
+}
@@ -0,0 +1,178 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// Служебные поля не считаются изменением заказа: они меняются при каждой записи
+var diffIgnoredFields = map[string]bool{
+	"version":    true,
+	"updated_at": true,
+}
+
+// FieldChange - изменение одного поля; Field - путь через точку (delivery.address).
+// From равно nil для добавленного поля, To - для удаленного.
+type FieldChange struct {
+	Field string `json:"field"`
+	From  any    `json:"from"`
+	To    any    `json:"to"`
+}
+
+// ItemChange - изменения товара, найденного в обеих версиях заказа
+type ItemChange struct {
+	Rid     string        `json:"rid"`
+	ChrtID  int           `json:"chrt_id"`
+	Changes []FieldChange `json:"changes"`
+}
+
+// OrderDiff - различия двух версий заказа. Товары сопоставляются по rid
+// (или chrt_id, если rid пуст).
+type OrderDiff struct {
+	Fields       []FieldChange `json:"fields,omitempty"`
+	AddedItems   []Item        `json:"added_items,omitempty"`
+	RemovedItems []Item        `json:"removed_items,omitempty"`
+	ChangedItems []ItemChange  `json:"changed_items,omitempty"`
+}
+
+// Empty сообщает, что версии не различаются
+func (d *OrderDiff) Empty() bool {
+	return len(d.Fields) == 0 && len(d.AddedItems) == 0 && len(d.RemovedItems) == 0 && len(d.ChangedItems) == 0
+}
+
+// DiffOrders сравнивает две версии заказа; nil означает отсутствие заказа
+// (создание или удаление)
+func DiffOrders(before, after *Order) *OrderDiff {
+	diff := &OrderDiff{}
+
+	var beforeItems, afterItems []Item
+	beforeFields := map[string]any{}
+	afterFields := map[string]any{}
+	if before != nil {
+		beforeItems = before.Items
+		flattenJSON("", toJSONMap(orderWithoutItems(before)), beforeFields)
+	}
+	if after != nil {
+		afterItems = after.Items
+		flattenJSON("", toJSONMap(orderWithoutItems(after)), afterFields)
+	}
+	diff.Fields = diffFields(beforeFields, afterFields)
+
+	beforeByKey := itemsByKey(beforeItems)
+	afterKeys := itemKeys(afterItems)
+	seen := make(map[string]bool, len(afterItems))
+
+	for i, item := range afterItems {
+		key := afterKeys[i]
+		seen[key] = true
+		old, ok := beforeByKey[key]
+		if !ok {
+			diff.AddedItems = append(diff.AddedItems, item)
+			continue
+		}
+		if changes := DiffItems(old, item); len(changes) > 0 {
+			diff.ChangedItems = append(diff.ChangedItems, ItemChange{Rid: item.Rid, ChrtID: item.ChrtID, Changes: changes})
+		}
+	}
+	for i, key := range itemKeys(beforeItems) {
+		if !seen[key] {
+			diff.RemovedItems = append(diff.RemovedItems, beforeItems[i])
+		}
+	}
+
+	return diff
+}
+
+// DiffItems возвращает изменившиеся поля товара
+func DiffItems(before, after Item) []FieldChange {
+	beforeFields := map[string]any{}
+	afterFields := map[string]any{}
+	flattenJSON("", toJSONMap(before), beforeFields)
+	flattenJSON("", toJSONMap(after), afterFields)
+	return diffFields(beforeFields, afterFields)
+}
+
+func diffFields(before, after map[string]any) []FieldChange {
+	var changes []FieldChange
+	for field, value := range after {
+		if old, ok := before[field]; !ok || !reflect.DeepEqual(old, value) {
+			changes = append(changes, FieldChange{Field: field, From: before[field], To: value})
+		}
+	}
+	for field, value := range before {
+		if _, ok := after[field]; !ok {
+			changes = append(changes, FieldChange{Field: field, From: value})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes
+}
+
+func orderWithoutItems(order *Order) Order {
+	copied := *order
+	copied.Items = nil
+	return copied
+}
+
+// toJSONMap переводит значение в JSON-объект; числа остаются json.Number,
+// чтобы не терять точность int64
+func toJSONMap(value any) map[string]any {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+
+	var result map[string]any
+	if err := decoder.Decode(&result); err != nil {
+		return nil
+	}
+	return result
+}
+
+func flattenJSON(prefix string, value map[string]any, out map[string]any) {
+	for key, field := range value {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		} else if key == "items" || diffIgnoredFields[key] {
+			continue
+		}
+		if nested, ok := field.(map[string]any); ok {
+			flattenJSON(path, nested, out)
+			continue
+		}
+		out[path] = field
+	}
+}
+
+// itemKeys - ключи сопоставления товаров; повторяющиеся ключи нумеруются по порядку
+func itemKeys(items []Item) []string {
+	keys := make([]string, len(items))
+	counts := make(map[string]int, len(items))
+	for i, item := range items {
+		key := item.Rid
+		if key == "" {
+			key = fmt.Sprintf("chrt_id:%d", item.ChrtID)
+		}
+		counts[key]++
+		if counts[key] > 1 {
+			key = fmt.Sprintf("%s#%d", key, counts[key])
+		}
+		keys[i] = key
+	}
+	return keys
+}
+
+func itemsByKey(items []Item) map[string]Item {
+	keys := itemKeys(items)
+	result := make(map[string]Item, len(items))
+	for i, item := range items {
+		result[keys[i]] = item
+	}
+	return result
+}
@@ -0,0 +1,96 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func diffTestOrder() *Order {
+	return &Order{
+		OrderUID:    "order-1",
+		TrackNumber: "TRACK",
+		Entry:       "WBIL",
+		CustomerID:  "customer",
+		DateCreated: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC),
+		Status:      OrderStatusCreated,
+		Version:     1,
+		Delivery:    &Delivery{Name: "Test", Address: "Ploshad Mira 15"},
+		Payment:     &Payment{Transaction: "order-1", Amount: 1817, PaymentDt: 1637907727},
+		Items: []Item{
+			{ChrtID: 1, Rid: "rid-1", Price: 100, Status: ItemStatusNew},
+			{ChrtID: 2, Rid: "rid-2", Price: 200, Status: ItemStatusNew},
+		},
+	}
+}
+
+func TestDiffOrders(t *testing.T) {
+	before := diffTestOrder()
+	after := before.Clone()
+	after.Version = 2
+	after.UpdatedAt = time.Now()
+	after.Delivery.Address = "Lenina 1"
+	after.Payment = nil
+	after.Items[0].Status = ItemStatusShipped
+	after.Items = append(after.Items[:1], Item{ChrtID: 3, Rid: "rid-3", Price: 300})
+
+	diff := DiffOrders(before, after)
+	require.False(t, diff.Empty())
+
+	fields := map[string]FieldChange{}
+	for _, change := range diff.Fields {
+		fields[change.Field] = change
+	}
+	assert.NotContains(t, fields, "version")
+	assert.NotContains(t, fields, "updated_at")
+	assert.Equal(t, "Ploshad Mira 15", fields["delivery.address"].From)
+	assert.Equal(t, "Lenina 1", fields["delivery.address"].To)
+	assert.Equal(t, json.Number("1817"), fields["payment.amount"].From)
+	assert.Nil(t, fields["payment.amount"].To)
+
+	require.Len(t, diff.AddedItems, 1)
+	assert.Equal(t, "rid-3", diff.AddedItems[0].Rid)
+	require.Len(t, diff.RemovedItems, 1)
+	assert.Equal(t, "rid-2", diff.RemovedItems[0].Rid)
+	require.Len(t, diff.ChangedItems, 1)
+	assert.Equal(t, []FieldChange{{Field: "status", From: json.Number("101"), To: json.Number("301")}}, diff.ChangedItems[0].Changes)
+
+	// Клон не разделяет данные с оригиналом
+	assert.Equal(t, "Ploshad Mira 15", before.Delivery.Address)
+	assert.Equal(t, ItemStatusNew, before.Items[0].Status)
+}
+
+func TestDiffOrders_CreateAndDelete(t *testing.T) {
+	order := diffTestOrder()
+
+	created := DiffOrders(nil, order)
+	assert.Len(t, created.AddedItems, 2)
+	assert.Empty(t, created.RemovedItems)
+	for _, change := range created.Fields {
+		assert.Nil(t, change.From, change.Field)
+	}
+
+	deleted := DiffOrders(order, nil)
+	assert.Len(t, deleted.RemovedItems, 2)
+	for _, change := range deleted.Fields {
+		assert.Nil(t, change.To, change.Field)
+	}
+
+	assert.True(t, DiffOrders(order, order.Clone()).Empty())
+}
+
+func TestDiffOrders_ItemsWithoutRid(t *testing.T) {
+	before := diffTestOrder()
+	before.Items = []Item{{ChrtID: 7, Price: 1}, {ChrtID: 7, Price: 2}}
+	after := before.Clone()
+	after.Items[1].Price = 3
+
+	diff := DiffOrders(before, after)
+	require.Len(t, diff.ChangedItems, 1)
+	assert.Equal(t, "price", diff.ChangedItems[0].Changes[0].Field)
+	assert.Empty(t, diff.AddedItems)
+	assert.Empty(t, diff.RemovedItems)
+}
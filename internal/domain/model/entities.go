@@ -3,20 +3,48 @@ package model
 import "time"
 
 type Order struct {
-	OrderUID          string    `json:"order_uid" binding:"required"`
-	TrackNumber       string    `json:"track_number" binding:"required"`
-	Entry             string    `json:"entry" binding:"required"`
-	Delivery          Delivery  `json:"delivery" binding:"required"`
-	Payment           Payment   `json:"payment" binding:"required"`
-	Items             []Item    `json:"items" binding:"required"`
-	Locale            string    `json:"locale"`
-	InternalSignature string    `json:"internal_signature"`
-	CustomerID        string    `json:"customer_id" binding:"required"`
-	DeliveryService   string    `json:"delivery_service"`
-	Shardkey          string    `json:"shardkey"`
-	SmID              int       `json:"sm_id"`
-	DateCreated       time.Time `json:"date_created"`
-	OofShard          string    `json:"oof_shard"`
+	OrderUID          string      `json:"order_uid" binding:"required"`
+	TrackNumber       string      `json:"track_number" binding:"required"`
+	Entry             string      `json:"entry" binding:"required"`
+	Delivery          *Delivery   `json:"delivery,omitempty"` // nil у черновика
+	Payment           *Payment    `json:"payment,omitempty"`  // nil у черновика
+	Items             []Item      `json:"items" binding:"required"`
+	Locale            string      `json:"locale"`
+	InternalSignature string      `json:"internal_signature"`
+	CustomerID        string      `json:"customer_id" binding:"required"`
+	DeliveryService   string      `json:"delivery_service"`
+	Shardkey          string      `json:"shardkey"`
+	SmID              int         `json:"sm_id"`
+	DateCreated       time.Time   `json:"date_created"`
+	OofShard          string      `json:"oof_shard"`
+	Status            OrderStatus `json:"status"`
+	Version           int64       `json:"version"`
+	UpdatedAt         time.Time   `json:"updated_at"`
+	DeletedAt         *time.Time  `json:"deleted_at,omitempty"` // не nil у мягко удаленного заказа
+}
+
+// IsDraft сообщает, что у заказа еще нет доставки или оплаты
+func (o *Order) IsDraft() bool {
+	return o.Delivery == nil || o.Payment == nil
+}
+
+// Clone возвращает глубокую копию заказа
+func (o *Order) Clone() *Order {
+	copied := *o
+	if o.Delivery != nil {
+		delivery := *o.Delivery
+		copied.Delivery = &delivery
+	}
+	if o.Payment != nil {
+		payment := *o.Payment
+		copied.Payment = &payment
+	}
+	if o.DeletedAt != nil {
+		deletedAt := *o.DeletedAt
+		copied.DeletedAt = &deletedAt
+	}
+	copied.Items = append([]Item(nil), o.Items...)
+	return &copied
 }
 
 type Delivery struct {
@@ -43,15 +71,15 @@ type Payment struct {
 }
 
 type Item struct {
-	ChrtID      int    `json:"chrt_id" binding:"required"`
-	TrackNumber string `json:"track_number" binding:"required"`
-	Price       int    `json:"price" binding:"required"`
-	Rid         string `json:"rid" binding:"required"`
-	Name        string `json:"name" binding:"required"`
-	Sale        int    `json:"sale" binding:"required"`
-	Size        string `json:"size" binding:"required"`
-	TotalPrice  int    `json:"total_price" binding:"required"`
-	NmID        int    `json:"nm_id" binding:"required"`
-	Brand       string `json:"brand" binding:"required"`
-	Status      int    `json:"status" binding:"required"`
+	ChrtID      int        `json:"chrt_id" binding:"required"`
+	TrackNumber string     `json:"track_number" binding:"required"`
+	Price       int        `json:"price" binding:"required"`
+	Rid         string     `json:"rid" binding:"required"`
+	Name        string     `json:"name" binding:"required"`
+	Sale        int        `json:"sale" binding:"required"`
+	Size        string     `json:"size" binding:"required"`
+	TotalPrice  int        `json:"total_price" binding:"required"`
+	NmID        int        `json:"nm_id" binding:"required"`
+	Brand       string     `json:"brand" binding:"required"`
+	Status      ItemStatus `json:"status" binding:"required"`
 }
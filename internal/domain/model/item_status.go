@@ -0,0 +1,125 @@
+package model
+
+import (
+	"slices"
+	"strconv"
+)
+
+// ItemStatus - статус товара в заказе. Коды сгруппированы по сотням:
+// 1xx - новый, 2xx - обработка на складе, 3xx - доставка, 4xx - отмена и возврат.
+type ItemStatus int
+
+const (
+	ItemStatusNew        ItemStatus = 101
+	ItemStatusConfirmed  ItemStatus = 201
+	ItemStatusAssembling ItemStatus = 202
+	ItemStatusReady      ItemStatus = 203
+	ItemStatusShipped    ItemStatus = 301
+	ItemStatusDelivered  ItemStatus = 302
+	ItemStatusCancelled  ItemStatus = 401
+	ItemStatusReturned   ItemStatus = 402
+)
+
+// ItemStatusInfo - описание статуса товара в каталоге
+type ItemStatusInfo struct {
+	Code        ItemStatus   `json:"code"`
+	Name        string       `json:"name"`
+	Transitions []ItemStatus `json:"transitions"`
+}
+
+// itemStatusCatalogue - известные статусы товаров и допустимые переходы
+var itemStatusCatalogue = []ItemStatusInfo{
+	{ItemStatusNew, "new", []ItemStatus{ItemStatusConfirmed, ItemStatusCancelled}},
+	{ItemStatusConfirmed, "confirmed", []ItemStatus{ItemStatusAssembling, ItemStatusCancelled}},
+	{ItemStatusAssembling, "assembling", []ItemStatus{ItemStatusReady, ItemStatusCancelled}},
+	{ItemStatusReady, "ready", []ItemStatus{ItemStatusShipped, ItemStatusCancelled}},
+	{ItemStatusShipped, "shipped", []ItemStatus{ItemStatusDelivered, ItemStatusReturned}},
+	{ItemStatusDelivered, "delivered", []ItemStatus{ItemStatusReturned}},
+	{ItemStatusCancelled, "cancelled", []ItemStatus{}},
+	{ItemStatusReturned, "returned", []ItemStatus{}},
+}
+
+// ItemStatusCatalogue возвращает копию каталога статусов товаров
+func ItemStatusCatalogue() []ItemStatusInfo {
+	catalogue := make([]ItemStatusInfo, len(itemStatusCatalogue))
+	for i, info := range itemStatusCatalogue {
+		info.Transitions = slices.Clone(info.Transitions)
+		catalogue[i] = info
+	}
+	return catalogue
+}
+
+func (s ItemStatus) info() (ItemStatusInfo, bool) {
+	for _, info := range itemStatusCatalogue {
+		if info.Code == s {
+			return info, true
+		}
+	}
+	return ItemStatusInfo{}, false
+}
+
+// Known сообщает, есть ли статус в каталоге
+func (s ItemStatus) Known() bool {
+	_, ok := s.info()
+	return ok
+}
+
+func (s ItemStatus) String() string {
+	if info, ok := s.info(); ok {
+		return info.Name
+	}
+	return strconv.Itoa(int(s))
+}
+
+// CanTransitionTo сообщает, разрешен ли переход из s в next.
+// Товары со статусом вне каталога (старые данные) можно перевести в любой известный статус.
+func (s ItemStatus) CanTransitionTo(next ItemStatus) bool {
+	if !next.Known() {
+		return false
+	}
+	info, ok := s.info()
+	if !ok {
+		return true
+	}
+	return slices.Contains(info.Transitions, next)
+}
+
+// DeriveOrderStatus выводит статус заказа из статусов его товаров.
+// Отмененные товары не влияют на заказ, пока в нем есть другие.
+// ok == false, если статусы товаров не определяют статус заказа.
+func DeriveOrderStatus(items []Item) (status OrderStatus, ok bool) {
+	if len(items) == 0 {
+		return "", false
+	}
+
+	var cancelled, returned, delivered, shipped, warehouse int
+	for _, item := range items {
+		switch item.Status {
+		case ItemStatusCancelled:
+			cancelled++
+		case ItemStatusReturned:
+			returned++
+		case ItemStatusDelivered:
+			delivered++
+		case ItemStatusShipped:
+			shipped++
+		case ItemStatusAssembling, ItemStatusReady:
+			warehouse++
+		}
+	}
+
+	active := len(items) - cancelled
+	switch {
+	case active == 0:
+		return OrderStatusCancelled, true
+	case returned == active:
+		return OrderStatusReturned, true
+	case delivered+returned == active:
+		return OrderStatusDelivered, true
+	case shipped+delivered+returned == active:
+		return OrderStatusShipped, true
+	case warehouse > 0:
+		return OrderStatusAssembling, true
+	}
+	return "", false
+}
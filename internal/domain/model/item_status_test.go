@@ -0,0 +1,53 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestItemStatus_CanTransitionTo(t *testing.T) {
+	assert.True(t, ItemStatusNew.CanTransitionTo(ItemStatusConfirmed))
+	assert.True(t, ItemStatusReady.CanTransitionTo(ItemStatusShipped))
+	assert.False(t, ItemStatusShipped.CanTransitionTo(ItemStatusCancelled))
+	assert.False(t, ItemStatusReturned.CanTransitionTo(ItemStatusNew))
+	assert.False(t, ItemStatusNew.CanTransitionTo(ItemStatus(999)))
+
+	// Статусы вне каталога переводятся в любой известный
+	assert.True(t, ItemStatus(1).CanTransitionTo(ItemStatusDelivered))
+}
+
+func TestDeriveOrderStatus(t *testing.T) {
+	items := func(statuses ...ItemStatus) []Item {
+		result := make([]Item, len(statuses))
+		for i, status := range statuses {
+			result[i].Status = status
+		}
+		return result
+	}
+
+	tests := []struct {
+		name   string
+		items  []Item
+		status OrderStatus
+		ok     bool
+	}{
+		{"no items", nil, "", false},
+		{"all new", items(ItemStatusNew, ItemStatusConfirmed), "", false},
+		{"one assembling", items(ItemStatusConfirmed, ItemStatusAssembling), OrderStatusAssembling, true},
+		{"all shipped", items(ItemStatusShipped, ItemStatusShipped), OrderStatusShipped, true},
+		{"shipped and cancelled", items(ItemStatusShipped, ItemStatusCancelled), OrderStatusShipped, true},
+		{"partly delivered", items(ItemStatusShipped, ItemStatusDelivered), OrderStatusShipped, true},
+		{"delivered", items(ItemStatusDelivered, ItemStatusReturned), OrderStatusDelivered, true},
+		{"returned", items(ItemStatusReturned, ItemStatusCancelled), OrderStatusReturned, true},
+		{"cancelled", items(ItemStatusCancelled, ItemStatusCancelled), OrderStatusCancelled, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, ok := DeriveOrderStatus(tt.items)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.status, status)
+		})
+	}
+}
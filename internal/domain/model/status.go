@@ -0,0 +1,59 @@
+package model
+
+import "time"
+
+// OrderStatus - статус заказа целиком (в отличие от Item.Status)
+type OrderStatus string
+
+const (
+	OrderStatusCreated    OrderStatus = "created"
+	OrderStatusPaid       OrderStatus = "paid"
+	OrderStatusAssembling OrderStatus = "assembling"
+	OrderStatusShipped    OrderStatus = "shipped"
+	OrderStatusDelivered  OrderStatus = "delivered"
+	OrderStatusCancelled  OrderStatus = "cancelled"
+	OrderStatusReturned   OrderStatus = "returned"
+)
+
+// orderStatusTransitions - допустимые переходы между статусами заказа
+var orderStatusTransitions = map[OrderStatus][]OrderStatus{
+	OrderStatusCreated:    {OrderStatusPaid, OrderStatusCancelled},
+	OrderStatusPaid:       {OrderStatusAssembling, OrderStatusCancelled},
+	OrderStatusAssembling: {OrderStatusShipped, OrderStatusCancelled},
+	OrderStatusShipped:    {OrderStatusDelivered, OrderStatusReturned},
+	OrderStatusDelivered:  {OrderStatusReturned},
+	OrderStatusCancelled:  {},
+	OrderStatusReturned:   {},
+}
+
+// Valid сообщает, известен ли статус
+func (s OrderStatus) Valid() bool {
+	_, ok := orderStatusTransitions[s]
+	return ok
+}
+
+// CanTransitionTo сообщает, разрешен ли переход из s в next
+func (s OrderStatus) CanTransitionTo(next OrderStatus) bool {
+	for _, allowed := range orderStatusTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// Final сообщает, что из статуса больше нет переходов
+func (s OrderStatus) Final() bool {
+	return s.Valid() && len(orderStatusTransitions[s]) == 0
+}
+
+// StatusChange - запись истории статусов заказа: кто, когда и почему
+type StatusChange struct {
+	OrderUID  string      `json:"order_uid"`
+	From      OrderStatus `json:"from"`
+	To        OrderStatus `json:"to"`
+	Actor     string      `json:"actor"`
+	Reason    string      `json:"reason,omitempty"`
+	Version   int64       `json:"version"`
+	ChangedAt time.Time   `json:"changed_at"`
+}
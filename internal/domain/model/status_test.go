@@ -0,0 +1,36 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderStatus_CanTransitionTo(t *testing.T) {
+	tests := []struct {
+		from, to OrderStatus
+		allowed  bool
+	}{
+		{OrderStatusCreated, OrderStatusPaid, true},
+		{OrderStatusCreated, OrderStatusShipped, false},
+		{OrderStatusPaid, OrderStatusCancelled, true},
+		{OrderStatusAssembling, OrderStatusShipped, true},
+		{OrderStatusShipped, OrderStatusCancelled, false},
+		{OrderStatusShipped, OrderStatusDelivered, true},
+		{OrderStatusDelivered, OrderStatusReturned, true},
+		{OrderStatusCancelled, OrderStatusCreated, false},
+		{OrderStatusPaid, OrderStatusPaid, false},
+		{OrderStatus("unknown"), OrderStatusPaid, false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.allowed, tt.from.CanTransitionTo(tt.to), "%s -> %s", tt.from, tt.to)
+	}
+}
+
+func TestOrderStatus_Final(t *testing.T) {
+	assert.True(t, OrderStatusCancelled.Final())
+	assert.True(t, OrderStatusReturned.Final())
+	assert.False(t, OrderStatusShipped.Final())
+	assert.False(t, OrderStatus("unknown").Final())
+}
@@ -0,0 +1,87 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// Validate проверяет обязательные поля заказа.
+// У черновика (draft) доставка и оплата могут отсутствовать.
+func (o *Order) Validate(draft bool) error {
+	switch {
+	case o.OrderUID == "":
+		return errors.New("order uid is required")
+	case o.TrackNumber == "":
+		return errors.New("track number is required")
+	case o.Entry == "":
+		return errors.New("entry is required")
+	case o.CustomerID == "":
+		return errors.New("customer id is required")
+	case len(o.Items) == 0:
+		return errors.New("items are required")
+	case !draft && o.Delivery == nil:
+		return errors.New("delivery is required")
+	case !draft && o.Payment == nil:
+		return errors.New("payment is required")
+	case o.Payment != nil && o.Payment.Transaction == "":
+		return errors.New("payment transaction is required")
+	}
+	return nil
+}
+
+// fieldLimit - строковое поле и размер его столбца в базе
+type fieldLimit struct {
+	name  string
+	value string
+	max   int
+}
+
+// ValidateLengths проверяет, что строковые поля помещаются в столбцы VARCHAR схемы.
+// Имя, телефон, адрес и email получателя хранятся в TEXT и не ограничены.
+func (o *Order) ValidateLengths() error {
+	limits := []fieldLimit{
+		{"order_uid", o.OrderUID, 50},
+		{"track_number", o.TrackNumber, 50},
+		{"entry", o.Entry, 10},
+		{"locale", o.Locale, 10},
+		{"internal_signature", o.InternalSignature, 100},
+		{"customer_id", o.CustomerID, 50},
+		{"delivery_service", o.DeliveryService, 50},
+		{"shardkey", o.Shardkey, 10},
+		{"oof_shard", o.OofShard, 10},
+	}
+	if o.Delivery != nil {
+		limits = append(limits,
+			fieldLimit{"delivery.zip", o.Delivery.Zip, 20},
+			fieldLimit{"delivery.city", o.Delivery.City, 100},
+			fieldLimit{"delivery.region", o.Delivery.Region, 100},
+		)
+	}
+	if o.Payment != nil {
+		limits = append(limits,
+			fieldLimit{"payment.transaction", o.Payment.Transaction, 100},
+			fieldLimit{"payment.request_id", o.Payment.RequestID, 100},
+			fieldLimit{"payment.currency", o.Payment.Currency, 10},
+			fieldLimit{"payment.provider", o.Payment.Provider, 50},
+			fieldLimit{"payment.bank", o.Payment.Bank, 50},
+		)
+	}
+	for i, item := range o.Items {
+		prefix := fmt.Sprintf("items[%d].", i)
+		limits = append(limits,
+			fieldLimit{prefix + "track_number", item.TrackNumber, 50},
+			fieldLimit{prefix + "rid", item.Rid, 100},
+			fieldLimit{prefix + "name", item.Name, 250},
+			fieldLimit{prefix + "size", item.Size, 10},
+			fieldLimit{prefix + "brand", item.Brand, 100},
+		)
+	}
+
+	for _, limit := range limits {
+		if utf8.RuneCountInString(limit.value) > limit.max {
+			return fmt.Errorf("%s is longer than %d characters", limit.name, limit.max)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package repositories
+
+import "context"
+
+// DefaultActor - автор изменений, если он не указан в контексте
+const DefaultActor = "system"
+
+// Каналы, через которые приходят изменения заказов
+const (
+	ChannelSystem = "system"
+	ChannelAPI    = "api"
+	ChannelKafka  = "kafka"
+	ChannelCLI    = "cli"
+)
+
+type actorKey struct{}
+
+type channelKey struct{}
+
+// WithActor сохраняет в контексте автора изменений для истории заказа
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext возвращает автора изменений из контекста или DefaultActor
+func ActorFromContext(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok && actor != "" {
+		return actor
+	}
+	return DefaultActor
+}
+
+// WithChannel сохраняет в контексте канал, через который пришло изменение
+func WithChannel(ctx context.Context, channel string) context.Context {
+	return context.WithValue(ctx, channelKey{}, channel)
+}
+
+// ChannelFromContext возвращает канал изменения из контекста или ChannelSystem
+func ChannelFromContext(ctx context.Context) string {
+	if channel, ok := ctx.Value(channelKey{}).(string); ok && channel != "" {
+		return channel
+	}
+	return ChannelSystem
+}
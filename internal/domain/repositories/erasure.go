@@ -0,0 +1,49 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrErasureJobNotFound - заявки на стирание с таким номером нет
+var ErrErasureJobNotFound = errors.New("erasure job not found")
+
+// ErasureStatus - состояние заявки на стирание данных покупателя
+type ErasureStatus string
+
+const (
+	ErasurePending ErasureStatus = "pending" // ждет обработки, обрабатывается или ждет повтора
+	ErasureDone    ErasureStatus = "done"
+	ErasureFailed  ErasureStatus = "failed"
+)
+
+// ErasureJob - заявка на стирание персональных данных покупателя
+type ErasureJob struct {
+	ID            int64         `json:"id"`
+	CustomerID    string        `json:"customer_id"`
+	Status        ErasureStatus `json:"status"`
+	RequestedBy   string        `json:"requested_by"`
+	RequestedAt   time.Time     `json:"requested_at"`
+	FinishedAt    *time.Time    `json:"finished_at,omitempty"`
+	Orders        int           `json:"orders"`                    // заказов покупателя, затронутых стиранием
+	Attempts      int           `json:"attempts"`                  // неудачных попыток выполнения
+	NextAttemptAt *time.Time    `json:"next_attempt_at,omitempty"` // повтор ждущей заявки после неудачи
+	Error         string        `json:"error,omitempty"`           // ошибка последней попытки
+}
+
+// CustomerEraser - хранилище, стирающее персональные данные покупателя по заявкам.
+// Стираются данные получателя в заказах (включая удаленные и архивные) и в журнале
+// аудита; оплаты и товары остаются для финансовой отчетности.
+type CustomerEraser interface {
+	// RequestErasure ставит заявку в очередь; повторная заявка на того же
+	// покупателя, пока первая ждет, возвращает первую
+	RequestErasure(ctx context.Context, customerID string) (*ErasureJob, error)
+	// ErasureJob возвращает заявку по номеру или ErrErasureJobNotFound
+	ErasureJob(ctx context.Context, id int64) (*ErasureJob, error)
+	// ProcessErasure выполняет самую старую ждущую заявку, время которой пришло, и
+	// возвращает ее вместе с заказами покупателя; без таких заявок возвращает nil.
+	// Неудачная заявка откладывается с растущей паузой, после нескольких попыток
+	// помечается failed; в обоих случаях она возвращается вместе с ошибкой.
+	ProcessErasure(ctx context.Context) (*ErasureJob, []string, error)
+}
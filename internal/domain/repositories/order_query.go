@@ -0,0 +1,87 @@
+package repositories
+
+import (
+	"errors"
+	"shop-microservice/internal/domain/model"
+	"time"
+)
+
+const (
+	DefaultListLimit = 50
+	MaxListLimit     = 500
+)
+
+// ErrInvalidCursor возвращается, если курсор поврежден или получен при другой сортировке
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// OrderSort - порядок выдачи заказов; минус означает убывание
+type OrderSort string
+
+const (
+	SortDateCreatedDesc OrderSort = "-date_created"
+	SortDateCreatedAsc  OrderSort = "date_created"
+	SortOrderUIDAsc     OrderSort = "order_uid"
+	SortOrderUIDDesc    OrderSort = "-order_uid"
+)
+
+func (s OrderSort) Valid() bool {
+	switch s {
+	case SortDateCreatedDesc, SortDateCreatedAsc, SortOrderUIDAsc, SortOrderUIDDesc:
+		return true
+	}
+	return false
+}
+
+// OrderFilter - условия отбора заказов; пустые поля не ограничивают выборку
+type OrderFilter struct {
+	OrderUIDs       []string
+	CustomerID      string
+	TrackNumber     string
+	CreatedFrom     time.Time // включительно
+	CreatedTo       time.Time // не включительно
+	DeliveryService string
+	Currency        string
+	Status          model.OrderStatus
+	ItemStatus      *model.ItemStatus // заказ содержит товар с этим статусом
+	Brand           string            // заказ содержит товар этого бренда
+	Email           string            // email получателя, без учета регистра
+	Phone           string            // телефон получателя, сравниваются только цифры
+	IncludeDeleted  bool              // включать мягко удаленные заказы
+	IncludeArchived bool              // включать заказы из архивных партиций
+}
+
+// Empty сообщает, что фильтр не ограничивает выборку: подходят все живые заказы
+func (f OrderFilter) Empty() bool {
+	return len(f.OrderUIDs) == 0 && f.CustomerID == "" && f.TrackNumber == "" &&
+		f.CreatedFrom.IsZero() && f.CreatedTo.IsZero() && f.DeliveryService == "" &&
+		f.Currency == "" && f.Status == "" && f.ItemStatus == nil && f.Brand == "" &&
+		f.Email == "" && f.Phone == "" && !f.IncludeDeleted && !f.IncludeArchived
+}
+
+// ListOptions - параметры постраничной выдачи заказов
+type ListOptions struct {
+	Filter OrderFilter
+	Sort   OrderSort
+	Limit  int
+	Cursor string
+}
+
+// Normalize подставляет значения по умолчанию и ограничивает размер страницы
+func (o ListOptions) Normalize() ListOptions {
+	if o.Sort == "" {
+		o.Sort = SortDateCreatedDesc
+	}
+	if o.Limit <= 0 {
+		o.Limit = DefaultListLimit
+	}
+	if o.Limit > MaxListLimit {
+		o.Limit = MaxListLimit
+	}
+	return o
+}
+
+// OrderPage - страница заказов; пустой NextCursor означает последнюю страницу
+type OrderPage struct {
+	Orders     []*model.Order `json:"orders"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
@@ -2,11 +2,174 @@ package repositories
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"shop-microservice/internal/domain/model"
+	"time"
 )
 
+// ErrOrderNotFound возвращается, когда заказа нет в хранилище
+var ErrOrderNotFound = errors.New("order not found")
+
+// ErrOrderExists возвращается при создании заказа с занятым OrderUID
+var ErrOrderExists = errors.New("order already exists")
+
+// ErrVersionConflict возвращается, если версия заказа не совпала с ожидаемой
+var ErrVersionConflict = errors.New("order version conflict")
+
+// ErrInvalidStatusTransition возвращается при переходе статуса, которого нет в графе
+var ErrInvalidStatusTransition = errors.New("invalid order status transition")
+
+// ErrRevisionNotFound возвращается, если состояния заказа на запрошенный момент или версию нет:
+// заказ тогда еще не существовал, уже был удален или версия не записана в журнал
+var ErrRevisionNotFound = errors.New("order revision not found")
+
+// ErrItemNotFound возвращается, если товар для смены статуса не найден
+var ErrItemNotFound = errors.New("item not found")
+
+// ErrAmbiguousItem возвращается, если chrt_id без order_uid есть в нескольких заказах
+var ErrAmbiguousItem = errors.New("item is ambiguous")
+
+// ConflictError - заказ уже существует; Version - версия сохраненного заказа
+type ConflictError struct {
+	OrderUID string
+	Version  int64
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("order %s already exists (version %d)", e.OrderUID, e.Version)
+}
+
+func (e *ConflictError) Unwrap() error {
+	return ErrOrderExists
+}
+
 type OrderRepository interface {
+	// Create сохраняет новый заказ; для существующего возвращает *ConflictError
+	Create(ctx context.Context, order *model.Order) error
+	// Save сохраняет заказ, заменяя существующий (upsert).
+	// Ненулевая order.Version должна совпасть с сохраненной.
 	Save(ctx context.Context, order *model.Order) error
+	// Update применяет mutate к текущему состоянию заказа и сохраняет результат атомарно.
+	// Ненулевая expectedVersion должна совпасть с сохраненной (compare-and-swap).
+	Update(ctx context.Context, uid string, expectedVersion int64, mutate func(order *model.Order) error) (*model.Order, error)
+	// Delete мягко удаляет заказ: он пропадает из чтения, но остается в базе до архивации
+	Delete(ctx context.Context, uid string, expectedVersion int64) error
+	// ChangeStatus переводит заказ в новый статус по графу переходов и записывает историю.
+	// Save и Update статус не меняют.
+	ChangeStatus(ctx context.Context, uid string, transition StatusTransition) (*model.Order, *model.StatusChange, error)
+	// StatusHistory возвращает историю статусов заказа от старых к новым
+	StatusHistory(ctx context.Context, uid string) ([]model.StatusChange, error)
+	// AuditHistory возвращает журнал изменений заказа от старых записей к новым (без снимков).
+	// Журнал удаленного заказа сохраняется.
+	AuditHistory(ctx context.Context, uid string) ([]model.AuditEntry, error)
+	// OrderAsOf возвращает заказ в том состоянии, в котором он был на момент at
+	OrderAsOf(ctx context.Context, uid string, at time.Time) (*model.Order, error)
+	// OrderAtVersion возвращает заказ в состоянии указанной версии
+	OrderAtVersion(ctx context.Context, uid string, version int64) (*model.Order, error)
+	// UpdateItemStatuses атомарно меняет статусы товаров (возможно, в разных заказах)
+	// и выводит из них статусы затронутых заказов
+	UpdateItemStatuses(ctx context.Context, updates []ItemStatusUpdate, reason string) (*ItemStatusResult, error)
 	FindByID(ctx context.Context, uid string) (*model.Order, error)
 	FindAll(ctx context.Context) ([]*model.Order, error)
+	List(ctx context.Context, opts ListOptions) (*OrderPage, error)
+	// Stream передает заказы в fn пачками по batchSize, не загружая все сразу
+	Stream(ctx context.Context, filter OrderFilter, batchSize int, fn func(batch []*model.Order) error) error
+}
+
+// BulkImporter - хранилище, умеющее загружать заказы пачкой (например, через COPY).
+// Существующие заказы заменяются, как в Save.
+type BulkImporter interface {
+	Import(ctx context.Context, orders []*model.Order) error
+}
+
+// RestorePolicy - как восстанавливать заказы, которые уже есть в хранилище
+type RestorePolicy string
+
+const (
+	RestoreFail      RestorePolicy = "fail"      // прервать восстановление с *ConflictError
+	RestoreSkip      RestorePolicy = "skip"      // оставить сохраненный заказ
+	RestoreOverwrite RestorePolicy = "overwrite" // заменить сохраненный заказ копией
+)
+
+func (p RestorePolicy) Valid() bool {
+	switch p {
+	case RestoreFail, RestoreSkip, RestoreOverwrite:
+		return true
+	}
+	return false
+}
+
+// OrderRestorer - хранилище, умеющее загружать заказы из резервной копии.
+// В отличие от Import статус, версия и время изменения сохраняются как есть.
+// Restore возвращает число записанных заказов.
+type OrderRestorer interface {
+	Restore(ctx context.Context, orders []*model.Order, policy RestorePolicy) (int, error)
+}
+
+// ArchiveOptions - параметры переноса старых заказов в архив
+type ArchiveOptions struct {
+	Before    time.Time // переносятся заказы, созданные раньше этого момента
+	BatchSize int
+	// ColdStore, если задан, получает каждую пачку до удаления из базы (например,
+	// дописывает NDJSON-файл), и архивные партиции тогда не заполняются. Заказы
+	// приходят запечатанными так же, как в архивных партициях.
+	// При сбое пачка может попасть в холодное хранилище повторно.
+	ColdStore func(ctx context.Context, batch []SealedOrder) error
+}
+
+// SealedOrder - заказ для хранения вне рабочих таблиц. С настроенным шифрованием
+// данные получателя в Order зашифрованы ключом данных DEK (обернут ключом KeyID),
+// а EmailBidx и PhoneBidx - слепые индексы для поиска; без шифрования заказ открыт.
+type SealedOrder struct {
+	Order     *model.Order `json:"document"`
+	KeyID     *string      `json:"key_id,omitempty"`
+	DEK       []byte       `json:"dek,omitempty"`
+	EmailBidx *string      `json:"email_bidx,omitempty"`
+	PhoneBidx *string      `json:"phone_bidx,omitempty"`
+}
+
+// OrderArchiver - хранилище, умеющее переносить старые заказы (и удаленные в том
+// числе) из рабочих таблиц в архив. Archive возвращает число перенесенных заказов.
+// Заказы из архивных партиций читаются с OrderFilter.IncludeArchived.
+type OrderArchiver interface {
+	Archive(ctx context.Context, opts ArchiveOptions) (int, error)
+}
+
+// ReencryptOptions - параметры перешифрования персональных данных получателя
+type ReencryptOptions struct {
+	BatchSize int
+	// Decrypt - вместо перешифрования текущим ключом сохранить данные открыто
+	// (перед отключением шифрования или откатом миграции)
+	Decrypt bool
+}
+
+// DeliveryReencrypter - хранилище, шифрующее данные получателя. Reencrypt шифрует
+// открытые записи и записи со старым ключом текущим ключом и возвращает их число.
+type DeliveryReencrypter interface {
+	Reencrypt(ctx context.Context, opts ReencryptOptions) (int, error)
+}
+
+// StatusTransition - запрос на смену статуса заказа.
+// Ненулевая ExpectedVersion должна совпасть с сохраненной.
+type StatusTransition struct {
+	To              model.OrderStatus
+	Reason          string
+	ExpectedVersion int64
+}
+
+// ItemStatusUpdate - смена статуса товара. Товар ищется по Rid, либо по паре OrderUID
+// и ChrtID, либо по одному ChrtID, если он есть только в одном действующем заказе
+// (ChrtID уникален только внутри заказа).
+type ItemStatusUpdate struct {
+	Rid      string           `json:"rid,omitempty"`
+	OrderUID string           `json:"order_uid,omitempty"`
+	ChrtID   int              `json:"chrt_id,omitempty"`
+	Status   model.ItemStatus `json:"status"`
+}
+
+// ItemStatusResult - затронутые заказы и выведенные из товаров смены их статусов
+type ItemStatusResult struct {
+	Orders  []*model.Order       `json:"orders"`
+	Changes []model.StatusChange `json:"status_changes"`
 }
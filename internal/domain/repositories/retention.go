@@ -0,0 +1,36 @@
+package repositories
+
+import (
+	"context"
+	"time"
+)
+
+// RetentionPolicy - сроки хранения данных заказов; нулевой срок отключает правило
+type RetentionPolicy struct {
+	// AnonymizeDeliveryAfter - стереть имя, телефон, индекс, адрес и email получателя
+	// у заказов, созданных раньше этого срока (город и регион остаются)
+	AnonymizeDeliveryAfter time.Duration
+	// DeleteCancelledAfter - окончательно удалить заказы, отмененные раньше этого срока
+	DeleteCancelledAfter time.Duration
+	// PurgeDeletedAfter - окончательно удалить мягко удаленные заказы
+	PurgeDeletedAfter time.Duration
+}
+
+// Empty сообщает, что ни одно правило не включено
+func (p RetentionPolicy) Empty() bool {
+	return p.AnonymizeDeliveryAfter <= 0 && p.DeleteCancelledAfter <= 0 && p.PurgeDeletedAfter <= 0
+}
+
+// PurgeReport - заказы, затронутые правилами хранения (включая архивные)
+type PurgeReport struct {
+	DryRun     bool     `json:"dry_run"`
+	Anonymized []string `json:"anonymized"` // у заказов стерты данные получателя
+	Deleted    []string `json:"deleted"`    // заказы удалены окончательно
+}
+
+// OrderPurger - хранилище, применяющее правила хранения к заказам, их архиву и журналу
+// аудита. Сроки отсчитываются от now. С dryRun ничего не меняется, отчет показывает,
+// что было бы сделано. Холодное хранилище архива и резервные копии не затрагиваются.
+type OrderPurger interface {
+	Purge(ctx context.Context, policy RetentionPolicy, now time.Time, dryRun bool) (*PurgeReport, error)
+}
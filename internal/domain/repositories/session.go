@@ -0,0 +1,41 @@
+package repositories
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// session - признак того, что в рамках запроса уже были изменения
+type session struct {
+	wrote atomic.Bool
+}
+
+type sessionKey struct{}
+
+// WithSession начинает в контексте сессию чтения своих записей: после первого
+// изменения через этот контекст чтения идут в основную базу, а не в реплики
+func WithSession(ctx context.Context) context.Context {
+	return context.WithValue(ctx, sessionKey{}, &session{})
+}
+
+// WithPrimaryReads возвращает контекст, все чтения через который идут в основную
+// базу. Нужен тем, кто реагирует на уже зафиксированные изменения (уведомления,
+// сверка кэша), когда реплика может их еще не получить.
+func WithPrimaryReads(ctx context.Context) context.Context {
+	s := &session{}
+	s.wrote.Store(true)
+	return context.WithValue(ctx, sessionKey{}, s)
+}
+
+// MarkWritten отмечает изменение в сессии контекста, если она есть
+func MarkWritten(ctx context.Context) {
+	if s, ok := ctx.Value(sessionKey{}).(*session); ok {
+		s.wrote.Store(true)
+	}
+}
+
+// ReadFromPrimary сообщает, что чтения через контекст должны идти в основную базу
+func ReadFromPrimary(ctx context.Context) bool {
+	s, ok := ctx.Value(sessionKey{}).(*session)
+	return ok && s.wrote.Load()
+}
@@ -0,0 +1,71 @@
+package cash
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+)
+
+// BloomFilter - вероятностное множество ключей: MayContain может ошибиться
+// в сторону "есть", но никогда не ошибается в сторону "нет".
+// Не потокобезопасен, синхронизация на стороне владельца.
+type BloomFilter struct {
+	bits []uint64
+	m    uint64
+	k    uint64
+}
+
+// NewBloomFilter подбирает размер фильтра под ожидаемое число ключей
+// и допустимую долю ложноположительных ответов
+func NewBloomFilter(expectedItems int, falsePositiveRate float64) *BloomFilter {
+	if expectedItems < 1 {
+		expectedItems = 1
+	}
+	if falsePositiveRate <= 0 || falsePositiveRate >= 1 {
+		falsePositiveRate = 0.01
+	}
+
+	n := float64(expectedItems)
+	m := uint64(math.Ceil(-n * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	if m < 64 {
+		m = 64
+	}
+	k := uint64(math.Round(float64(m) / n * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+
+	return &BloomFilter{
+		bits: make([]uint64, (m+63)/64),
+		m:    m,
+		k:    k,
+	}
+}
+
+func (f *BloomFilter) Add(key string) {
+	h1, h2 := bloomHashes(key)
+	for i := range f.k {
+		bit := (h1 + i*h2) % f.m
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+func (f *BloomFilter) MayContain(key string) bool {
+	h1, h2 := bloomHashes(key)
+	for i := range f.k {
+		bit := (h1 + i*h2) % f.m
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// bloomHashes возвращает две независимые половины 128-битного FNV,
+// из которых строятся k хэшей (схема Кирша-Митценмахера)
+func bloomHashes(key string) (uint64, uint64) {
+	hasher := fnv.New128a()
+	hasher.Write([]byte(key))
+	sum := hasher.Sum(nil)
+	return binary.BigEndian.Uint64(sum[:8]), binary.BigEndian.Uint64(sum[8:]) | 1
+}
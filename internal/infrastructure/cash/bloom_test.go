@@ -0,0 +1,83 @@
+package cash
+
+import (
+	"context"
+	"fmt"
+	"shop-microservice/internal/domain/model"
+	"shop-microservice/internal/domain/repositories"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBloomFilter_NoFalseNegatives(t *testing.T) {
+	filter := NewBloomFilter(1000, 0.01)
+
+	for i := range 1000 {
+		filter.Add(fmt.Sprintf("order-%d", i))
+	}
+
+	for i := range 1000 {
+		assert.True(t, filter.MayContain(fmt.Sprintf("order-%d", i)))
+	}
+}
+
+func TestBloomFilter_FalsePositiveRate(t *testing.T) {
+	filter := NewBloomFilter(1000, 0.01)
+	for i := range 1000 {
+		filter.Add(fmt.Sprintf("order-%d", i))
+	}
+
+	falsePositives := 0
+	for i := range 10000 {
+		if filter.MayContain(fmt.Sprintf("unknown-%d", i)) {
+			falsePositives++
+		}
+	}
+
+	// Допускаем трехкратный запас относительно расчетных 1%
+	assert.Less(t, falsePositives, 300)
+}
+
+func TestCash_MightExist(t *testing.T) {
+	cash := NewCash()
+
+	// До полной загрузки фильтра нет, отказывать нельзя
+	assert.True(t, cash.MightExist("unknown"))
+
+	cash.Load([]*model.Order{createTestOrder()})
+	assert.True(t, cash.MightExist("test-order-uid"))
+	assert.False(t, cash.MightExist("unknown"))
+
+	// Новые заказы попадают в фильтр при записи
+	order := createTestOrder()
+	order.OrderUID = "new-order"
+	cash.Set(order.OrderUID, order)
+	cash.Delete(order.OrderUID)
+	assert.True(t, cash.MightExist("new-order"))
+
+	// Очистка кэша не делает известные заказы неизвестными
+	cash.Clear()
+	assert.True(t, cash.MightExist("test-order-uid"))
+}
+
+func TestCachedOrderRepository_UnknownIDSkipsBackend(t *testing.T) {
+	order := createTestOrder()
+	backing := newCountingRepository(order)
+	cash := NewCash()
+	repo := NewCachedOrderRepository(backing, cash)
+	ctx := context.Background()
+
+	_, err := repo.FindAll(ctx)
+	require.NoError(t, err)
+	cash.Invalidate(order.OrderUID)
+
+	_, err = repo.FindByID(ctx, "random-id")
+	require.ErrorIs(t, err, repositories.ErrOrderNotFound)
+	assert.Equal(t, 0, backing.finds)
+
+	_, err = repo.FindByID(ctx, order.OrderUID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, backing.finds)
+}
@@ -4,25 +4,83 @@ import (
 	"context"
 	"log"
 	"shop-microservice/internal/domain/model"
+	"shop-microservice/internal/domain/repositories"
+	"strings"
 	"sync"
 	"time"
 )
 
+const (
+	minKnownCapacity    = 1024
+	knownFalsePositives = 0.01
+	warmUpBatchSize     = 1000
+)
+
 type Cash struct {
 	mu     sync.RWMutex
 	memory map[string]*model.Order
+	// loaded означает, что кэш содержит все заказы из базы
+	loaded bool
+	// fingerprints - хэш содержимого заказа в базе на момент загрузки
+	fingerprints map[string]string
+	// known - фильтр Блума всех OrderUID в базе, строится при полной загрузке
+	known *BloomFilter
+	// written - uid, измененные во время полной загрузки (nil вне загрузки):
+	// снимок базы мог их не застать, load оставляет их текущее состояние
+	written map[string]struct{}
+	// stale - во время загрузки кэш инвалидировали, после нее он не полный
+	stale bool
+
+	// вторичные индексы: значение поля -> множество OrderUID
+	byCustomer    map[string]map[string]struct{}
+	byTrack       map[string]map[string]struct{}
+	byTransaction map[string]map[string]struct{}
+	byNmID        map[int]map[string]struct{}
 }
 
 func NewCash() *Cash {
-	return &Cash{
-		memory: make(map[string]*model.Order),
-	}
+	cash := &Cash{}
+	cash.reset()
+	return cash
+}
+
+// reset пересоздает хранилище и индексы, вызывается под блокировкой
+func (cash *Cash) reset() {
+	cash.memory = make(map[string]*model.Order)
+	cash.fingerprints = make(map[string]string)
+	cash.byCustomer = make(map[string]map[string]struct{})
+	cash.byTrack = make(map[string]map[string]struct{})
+	cash.byTransaction = make(map[string]map[string]struct{})
+	cash.byNmID = make(map[int]map[string]struct{})
 }
 
 func (cash *Cash) Set(uid string, order *model.Order) {
 	cash.mu.Lock()
 	defer cash.mu.Unlock()
-	cash.memory[uid] = order
+	cash.put(uid, order)
+	cash.touch(uid)
+}
+
+// SetWithFingerprint сохраняет заказ вместе с хэшем его содержимого в базе
+func (cash *Cash) SetWithFingerprint(uid string, order *model.Order, fingerprint string) {
+	cash.mu.Lock()
+	defer cash.mu.Unlock()
+	cash.put(uid, order)
+	cash.fingerprints[uid] = fingerprint
+	cash.touch(uid)
+}
+
+// Fingerprints возвращает снимок ключей кэша с хэшами содержимого.
+// Пустой хэш означает, что заказ попал в кэш не из сверки (например, при записи).
+func (cash *Cash) Fingerprints() map[string]string {
+	cash.mu.RLock()
+	defer cash.mu.RUnlock()
+
+	fingerprints := make(map[string]string, len(cash.memory))
+	for uid := range cash.memory {
+		fingerprints[uid] = cash.fingerprints[uid]
+	}
+	return fingerprints
 }
 
 func (cash *Cash) Get(uid string) (*model.Order, bool) {
@@ -44,10 +102,206 @@ func (cash *Cash) GetAll() []*model.Order {
 	return orders
 }
 
+// GetByCustomer возвращает заказы покупателя из кэша
+func (cash *Cash) GetByCustomer(customerID string) []*model.Order {
+	cash.mu.RLock()
+	defer cash.mu.RUnlock()
+	return cash.collect(cash.byCustomer[customerID])
+}
+
+// GetByTrackNumber возвращает заказы с указанным трек-номером
+func (cash *Cash) GetByTrackNumber(trackNumber string) []*model.Order {
+	cash.mu.RLock()
+	defer cash.mu.RUnlock()
+	return cash.collect(cash.byTrack[trackNumber])
+}
+
+// GetByTransaction возвращает заказы по идентификатору платежной транзакции
+func (cash *Cash) GetByTransaction(transaction string) []*model.Order {
+	cash.mu.RLock()
+	defer cash.mu.RUnlock()
+	return cash.collect(cash.byTransaction[transaction])
+}
+
+// GetByNmID возвращает заказы, содержащие товар с указанным nm_id
+func (cash *Cash) GetByNmID(nmID int) []*model.Order {
+	cash.mu.RLock()
+	defer cash.mu.RUnlock()
+	return cash.collect(cash.byNmID[nmID])
+}
+
 func (cash *Cash) Delete(uid string) {
 	cash.mu.Lock()
 	defer cash.mu.Unlock()
-	delete(cash.memory, uid)
+	cash.remove(uid)
+	cash.touch(uid)
+}
+
+// Invalidate удаляет заказ из кэша, не зная, есть ли он в базе.
+// После этого кэш перестает считаться полным, а фильтр Блума
+// пропускает uid в базу (заказ мог только что появиться).
+func (cash *Cash) Invalidate(uid string) {
+	cash.mu.Lock()
+	defer cash.mu.Unlock()
+	cash.remove(uid)
+	cash.touch(uid)
+	cash.loaded = false
+	cash.stale = true
+	if cash.known != nil {
+		cash.known.Add(uid)
+	}
+}
+
+// InvalidatePrefix удаляет из кэша заказы, чей OrderUID начинается с prefix
+func (cash *Cash) InvalidatePrefix(prefix string) int {
+	cash.mu.Lock()
+	defer cash.mu.Unlock()
+
+	removed := 0
+	for uid := range cash.memory {
+		if strings.HasPrefix(uid, prefix) {
+			cash.remove(uid)
+			cash.touch(uid)
+			removed++
+		}
+	}
+	if removed > 0 {
+		cash.loaded = false
+		cash.stale = true
+	}
+	return removed
+}
+
+// InvalidateCustomer удаляет из кэша все заказы покупателя
+func (cash *Cash) InvalidateCustomer(customerID string) int {
+	cash.mu.Lock()
+	defer cash.mu.Unlock()
+
+	uids := make([]string, 0, len(cash.byCustomer[customerID]))
+	for uid := range cash.byCustomer[customerID] {
+		uids = append(uids, uid)
+	}
+	for _, uid := range uids {
+		cash.remove(uid)
+		cash.touch(uid)
+	}
+	if len(uids) > 0 {
+		cash.loaded = false
+		cash.stale = true
+	}
+	return len(uids)
+}
+
+// Keys возвращает до limit ключей кэша в произвольном порядке
+func (cash *Cash) Keys(limit int) []string {
+	cash.mu.RLock()
+	defer cash.mu.RUnlock()
+
+	if limit <= 0 || limit > len(cash.memory) {
+		limit = len(cash.memory)
+	}
+	keys := make([]string, 0, limit)
+	for uid := range cash.memory {
+		if len(keys) == limit {
+			break
+		}
+		keys = append(keys, uid)
+	}
+	return keys
+}
+
+// Load заменяет содержимое кэша полным списком заказов из базы
+func (cash *Cash) Load(orders []*model.Order) {
+	cash.load(orders, nil)
+}
+
+// beginLoad начинает полную загрузку: до load записи в кэш запоминаются, чтобы
+// снимок базы, прочитанный раньше них, их не затер
+func (cash *Cash) beginLoad() {
+	cash.mu.Lock()
+	defer cash.mu.Unlock()
+	cash.written = make(map[string]struct{})
+	cash.stale = false
+}
+
+// cancelLoad завершает загрузку, которая не дошла до load
+func (cash *Cash) cancelLoad() {
+	cash.mu.Lock()
+	defer cash.mu.Unlock()
+	cash.written = nil
+}
+
+// touch запоминает uid, измененный во время полной загрузки, вызывается под блокировкой
+func (cash *Cash) touch(uid string) {
+	if cash.written != nil {
+		cash.written[uid] = struct{}{}
+	}
+}
+
+// keptEntry - состояние заказа в кэше, измененного во время полной загрузки
+type keptEntry struct {
+	order       *model.Order
+	fingerprint string
+	exists      bool
+}
+
+func (cash *Cash) load(orders []*model.Order, fingerprints map[string]string) {
+	cash.mu.Lock()
+	defer cash.mu.Unlock()
+
+	// Записи, сделанные после beginLoad, свежее снимка: сохраняем их текущее состояние
+	kept := make(map[string]keptEntry, len(cash.written))
+	for uid := range cash.written {
+		order, exists := cash.memory[uid]
+		kept[uid] = keptEntry{order: order, fingerprint: cash.fingerprints[uid], exists: exists}
+	}
+	complete := !cash.stale || cash.written == nil
+
+	cash.reset()
+	// Запас по емкости, чтобы новые заказы не ухудшали точность до следующей загрузки
+	cash.known = NewBloomFilter(max(2*len(orders), minKnownCapacity), knownFalsePositives)
+	for _, order := range orders {
+		if order == nil {
+			continue
+		}
+		cash.put(order.OrderUID, order)
+		if fingerprint, ok := fingerprints[order.OrderUID]; ok {
+			cash.fingerprints[order.OrderUID] = fingerprint
+		}
+	}
+	for uid, entry := range kept {
+		cash.known.Add(uid)
+		if !entry.exists {
+			cash.remove(uid)
+			continue
+		}
+		cash.put(uid, entry.order)
+		if entry.fingerprint != "" {
+			cash.fingerprints[uid] = entry.fingerprint
+		}
+	}
+	cash.written = nil
+	cash.stale = false
+	cash.loaded = complete
+}
+
+// MightExist сообщает, может ли заказ существовать в базе.
+// false означает, что заказа точно нет; до первой полной загрузки всегда true.
+func (cash *Cash) MightExist(uid string) bool {
+	cash.mu.RLock()
+	defer cash.mu.RUnlock()
+
+	if _, exists := cash.memory[uid]; exists {
+		return true
+	}
+	return cash.known == nil || cash.known.MayContain(uid)
+}
+
+// Loaded сообщает, содержит ли кэш все заказы из базы
+func (cash *Cash) Loaded() bool {
+	cash.mu.RLock()
+	defer cash.mu.RUnlock()
+	return cash.loaded
 }
 
 func (cash *Cash) Size() int {
@@ -59,7 +313,9 @@ func (cash *Cash) Size() int {
 func (cash *Cash) Clear() {
 	cash.mu.Lock()
 	defer cash.mu.Unlock()
-	cash.memory = make(map[string]*model.Order)
+	cash.reset()
+	cash.loaded = false
+	cash.stale = true
 }
 
 // WarmUp заполняет кэш данными из репозитория при старте сервиса
@@ -68,30 +324,117 @@ func (cash *Cash) WarmUp(repo OrderRepository) error {
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
+	ctx = repositories.WithPrimaryReads(ctx)
+	cash.beginLoad()
+
+	// Хэши читаем до данных и из той же основной базы: если заказ изменится
+	// между запросами, сверка увидит расхождение и перечитает его
+	var fingerprints map[string]string
+	if source, ok := repo.(ReconcileSource); ok {
+		var err error
+		if fingerprints, err = source.Fingerprints(ctx); err != nil {
+			log.Printf("Warning: failed to load order fingerprints: %v", err)
+		}
+	}
 
-	orders, err := repo.FindAll(ctx)
+	var orders []*model.Order
+	err := repo.Stream(ctx, repositories.OrderFilter{}, warmUpBatchSize, func(batch []*model.Order) error {
+		orders = append(orders, batch...)
+		return nil
+	})
 	if err != nil {
+		cash.cancelLoad()
 		return err
 	}
 
-	cash.mu.Lock()
-	defer cash.mu.Unlock()
+	// Заменяем содержимое кэша снимком, сохраняя записи, сделанные во время загрузки
+	cash.load(orders, fingerprints)
 
-	// Очищаем текущий кэш перед заполнением
-	cash.memory = make(map[string]*model.Order)
+	log.Printf("Cache warm-up completed. Loaded %d orders in %v", len(orders), time.Since(start))
+	return nil
+}
 
-	for _, order := range orders {
-		if order != nil {
-			cash.memory[order.OrderUID] = order
+// put сохраняет заказ и обновляет индексы, вызывается под блокировкой.
+// Все пути записи (Set, Load) проходят через put, а удаления через remove,
+// поэтому индексы не расходятся с основным хранилищем.
+func (cash *Cash) put(uid string, order *model.Order) {
+	cash.remove(uid)
+	cash.memory[uid] = order
+	if cash.known != nil {
+		cash.known.Add(uid)
+	}
+	if order == nil {
+		return
+	}
+
+	addToIndex(cash.byCustomer, order.CustomerID, uid)
+	addToIndex(cash.byTrack, order.TrackNumber, uid)
+	if order.Payment != nil {
+		addToIndex(cash.byTransaction, order.Payment.Transaction, uid)
+	}
+	for _, item := range order.Items {
+		addToIndex(cash.byNmID, item.NmID, uid)
+	}
+}
+
+// remove удаляет заказ и все ссылки на него из индексов, вызывается под блокировкой
+func (cash *Cash) remove(uid string) {
+	order, exists := cash.memory[uid]
+	if !exists {
+		return
+	}
+	delete(cash.memory, uid)
+	delete(cash.fingerprints, uid)
+	if order == nil {
+		return
+	}
+
+	removeFromIndex(cash.byCustomer, order.CustomerID, uid)
+	removeFromIndex(cash.byTrack, order.TrackNumber, uid)
+	if order.Payment != nil {
+		removeFromIndex(cash.byTransaction, order.Payment.Transaction, uid)
+	}
+	for _, item := range order.Items {
+		removeFromIndex(cash.byNmID, item.NmID, uid)
+	}
+}
+
+func (cash *Cash) collect(uids map[string]struct{}) []*model.Order {
+	orders := make([]*model.Order, 0, len(uids))
+	for uid := range uids {
+		if order := cash.memory[uid]; order != nil {
+			orders = append(orders, order)
 		}
 	}
+	return orders
+}
 
-	log.Printf("Cache warm-up completed. Loaded %d orders in %v", len(orders), time.Since(start))
-	return nil
+func addToIndex[K comparable](index map[K]map[string]struct{}, key K, uid string) {
+	var zero K
+	if key == zero {
+		return
+	}
+	uids, ok := index[key]
+	if !ok {
+		uids = make(map[string]struct{})
+		index[key] = uids
+	}
+	uids[uid] = struct{}{}
+}
+
+func removeFromIndex[K comparable](index map[K]map[string]struct{}, key K, uid string) {
+	uids, ok := index[key]
+	if !ok {
+		return
+	}
+	delete(uids, uid)
+	if len(uids) == 0 {
+		delete(index, key)
+	}
 }
 
 // OrderRepository интерфейс для доступа к данным заказов
 type OrderRepository interface {
-	FindAll(ctx context.Context) ([]*model.Order, error)
 	FindByID(ctx context.Context, uid string) (*model.Order, error)
+	Stream(ctx context.Context, filter repositories.OrderFilter, batchSize int, fn func(batch []*model.Order) error) error
 }
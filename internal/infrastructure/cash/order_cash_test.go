@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"shop-microservice/internal/domain/model"
+	"shop-microservice/internal/domain/repositories"
+	"slices"
 	"testing"
 	"time"
 
@@ -14,6 +16,8 @@ import (
 type MockOrderRepository struct {
 	orders []*model.Order
 	err    error
+	// onStream вызывается перед выгрузкой, как запись, идущая параллельно прогреву
+	onStream func()
 }
 
 func (m *MockOrderRepository) FindAll(ctx context.Context) ([]*model.Order, error) {
@@ -35,6 +39,31 @@ func (m *MockOrderRepository) FindByID(ctx context.Context, uid string) (*model.
 	return nil, errors.New("order not found")
 }
 
+func (m *MockOrderRepository) Stream(ctx context.Context, filter repositories.OrderFilter, batchSize int, fn func(batch []*model.Order) error) error {
+	if m.err != nil {
+		return m.err
+	}
+	if m.onStream != nil {
+		m.onStream()
+	}
+	return streamOrders(m.orders, filter, fn)
+}
+
+// streamOrders отдает заказы одной пачкой с учетом фильтра по OrderUID
+func streamOrders(orders []*model.Order, filter repositories.OrderFilter, fn func(batch []*model.Order) error) error {
+	var batch []*model.Order
+	for _, order := range orders {
+		if len(filter.OrderUIDs) > 0 && !slices.Contains(filter.OrderUIDs, order.OrderUID) {
+			continue
+		}
+		batch = append(batch, order)
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+	return fn(batch)
+}
+
 func TestCash_SetAndGet(t *testing.T) {
 	cash := NewCash()
 	order := createTestOrder()
@@ -159,6 +188,56 @@ func TestCash_WarmUp_Success(t *testing.T) {
 	assert.Equal(t, order2.OrderUID, result2.OrderUID)
 }
 
+func TestCash_WarmUp_KeepsWritesMadeDuringLoad(t *testing.T) {
+	cash := NewCash()
+
+	stored := createTestOrder()
+	removed := createTestOrder()
+	removed.OrderUID = "removed-during-warm-up"
+	created := createTestOrder()
+	created.OrderUID = "created-during-warm-up"
+	updated := createTestOrder()
+	updated.TrackNumber = "UPDATED"
+
+	// Снимок базы прочитан до записей, сделанных параллельно прогреву
+	mockRepo := &MockOrderRepository{
+		orders: []*model.Order{stored, removed},
+		onStream: func() {
+			cash.Set(created.OrderUID, created)
+			cash.Set(updated.OrderUID, updated)
+			cash.Delete(removed.OrderUID)
+		},
+	}
+	require.NoError(t, cash.WarmUp(mockRepo))
+
+	assert.True(t, cash.Loaded())
+	assert.True(t, cash.MightExist(created.OrderUID))
+	found, exists := cash.Get(created.OrderUID)
+	require.True(t, exists)
+	assert.Equal(t, created, found)
+	found, exists = cash.Get(stored.OrderUID)
+	require.True(t, exists)
+	assert.Equal(t, "UPDATED", found.TrackNumber)
+	_, exists = cash.Get(removed.OrderUID)
+	assert.False(t, exists)
+}
+
+func TestCash_WarmUp_InvalidateDuringLoad(t *testing.T) {
+	cash := NewCash()
+	order := createTestOrder()
+
+	mockRepo := &MockOrderRepository{
+		orders:   []*model.Order{order},
+		onStream: func() { cash.Invalidate("maybe-new") },
+	}
+	require.NoError(t, cash.WarmUp(mockRepo))
+
+	// Инвалидированный заказ мог появиться в базе: кэш не полный, фильтр его пропускает
+	assert.False(t, cash.Loaded())
+	assert.True(t, cash.MightExist("maybe-new"))
+	assert.Equal(t, 1, cash.Size())
+}
+
 func TestCash_WarmUp_EmptyRepository(t *testing.T) {
 	cash := NewCash()
 
@@ -278,6 +357,127 @@ func TestCash_NilOrderHandling(t *testing.T) {
 	assert.Equal(t, 1, cash.Size())
 }
 
+func TestCash_SecondaryIndexes(t *testing.T) {
+	cash := NewCash()
+
+	order1 := createTestOrder()
+	order2 := createTestOrder()
+	order2.OrderUID = "test-order-uid-2"
+	order2.TrackNumber = "TEST456"
+	order2.Payment.Transaction = "test-transaction-2"
+	order2.Items[0].NmID = 777
+
+	cash.Set(order1.OrderUID, order1)
+	cash.Set(order2.OrderUID, order2)
+
+	assert.Len(t, cash.GetByCustomer("test-customer"), 2)
+	assert.Empty(t, cash.GetByCustomer("unknown-customer"))
+
+	byTrack := cash.GetByTrackNumber("TEST456")
+	require.Len(t, byTrack, 1)
+	assert.Equal(t, order2.OrderUID, byTrack[0].OrderUID)
+
+	byTransaction := cash.GetByTransaction("test-transaction")
+	require.Len(t, byTransaction, 1)
+	assert.Equal(t, order1.OrderUID, byTransaction[0].OrderUID)
+
+	byNmID := cash.GetByNmID(777)
+	require.Len(t, byNmID, 1)
+	assert.Equal(t, order2.OrderUID, byNmID[0].OrderUID)
+}
+
+func TestCash_SecondaryIndexes_OverwriteAndDelete(t *testing.T) {
+	cash := NewCash()
+	order := createTestOrder()
+	cash.Set(order.OrderUID, order)
+
+	// Перезапись заказа должна убрать старые значения из индексов
+	modified := createTestOrder()
+	modified.CustomerID = "other-customer"
+	modified.TrackNumber = "MODIFIED123"
+	cash.Set(order.OrderUID, modified)
+
+	assert.Empty(t, cash.GetByCustomer("test-customer"))
+	assert.Empty(t, cash.GetByTrackNumber("TEST123"))
+	assert.Len(t, cash.GetByCustomer("other-customer"), 1)
+	assert.Len(t, cash.GetByTrackNumber("MODIFIED123"), 1)
+
+	cash.Delete(order.OrderUID)
+
+	assert.Empty(t, cash.GetByCustomer("other-customer"))
+	assert.Empty(t, cash.GetByTransaction("test-transaction"))
+	assert.Empty(t, cash.GetByNmID(order.Items[0].NmID))
+}
+
+func TestCash_SecondaryIndexes_ClearAndWarmUp(t *testing.T) {
+	cash := NewCash()
+	stale := createTestOrder()
+	stale.OrderUID = "stale-order"
+	stale.CustomerID = "stale-customer"
+	cash.Set(stale.OrderUID, stale)
+
+	mockRepo := &MockOrderRepository{
+		orders: []*model.Order{createTestOrder()},
+	}
+
+	require.NoError(t, cash.WarmUp(mockRepo))
+
+	assert.Empty(t, cash.GetByCustomer("stale-customer"))
+	assert.Len(t, cash.GetByCustomer("test-customer"), 1)
+
+	cash.Clear()
+	assert.Empty(t, cash.GetByCustomer("test-customer"))
+	assert.Empty(t, cash.GetByTrackNumber("TEST123"))
+}
+
+func TestCash_InvalidatePrefixAndCustomer(t *testing.T) {
+	cash := NewCash()
+
+	order1 := createTestOrder()
+	order2 := createTestOrder()
+	order2.OrderUID = "test-order-uid-2"
+	order3 := createTestOrder()
+	order3.OrderUID = "other-order"
+	order3.CustomerID = "other-customer"
+	cash.Load([]*model.Order{order1, order2, order3})
+
+	assert.Equal(t, 2, cash.InvalidatePrefix("test-order"))
+	assert.Equal(t, 1, cash.Size())
+	assert.False(t, cash.Loaded())
+	assert.Empty(t, cash.GetByCustomer("test-customer"))
+
+	assert.Equal(t, 0, cash.InvalidateCustomer("test-customer"))
+	assert.Equal(t, 1, cash.InvalidateCustomer("other-customer"))
+	assert.Equal(t, 0, cash.Size())
+}
+
+func TestCash_Keys(t *testing.T) {
+	cash := NewCash()
+	assert.Empty(t, cash.Keys(10))
+
+	for _, uid := range []string{"a", "b", "c"} {
+		order := createTestOrder()
+		order.OrderUID = uid
+		cash.Set(uid, order)
+	}
+
+	assert.Len(t, cash.Keys(2), 2)
+	assert.ElementsMatch(t, []string{"a", "b", "c"}, cash.Keys(0))
+}
+
+func TestCash_DraftOrder(t *testing.T) {
+	cash := NewCash()
+	draft := createTestOrder()
+	draft.Payment = nil
+
+	cash.Set(draft.OrderUID, draft)
+	assert.Len(t, cash.GetByCustomer(draft.CustomerID), 1)
+	assert.Empty(t, cash.GetByTransaction(""))
+
+	cash.Delete(draft.OrderUID)
+	assert.Equal(t, 0, cash.Size())
+}
+
 func createTestOrder() *model.Order {
 	return &model.Order{
 		OrderUID:          "test-order-uid",
@@ -291,7 +491,7 @@ func createTestOrder() *model.Order {
 		SmID:              99,
 		DateCreated:       time.Now(),
 		OofShard:          "1",
-		Delivery: model.Delivery{
+		Delivery: &model.Delivery{
 			Name:    "Test Testov",
 			Phone:   "+9720000000",
 			Zip:     "2639809",
@@ -300,7 +500,7 @@ func createTestOrder() *model.Order {
 			Region:  "Kraiot",
 			Email:   "test@gmail.com",
 		},
-		Payment: model.Payment{
+		Payment: &model.Payment{
 			Transaction:  "test-transaction",
 			RequestID:    "",
 			Currency:     "USD",
@@ -0,0 +1,210 @@
+package cash
+
+import (
+	"context"
+	"errors"
+	"log"
+	"shop-microservice/internal/domain/model"
+	"shop-microservice/internal/domain/repositories"
+	"sync"
+	"time"
+)
+
+// reconcileBatchSize - сколько расходящихся заказов перечитывается одним запросом
+const reconcileBatchSize = 500
+
+// ReconcileSource - источник истины для сверки кэша. Fingerprints - дешевые
+// отпечатки заказов (версия и время изменения), их сравнивает каждый проход.
+type ReconcileSource interface {
+	OrderRepository
+	Fingerprints(ctx context.Context) (map[string]string, error)
+}
+
+// ContentVerifier - источник, умеющий хэшировать заказы целиком. Это дорого,
+// поэтому такие хэши считаются только для проверки по требованию (VerifyOnce).
+type ContentVerifier interface {
+	ContentFingerprints(ctx context.Context) (map[string]string, error)
+}
+
+// errVerifyNotSupported - источник не умеет хэшировать заказы целиком
+var errVerifyNotSupported = errors.New("content verification is not supported by the source")
+
+// ReconcileReport - результат одного прохода сверки.
+// Stale - записи с отпечатком, отличным от базы; Unverified - записи без отпечатка
+// (попали в кэш при записи или чтении), их тоже перечитывают, но расхождением не
+// считают; Changed - заказы, чье содержимое изменилось в обход сервиса (VerifyOnce).
+type ReconcileReport struct {
+	Checked    int           `json:"checked"`
+	Stale      int           `json:"stale"`
+	Unverified int           `json:"unverified"`
+	Changed    int           `json:"changed"`
+	Missing    int           `json:"missing"`
+	Orphaned   int           `json:"orphaned"`
+	Repaired   int           `json:"repaired"`
+	Failed     int           `json:"failed"`
+	Duration   time.Duration `json:"duration"`
+}
+
+// Reconciler периодически сверяет кэш с базой и исправляет расхождения
+type Reconciler struct {
+	cash     *Cash
+	source   ReconcileSource
+	interval time.Duration
+
+	// verified - хэши содержимого с прошлой проверки по требованию
+	mu       sync.Mutex
+	verified map[string]string
+}
+
+func NewReconciler(cash *Cash, source ReconcileSource, interval time.Duration) *Reconciler {
+	return &Reconciler{
+		cash:     cash,
+		source:   source,
+		interval: interval,
+	}
+}
+
+// Run запускает сверку по таймеру до отмены контекста
+func (r *Reconciler) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report, err := r.ReconcileOnce(ctx)
+			if err != nil {
+				log.Printf("Cache reconciliation failed: %v", err)
+				continue
+			}
+			log.Printf("Cache reconciliation completed: checked=%d stale=%d unverified=%d missing=%d orphaned=%d repaired=%d failed=%d in %v",
+				report.Checked, report.Stale, report.Unverified, report.Missing, report.Orphaned, report.Repaired, report.Failed, report.Duration)
+		}
+	}
+}
+
+// ReconcileOnce сравнивает отпечатки заказов в кэше и в базе:
+// устаревшие и отсутствующие записи перечитываются, лишние удаляются.
+// Отпечатки и заказы читаются из основной базы, чтобы отставшая реплика не
+// вернула в кэш старые версии.
+func (r *Reconciler) ReconcileOnce(ctx context.Context) (ReconcileReport, error) {
+	return r.reconcile(repositories.WithPrimaryReads(ctx), nil)
+}
+
+// VerifyOnce - сверка по требованию, которая видит и изменения в обход сервиса:
+// ручной SQL не меняет версию, и ReconcileOnce его пропускает. Заказы хэшируются
+// целиком, и те, чей хэш изменился с прошлой проверки, перечитываются вместе с
+// обычными расхождениями; первая проверка перечитывает все заказы.
+func (r *Reconciler) VerifyOnce(ctx context.Context) (ReconcileReport, error) {
+	verifier, ok := r.source.(ContentVerifier)
+	if !ok {
+		return ReconcileReport{}, errVerifyNotSupported
+	}
+
+	ctx = repositories.WithPrimaryReads(ctx)
+	content, err := verifier.ContentFingerprints(ctx)
+	if err != nil {
+		return ReconcileReport{}, err
+	}
+
+	r.mu.Lock()
+	previous := r.verified
+	r.mu.Unlock()
+
+	changed := make(map[string]bool)
+	for uid, hash := range content {
+		if previous[uid] != hash {
+			changed[uid] = true
+		}
+	}
+
+	report, err := r.reconcile(ctx, changed)
+	// Неперечитанные заказы остаются измененными до следующей проверки
+	if err == nil && report.Failed == 0 {
+		r.mu.Lock()
+		r.verified = content
+		r.mu.Unlock()
+	}
+	return report, err
+}
+
+// reconcile - проход сверки; changed - заказы, которые перечитываются, даже если
+// их отпечаток совпадает с кэшем
+func (r *Reconciler) reconcile(ctx context.Context, changed map[string]bool) (ReconcileReport, error) {
+	start := time.Now()
+	var report ReconcileReport
+
+	dbFingerprints, err := r.source.Fingerprints(ctx)
+	if err != nil {
+		return report, err
+	}
+	cached := r.cash.Fingerprints()
+
+	var toLoad []string
+	for uid, fingerprint := range dbFingerprints {
+		report.Checked++
+		cachedFingerprint, exists := cached[uid]
+		switch {
+		case !exists:
+			report.Missing++
+			toLoad = append(toLoad, uid)
+		case cachedFingerprint == "":
+			report.Unverified++
+			toLoad = append(toLoad, uid)
+		case cachedFingerprint != fingerprint:
+			report.Stale++
+			toLoad = append(toLoad, uid)
+		case changed[uid]:
+			report.Changed++
+			toLoad = append(toLoad, uid)
+		}
+	}
+
+	for len(toLoad) > 0 {
+		chunk := toLoad[:min(reconcileBatchSize, len(toLoad))]
+		toLoad = toLoad[len(chunk):]
+
+		loaded := 0
+		err := r.source.Stream(ctx, repositories.OrderFilter{OrderUIDs: chunk}, reconcileBatchSize,
+			func(batch []*model.Order) error {
+				for _, order := range batch {
+					r.cash.SetWithFingerprint(order.OrderUID, order, dbFingerprints[order.OrderUID])
+				}
+				loaded += len(batch)
+				return nil
+			})
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return report, ctxErr
+			}
+			report.Failed += len(chunk) - loaded
+			report.Repaired += loaded
+			continue
+		}
+		report.Repaired += loaded
+		// Заказ удален между снимком хэшей и загрузкой - уберем на следующем проходе
+		report.Failed += len(chunk) - loaded
+	}
+
+	for uid := range cached {
+		if _, exists := dbFingerprints[uid]; exists {
+			continue
+		}
+		// Заказ мог появиться в базе после снимка хэшей, поэтому перед
+		// удалением убеждаемся, что его действительно нет.
+		_, err := r.source.FindByID(ctx, uid)
+		switch {
+		case errors.Is(err, repositories.ErrOrderNotFound):
+			report.Orphaned++
+			r.cash.Delete(uid)
+			report.Repaired++
+		case err != nil:
+			report.Failed++
+		}
+	}
+
+	report.Duration = time.Since(start)
+	return report, nil
+}
@@ -0,0 +1,235 @@
+package cash
+
+import (
+	"context"
+	"errors"
+	"shop-microservice/internal/domain/model"
+	"shop-microservice/internal/domain/repositories"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fingerprintRepository struct {
+	orders       map[string]*model.Order
+	fingerprints map[string]string
+	err          error
+	// replica - устаревшие заказы, которые отдает реплика при чтении не из основной базы
+	replica map[string]*model.Order
+	// content - хэши содержимого заказов для VerifyOnce
+	content map[string]string
+}
+
+// read возвращает заказы основной базы или реплики, куда бы ушло чтение с ctx
+func (r *fingerprintRepository) read(ctx context.Context) map[string]*model.Order {
+	if r.replica != nil && !repositories.ReadFromPrimary(ctx) {
+		return r.replica
+	}
+	return r.orders
+}
+
+func (r *fingerprintRepository) FindAll(ctx context.Context) ([]*model.Order, error) {
+	orders := make([]*model.Order, 0, len(r.orders))
+	for _, order := range r.read(ctx) {
+		orders = append(orders, order)
+	}
+	return orders, nil
+}
+
+func (r *fingerprintRepository) FindByID(ctx context.Context, uid string) (*model.Order, error) {
+	order, ok := r.read(ctx)[uid]
+	if !ok {
+		return nil, repositories.ErrOrderNotFound
+	}
+	return order, nil
+}
+
+func (r *fingerprintRepository) Stream(ctx context.Context, filter repositories.OrderFilter, batchSize int, fn func(batch []*model.Order) error) error {
+	orders, err := r.FindAll(ctx)
+	if err != nil {
+		return err
+	}
+	return streamOrders(orders, filter, fn)
+}
+
+func (r *fingerprintRepository) Fingerprints(ctx context.Context) (map[string]string, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	return r.fingerprints, nil
+}
+
+func (r *fingerprintRepository) ContentFingerprints(ctx context.Context) (map[string]string, error) {
+	return r.content, nil
+}
+
+func TestReconciler_ReconcileOnce(t *testing.T) {
+	fresh := createTestOrder()
+	fresh.OrderUID = "fresh"
+	stale := createTestOrder()
+	stale.OrderUID = "stale"
+	missing := createTestOrder()
+	missing.OrderUID = "missing"
+	orphan := createTestOrder()
+	orphan.OrderUID = "orphan"
+
+	updatedStale := createTestOrder()
+	updatedStale.OrderUID = "stale"
+	updatedStale.TrackNumber = "UPDATED"
+
+	source := &fingerprintRepository{
+		orders: map[string]*model.Order{
+			"fresh":   fresh,
+			"stale":   updatedStale,
+			"missing": missing,
+		},
+		fingerprints: map[string]string{
+			"fresh":   "h1",
+			"stale":   "h2-new",
+			"missing": "h3",
+		},
+	}
+
+	cash := NewCash()
+	cash.SetWithFingerprint("fresh", fresh, "h1")
+	cash.SetWithFingerprint("stale", stale, "h2")
+	cash.Set("orphan", orphan)
+
+	reconciler := NewReconciler(cash, source, 0)
+	report, err := reconciler.ReconcileOnce(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, report.Checked)
+	assert.Equal(t, 1, report.Stale)
+	assert.Equal(t, 1, report.Missing)
+	assert.Equal(t, 1, report.Orphaned)
+	assert.Equal(t, 3, report.Repaired)
+	assert.Equal(t, 0, report.Failed)
+
+	result, exists := cash.Get("stale")
+	require.True(t, exists)
+	assert.Equal(t, "UPDATED", result.TrackNumber)
+
+	_, exists = cash.Get("missing")
+	assert.True(t, exists)
+
+	_, exists = cash.Get("orphan")
+	assert.False(t, exists)
+
+	// Повторная сверка не находит расхождений
+	report, err = reconciler.ReconcileOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, report.Stale+report.Missing+report.Orphaned)
+}
+
+func TestReconciler_WriteThroughEntryIsReloaded(t *testing.T) {
+	order := createTestOrder()
+	source := &fingerprintRepository{
+		orders:       map[string]*model.Order{order.OrderUID: order},
+		fingerprints: map[string]string{order.OrderUID: "h1"},
+	}
+
+	cash := NewCash()
+	cash.Set(order.OrderUID, order)
+
+	report, err := NewReconciler(cash, source, 0).ReconcileOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, report.Stale)
+	assert.Equal(t, 1, report.Unverified)
+	assert.Equal(t, 1, report.Repaired)
+	assert.Equal(t, "h1", cash.Fingerprints()[order.OrderUID])
+}
+
+func TestReconciler_VerifyOnce(t *testing.T) {
+	order := createTestOrder()
+	source := &fingerprintRepository{
+		orders:       map[string]*model.Order{order.OrderUID: order},
+		fingerprints: map[string]string{order.OrderUID: "v1"},
+		content:      map[string]string{order.OrderUID: "md5-a"},
+	}
+
+	cash := NewCash()
+	reconciler := NewReconciler(cash, source, 0)
+	_, err := reconciler.ReconcileOnce(context.Background())
+	require.NoError(t, err)
+
+	// Первая проверка перечитывает все заказы, повторная без изменений - ничего
+	report, err := reconciler.VerifyOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Changed)
+	report, err = reconciler.VerifyOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, report.Changed)
+	assert.Equal(t, 0, report.Repaired)
+
+	// Ручной SQL меняет содержимое, но не версию: обычная сверка его не видит
+	edited := createTestOrder()
+	edited.TrackNumber = "EDITED BY HAND"
+	source.orders[order.OrderUID] = edited
+	source.content = map[string]string{order.OrderUID: "md5-b"}
+
+	report, err = reconciler.ReconcileOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, report.Repaired)
+
+	report, err = reconciler.VerifyOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Changed)
+	assert.Equal(t, 1, report.Repaired)
+
+	cached, exists := cash.Get(order.OrderUID)
+	require.True(t, exists)
+	assert.Equal(t, "EDITED BY HAND", cached.TrackNumber)
+}
+
+func TestCash_StaleReplicaIsNotCached(t *testing.T) {
+	primary := createTestOrder()
+	primary.TrackNumber = "PRIMARY"
+	primary.Version = 2
+	stale := createTestOrder()
+	stale.TrackNumber = "REPLICA"
+	stale.Version = 1
+	source := &fingerprintRepository{
+		orders:       map[string]*model.Order{primary.OrderUID: primary},
+		fingerprints: map[string]string{primary.OrderUID: "h2"},
+		replica:      map[string]*model.Order{stale.OrderUID: stale},
+	}
+
+	cash := NewCash()
+	require.NoError(t, cash.WarmUp(source))
+	cached, exists := cash.Get(primary.OrderUID)
+	require.True(t, exists)
+	assert.Equal(t, "PRIMARY", cached.TrackNumber, "прогрев не должен брать заказы с реплики")
+
+	cash = NewCash()
+	_, err := NewReconciler(cash, source, 0).ReconcileOnce(context.Background())
+	require.NoError(t, err)
+	cached, exists = cash.Get(primary.OrderUID)
+	require.True(t, exists)
+	assert.Equal(t, "PRIMARY", cached.TrackNumber, "сверка не должна брать заказы с реплики")
+}
+
+func TestCash_WarmUp_LoadsFingerprints(t *testing.T) {
+	order := createTestOrder()
+	source := &fingerprintRepository{
+		orders:       map[string]*model.Order{order.OrderUID: order},
+		fingerprints: map[string]string{order.OrderUID: "h1"},
+	}
+
+	cash := NewCash()
+	require.NoError(t, cash.WarmUp(source))
+
+	report, err := NewReconciler(cash, source, 0).ReconcileOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, report.Stale)
+	assert.Equal(t, 0, report.Repaired)
+}
+
+func TestReconciler_SourceError(t *testing.T) {
+	source := &fingerprintRepository{err: errors.New("database connection failed")}
+
+	_, err := NewReconciler(NewCash(), source, 0).ReconcileOnce(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "database connection failed")
+}
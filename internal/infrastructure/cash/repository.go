@@ -0,0 +1,290 @@
+package cash
+
+import (
+	"context"
+	"errors"
+	"shop-microservice/internal/domain/model"
+	"shop-microservice/internal/domain/repositories"
+	"time"
+)
+
+// CachedOrderRepository - декоратор над репозиторием заказов.
+// Чтение идет через кэш (read-through), запись сначала в репозиторий,
+// затем в кэш (write-through). Все потребители (HTTP, Kafka, админка)
+// получают одинаковое поведение кэширования.
+type CachedOrderRepository struct {
+	repo repositories.OrderRepository
+	cash *Cash
+}
+
+var (
+	_ repositories.OrderRepository = (*CachedOrderRepository)(nil)
+	_ repositories.BulkImporter    = (*CachedOrderRepository)(nil)
+	_ repositories.CustomerEraser  = (*CachedOrderRepository)(nil)
+)
+
+// errErasureNotSupported - репозиторий не умеет стирать данные покупателей
+var errErasureNotSupported = errors.New("customer erasure is not supported by the repository")
+
+func NewCachedOrderRepository(repo repositories.OrderRepository, cash *Cash) *CachedOrderRepository {
+	return &CachedOrderRepository{
+		repo: repo,
+		cash: cash,
+	}
+}
+
+// Create создает заказ в репозитории и кладет его в кэш
+func (r *CachedOrderRepository) Create(ctx context.Context, order *model.Order) error {
+	if err := r.repo.Create(ctx, order); err != nil {
+		// Конфликт ничего не меняет в базе, кэш остается актуальным
+		if !errors.Is(err, repositories.ErrOrderExists) {
+			r.cash.Invalidate(order.OrderUID)
+		}
+		return err
+	}
+
+	r.cash.Set(order.OrderUID, order)
+	return nil
+}
+
+// Save сохраняет заказ в репозитории и обновляет кэш
+func (r *CachedOrderRepository) Save(ctx context.Context, order *model.Order) error {
+	if err := r.repo.Save(ctx, order); err != nil {
+		// Состояние записи в базе неизвестно, старую копию держать нельзя
+		r.cash.Invalidate(order.OrderUID)
+		return err
+	}
+
+	r.cash.Set(order.OrderUID, order)
+	return nil
+}
+
+// Update изменяет заказ в репозитории и кладет новое состояние в кэш
+func (r *CachedOrderRepository) Update(ctx context.Context, uid string, expectedVersion int64, mutate func(order *model.Order) error) (*model.Order, error) {
+	var mutateErr error
+	order, err := r.repo.Update(ctx, uid, expectedVersion, func(order *model.Order) error {
+		mutateErr = mutate(order)
+		return mutateErr
+	})
+	if err != nil {
+		// Ошибка в mutate означает, что до записи дело не дошло
+		if mutateErr == nil {
+			r.forget(uid, err)
+		}
+		return nil, err
+	}
+
+	r.cash.Set(uid, order)
+	return order, nil
+}
+
+// Delete удаляет заказ из репозитория и из кэша
+func (r *CachedOrderRepository) Delete(ctx context.Context, uid string, expectedVersion int64) error {
+	if err := r.repo.Delete(ctx, uid, expectedVersion); err != nil {
+		r.forget(uid, err)
+		return err
+	}
+
+	r.cash.Delete(uid)
+	return nil
+}
+
+// ChangeStatus меняет статус заказа в репозитории и кладет новое состояние в кэш
+func (r *CachedOrderRepository) ChangeStatus(ctx context.Context, uid string, transition repositories.StatusTransition) (*model.Order, *model.StatusChange, error) {
+	order, change, err := r.repo.ChangeStatus(ctx, uid, transition)
+	if err != nil {
+		// Отказ в переходе мог быть вызван устаревшей копией, перечитаем ее
+		r.forget(uid, err)
+		return nil, nil, err
+	}
+
+	r.cash.Set(uid, order)
+	return order, change, nil
+}
+
+// StatusHistory читает историю статусов напрямую из репозитория
+func (r *CachedOrderRepository) StatusHistory(ctx context.Context, uid string) ([]model.StatusChange, error) {
+	return r.repo.StatusHistory(ctx, uid)
+}
+
+// AuditHistory читает журнал изменений напрямую из репозитория
+func (r *CachedOrderRepository) AuditHistory(ctx context.Context, uid string) ([]model.AuditEntry, error) {
+	return r.repo.AuditHistory(ctx, uid)
+}
+
+// OrderAsOf читает прошлое состояние заказа напрямую из репозитория
+func (r *CachedOrderRepository) OrderAsOf(ctx context.Context, uid string, at time.Time) (*model.Order, error) {
+	return r.repo.OrderAsOf(ctx, uid, at)
+}
+
+// OrderAtVersion читает прошлую версию заказа напрямую из репозитория
+func (r *CachedOrderRepository) OrderAtVersion(ctx context.Context, uid string, version int64) (*model.Order, error) {
+	return r.repo.OrderAtVersion(ctx, uid, version)
+}
+
+// UpdateItemStatuses меняет статусы товаров и кладет затронутые заказы в кэш.
+// При ошибке транзакция откатывается целиком, кэш остается актуальным.
+func (r *CachedOrderRepository) UpdateItemStatuses(ctx context.Context, updates []repositories.ItemStatusUpdate, reason string) (*repositories.ItemStatusResult, error) {
+	result, err := r.repo.UpdateItemStatuses(ctx, updates, reason)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, order := range result.Orders {
+		r.cash.Set(order.OrderUID, order)
+	}
+	return result, nil
+}
+
+// Import загружает заказы пачкой, если это умеет репозиторий, и сбрасывает их копии в кэше
+func (r *CachedOrderRepository) Import(ctx context.Context, orders []*model.Order) error {
+	bulk, ok := r.repo.(repositories.BulkImporter)
+	if !ok {
+		return errors.New("bulk import is not supported by the repository")
+	}
+
+	if err := bulk.Import(ctx, orders); err != nil {
+		return err
+	}
+
+	// Версии и статусы назначает база, поэтому заказы перечитываются при обращении
+	for _, order := range orders {
+		r.cash.Invalidate(order.OrderUID)
+	}
+	return nil
+}
+
+// RequestErasure ставит заявку на стирание данных покупателя, если это умеет репозиторий
+func (r *CachedOrderRepository) RequestErasure(ctx context.Context, customerID string) (*repositories.ErasureJob, error) {
+	eraser, ok := r.repo.(repositories.CustomerEraser)
+	if !ok {
+		return nil, errErasureNotSupported
+	}
+	return eraser.RequestErasure(ctx, customerID)
+}
+
+// ErasureJob возвращает заявку на стирание из репозитория
+func (r *CachedOrderRepository) ErasureJob(ctx context.Context, id int64) (*repositories.ErasureJob, error) {
+	eraser, ok := r.repo.(repositories.CustomerEraser)
+	if !ok {
+		return nil, errErasureNotSupported
+	}
+	return eraser.ErasureJob(ctx, id)
+}
+
+// ProcessErasure выполняет заявку на стирание и сбрасывает заказы покупателя в кэше
+func (r *CachedOrderRepository) ProcessErasure(ctx context.Context) (*repositories.ErasureJob, []string, error) {
+	eraser, ok := r.repo.(repositories.CustomerEraser)
+	if !ok {
+		return nil, nil, errErasureNotSupported
+	}
+
+	job, uids, err := eraser.ProcessErasure(ctx)
+	if job != nil && job.Status == repositories.ErasureDone {
+		r.cash.InvalidateCustomer(job.CustomerID)
+		for _, uid := range uids {
+			r.cash.Invalidate(uid)
+		}
+	}
+	return job, uids, err
+}
+
+// FindByID ищет заказ в кэше, при промахе загружает из репозитория
+func (r *CachedOrderRepository) FindByID(ctx context.Context, uid string) (*model.Order, error) {
+	if order, exists := r.cash.Get(uid); exists && order != nil {
+		return order, nil
+	}
+
+	if !r.cash.MightExist(uid) {
+		return nil, repositories.ErrOrderNotFound
+	}
+
+	// Промах заполняет кэш, поэтому заказ читается из основной базы: копия
+	// с отстающей реплики затерла бы в кэше более новую запись
+	order, err := r.repo.FindByID(repositories.WithPrimaryReads(ctx), uid)
+	if err != nil {
+		return nil, err
+	}
+
+	r.cash.Set(uid, order)
+	return order, nil
+}
+
+// FindAll отдает заказы из кэша, если он полный, иначе загружает их из репозитория
+func (r *CachedOrderRepository) FindAll(ctx context.Context) ([]*model.Order, error) {
+	if r.cash.Loaded() {
+		return r.cash.GetAll(), nil
+	}
+
+	// Полную загрузку читаем из основной базы: отстающая реплика оставила бы
+	// в кэше устаревшие заказы, которые он потом считает полными
+	r.cash.beginLoad()
+	orders, err := r.repo.FindAll(repositories.WithPrimaryReads(ctx))
+	if err != nil {
+		r.cash.cancelLoad()
+		return nil, err
+	}
+
+	r.cash.load(orders, nil)
+	return orders, nil
+}
+
+// List отдает страницу заказов из репозитория: порядок и фильтры
+// обеспечивает база, кэш для этого не предназначен
+func (r *CachedOrderRepository) List(ctx context.Context, opts repositories.ListOptions) (*repositories.OrderPage, error) {
+	return r.repo.List(ctx, opts)
+}
+
+// Stream передает заказы из репозитория пачками, минуя кэш
+func (r *CachedOrderRepository) Stream(ctx context.Context, filter repositories.OrderFilter, batchSize int, fn func(batch []*model.Order) error) error {
+	return r.repo.Stream(ctx, filter, batchSize, fn)
+}
+
+// Invalidate сбрасывает закэшированную копию заказа
+func (r *CachedOrderRepository) Invalidate(uid string) {
+	r.cash.Invalidate(uid)
+}
+
+// Refresh перечитывает заказ из репозитория и обновляет кэш. Изменение уже
+// зафиксировано, поэтому заказ читается из основной базы, а не из реплики.
+func (r *CachedOrderRepository) Refresh(ctx context.Context, uid string) (*model.Order, error) {
+	order, err := r.repo.FindByID(repositories.WithPrimaryReads(ctx), uid)
+	if err != nil {
+		r.forget(uid, err)
+		return nil, err
+	}
+
+	r.cash.Set(uid, order)
+	return order, nil
+}
+
+// forget убирает заказ из кэша после ошибки репозитория: если заказа нет
+// в базе, полнота кэша не страдает, иначе состояние неизвестно
+func (r *CachedOrderRepository) forget(uid string, err error) {
+	if errors.Is(err, repositories.ErrOrderNotFound) {
+		r.cash.Delete(uid)
+		return
+	}
+	r.cash.Invalidate(uid)
+}
+
+// Ping проверяет доступность хранилища в обход кэша
+func (r *CachedOrderRepository) Ping(ctx context.Context) error {
+	return Ping(ctx, r.repo)
+}
+
+// Ping проверяет доступность хранилища repo: его собственным Ping, если он есть
+// (у CachedOrderRepository он идет в обход кэша), иначе чтением из основной базы
+func Ping(ctx context.Context, repo repositories.OrderRepository) error {
+	if pinger, ok := repo.(pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	// Без Ping хватает самого дешевого чтения - одного заказа из основной базы
+	_, err := repo.List(repositories.WithPrimaryReads(ctx), repositories.ListOptions{Limit: 1})
+	return err
+}
+
+// pinger - хранилище, умеющее проверять соединение
+type pinger interface {
+	Ping(ctx context.Context) error
+}
@@ -0,0 +1,589 @@
+package cash
+
+import (
+	"context"
+	"errors"
+	"shop-microservice/internal/domain/model"
+	"shop-microservice/internal/domain/repositories"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingRepository - хранилище в памяти, считающее обращения
+type countingRepository struct {
+	orders   map[string]*model.Order
+	saveErr  error
+	finds    int
+	findAlls int
+	lists    int
+	// primary - читал ли последний FindByID или FindAll из основной базы
+	primary bool
+	// replica - устаревшие заказы, которые отдает реплика при чтении не из основной базы
+	replica map[string]*model.Order
+}
+
+func newCountingRepository(orders ...*model.Order) *countingRepository {
+	repo := &countingRepository{orders: make(map[string]*model.Order)}
+	for _, order := range orders {
+		repo.orders[order.OrderUID] = order
+	}
+	return repo
+}
+
+func (r *countingRepository) Create(ctx context.Context, order *model.Order) error {
+	if _, ok := r.orders[order.OrderUID]; ok {
+		return &repositories.ConflictError{OrderUID: order.OrderUID, Version: r.orders[order.OrderUID].Version}
+	}
+	return r.Save(ctx, order)
+}
+
+func (r *countingRepository) Save(ctx context.Context, order *model.Order) error {
+	if r.saveErr != nil {
+		return r.saveErr
+	}
+	current, ok := r.orders[order.OrderUID]
+	if order.Version > 0 && (!ok || current.Version != order.Version) {
+		return repositories.ErrVersionConflict
+	}
+	order.Version++
+	r.orders[order.OrderUID] = order
+	return nil
+}
+
+func (r *countingRepository) Update(ctx context.Context, uid string, expectedVersion int64, mutate func(order *model.Order) error) (*model.Order, error) {
+	current, ok := r.orders[uid]
+	if !ok {
+		return nil, repositories.ErrOrderNotFound
+	}
+	if expectedVersion > 0 && current.Version != expectedVersion {
+		return nil, repositories.ErrVersionConflict
+	}
+	updated := *current
+	if err := mutate(&updated); err != nil {
+		return nil, err
+	}
+	updated.Version = current.Version + 1
+	r.orders[uid] = &updated
+	return &updated, nil
+}
+
+func (r *countingRepository) Delete(ctx context.Context, uid string, expectedVersion int64) error {
+	current, ok := r.orders[uid]
+	if !ok {
+		return repositories.ErrOrderNotFound
+	}
+	if expectedVersion > 0 && current.Version != expectedVersion {
+		return repositories.ErrVersionConflict
+	}
+	delete(r.orders, uid)
+	return nil
+}
+
+func (r *countingRepository) ChangeStatus(ctx context.Context, uid string, transition repositories.StatusTransition) (*model.Order, *model.StatusChange, error) {
+	current, ok := r.orders[uid]
+	if !ok {
+		return nil, nil, repositories.ErrOrderNotFound
+	}
+	if !current.Status.CanTransitionTo(transition.To) {
+		return nil, nil, repositories.ErrInvalidStatusTransition
+	}
+	updated := *current
+	updated.Status = transition.To
+	updated.Version++
+	r.orders[uid] = &updated
+	return &updated, &model.StatusChange{OrderUID: uid, From: current.Status, To: transition.To, Version: updated.Version}, nil
+}
+
+func (r *countingRepository) UpdateItemStatuses(ctx context.Context, updates []repositories.ItemStatusUpdate, reason string) (*repositories.ItemStatusResult, error) {
+	result := &repositories.ItemStatusResult{}
+	for _, update := range updates {
+		current, ok := r.orders[update.OrderUID]
+		if !ok {
+			return nil, repositories.ErrItemNotFound
+		}
+		updated := *current
+		updated.Items = append([]model.Item(nil), current.Items...)
+		for i := range updated.Items {
+			if updated.Items[i].Rid == update.Rid {
+				updated.Items[i].Status = update.Status
+			}
+		}
+		updated.Version++
+		r.orders[update.OrderUID] = &updated
+		result.Orders = append(result.Orders, &updated)
+	}
+	return result, nil
+}
+
+func (r *countingRepository) StatusHistory(ctx context.Context, uid string) ([]model.StatusChange, error) {
+	return nil, nil
+}
+
+func (r *countingRepository) AuditHistory(ctx context.Context, uid string) ([]model.AuditEntry, error) {
+	return nil, nil
+}
+
+func (r *countingRepository) OrderAsOf(ctx context.Context, uid string, at time.Time) (*model.Order, error) {
+	return nil, repositories.ErrRevisionNotFound
+}
+
+func (r *countingRepository) OrderAtVersion(ctx context.Context, uid string, version int64) (*model.Order, error) {
+	return nil, repositories.ErrRevisionNotFound
+}
+
+func (r *countingRepository) Import(ctx context.Context, orders []*model.Order) error {
+	for _, order := range orders {
+		imported := *order
+		imported.Version++
+		r.orders[order.OrderUID] = &imported
+	}
+	return nil
+}
+
+func (r *countingRepository) FindByID(ctx context.Context, uid string) (*model.Order, error) {
+	r.finds++
+	r.primary = repositories.ReadFromPrimary(ctx)
+	if stale, ok := r.replica[uid]; ok && !r.primary {
+		return stale, nil
+	}
+	order, ok := r.orders[uid]
+	if !ok {
+		return nil, repositories.ErrOrderNotFound
+	}
+	return order, nil
+}
+
+func (r *countingRepository) FindAll(ctx context.Context) ([]*model.Order, error) {
+	r.findAlls++
+	r.primary = repositories.ReadFromPrimary(ctx)
+	orders := make([]*model.Order, 0, len(r.orders))
+	for uid, order := range r.orders {
+		if stale, ok := r.replica[uid]; ok && !r.primary {
+			order = stale
+		}
+		orders = append(orders, order)
+	}
+	return orders, nil
+}
+
+func (r *countingRepository) List(ctx context.Context, opts repositories.ListOptions) (*repositories.OrderPage, error) {
+	r.lists++
+	orders := make([]*model.Order, 0, len(r.orders))
+	for _, order := range r.orders {
+		if opts.Limit > 0 && len(orders) == opts.Limit {
+			break
+		}
+		orders = append(orders, order)
+	}
+	return &repositories.OrderPage{Orders: orders}, nil
+}
+
+func (r *countingRepository) Stream(ctx context.Context, filter repositories.OrderFilter, batchSize int, fn func(batch []*model.Order) error) error {
+	orders, err := r.FindAll(ctx)
+	if err != nil {
+		return err
+	}
+	return streamOrders(orders, filter, fn)
+}
+
+func TestCachedOrderRepository_ReadThrough(t *testing.T) {
+	order := createTestOrder()
+	backing := newCountingRepository(order)
+	repo := NewCachedOrderRepository(backing, NewCash())
+	ctx := context.Background()
+
+	result, err := repo.FindByID(ctx, order.OrderUID)
+	require.NoError(t, err)
+	assert.Equal(t, order.OrderUID, result.OrderUID)
+	assert.True(t, backing.primary, "промах кэша должен читать основную базу")
+
+	_, err = repo.FindByID(ctx, order.OrderUID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, backing.finds)
+
+	_, err = repo.FindByID(ctx, "non-existent-id")
+	require.Error(t, err)
+}
+
+func TestCachedOrderRepository_StaleReplicaIsNotCached(t *testing.T) {
+	order := createTestOrder()
+	order.TrackNumber = "PRIMARY"
+	stale := createTestOrder()
+	stale.TrackNumber = "REPLICA"
+	backing := newCountingRepository(order)
+	backing.replica = map[string]*model.Order{order.OrderUID: stale}
+	ctx := context.Background()
+
+	fills := map[string]func(repo *CachedOrderRepository) error{
+		"FindByID": func(repo *CachedOrderRepository) error {
+			_, err := repo.FindByID(ctx, order.OrderUID)
+			return err
+		},
+		"FindAll": func(repo *CachedOrderRepository) error {
+			_, err := repo.FindAll(ctx)
+			return err
+		},
+		"Refresh": func(repo *CachedOrderRepository) error {
+			_, err := repo.Refresh(ctx, order.OrderUID)
+			return err
+		},
+	}
+	for name, fill := range fills {
+		cash := NewCash()
+		require.NoError(t, fill(NewCachedOrderRepository(backing, cash)), name)
+
+		cached, exists := cash.Get(order.OrderUID)
+		require.True(t, exists, name)
+		assert.Equal(t, "PRIMARY", cached.TrackNumber, "%s не должен класть в кэш заказ с реплики", name)
+	}
+}
+
+func TestCachedOrderRepository_WriteThrough(t *testing.T) {
+	backing := newCountingRepository()
+	cash := NewCash()
+	repo := NewCachedOrderRepository(backing, cash)
+	ctx := context.Background()
+
+	order := createTestOrder()
+	require.NoError(t, repo.Save(ctx, order))
+
+	cached, exists := cash.Get(order.OrderUID)
+	require.True(t, exists)
+	assert.Equal(t, order.TrackNumber, cached.TrackNumber)
+
+	_, err := repo.FindByID(ctx, order.OrderUID)
+	require.NoError(t, err)
+	assert.Equal(t, 0, backing.finds)
+}
+
+func TestCachedOrderRepository_SaveErrorInvalidates(t *testing.T) {
+	backing := newCountingRepository()
+	cash := NewCash()
+	repo := NewCachedOrderRepository(backing, cash)
+
+	order := createTestOrder()
+	cash.Load([]*model.Order{order})
+
+	backing.saveErr = errors.New("database error")
+	err := repo.Save(context.Background(), order)
+	require.Error(t, err)
+
+	_, exists := cash.Get(order.OrderUID)
+	assert.False(t, exists)
+	assert.False(t, cash.Loaded())
+}
+
+func TestCachedOrderRepository_FindAll(t *testing.T) {
+	order1 := createTestOrder()
+	order2 := createTestOrder()
+	order2.OrderUID = "test-order-uid-2"
+	backing := newCountingRepository(order1, order2)
+	cash := NewCash()
+	repo := NewCachedOrderRepository(backing, cash)
+	ctx := context.Background()
+
+	orders, err := repo.FindAll(ctx)
+	require.NoError(t, err)
+	assert.Len(t, orders, 2)
+	assert.True(t, cash.Loaded())
+
+	orders, err = repo.FindAll(ctx)
+	require.NoError(t, err)
+	assert.Len(t, orders, 2)
+	assert.Equal(t, 1, backing.findAlls)
+	assert.True(t, backing.primary, "полная загрузка кэша должна читать основную базу")
+
+	repo.Invalidate(order1.OrderUID)
+	_, err = repo.FindAll(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, backing.findAlls)
+}
+
+func TestCachedOrderRepository_PingWithoutPinger(t *testing.T) {
+	backing := newCountingRepository(createTestOrder())
+	repo := NewCachedOrderRepository(backing, NewCash())
+
+	require.NoError(t, repo.Ping(context.Background()))
+	assert.Equal(t, 0, backing.findAlls, "проверка здоровья не должна читать все заказы")
+	assert.Equal(t, 1, backing.lists)
+}
+
+func TestCachedOrderRepository_Refresh(t *testing.T) {
+	order := createTestOrder()
+	backing := newCountingRepository(order)
+	cash := NewCash()
+	repo := NewCachedOrderRepository(backing, cash)
+	ctx := context.Background()
+
+	cash.Set(order.OrderUID, order)
+
+	updated := createTestOrder()
+	updated.TrackNumber = "UPDATED"
+	backing.orders[order.OrderUID] = updated
+
+	result, err := repo.Refresh(ctx, order.OrderUID)
+	require.NoError(t, err)
+	assert.Equal(t, "UPDATED", result.TrackNumber)
+
+	cash.Load([]*model.Order{result})
+	delete(backing.orders, order.OrderUID)
+	_, err = repo.Refresh(ctx, order.OrderUID)
+	require.ErrorIs(t, err, repositories.ErrOrderNotFound)
+
+	_, exists := cash.Get(order.OrderUID)
+	assert.False(t, exists)
+	// Удаленный в базе заказ не нарушает полноту кэша
+	assert.True(t, cash.Loaded())
+}
+
+func TestCachedOrderRepository_Update(t *testing.T) {
+	order := createTestOrder()
+	backing := newCountingRepository(order)
+	cash := NewCash()
+	repo := NewCachedOrderRepository(backing, cash)
+	ctx := context.Background()
+
+	cash.Load([]*model.Order{order})
+
+	updated, err := repo.Update(ctx, order.OrderUID, 0, func(order *model.Order) error {
+		order.TrackNumber = "UPDATED"
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "UPDATED", updated.TrackNumber)
+
+	cached, exists := cash.Get(order.OrderUID)
+	require.True(t, exists)
+	assert.Equal(t, "UPDATED", cached.TrackNumber)
+	assert.Len(t, cash.GetByTrackNumber("UPDATED"), 1)
+
+	// Ошибка проверки не трогает кэш
+	_, err = repo.Update(ctx, order.OrderUID, 0, func(order *model.Order) error {
+		return errors.New("invalid patch")
+	})
+	require.Error(t, err)
+	_, exists = cash.Get(order.OrderUID)
+	assert.True(t, exists)
+	assert.True(t, cash.Loaded())
+}
+
+func TestCachedOrderRepository_Delete(t *testing.T) {
+	order := createTestOrder()
+	backing := newCountingRepository(order)
+	cash := NewCash()
+	repo := NewCachedOrderRepository(backing, cash)
+	ctx := context.Background()
+
+	cash.Load([]*model.Order{order})
+
+	require.NoError(t, repo.Delete(ctx, order.OrderUID, 0))
+	_, exists := cash.Get(order.OrderUID)
+	assert.False(t, exists)
+	assert.True(t, cash.Loaded())
+
+	err := repo.Delete(ctx, order.OrderUID, 0)
+	require.ErrorIs(t, err, repositories.ErrOrderNotFound)
+}
+
+func TestCachedOrderRepository_VersionConflict(t *testing.T) {
+	order := createTestOrder()
+	order.Version = 3
+	backing := newCountingRepository(order)
+	cash := NewCash()
+	repo := NewCachedOrderRepository(backing, cash)
+	ctx := context.Background()
+
+	cash.Load([]*model.Order{order})
+
+	_, err := repo.Update(ctx, order.OrderUID, 2, func(order *model.Order) error {
+		order.TrackNumber = "UPDATED"
+		return nil
+	})
+	require.ErrorIs(t, err, repositories.ErrVersionConflict)
+
+	// Копия в кэше могла устареть, ее нужно перечитать
+	_, exists := cash.Get(order.OrderUID)
+	assert.False(t, exists)
+
+	updated, err := repo.Update(ctx, order.OrderUID, 3, func(order *model.Order) error {
+		order.TrackNumber = "UPDATED"
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), updated.Version)
+
+	err = repo.Delete(ctx, order.OrderUID, 3)
+	require.ErrorIs(t, err, repositories.ErrVersionConflict)
+	require.NoError(t, repo.Delete(ctx, order.OrderUID, 4))
+}
+
+func TestCachedOrderRepository_Create(t *testing.T) {
+	backing := newCountingRepository()
+	cash := NewCash()
+	repo := NewCachedOrderRepository(backing, cash)
+	ctx := context.Background()
+
+	order := createTestOrder()
+	require.NoError(t, repo.Create(ctx, order))
+	_, exists := cash.Get(order.OrderUID)
+	assert.True(t, exists)
+
+	duplicate := createTestOrder()
+	duplicate.TrackNumber = "DUPLICATE"
+	err := repo.Create(ctx, duplicate)
+
+	var conflict *repositories.ConflictError
+	require.ErrorAs(t, err, &conflict)
+	assert.Equal(t, int64(1), conflict.Version)
+	require.ErrorIs(t, err, repositories.ErrOrderExists)
+
+	cached, exists := cash.Get(order.OrderUID)
+	require.True(t, exists)
+	assert.Equal(t, order.TrackNumber, cached.TrackNumber)
+}
+
+func TestCachedOrderRepository_ChangeStatus(t *testing.T) {
+	order := createTestOrder()
+	order.Status = model.OrderStatusCreated
+	backing := newCountingRepository(order)
+	cash := NewCash()
+	repo := NewCachedOrderRepository(backing, cash)
+	ctx := context.Background()
+
+	cash.Load([]*model.Order{order})
+
+	updated, change, err := repo.ChangeStatus(ctx, order.OrderUID, repositories.StatusTransition{To: model.OrderStatusPaid})
+	require.NoError(t, err)
+	assert.Equal(t, model.OrderStatusPaid, updated.Status)
+	assert.Equal(t, model.OrderStatusCreated, change.From)
+
+	cached, exists := cash.Get(order.OrderUID)
+	require.True(t, exists)
+	assert.Equal(t, model.OrderStatusPaid, cached.Status)
+
+	_, _, err = repo.ChangeStatus(ctx, order.OrderUID, repositories.StatusTransition{To: model.OrderStatusDelivered})
+	require.ErrorIs(t, err, repositories.ErrInvalidStatusTransition)
+	_, exists = cash.Get(order.OrderUID)
+	assert.False(t, exists)
+}
+
+func TestCachedOrderRepository_UpdateItemStatuses(t *testing.T) {
+	order := createTestOrder()
+	backing := newCountingRepository(order)
+	cash := NewCash()
+	repo := NewCachedOrderRepository(backing, cash)
+	ctx := context.Background()
+
+	cash.Load([]*model.Order{order})
+
+	result, err := repo.UpdateItemStatuses(ctx, []repositories.ItemStatusUpdate{
+		{Rid: order.Items[0].Rid, OrderUID: order.OrderUID, Status: model.ItemStatusShipped},
+	}, "")
+	require.NoError(t, err)
+	require.Len(t, result.Orders, 1)
+
+	cached, exists := cash.Get(order.OrderUID)
+	require.True(t, exists)
+	assert.Equal(t, model.ItemStatusShipped, cached.Items[0].Status)
+	assert.Equal(t, result.Orders[0].Version, cached.Version)
+}
+
+func TestCachedOrderRepository_Import(t *testing.T) {
+	order := createTestOrder()
+	backing := newCountingRepository(order)
+	cash := NewCash()
+	repo := NewCachedOrderRepository(backing, cash)
+	ctx := context.Background()
+
+	cash.Load([]*model.Order{order})
+
+	imported := createTestOrder()
+	imported.OrderUID = "imported-order"
+	reimported := *order
+	reimported.TrackNumber = "imported-track"
+
+	require.NoError(t, repo.Import(ctx, []*model.Order{&reimported, imported}))
+
+	_, exists := cash.Get(order.OrderUID)
+	assert.False(t, exists)
+
+	found, err := repo.FindByID(ctx, imported.OrderUID)
+	require.NoError(t, err)
+	assert.Equal(t, imported.OrderUID, found.OrderUID)
+
+	found, err = repo.FindByID(ctx, order.OrderUID)
+	require.NoError(t, err)
+	assert.Equal(t, "imported-track", found.TrackNumber)
+}
+
+// erasingRepository - хранилище, стирающее данные покупателя: у заказов
+// покупателя очищается доставка
+type erasingRepository struct {
+	*countingRepository
+	job *repositories.ErasureJob
+}
+
+func (r *erasingRepository) RequestErasure(ctx context.Context, customerID string) (*repositories.ErasureJob, error) {
+	r.job = &repositories.ErasureJob{ID: 1, CustomerID: customerID, Status: repositories.ErasurePending}
+	return r.job, nil
+}
+
+func (r *erasingRepository) ErasureJob(ctx context.Context, id int64) (*repositories.ErasureJob, error) {
+	if r.job == nil || r.job.ID != id {
+		return nil, repositories.ErrErasureJobNotFound
+	}
+	return r.job, nil
+}
+
+func (r *erasingRepository) ProcessErasure(ctx context.Context) (*repositories.ErasureJob, []string, error) {
+	if r.job == nil || r.job.Status != repositories.ErasurePending {
+		return nil, nil, nil
+	}
+	var uids []string
+	for uid, order := range r.orders {
+		if order.CustomerID == r.job.CustomerID {
+			erased := *order
+			erased.Delivery = &model.Delivery{}
+			r.orders[uid] = &erased
+			uids = append(uids, uid)
+		}
+	}
+	r.job.Status, r.job.Orders = repositories.ErasureDone, len(uids)
+	return r.job, uids, nil
+}
+
+func TestCachedOrderRepository_ProcessErasure(t *testing.T) {
+	order := createTestOrder()
+	backing := &erasingRepository{countingRepository: newCountingRepository(order)}
+	cash := NewCash()
+	repo := NewCachedOrderRepository(backing, cash)
+	ctx := context.Background()
+
+	cash.Load([]*model.Order{order})
+
+	job, err := repo.RequestErasure(ctx, order.CustomerID)
+	require.NoError(t, err)
+	assert.Equal(t, repositories.ErasurePending, job.Status)
+
+	job, uids, err := repo.ProcessErasure(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, repositories.ErasureDone, job.Status)
+	assert.Equal(t, []string{order.OrderUID}, uids)
+
+	_, exists := cash.Get(order.OrderUID)
+	assert.False(t, exists, "erased order is dropped from the cache")
+
+	found, err := repo.FindByID(ctx, order.OrderUID)
+	require.NoError(t, err)
+	assert.Empty(t, found.Delivery.Name)
+}
+
+func TestCachedOrderRepository_ErasureNotSupported(t *testing.T) {
+	repo := NewCachedOrderRepository(newCountingRepository(), NewCash())
+
+	_, err := repo.RequestErasure(context.Background(), "customer")
+	assert.Error(t, err)
+}
@@ -0,0 +1,204 @@
+// Package fieldcrypt - конвертное шифрование отдельных полей записей.
+//
+// Каждая запись шифруется своим случайным ключом данных (DEK), который хранится
+// рядом с записью, зашифрованный ключом шифрования ключей (KEK) провайдера.
+// При ротации KEK перешифровываются только ключи данных, сами поля не меняются.
+// Для поиска по зашифрованным полям строятся слепые индексы - HMAC от
+// нормализованного значения на отдельном ключе, который при ротации не меняется.
+package fieldcrypt
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// KeySize - размер ключей данных и ключей провайдера (AES-256)
+const KeySize = 32
+
+// ErrUnknownKey - у провайдера нет ключа с таким идентификатором
+var ErrUnknownKey = errors.New("unknown encryption key")
+
+// KeyProvider - источник ключей шифрования ключей: локальный файл или внешний KMS
+type KeyProvider interface {
+	// CurrentKeyID - ключ, которым оборачиваются новые ключи данных
+	CurrentKeyID() string
+	// WrapKey шифрует ключ данных ключом keyID
+	WrapKey(ctx context.Context, keyID string, dek []byte) ([]byte, error)
+	// UnwrapKey расшифровывает ключ данных, зашифрованный ключом keyID
+	UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+	// IndexKey - секрет слепых индексов; его смена требует пересчета индексов
+	IndexKey() []byte
+}
+
+// Cipher шифрует поля записей ключами провайдера
+type Cipher struct {
+	keys KeyProvider
+}
+
+// New создает шифратор; ключ слепых индексов должен быть задан
+func New(keys KeyProvider) (*Cipher, error) {
+	if keys.CurrentKeyID() == "" {
+		return nil, fmt.Errorf("fieldcrypt: current key is not set")
+	}
+	if len(keys.IndexKey()) < KeySize {
+		return nil, fmt.Errorf("fieldcrypt: index key must be at least %d bytes", KeySize)
+	}
+	return &Cipher{keys: keys}, nil
+}
+
+// CurrentKeyID - ключ, которым шифруются новые записи
+func (c *Cipher) CurrentKeyID() string {
+	return c.keys.CurrentKeyID()
+}
+
+// Envelope - ключ данных одной записи
+type Envelope struct {
+	KeyID      string // ключ провайдера, которым обернут ключ данных
+	WrappedKey []byte // ключ данных, зашифрованный ключом KeyID
+	aead       cipher.AEAD
+}
+
+// NewEnvelope создает ключ данных для новой записи и оборачивает его текущим ключом
+func (c *Cipher) NewEnvelope(ctx context.Context) (*Envelope, error) {
+	dek := make([]byte, KeySize)
+	if _, err := rand.Read(dek); err != nil {
+		return nil, fmt.Errorf("fieldcrypt: %w", err)
+	}
+	keyID := c.keys.CurrentKeyID()
+	wrapped, err := c.keys.WrapKey(ctx, keyID, dek)
+	if err != nil {
+		return nil, fmt.Errorf("fieldcrypt: wrap key: %w", err)
+	}
+	return newEnvelope(keyID, wrapped, dek)
+}
+
+// OpenEnvelope восстанавливает ключ данных записи
+func (c *Cipher) OpenEnvelope(ctx context.Context, keyID string, wrapped []byte) (*Envelope, error) {
+	dek, err := c.keys.UnwrapKey(ctx, keyID, wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("fieldcrypt: unwrap key %q: %w", keyID, err)
+	}
+	return newEnvelope(keyID, wrapped, dek)
+}
+
+// Rewrap перешифровывает ключ данных текущим ключом провайдера; поля записи не меняются
+func (c *Cipher) Rewrap(ctx context.Context, keyID string, wrapped []byte) (*Envelope, error) {
+	dek, err := c.keys.UnwrapKey(ctx, keyID, wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("fieldcrypt: unwrap key %q: %w", keyID, err)
+	}
+	current := c.keys.CurrentKeyID()
+	rewrapped, err := c.keys.WrapKey(ctx, current, dek)
+	if err != nil {
+		return nil, fmt.Errorf("fieldcrypt: wrap key: %w", err)
+	}
+	return newEnvelope(current, rewrapped, dek)
+}
+
+func newEnvelope(keyID string, wrapped, dek []byte) (*Envelope, error) {
+	aead, err := newAEAD(dek)
+	if err != nil {
+		return nil, err
+	}
+	return &Envelope{KeyID: keyID, WrappedKey: wrapped, aead: aead}, nil
+}
+
+// Encrypt шифрует значение поля field. Пустое значение не шифруется, чтобы стертые
+// поля оставались пустыми. Имя поля связывается с шифртекстом, поэтому значения
+// нельзя переставить между полями.
+func (e *Envelope) Encrypt(field, plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+	sealed, err := seal(e.aead, []byte(plaintext), []byte(field))
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt расшифровывает значение поля field
+func (e *Envelope) Decrypt(field, ciphertext string) (string, error) {
+	if ciphertext == "" {
+		return "", nil
+	}
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("fieldcrypt: %s: %w", field, err)
+	}
+	plaintext, err := open(e.aead, sealed, []byte(field))
+	if err != nil {
+		return "", fmt.Errorf("fieldcrypt: %s: %w", field, err)
+	}
+	return string(plaintext), nil
+}
+
+// BlindIndex - слепой индекс значения поля field для поиска на равенство;
+// для пустого значения индекса нет
+func (c *Cipher) BlindIndex(field, value string) string {
+	value = Normalize(field, value)
+	if value == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, c.keys.IndexKey())
+	mac.Write([]byte(field))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Normalize приводит значение к виду, по которому строится слепой индекс:
+// email без пробелов и в нижнем регистре, у телефона остаются только цифры
+func Normalize(field, value string) string {
+	switch field {
+	case "email":
+		return strings.ToLower(strings.TrimSpace(value))
+	case "phone":
+		return strings.Map(func(r rune) rune {
+			if unicode.IsDigit(r) {
+				return r
+			}
+			return -1
+		}, value)
+	default:
+		return strings.TrimSpace(value)
+	}
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("fieldcrypt: key must be %d bytes, got %d", KeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("fieldcrypt: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal шифрует AES-GCM, случайный nonce идет перед шифртекстом
+func seal(aead cipher.AEAD, plaintext, additional []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("fieldcrypt: %w", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, additional), nil
+}
+
+func open(aead cipher.AEAD, sealed, additional []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additional)
+}
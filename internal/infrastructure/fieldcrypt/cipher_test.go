@@ -0,0 +1,108 @@
+package fieldcrypt
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testKeyFile собирает файл ключей с ключами ids; текущий - последний
+func testKeyFile(t *testing.T, ids ...string) *KeyFile {
+	t.Helper()
+	keys := ""
+	for i, id := range ids {
+		if i > 0 {
+			keys += ", "
+		}
+		keys += fmt.Sprintf("%q: %q", id, base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{byte(i + 1)}, KeySize)))
+	}
+	data := fmt.Sprintf(`{"current": %q, "keys": {%s}, "index_key": %q}`,
+		ids[len(ids)-1], keys, base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{0xAA}, KeySize)))
+
+	file, err := ParseKeyFile([]byte(data))
+	require.NoError(t, err)
+	return file
+}
+
+func TestEnvelope_RoundTrip(t *testing.T) {
+	c, err := New(testKeyFile(t, "k1"))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	envelope, err := c.NewEnvelope(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "k1", envelope.KeyID)
+
+	ciphertext, err := envelope.Encrypt("email", "john@example.com")
+	require.NoError(t, err)
+	assert.NotContains(t, ciphertext, "john")
+
+	opened, err := c.OpenEnvelope(ctx, envelope.KeyID, envelope.WrappedKey)
+	require.NoError(t, err)
+	plaintext, err := opened.Decrypt("email", ciphertext)
+	require.NoError(t, err)
+	assert.Equal(t, "john@example.com", plaintext)
+
+	_, err = opened.Decrypt("phone", ciphertext)
+	assert.Error(t, err, "ciphertext is bound to its field")
+}
+
+func TestEnvelope_EmptyValue(t *testing.T) {
+	c, err := New(testKeyFile(t, "k1"))
+	require.NoError(t, err)
+
+	envelope, err := c.NewEnvelope(context.Background())
+	require.NoError(t, err)
+
+	ciphertext, err := envelope.Encrypt("name", "")
+	require.NoError(t, err)
+	assert.Empty(t, ciphertext)
+
+	plaintext, err := envelope.Decrypt("name", "")
+	require.NoError(t, err)
+	assert.Empty(t, plaintext)
+}
+
+func TestCipher_Rewrap(t *testing.T) {
+	ctx := context.Background()
+	old, err := New(testKeyFile(t, "k1"))
+	require.NoError(t, err)
+
+	envelope, err := old.NewEnvelope(ctx)
+	require.NoError(t, err)
+	ciphertext, err := envelope.Encrypt("address", "Ploshad Mira 15")
+	require.NoError(t, err)
+
+	rotated, err := New(testKeyFile(t, "k1", "k2"))
+	require.NoError(t, err)
+	rewrapped, err := rotated.Rewrap(ctx, envelope.KeyID, envelope.WrappedKey)
+	require.NoError(t, err)
+	assert.Equal(t, "k2", rewrapped.KeyID)
+
+	// Поле читается новым конвертом без перешифрования
+	plaintext, err := rewrapped.Decrypt("address", ciphertext)
+	require.NoError(t, err)
+	assert.Equal(t, "Ploshad Mira 15", plaintext)
+
+	// После удаления старого ключа перешифрованная запись читается
+	current, err := New(testKeyFile(t, "k0", "k2"))
+	require.NoError(t, err)
+	_, err = current.OpenEnvelope(ctx, envelope.KeyID, envelope.WrappedKey)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+}
+
+func TestCipher_BlindIndex(t *testing.T) {
+	c, err := New(testKeyFile(t, "k1"))
+	require.NoError(t, err)
+
+	assert.Equal(t, c.BlindIndex("email", "John@Example.com "), c.BlindIndex("email", "john@example.com"))
+	assert.Equal(t, c.BlindIndex("phone", "+7 (900) 123-45-67"), c.BlindIndex("phone", "79001234567"))
+	assert.NotEqual(t, c.BlindIndex("email", "79001234567"), c.BlindIndex("phone", "79001234567"))
+	assert.Empty(t, c.BlindIndex("email", " "))
+	assert.Len(t, c.BlindIndex("email", "john@example.com"), 64)
+}
@@ -0,0 +1,115 @@
+package fieldcrypt
+
+import (
+	"context"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// KeyFile - провайдер ключей из локального JSON-файла для разработки:
+//
+//	{
+//	  "current": "2025-06",
+//	  "keys": {"2025-01": "<base64, 32 байта>", "2025-06": "<base64, 32 байта>"},
+//	  "index_key": "<base64, 32 байта>"
+//	}
+//
+// Ключи генерируются, например, `openssl rand -base64 32`. Для ротации в файл
+// добавляется новый ключ и становится current; старый удаляется после
+// перешифрования (подкоманда reencrypt).
+type KeyFile struct {
+	current  string
+	keys     map[string][]byte
+	indexKey []byte
+}
+
+type keyFileJSON struct {
+	Current  string            `json:"current"`
+	Keys     map[string]string `json:"keys"`
+	IndexKey string            `json:"index_key"`
+}
+
+// LoadKeyFile читает и проверяет файл ключей
+func LoadKeyFile(path string) (*KeyFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("fieldcrypt: %w", err)
+	}
+	return ParseKeyFile(data)
+}
+
+// ParseKeyFile разбирает содержимое файла ключей
+func ParseKeyFile(data []byte) (*KeyFile, error) {
+	var raw keyFileJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("fieldcrypt: key file: %w", err)
+	}
+
+	decode := func(name, value string) ([]byte, error) {
+		key, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("fieldcrypt: key file: %s: %w", name, err)
+		}
+		if len(key) != KeySize {
+			return nil, fmt.Errorf("fieldcrypt: key file: %s must be %d bytes, got %d", name, KeySize, len(key))
+		}
+		return key, nil
+	}
+
+	file := &KeyFile{current: raw.Current, keys: make(map[string][]byte, len(raw.Keys))}
+	for id, value := range raw.Keys {
+		key, err := decode("key "+id, value)
+		if err != nil {
+			return nil, err
+		}
+		file.keys[id] = key
+	}
+	if _, ok := file.keys[raw.Current]; !ok {
+		return nil, fmt.Errorf("fieldcrypt: key file: current key %q is not in keys", raw.Current)
+	}
+
+	var err error
+	if file.indexKey, err = decode("index_key", raw.IndexKey); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// CurrentKeyID - ключ, которым оборачиваются новые ключи данных
+func (f *KeyFile) CurrentKeyID() string {
+	return f.current
+}
+
+// WrapKey шифрует ключ данных ключом keyID
+func (f *KeyFile) WrapKey(ctx context.Context, keyID string, dek []byte) ([]byte, error) {
+	aead, err := f.aead(keyID)
+	if err != nil {
+		return nil, err
+	}
+	return seal(aead, dek, []byte(keyID))
+}
+
+// UnwrapKey расшифровывает ключ данных, зашифрованный ключом keyID
+func (f *KeyFile) UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	aead, err := f.aead(keyID)
+	if err != nil {
+		return nil, err
+	}
+	return open(aead, wrapped, []byte(keyID))
+}
+
+// IndexKey - секрет слепых индексов
+func (f *KeyFile) IndexKey() []byte {
+	return f.indexKey
+}
+
+func (f *KeyFile) aead(keyID string) (cipher.AEAD, error) {
+	key, ok := f.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, keyID)
+	}
+	return newAEAD(key)
+}
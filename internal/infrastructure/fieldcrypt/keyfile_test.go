@@ -0,0 +1,33 @@
+package fieldcrypt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseKeyFile_Invalid(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, KeySize))
+	short := base64.StdEncoding.EncodeToString([]byte("short"))
+
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"not json", `keys`},
+		{"missing current", fmt.Sprintf(`{"current": "k2", "keys": {"k1": %q}, "index_key": %q}`, key, key)},
+		{"short key", fmt.Sprintf(`{"current": "k1", "keys": {"k1": %q}, "index_key": %q}`, short, key)},
+		{"bad base64", fmt.Sprintf(`{"current": "k1", "keys": {"k1": "%%%%"}, "index_key": %q}`, key)},
+		{"missing index key", fmt.Sprintf(`{"current": "k1", "keys": {"k1": %q}}`, key)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseKeyFile([]byte(tt.data))
+			assert.Error(t, err)
+		})
+	}
+}
@@ -5,8 +5,9 @@ import (
 )
 
 type MockProducer struct {
-	ProduceFunc func(ctx context.Context, key string, value interface{}) error
-	CloseFunc   func() error
+	ProduceFunc      func(ctx context.Context, key string, value interface{}) error
+	ProduceEventFunc func(ctx context.Context, eventType string, key string, value interface{}) error
+	CloseFunc        func() error
 }
 
 func (m *MockProducer) Produce(ctx context.Context, key string, value interface{}) error {
@@ -16,6 +17,13 @@ func (m *MockProducer) Produce(ctx context.Context, key string, value interface{
 	return nil
 }
 
+func (m *MockProducer) ProduceEvent(ctx context.Context, eventType string, key string, value interface{}) error {
+	if m.ProduceEventFunc != nil {
+		return m.ProduceEventFunc(ctx, eventType, key, value)
+	}
+	return nil
+}
+
 func (m *MockProducer) Close() error {
 	if m.CloseFunc != nil {
 		return m.CloseFunc()
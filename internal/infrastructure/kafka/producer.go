@@ -11,6 +11,21 @@ import (
 	"github.com/segmentio/kafka-go/compress"
 )
 
+// EventTypeHeader - заголовок сообщения с типом события
+const EventTypeHeader = "event_type"
+
+// Типы событий о заказах
+const (
+	EventOrderCreated = "order.created"
+	EventOrderUpdated = "order.updated"
+	EventOrderDeleted = "order.deleted"
+
+	EventOrderStatusChanged = "order.status_changed"
+	// EventOrderAnonymized - у заказа стерты данные получателя по сроку хранения;
+	// потребители должны стереть их в своих копиях
+	EventOrderAnonymized = "order.anonymized"
+)
+
 type Producer struct {
 	writer *kafka.Writer
 	topic  string
@@ -61,6 +76,34 @@ func (p *Producer) Produce(ctx context.Context, key string, value interface{}) e
 	return nil
 }
 
+// ProduceEvent отправляет событие с типом в заголовке event_type.
+// nil value отправляется как tombstone (сообщение без тела).
+func (p *Producer) ProduceEvent(ctx context.Context, eventType string, key string, value interface{}) error {
+	var body []byte
+	if value != nil {
+		jsonValue, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("failed to marshal message: %w", err)
+		}
+		body = jsonValue
+	}
+
+	msg := kafka.Message{
+		Key:   []byte(key),
+		Value: body,
+		Time:  time.Now(),
+		Headers: []kafka.Header{
+			{Key: EventTypeHeader, Value: []byte(eventType)},
+		},
+	}
+
+	if err := p.writer.WriteMessages(ctx, msg); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+
+	return nil
+}
+
 func (p *Producer) Close() error {
 	return p.writer.Close()
 }
@@ -0,0 +1,304 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"shop-microservice/internal/domain/model"
+	"shop-microservice/internal/domain/repositories"
+	"shop-microservice/internal/infrastructure/fieldcrypt"
+
+	"github.com/lib/pq"
+)
+
+var _ repositories.OrderArchiver = (*OrderRepository)(nil)
+
+// selectArchivedOrders - archived orders under the alias o, so cursor and sort clauses
+// of the working tables apply as they are
+const selectArchivedOrders = `
+        SELECT o.document, o.deleted_at, o.key_id, o.dek
+        FROM orders_archive o`
+
+// applyArchiveFilter - the same conditions as applyOrderFilter, evaluated on the
+// archived document where there is no column for them
+func applyArchiveFilter(b *queryBuilder, filter repositories.OrderFilter, cipher *fieldcrypt.Cipher) {
+	if !filter.IncludeDeleted {
+		b.add("o.deleted_at IS NULL")
+	}
+	if len(filter.OrderUIDs) > 0 {
+		b.add("o.order_uid = ANY(%s)", pq.Array(filter.OrderUIDs))
+	}
+	if filter.CustomerID != "" {
+		b.add("o.customer_id = %s", filter.CustomerID)
+	}
+	if filter.TrackNumber != "" {
+		b.add("o.document->>'track_number' = %s", filter.TrackNumber)
+	}
+	if !filter.CreatedFrom.IsZero() {
+		b.add("o.date_created >= %s", filter.CreatedFrom)
+	}
+	if !filter.CreatedTo.IsZero() {
+		b.add("o.date_created < %s", filter.CreatedTo)
+	}
+	if filter.DeliveryService != "" {
+		b.add("o.document->>'delivery_service' = %s", filter.DeliveryService)
+	}
+	if filter.Currency != "" {
+		b.add("o.document->'payment'->>'currency' = %s", filter.Currency)
+	}
+	if filter.Status != "" {
+		b.add("o.status = %s", string(filter.Status))
+	}
+	if filter.ItemStatus != nil {
+		b.add("EXISTS (SELECT 1 FROM jsonb_array_elements(o.document->'items') i WHERE (i->>'status')::int = %s)", *filter.ItemStatus)
+	}
+	if filter.Brand != "" {
+		b.add("EXISTS (SELECT 1 FROM jsonb_array_elements(o.document->'items') i WHERE i->>'brand' = %s)", filter.Brand)
+	}
+	if filter.Email != "" {
+		email := fieldcrypt.Normalize("email", filter.Email)
+		if cipher != nil {
+			b.add("(o.email_bidx = %s OR (o.key_id IS NULL AND lower(trim(o.document->'delivery'->>'email')) = %s))",
+				cipher.BlindIndex("email", email), email)
+		} else {
+			b.add("lower(trim(o.document->'delivery'->>'email')) = %s", email)
+		}
+	}
+	if filter.Phone != "" {
+		phone := fieldcrypt.Normalize("phone", filter.Phone)
+		if cipher != nil {
+			b.add("(o.phone_bidx = %s OR (o.key_id IS NULL AND regexp_replace(o.document->'delivery'->>'phone', '\\D', '', 'g') = %s))",
+				cipher.BlindIndex("phone", phone), phone)
+		} else {
+			b.add("regexp_replace(o.document->'delivery'->>'phone', '\\D', '', 'g') = %s", phone)
+		}
+	}
+}
+
+// queryArchivedOrders - reads up to opts.Limit+1 archived orders with their items
+func (r *OrderRepository) queryArchivedOrders(ctx context.Context, q queryer, opts repositories.ListOptions, cursor *listCursor) ([]model.Order, error) {
+	builder := &queryBuilder{}
+	applyArchiveFilter(builder, opts.Filter, r.cipher)
+	if cursor != nil {
+		applyCursor(builder, opts.Sort, cursor)
+	}
+
+	query := selectArchivedOrders + builder.where() + orderByClause(opts.Sort) +
+		fmt.Sprintf(" LIMIT %d", opts.Limit+1)
+
+	rows, err := q.QueryContext(ctx, query, builder.args...)
+	if err != nil {
+		return nil, errFail("failed to query archived orders: %w", err)
+	}
+	defer rows.Close()
+
+	var orders []model.Order
+	for rows.Next() {
+		var document []byte
+		var deletedAt sql.NullTime
+		var key documentKey
+		if err := rows.Scan(&document, &deletedAt, &key.keyID, &key.dek); err != nil {
+			return nil, errFail("failed to scan archived order: %w", err)
+		}
+		var order model.Order
+		if err := json.Unmarshal(document, &order); err != nil {
+			return nil, errFail("failed to decode archived order: %w", err)
+		}
+		envelope, err := r.openDocumentKey(ctx, key)
+		if err == nil {
+			err = decryptOrder(envelope, &order)
+		}
+		if err != nil {
+			return nil, errFail("failed to decrypt archived order %s: %w", order.OrderUID, err)
+		}
+		if deletedAt.Valid {
+			order.DeletedAt = &deletedAt.Time
+		}
+		orders = append(orders, order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errFail("rows iteration error: %w", err)
+	}
+	return orders, nil
+}
+
+// Archive - moves orders created before opts.Before, soft-deleted ones included, out of
+// the working tables in batches. Each batch is written to the monthly partitions of
+// orders_archive (or handed to opts.ColdStore) and deleted in one transaction.
+// Orders locked by concurrent writers are skipped and left for the next run.
+func (r *OrderRepository) Archive(ctx context.Context, opts repositories.ArchiveOptions) (int, error) {
+	if opts.Before.IsZero() {
+		return 0, errFail("Archive: cutoff time is required")
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = streamBatchSize
+	}
+
+	archived := 0
+	for {
+		moved, err := r.archiveBatch(ctx, opts)
+		archived += moved
+		if err != nil {
+			return archived, errFail("Archive: %w", err)
+		}
+		if moved < opts.BatchSize {
+			return archived, nil
+		}
+	}
+}
+
+func (r *OrderRepository) archiveBatch(ctx context.Context, opts repositories.ArchiveOptions) (int, error) {
+	tx, err := r.begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+        SELECT order_uid FROM orders
+        WHERE date_created < $1
+        ORDER BY date_created, order_uid
+        LIMIT $2
+        FOR UPDATE SKIP LOCKED
+	`, opts.Before, opts.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+	var uids []string
+	for rows.Next() {
+		var uid string
+		if err := rows.Scan(&uid); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		uids = append(uids, uid)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(uids) == 0 {
+		return 0, nil
+	}
+
+	page, err := r.listOrders(ctx, tx, repositories.ListOptions{
+		Filter: repositories.OrderFilter{OrderUIDs: uids, IncludeDeleted: true},
+		Sort:   repositories.SortOrderUIDAsc,
+		Limit:  len(uids),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	sealed := make([]repositories.SealedOrder, len(page.Orders))
+	for i, order := range page.Orders {
+		if sealed[i], err = r.sealOrder(ctx, order); err != nil {
+			return 0, errFail("order %s: %w", order.OrderUID, err)
+		}
+	}
+
+	if opts.ColdStore != nil {
+		err = opts.ColdStore(ctx, sealed)
+	} else {
+		err = r.writeArchive(ctx, tx, sealed)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	// Доставка, оплата и товары удаляются каскадно, история статусов и журнал аудита остаются
+	if _, err := tx.ExecContext(ctx, "DELETE FROM orders WHERE order_uid = ANY($1)", pq.Array(uids)); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(uids), nil
+}
+
+// sealOrder - the order with delivery PII sealed under its own data key, the key and
+// blind indexes for search, as stored in orders_archive and handed to a cold store;
+// without a cipher the order stays plaintext
+func (r *OrderRepository) sealOrder(ctx context.Context, order *model.Order) (repositories.SealedOrder, error) {
+	sealed := repositories.SealedOrder{Order: order}
+	envelope, err := r.documentEnvelope(ctx, order.Delivery != nil)
+	if err != nil || envelope == nil {
+		return sealed, err
+	}
+
+	sealed.Order = order.Clone()
+	if err := encryptOrder(envelope, sealed.Order); err != nil {
+		return repositories.SealedOrder{}, err
+	}
+	sealed.KeyID, sealed.DEK = &envelope.KeyID, envelope.WrappedKey
+	if index := r.cipher.BlindIndex("email", order.Delivery.Email); index != "" {
+		sealed.EmailBidx = &index
+	}
+	if index := r.cipher.BlindIndex("phone", order.Delivery.Phone); index != "" {
+		sealed.PhoneBidx = &index
+	}
+	return sealed, nil
+}
+
+// writeArchive - creates missing monthly partitions and inserts the orders as documents.
+// An order archived again (re-created after archival) replaces its previous copy, also
+// when it was re-created with another date_created: the partitioned primary key has to
+// include date_created, so copies under other dates are deleted in the same statement.
+func (r *OrderRepository) writeArchive(ctx context.Context, tx *sql.Tx, orders []repositories.SealedOrder) error {
+	months := make(map[time.Time]bool)
+	for _, sealed := range orders {
+		month := partitionMonth(sealed.Order.DateCreated)
+		if months[month] {
+			continue
+		}
+		if err := ensureArchivePartition(ctx, tx, month); err != nil {
+			return err
+		}
+		months[month] = true
+	}
+
+	documents, err := json.Marshal(orders)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+        WITH documents AS (
+            SELECT d->>'order_uid' AS order_uid, (d->>'date_created')::timestamptz AS date_created,
+                   d->>'customer_id' AS customer_id, d->>'status' AS status,
+                   (d->>'deleted_at')::timestamptz AS deleted_at, d - 'deleted_at' AS document,
+                   e->>'key_id' AS key_id, decode(e->>'dek', 'base64') AS dek,
+                   e->>'email_bidx' AS email_bidx, e->>'phone_bidx' AS phone_bidx
+            FROM jsonb_array_elements($1::jsonb) e, jsonb_extract_path(e, 'document') d
+        ), replaced AS (
+            DELETE FROM orders_archive a USING documents
+            WHERE a.order_uid = documents.order_uid AND a.date_created <> documents.date_created
+        )
+        INSERT INTO orders_archive (order_uid, date_created, customer_id, status, deleted_at, document,
+                                    key_id, dek, email_bidx, phone_bidx)
+        SELECT order_uid, date_created, customer_id, status, deleted_at, document,
+               key_id, dek, email_bidx, phone_bidx
+        FROM documents
+        ON CONFLICT (order_uid, date_created) DO UPDATE SET
+            customer_id = EXCLUDED.customer_id,
+            status = EXCLUDED.status,
+            deleted_at = EXCLUDED.deleted_at,
+            archived_at = now(),
+            document = EXCLUDED.document,
+            key_id = EXCLUDED.key_id,
+            dek = EXCLUDED.dek,
+            email_bidx = EXCLUDED.email_bidx,
+            phone_bidx = EXCLUDED.phone_bidx
+	`, string(documents))
+	return err
+}
+
+// ensureArchivePartition - creates the orders_archive partition for the month if missing
+func ensureArchivePartition(ctx context.Context, tx *sql.Tx, month time.Time) error {
+	_, err := tx.ExecContext(ctx, createPartition("orders_archive", month))
+	return err
+}
@@ -0,0 +1,198 @@
+package postgresql
+
+import (
+	"context"
+	"encoding/json"
+	"shop-microservice/internal/domain/model"
+	"shop-microservice/internal/domain/repositories"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// expectArchiveBatch ожидает выборку и чтение пачки заказов для архивации
+func expectArchiveBatch(mock sqlmock.Sqlmock, cutoff time.Time, batchSize int, orders ...*model.Order) {
+	uids := sqlmock.NewRows([]string{"order_uid"})
+	rows := newOrderRows()
+	for _, order := range orders {
+		uids.AddRow(order.OrderUID)
+		addOrderRow(rows, order)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT order_uid FROM orders .* FOR UPDATE SKIP LOCKED").
+		WithArgs(cutoff, batchSize).
+		WillReturnRows(uids)
+	if len(orders) == 0 {
+		mock.ExpectRollback()
+		return
+	}
+	mock.ExpectQuery("SELECT o.order_uid").WillReturnRows(rows)
+	mock.ExpectQuery("SELECT order_uid, chrt_id").
+		WillReturnRows(sqlmock.NewRows([]string{
+			"order_uid", "chrt_id", "track_number", "price", "rid", "name", "sale", "size", "total_price", "nm_id", "brand", "status",
+		}))
+}
+
+func TestOrderRepository_Archive_Partitions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewOrderRepository(db)
+	cutoff := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	order := createTestOrder()
+	order.DateCreated = time.Date(2024, 5, 17, 10, 0, 0, 0, time.UTC)
+	deletedAt := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	order.DeletedAt = &deletedAt
+
+	expectArchiveBatch(mock, cutoff, 10, order)
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS "orders_archive_2024_05" PARTITION OF orders_archive ` +
+		`FOR VALUES FROM \('2024-05-01T00:00:00Z'\) TO \('2024-06-01T00:00:00Z'\)`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("FROM jsonb_array_elements.* DELETE FROM orders_archive .*a.date_created <> documents.date_created.* INSERT INTO orders_archive").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM orders WHERE order_uid = ANY").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	archived, err := repo.Archive(context.Background(), repositories.ArchiveOptions{Before: cutoff, BatchSize: 10})
+	require.NoError(t, err)
+	assert.Equal(t, 1, archived)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_Archive_ColdStore(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewOrderRepository(db)
+	cutoff := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	first := createTestOrder()
+	first.OrderUID = "old-1"
+	second := createTestOrder()
+	second.OrderUID = "old-2"
+
+	expectArchiveBatch(mock, cutoff, 2, first, second)
+	mock.ExpectExec("DELETE FROM orders WHERE order_uid = ANY").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+	expectArchiveBatch(mock, cutoff, 2)
+
+	var stored []string
+	archived, err := repo.Archive(context.Background(), repositories.ArchiveOptions{
+		Before:    cutoff,
+		BatchSize: 2,
+		ColdStore: func(ctx context.Context, batch []repositories.SealedOrder) error {
+			for _, sealed := range batch {
+				stored = append(stored, sealed.Order.OrderUID)
+				assert.Nil(t, sealed.KeyID, "without a cipher orders are stored as they are")
+			}
+			return nil
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, archived)
+	assert.Equal(t, []string{"old-1", "old-2"}, stored)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_Archive_ColdStoreSealed(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	cipher := testCipher(t, "k1")
+	repo := NewOrderRepository(db, WithDeliveryCipher(cipher))
+	cutoff := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	order := createTestOrder()
+	d := *order.Delivery
+
+	expectArchiveBatch(mock, cutoff, 2, order)
+	mock.ExpectExec("DELETE FROM orders WHERE order_uid = ANY").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	var stored []byte
+	_, err = repo.Archive(context.Background(), repositories.ArchiveOptions{
+		Before:    cutoff,
+		BatchSize: 2,
+		ColdStore: func(ctx context.Context, batch []repositories.SealedOrder) error {
+			require.Len(t, batch, 1)
+			stored, err = json.Marshal(batch[0])
+			return err
+		},
+	})
+	require.NoError(t, err)
+
+	// В холодное хранилище данные получателя попадают только зашифрованными
+	for _, value := range []string{d.Name, d.Phone, d.Address, d.Email} {
+		assert.NotContains(t, string(stored), value)
+	}
+	var sealed repositories.SealedOrder
+	require.NoError(t, json.Unmarshal(stored, &sealed))
+	require.NotNil(t, sealed.KeyID)
+	assert.Equal(t, "k1", *sealed.KeyID)
+	assert.Equal(t, cipher.BlindIndex("email", d.Email), *sealed.EmailBidx)
+
+	envelope, err := cipher.OpenEnvelope(context.Background(), *sealed.KeyID, sealed.DEK)
+	require.NoError(t, err)
+	require.NoError(t, decryptOrder(envelope, sealed.Order))
+	assert.Equal(t, d, *sealed.Order.Delivery)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_List_IncludeArchived(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewOrderRepository(db)
+	live := createTestOrder()
+	live.OrderUID = "live"
+	live.DateCreated = time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	newer := createTestOrder()
+	newer.OrderUID = "archived-newer"
+	newer.DateCreated = time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+	older := createTestOrder()
+	older.OrderUID = "archived-older"
+	older.DateCreated = time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	archivedRows := sqlmock.NewRows([]string{"document", "deleted_at", "key_id", "dek"})
+	for _, order := range []*model.Order{newer, older} {
+		raw, err := json.Marshal(order)
+		require.NoError(t, err)
+		archivedRows.AddRow(raw, nil, nil, nil)
+	}
+
+	mock.ExpectQuery(`FROM orders o .* WHERE o.deleted_at IS NULL AND o.customer_id = \$1 ORDER BY o.date_created DESC, o.order_uid DESC LIMIT 3`).
+		WithArgs(live.CustomerID).
+		WillReturnRows(addOrderRow(newOrderRows(), live))
+	mock.ExpectQuery(`FROM orders_archive o WHERE o.deleted_at IS NULL AND o.customer_id = \$1 ORDER BY o.date_created DESC, o.order_uid DESC LIMIT 3`).
+		WithArgs(live.CustomerID).
+		WillReturnRows(archivedRows)
+	mock.ExpectQuery("SELECT order_uid, chrt_id").
+		WillReturnRows(sqlmock.NewRows([]string{
+			"order_uid", "chrt_id", "track_number", "price", "rid", "name", "sale", "size", "total_price", "nm_id", "brand", "status",
+		}))
+
+	page, err := repo.List(context.Background(), repositories.ListOptions{
+		Filter: repositories.OrderFilter{CustomerID: live.CustomerID, IncludeArchived: true},
+		Limit:  2,
+	})
+	require.NoError(t, err)
+	require.Len(t, page.Orders, 2)
+	assert.Equal(t, "archived-newer", page.Orders[0].OrderUID)
+	assert.Equal(t, "live", page.Orders[1].OrderUID)
+	assert.Len(t, page.Orders[0].Items, 1, "archived items come from the document")
+	assert.NotEmpty(t, page.NextCursor)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
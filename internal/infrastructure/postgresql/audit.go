@@ -0,0 +1,303 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"shop-microservice/internal/domain/model"
+	"shop-microservice/internal/domain/repositories"
+	"time"
+)
+
+// recordAudit - appends an audit entry for one order change inside tx.
+// before is nil for a new order, after is nil for a deleted one.
+// Actor and channel are taken from ctx. With a cipher, delivery PII in the snapshot
+// and the changes is encrypted under the data key of the entry.
+func (r *OrderRepository) recordAudit(ctx context.Context, tx *sql.Tx, action model.AuditAction, before, after *model.Order) error {
+	current := after
+	if current == nil {
+		current = before
+	}
+
+	diff := model.DiffOrders(before, after)
+	envelope, err := r.documentEnvelope(ctx, changesHavePII(diff) || (after != nil && after.Delivery != nil))
+	if err != nil {
+		return errFail("audit: %w", err)
+	}
+	if err := encryptChanges(envelope, diff); err != nil {
+		return errFail("audit: %w", err)
+	}
+	changes, err := json.Marshal(diff)
+	if err != nil {
+		return errFail("audit: %w", err)
+	}
+
+	var snapshot sql.NullString
+	if after != nil {
+		sealed := after.Clone()
+		if err := encryptOrder(envelope, sealed); err != nil {
+			return errFail("audit: %w", err)
+		}
+		raw, err := json.Marshal(sealed)
+		if err != nil {
+			return errFail("audit: %w", err)
+		}
+		snapshot = sql.NullString{String: string(raw), Valid: true}
+	}
+
+	key := keyOf(envelope)
+	_, err = tx.ExecContext(ctx, `
+        INSERT INTO order_audit (order_uid, version, action, actor, channel, changes, snapshot, key_id, dek)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`, current.OrderUID, current.Version, action,
+		repositories.ActorFromContext(ctx), repositories.ChannelFromContext(ctx), string(changes), snapshot,
+		key.keyID, key.wrappedKey())
+	if err != nil {
+		return errFail("audit: %w", err)
+	}
+	return nil
+}
+
+// recordBulkAudit - copies audit entries for the orders left in staging_orders after
+// a bulk load. Only snapshots are recorded; status, version and updated_at are read
+// back from orders since the merge assigns them.
+func (r *OrderRepository) recordBulkAudit(ctx context.Context, tx *sql.Tx, action model.AuditAction, orders []*model.Order) error {
+	rows, err := tx.QueryContext(ctx, `
+        SELECT o.order_uid, o.status, o.version, o.updated_at
+        FROM orders o JOIN staging_orders s ON s.order_uid = o.order_uid
+	`)
+	if err != nil {
+		return errFail("audit: %w", err)
+	}
+	stored := make(map[string]*model.Order)
+	for rows.Next() {
+		var state model.Order
+		if err := rows.Scan(&state.OrderUID, &state.Status, &state.Version, &state.UpdatedAt); err != nil {
+			rows.Close()
+			return errFail("audit: %w", err)
+		}
+		stored[state.OrderUID] = &state
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return errFail("audit: %w", err)
+	}
+
+	actor := repositories.ActorFromContext(ctx)
+	channel := repositories.ChannelFromContext(ctx)
+	var sealErr error
+	err = copyRows(ctx, tx, "order_audit", []string{
+		"order_uid", "version", "action", "actor", "channel", "snapshot", "key_id", "dek",
+	}, orders, func(order *model.Order) [][]any {
+		state, ok := stored[order.OrderUID]
+		if !ok || sealErr != nil {
+			return nil
+		}
+		snapshot := order.Clone()
+		snapshot.Status, snapshot.Version, snapshot.UpdatedAt = state.Status, state.Version, state.UpdatedAt
+		envelope, err := r.documentEnvelope(ctx, snapshot.Delivery != nil)
+		if err == nil {
+			err = encryptOrder(envelope, snapshot)
+		}
+		raw, marshalErr := json.Marshal(snapshot)
+		if err == nil {
+			err = marshalErr
+		}
+		if err != nil {
+			sealErr = err
+			return nil
+		}
+		key := keyOf(envelope)
+		return [][]any{{order.OrderUID, state.Version, string(action), actor, channel, string(raw),
+			key.keyID, key.wrappedKey()}}
+	})
+	if err == nil {
+		err = sealErr
+	}
+	if err != nil {
+		return errFail("audit: %w", err)
+	}
+	return nil
+}
+
+// AuditHistory - returns audit entries of the order, oldest first, without snapshots.
+// Entries of deleted orders are kept, so the history of a deleted order is available.
+func (r *OrderRepository) AuditHistory(ctx context.Context, uid string) ([]model.AuditEntry, error) {
+	query := `
+        SELECT id, order_uid, version, action, actor, channel, changed_at, changes, key_id, dek
+        FROM order_audit
+        WHERE order_uid = $1
+        ORDER BY id
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, uid)
+	if err != nil {
+		return nil, errFail("Audit History: %w", err)
+	}
+	defer rows.Close()
+
+	history := make([]model.AuditEntry, 0)
+	for rows.Next() {
+		var entry model.AuditEntry
+		var changes []byte
+		var key documentKey
+		if err := rows.Scan(
+			&entry.ID, &entry.OrderUID, &entry.Version, &entry.Action, &entry.Actor, &entry.Channel,
+			&entry.ChangedAt, &changes, &key.keyID, &key.dek,
+		); err != nil {
+			return nil, errFail("Audit History: %w", err)
+		}
+		if changes != nil {
+			entry.Changes = &model.OrderDiff{}
+			if err := json.Unmarshal(changes, entry.Changes); err != nil {
+				return nil, errFail("Audit History: entry %d: %w", entry.ID, err)
+			}
+			envelope, err := r.openDocumentKey(ctx, key)
+			if err == nil {
+				err = decryptChanges(envelope, entry.Changes)
+			}
+			if err != nil {
+				return nil, errFail("Audit History: entry %d: %w", entry.ID, err)
+			}
+		}
+		history = append(history, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errFail("Audit History: %w", err)
+	}
+
+	// Заказы, созданные до появления журнала, не имеют записей
+	if len(history) == 0 {
+		var exists bool
+		err := r.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM orders WHERE order_uid = $1)", uid).Scan(&exists)
+		if err != nil {
+			return nil, errFail("Audit History: %w", err)
+		}
+		if !exists {
+			return nil, errFail("Audit History: %w", repositories.ErrOrderNotFound)
+		}
+	}
+
+	return history, nil
+}
+
+// OrderAsOf - returns the order as it was at the moment at, taken from the snapshot of
+// the last audit entry recorded up to that moment. Only delete and purge entries without
+// a snapshot mean the order was gone; other such entries (anonymization of a working
+// order) are skipped in favour of the previous, already scrubbed snapshot. An order
+// written before the audit log existed and not changed since is returned from the
+// orders table.
+func (r *OrderRepository) OrderAsOf(ctx context.Context, uid string, at time.Time) (*model.Order, error) {
+	fail := func(err error) (*model.Order, error) {
+		return nil, errFail("Order As Of: %w", err)
+	}
+
+	snapshot, found, err := r.querySnapshot(ctx, `
+        SELECT snapshot, key_id, dek FROM order_audit
+        WHERE order_uid = $1 AND changed_at <= $2
+          AND (snapshot IS NOT NULL OR action IN ($3, $4))
+        ORDER BY id DESC
+        LIMIT 1
+	`, uid, at, string(model.AuditDelete), string(model.AuditPurge))
+	if err != nil {
+		return fail(err)
+	}
+	if found {
+		// Последняя запись до момента - удаление
+		if snapshot == nil {
+			return fail(repositories.ErrRevisionNotFound)
+		}
+		return snapshot, nil
+	}
+
+	current, err := r.currentRevision(ctx, uid)
+	if err != nil {
+		return fail(err)
+	}
+	if current.UpdatedAt.After(at) {
+		return fail(repositories.ErrRevisionNotFound)
+	}
+	return current, nil
+}
+
+// OrderAtVersion - returns the order as it was at the given version, taken from the audit
+// snapshots. The current version is also served for orders written before the audit log.
+func (r *OrderRepository) OrderAtVersion(ctx context.Context, uid string, version int64) (*model.Order, error) {
+	fail := func(err error) (*model.Order, error) {
+		return nil, errFail("Order At Version: %w", err)
+	}
+
+	snapshot, found, err := r.querySnapshot(ctx, `
+        SELECT snapshot, key_id, dek FROM order_audit
+        WHERE order_uid = $1 AND version = $2 AND snapshot IS NOT NULL
+        ORDER BY id DESC
+        LIMIT 1
+	`, uid, version)
+	if err != nil {
+		return fail(err)
+	}
+	if found {
+		return snapshot, nil
+	}
+
+	current, err := r.currentRevision(ctx, uid)
+	if err != nil {
+		return fail(err)
+	}
+	if current.Version != version {
+		return fail(repositories.ErrRevisionNotFound)
+	}
+	return current, nil
+}
+
+// querySnapshot - runs a query selecting one audit snapshot with its key. found reports
+// whether an entry matched; the snapshot of a delete entry is nil.
+func (r *OrderRepository) querySnapshot(ctx context.Context, query string, args ...any) (*model.Order, bool, error) {
+	var raw []byte
+	var key documentKey
+	err := r.db.QueryRowContext(ctx, query, args...).Scan(&raw, &key.keyID, &key.dek)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if raw == nil {
+		return nil, true, nil
+	}
+
+	var order model.Order
+	if err := json.Unmarshal(raw, &order); err != nil {
+		return nil, false, fmt.Errorf("snapshot: %w", err)
+	}
+	envelope, err := r.openDocumentKey(ctx, key)
+	if err == nil {
+		err = decryptOrder(envelope, &order)
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("snapshot: %w", err)
+	}
+	return &order, true, nil
+}
+
+// currentRevision - loads the stored order when the audit log has no matching snapshot.
+// A deleted order that still has audit entries yields ErrRevisionNotFound rather than
+// ErrOrderNotFound: the order is known, only the requested revision is missing.
+func (r *OrderRepository) currentRevision(ctx context.Context, uid string) (*model.Order, error) {
+	current, err := r.loadOrder(ctx, r.db, uid)
+	if err == nil || !errors.Is(err, repositories.ErrOrderNotFound) {
+		return current, err
+	}
+
+	var audited bool
+	err = r.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM order_audit WHERE order_uid = $1)", uid).Scan(&audited)
+	if err != nil {
+		return nil, err
+	}
+	if audited {
+		return nil, repositories.ErrRevisionNotFound
+	}
+	return nil, repositories.ErrOrderNotFound
+}
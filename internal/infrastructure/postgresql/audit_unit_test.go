@@ -0,0 +1,130 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"shop-microservice/internal/domain/repositories"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrderRepository_OrderAsOf_Snapshot(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewOrderRepository(db)
+	order := createTestOrder()
+	order.Version = 2
+	raw, err := json.Marshal(order)
+	require.NoError(t, err)
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery("SELECT snapshot, key_id, dek FROM order_audit .* changed_at <= \\$2").
+		WithArgs(order.OrderUID, at, "delete", "purge").
+		WillReturnRows(sqlmock.NewRows([]string{"snapshot", "key_id", "dek"}).AddRow(raw, nil, nil))
+
+	found, err := repo.OrderAsOf(context.Background(), order.OrderUID, at)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), found.Version)
+	assert.Equal(t, order.TrackNumber, found.TrackNumber)
+	require.Len(t, found.Items, 1)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_OrderAsOf_Deleted(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewOrderRepository(db)
+
+	mock.ExpectQuery("SELECT snapshot, key_id, dek FROM order_audit").
+		WithArgs("gone", sqlmock.AnyArg(), "delete", "purge").
+		WillReturnRows(sqlmock.NewRows([]string{"snapshot", "key_id", "dek"}).AddRow(nil, nil, nil))
+
+	_, err = repo.OrderAsOf(context.Background(), "gone", time.Now())
+	require.ErrorIs(t, err, repositories.ErrRevisionNotFound)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_OrderAsOf_Anonymized(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewOrderRepository(db)
+	order := createTestOrder()
+	order.Delivery.Email, order.Delivery.Phone = "", ""
+	raw, err := json.Marshal(order)
+	require.NoError(t, err)
+
+	// Запись анонимизации без снимка пропускается, берется предыдущий очищенный снимок
+	mock.ExpectQuery("SELECT snapshot, key_id, dek FROM order_audit .* AND \\(snapshot IS NOT NULL OR action IN \\(\\$3, \\$4\\)\\)").
+		WithArgs(order.OrderUID, sqlmock.AnyArg(), "delete", "purge").
+		WillReturnRows(sqlmock.NewRows([]string{"snapshot", "key_id", "dek"}).AddRow(raw, nil, nil))
+
+	found, err := repo.OrderAsOf(context.Background(), order.OrderUID, time.Now())
+	require.NoError(t, err)
+	assert.Empty(t, found.Delivery.Email)
+	assert.Equal(t, order.TrackNumber, found.TrackNumber)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_OrderAsOf_BeforeAudit(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewOrderRepository(db)
+	order := createTestOrder()
+
+	mock.ExpectQuery("SELECT snapshot, key_id, dek FROM order_audit").
+		WithArgs(order.OrderUID, sqlmock.AnyArg(), "delete", "purge").
+		WillReturnRows(sqlmock.NewRows([]string{"snapshot", "key_id", "dek"}))
+	mock.ExpectQuery("SELECT o.order_uid").
+		WithArgs(order.OrderUID).
+		WillReturnRows(addOrderRow(newOrderRows(), order))
+	mock.ExpectQuery("SELECT chrt_id").
+		WithArgs(order.OrderUID).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"chrt_id", "track_number", "price", "rid", "name", "sale", "size", "total_price", "nm_id", "brand", "status",
+		}))
+
+	// Заказ изменен позже запрошенного момента, а журнала о прошлом состоянии нет
+	_, err = repo.OrderAsOf(context.Background(), order.OrderUID, order.UpdatedAt.Add(-time.Hour))
+	require.ErrorIs(t, err, repositories.ErrRevisionNotFound)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_OrderAtVersion_NotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewOrderRepository(db)
+
+	mock.ExpectQuery("SELECT snapshot, key_id, dek FROM order_audit .* version = \\$2 AND snapshot IS NOT NULL").
+		WithArgs("missing", int64(3)).
+		WillReturnRows(sqlmock.NewRows([]string{"snapshot", "key_id", "dek"}))
+	mock.ExpectQuery("SELECT o.order_uid").
+		WithArgs("missing").
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM order_audit").
+		WithArgs("missing").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+	_, err = repo.OrderAtVersion(context.Background(), "missing", 3)
+	require.ErrorIs(t, err, repositories.ErrOrderNotFound)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,414 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"shop-microservice/internal/domain/model"
+	"shop-microservice/internal/domain/repositories"
+
+	"github.com/lib/pq"
+)
+
+var (
+	_ repositories.BulkImporter  = (*OrderRepository)(nil)
+	_ repositories.OrderRestorer = (*OrderRepository)(nil)
+)
+
+// Staging tables are created per transaction and dropped on commit
+const createStagingTables = `
+        CREATE TEMP TABLE staging_orders ON COMMIT DROP AS
+            SELECT order_uid, track_number, entry, locale, internal_signature, customer_id,
+                   delivery_service, shardkey, sm_id, date_created, oof_shard,
+                   status, version, updated_at
+            FROM orders WITH NO DATA;
+        CREATE TEMP TABLE staging_deliveries ON COMMIT DROP AS
+            SELECT order_uid, date_created, name, phone, zip, city, address, region, email,
+                   key_id, dek, email_bidx, phone_bidx
+            FROM deliveries WITH NO DATA;
+        CREATE TEMP TABLE staging_payments ON COMMIT DROP AS
+            SELECT order_uid, date_created, transaction, request_id, currency, provider, amount,
+                   payment_dt, bank, delivery_cost, goods_total, custom_fee
+            FROM payments WITH NO DATA;
+        CREATE TEMP TABLE staging_items ON COMMIT DROP AS
+            SELECT order_uid, date_created, chrt_id, track_number, price, rid, name, sale, size,
+                   total_price, nm_id, brand, status
+            FROM items WITH NO DATA;
+`
+
+// mergeStagingTables upserts staged rows like Save does: existing orders get a new
+// version, their items are replaced, statuses are left to the state machine.
+// Soft-deleted orders are brought back, orders staged with another date_created are
+// moved to its partition first.
+var mergeStagingTables = moveOrders("staging_orders t") + `;
+
+        INSERT INTO orders (
+            order_uid, track_number, entry, locale, internal_signature, customer_id,
+            delivery_service, shardkey, sm_id, date_created, oof_shard, version, updated_at
+        )
+        SELECT order_uid, track_number, entry, locale, internal_signature, customer_id,
+               delivery_service, shardkey, sm_id, date_created, oof_shard, 1, now()
+        FROM staging_orders
+        ON CONFLICT (order_uid, date_created) DO UPDATE SET
+            track_number = EXCLUDED.track_number,
+            entry = EXCLUDED.entry,
+            locale = EXCLUDED.locale,
+            internal_signature = EXCLUDED.internal_signature,
+            customer_id = EXCLUDED.customer_id,
+            delivery_service = EXCLUDED.delivery_service,
+            shardkey = EXCLUDED.shardkey,
+            sm_id = EXCLUDED.sm_id,
+            oof_shard = EXCLUDED.oof_shard,
+            version = orders.version + 1,
+            updated_at = now(),
+            deleted_at = NULL;
+
+        INSERT INTO deliveries (
+            order_uid, date_created, name, phone, zip, city, address, region, email,
+            key_id, dek, email_bidx, phone_bidx
+        )
+        SELECT order_uid, date_created, name, phone, zip, city, address, region, email,
+               key_id, dek, email_bidx, phone_bidx
+        FROM staging_deliveries
+        ON CONFLICT (order_uid) DO UPDATE SET
+            name = EXCLUDED.name,
+            phone = EXCLUDED.phone,
+            zip = EXCLUDED.zip,
+            city = EXCLUDED.city,
+            address = EXCLUDED.address,
+            region = EXCLUDED.region,
+            email = EXCLUDED.email,
+            key_id = EXCLUDED.key_id,
+            dek = EXCLUDED.dek,
+            email_bidx = EXCLUDED.email_bidx,
+            phone_bidx = EXCLUDED.phone_bidx;
+
+        INSERT INTO payments (
+            order_uid, date_created, transaction, request_id, currency, provider, amount,
+            payment_dt, bank, delivery_cost, goods_total, custom_fee
+        )
+        SELECT order_uid, date_created, transaction, request_id, currency, provider, amount,
+               payment_dt, bank, delivery_cost, goods_total, custom_fee
+        FROM staging_payments
+        ON CONFLICT (order_uid) DO UPDATE SET
+            transaction = EXCLUDED.transaction,
+            request_id = EXCLUDED.request_id,
+            currency = EXCLUDED.currency,
+            provider = EXCLUDED.provider,
+            amount = EXCLUDED.amount,
+            payment_dt = EXCLUDED.payment_dt,
+            bank = EXCLUDED.bank,
+            delivery_cost = EXCLUDED.delivery_cost,
+            goods_total = EXCLUDED.goods_total,
+            custom_fee = EXCLUDED.custom_fee;
+
+        DELETE FROM items WHERE order_uid IN (SELECT order_uid FROM staging_orders);
+
+        INSERT INTO items (
+            order_uid, date_created, chrt_id, track_number, price, rid, name, sale, size,
+            total_price, nm_id, brand, status
+        )
+        SELECT order_uid, date_created, chrt_id, track_number, price, rid, name, sale, size,
+               total_price, nm_id, brand, status
+        FROM staging_items;
+`
+
+// restoreStagingTables writes staged orders as they are, including status and
+// updated_at. New orders keep the version from the backup; an overwritten order gets
+// a version above both its own and the backup one, so versions never move backwards
+// and caches and ETags notice the change. A restored status counts as changed at the
+// backup updated_at, unless the order already has it. Parts of restored orders are replaced, so
+// a draft in the backup stays a draft. Orders are moved to the partition of the backup
+// date_created first.
+var restoreStagingTables = moveOrders("staging_orders t") + `;
+
+        DELETE FROM deliveries WHERE order_uid IN (SELECT order_uid FROM staging_orders);
+        DELETE FROM payments WHERE order_uid IN (SELECT order_uid FROM staging_orders);
+        DELETE FROM items WHERE order_uid IN (SELECT order_uid FROM staging_orders);
+
+        INSERT INTO orders (
+            order_uid, track_number, entry, locale, internal_signature, customer_id,
+            delivery_service, shardkey, sm_id, date_created, oof_shard, status, status_changed_at,
+            version, updated_at
+        )
+        SELECT order_uid, track_number, entry, locale, internal_signature, customer_id,
+               delivery_service, shardkey, sm_id, date_created, oof_shard, status, updated_at,
+               version, updated_at
+        FROM staging_orders
+        ON CONFLICT (order_uid, date_created) DO UPDATE SET
+            track_number = EXCLUDED.track_number,
+            entry = EXCLUDED.entry,
+            locale = EXCLUDED.locale,
+            internal_signature = EXCLUDED.internal_signature,
+            customer_id = EXCLUDED.customer_id,
+            delivery_service = EXCLUDED.delivery_service,
+            shardkey = EXCLUDED.shardkey,
+            sm_id = EXCLUDED.sm_id,
+            oof_shard = EXCLUDED.oof_shard,
+            status = EXCLUDED.status,
+            status_changed_at = CASE
+                WHEN orders.status = EXCLUDED.status THEN orders.status_changed_at
+                ELSE EXCLUDED.status_changed_at
+            END,
+            version = GREATEST(orders.version, EXCLUDED.version) + 1,
+            updated_at = EXCLUDED.updated_at,
+            deleted_at = NULL;
+
+        INSERT INTO deliveries (
+            order_uid, date_created, name, phone, zip, city, address, region, email,
+            key_id, dek, email_bidx, phone_bidx
+        )
+        SELECT order_uid, date_created, name, phone, zip, city, address, region, email,
+               key_id, dek, email_bidx, phone_bidx
+        FROM staging_deliveries
+        WHERE order_uid IN (SELECT order_uid FROM staging_orders);
+
+        INSERT INTO payments (
+            order_uid, date_created, transaction, request_id, currency, provider, amount,
+            payment_dt, bank, delivery_cost, goods_total, custom_fee
+        )
+        SELECT order_uid, date_created, transaction, request_id, currency, provider, amount,
+               payment_dt, bank, delivery_cost, goods_total, custom_fee
+        FROM staging_payments
+        WHERE order_uid IN (SELECT order_uid FROM staging_orders);
+
+        INSERT INTO items (
+            order_uid, date_created, chrt_id, track_number, price, rid, name, sale, size,
+            total_price, nm_id, brand, status
+        )
+        SELECT order_uid, date_created, chrt_id, track_number, price, rid, name, sale, size,
+               total_price, nm_id, brand, status
+        FROM staging_items
+        WHERE order_uid IN (SELECT order_uid FROM staging_orders);
+`
+
+// Import - bulk loads orders with COPY into staging tables and merges them into
+// orders, deliveries, payments and items in one transaction. Order uids must be
+// unique within the call.
+func (r *OrderRepository) Import(ctx context.Context, orders []*model.Order) error {
+	fail := func(err error) error {
+		return fmt.Errorf("Import Orders: %w", err)
+	}
+
+	if len(orders) == 0 {
+		return nil
+	}
+
+	if err := ensureOrderPartitions(ctx, r.db, orderDates(orders)...); err != nil {
+		return fail(err)
+	}
+
+	tx, err := r.begin(ctx)
+	if err != nil {
+		return fail(err)
+	}
+	defer tx.Rollback()
+
+	if err := lockOrderUIDs(ctx, tx, orderUIDs(orders)...); err != nil {
+		return fail(err)
+	}
+
+	if err := r.stageOrders(ctx, tx, orders); err != nil {
+		return fail(err)
+	}
+
+	if _, err := tx.ExecContext(ctx, mergeStagingTables); err != nil {
+		return fail(err)
+	}
+
+	if err := r.recordBulkAudit(ctx, tx, model.AuditImport, orders); err != nil {
+		return fail(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fail(err)
+	}
+
+	return nil
+}
+
+// Restore - loads orders from a backup through the same staging tables as Import,
+// keeping their status and updated_at. Existing orders are handled by policy,
+// soft-deleted ones are overwritten. Every restored order gets a restore audit entry
+// with the version it ends up with.
+func (r *OrderRepository) Restore(ctx context.Context, orders []*model.Order, policy repositories.RestorePolicy) (int, error) {
+	fail := func(err error) (int, error) {
+		return 0, fmt.Errorf("Restore Orders: %w", err)
+	}
+
+	if len(orders) == 0 {
+		return 0, nil
+	}
+
+	if err := ensureOrderPartitions(ctx, r.db, orderDates(orders)...); err != nil {
+		return fail(err)
+	}
+
+	tx, err := r.begin(ctx)
+	if err != nil {
+		return fail(err)
+	}
+	defer tx.Rollback()
+
+	if err := lockOrderUIDs(ctx, tx, orderUIDs(orders)...); err != nil {
+		return fail(err)
+	}
+
+	if err := r.stageOrders(ctx, tx, orders); err != nil {
+		return fail(err)
+	}
+
+	switch policy {
+	case repositories.RestoreFail:
+		var conflict repositories.ConflictError
+		err := tx.QueryRowContext(ctx, `
+            SELECT s.order_uid, o.version
+            FROM staging_orders s JOIN orders o ON o.order_uid = s.order_uid AND o.deleted_at IS NULL
+            ORDER BY s.order_uid LIMIT 1`).Scan(&conflict.OrderUID, &conflict.Version)
+		if err == nil {
+			return fail(&conflict)
+		}
+		if err != sql.ErrNoRows {
+			return fail(err)
+		}
+	case repositories.RestoreSkip:
+		_, err := tx.ExecContext(ctx, `
+            DELETE FROM staging_orders s USING orders o
+            WHERE s.order_uid = o.order_uid AND o.deleted_at IS NULL`)
+		if err != nil {
+			return fail(err)
+		}
+	case repositories.RestoreOverwrite:
+	default:
+		return fail(errFail("unknown restore policy %q", policy))
+	}
+
+	var restored int
+	if err := tx.QueryRowContext(ctx, `SELECT count(*) FROM staging_orders`).Scan(&restored); err != nil {
+		return fail(err)
+	}
+
+	if _, err := tx.ExecContext(ctx, restoreStagingTables); err != nil {
+		return fail(err)
+	}
+
+	if err := r.recordBulkAudit(ctx, tx, model.AuditRestore, orders); err != nil {
+		return fail(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fail(err)
+	}
+
+	return restored, nil
+}
+
+// stageOrders - creates the staging tables and copies orders with their parts into them;
+// deliveries are encrypted before they leave the service
+func (r *OrderRepository) stageOrders(ctx context.Context, tx *sql.Tx, orders []*model.Order) error {
+	deliveries := make(map[string]storedDelivery, len(orders))
+	for _, order := range orders {
+		if order.Delivery == nil {
+			continue
+		}
+		stored, err := r.sealDelivery(ctx, order.Delivery)
+		if err != nil {
+			return err
+		}
+		deliveries[order.OrderUID] = stored
+	}
+
+	if _, err := tx.ExecContext(ctx, createStagingTables); err != nil {
+		return err
+	}
+
+	err := copyRows(ctx, tx, "staging_orders", []string{
+		"order_uid", "track_number", "entry", "locale", "internal_signature", "customer_id",
+		"delivery_service", "shardkey", "sm_id", "date_created", "oof_shard",
+		"status", "version", "updated_at",
+	}, orders, func(order *model.Order) [][]any {
+		return [][]any{{
+			order.OrderUID, order.TrackNumber, order.Entry, order.Locale, order.InternalSignature, order.CustomerID,
+			order.DeliveryService, order.Shardkey, order.SmID, order.DateCreated, order.OofShard,
+			string(order.Status), order.Version, order.UpdatedAt,
+		}}
+	})
+	if err != nil {
+		return err
+	}
+
+	err = copyRows(ctx, tx, "staging_deliveries", []string{
+		"order_uid", "date_created", "name", "phone", "zip", "city", "address", "region", "email",
+		"key_id", "dek", "email_bidx", "phone_bidx",
+	}, orders, func(order *model.Order) [][]any {
+		d := order.Delivery
+		if d == nil {
+			return nil
+		}
+		s := deliveries[order.OrderUID]
+		return [][]any{{
+			order.OrderUID, order.DateCreated, s.name, s.phone, d.Zip, d.City, s.address, d.Region, s.email,
+			s.keyID, s.wrappedKey(), s.emailIndex, s.phoneIndex,
+		}}
+	})
+	if err != nil {
+		return err
+	}
+
+	err = copyRows(ctx, tx, "staging_payments", []string{
+		"order_uid", "date_created", "transaction", "request_id", "currency", "provider", "amount", "payment_dt",
+		"bank", "delivery_cost", "goods_total", "custom_fee",
+	}, orders, func(order *model.Order) [][]any {
+		p := order.Payment
+		if p == nil {
+			return nil
+		}
+		return [][]any{{
+			order.OrderUID, order.DateCreated, p.Transaction, p.RequestID, p.Currency, p.Provider, p.Amount, p.PaymentDt,
+			p.Bank, p.DeliveryCost, p.GoodsTotal, p.CustomFee,
+		}}
+	})
+	if err != nil {
+		return err
+	}
+
+	err = copyRows(ctx, tx, "staging_items", []string{
+		"order_uid", "date_created", "chrt_id", "track_number", "price", "rid", "name", "sale", "size",
+		"total_price", "nm_id", "brand", "status",
+	}, orders, func(order *model.Order) [][]any {
+		rows := make([][]any, 0, len(order.Items))
+		for _, item := range order.Items {
+			rows = append(rows, []any{
+				order.OrderUID, order.DateCreated, item.ChrtID, item.TrackNumber, item.Price, item.Rid, item.Name, item.Sale, item.Size,
+				item.TotalPrice, item.NmID, item.Brand, item.Status,
+			})
+		}
+		return rows
+	})
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// copyRows - streams rows produced by rowsOf for every order into table with COPY FROM STDIN
+func copyRows(ctx context.Context, tx *sql.Tx, table string, columns []string, orders []*model.Order, rowsOf func(order *model.Order) [][]any) error {
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn(table, columns...))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, order := range orders {
+		for _, row := range rowsOf(order) {
+			if _, err := stmt.ExecContext(ctx, row...); err != nil {
+				return errFail("copy into %s: %w", table, err)
+			}
+		}
+	}
+
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		return errFail("copy into %s: %w", table, err)
+	}
+	return stmt.Close()
+}
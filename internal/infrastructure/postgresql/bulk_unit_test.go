@@ -0,0 +1,158 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"shop-microservice/internal/domain/model"
+	"shop-microservice/internal/domain/repositories"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// expectCopy ожидает COPY в таблицу: по Exec на каждую строку и завершающий Exec без аргументов
+func expectCopy(mock sqlmock.Sqlmock, table string, rows int) {
+	query := `COPY "` + table + `"`
+	mock.ExpectPrepare(query)
+	for i := 0; i < rows; i++ {
+		mock.ExpectExec(query).WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	mock.ExpectExec(query).WithoutArgs().WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func TestOrderRepository_Import_Unit(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewOrderRepository(db)
+	order := createTestOrder()
+	draft := createTestOrder()
+	draft.OrderUID = "draft-order"
+	draft.Delivery = nil
+	draft.Payment = nil
+
+	expectPartitions(mock, order.DateCreated)
+	mock.ExpectBegin()
+	expectUIDLock(mock, draft.OrderUID, order.OrderUID)
+	mock.ExpectExec("CREATE TEMP TABLE staging_orders").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectCopy(mock, "staging_orders", 2)
+	expectCopy(mock, "staging_deliveries", 1)
+	expectCopy(mock, "staging_payments", 1)
+	expectCopy(mock, "staging_items", len(order.Items)+len(draft.Items))
+	mock.ExpectExec("WITH target AS .* FROM staging_orders t .* INSERT INTO orders .* FROM staging_orders ON CONFLICT \\(order_uid, date_created\\)").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectQuery("SELECT o.order_uid, o.status, o.version, o.updated_at").
+		WillReturnRows(sqlmock.NewRows([]string{"order_uid", "status", "version", "updated_at"}).
+			AddRow(order.OrderUID, "paid", 4, time.Now()).
+			AddRow(draft.OrderUID, "created", 1, time.Now()))
+	mock.ExpectPrepare(`COPY "order_audit"`)
+	mock.ExpectExec(`COPY "order_audit"`).
+		WithArgs(order.OrderUID, int64(4), "import", repositories.DefaultActor, repositories.ChannelSystem, sqlmock.AnyArg(), nil, nil).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`COPY "order_audit"`).
+		WithArgs(draft.OrderUID, int64(1), "import", repositories.DefaultActor, repositories.ChannelSystem, sqlmock.AnyArg(), nil, nil).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`COPY "order_audit"`).WithoutArgs().WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	err = repo.Import(context.Background(), []*model.Order{order, draft})
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_Import_CopyFailure(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewOrderRepository(db)
+	order := createTestOrder()
+
+	expectPartitions(mock, order.DateCreated)
+	mock.ExpectBegin()
+	expectUIDLock(mock, order.OrderUID)
+	mock.ExpectExec("CREATE TEMP TABLE staging_orders").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectPrepare(`COPY "staging_orders"`)
+	mock.ExpectExec(`COPY "staging_orders"`).WillReturnError(errors.New("invalid input syntax"))
+	mock.ExpectRollback()
+
+	err = repo.Import(context.Background(), []*model.Order{order})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "copy into staging_orders")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_Import_Empty(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.NoError(t, NewOrderRepository(db).Import(context.Background(), nil))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// expectStaging ожидает создание staging-таблиц и COPY одного полного заказа
+func expectStaging(mock sqlmock.Sqlmock, order *model.Order) {
+	mock.ExpectExec("CREATE TEMP TABLE staging_orders").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectCopy(mock, "staging_orders", 1)
+	expectCopy(mock, "staging_deliveries", 1)
+	expectCopy(mock, "staging_payments", 1)
+	expectCopy(mock, "staging_items", len(order.Items))
+}
+
+func TestOrderRepository_Restore_Skip(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewOrderRepository(db)
+	order := createTestOrder()
+
+	expectPartitions(mock, order.DateCreated)
+	mock.ExpectBegin()
+	expectUIDLock(mock, order.OrderUID)
+	expectStaging(mock, order)
+	mock.ExpectExec("DELETE FROM staging_orders s USING orders o").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT count\\(\\*\\) FROM staging_orders").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec("WITH target AS .* FROM staging_orders t .* DELETE FROM deliveries .* INSERT INTO orders .* status = EXCLUDED.status").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT o.order_uid, o.status, o.version, o.updated_at").
+		WillReturnRows(sqlmock.NewRows([]string{"order_uid", "status", "version", "updated_at"}))
+	expectCopy(mock, "order_audit", 0)
+	mock.ExpectCommit()
+
+	restored, err := repo.Restore(context.Background(), []*model.Order{order}, repositories.RestoreSkip)
+	require.NoError(t, err)
+	assert.Equal(t, 0, restored)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_Restore_FailOnConflict(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewOrderRepository(db)
+	order := createTestOrder()
+
+	expectPartitions(mock, order.DateCreated)
+	mock.ExpectBegin()
+	expectUIDLock(mock, order.OrderUID)
+	expectStaging(mock, order)
+	mock.ExpectQuery("SELECT s.order_uid, o.version").
+		WillReturnRows(sqlmock.NewRows([]string{"order_uid", "version"}).AddRow(order.OrderUID, 4))
+	mock.ExpectRollback()
+
+	_, err = repo.Restore(context.Background(), []*model.Order{order}, repositories.RestoreFail)
+	require.ErrorIs(t, err, repositories.ErrOrderExists)
+
+	var conflict *repositories.ConflictError
+	require.ErrorAs(t, err, &conflict)
+	assert.Equal(t, int64(4), conflict.Version)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
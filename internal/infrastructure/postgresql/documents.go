@@ -0,0 +1,423 @@
+package postgresql
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"shop-microservice/internal/domain/model"
+	"shop-microservice/internal/domain/repositories"
+	"shop-microservice/internal/infrastructure/fieldcrypt"
+)
+
+// piiFields - delivery fields stored encrypted, named as in deliveries and in order JSON
+var piiFields = []string{"name", "phone", "address", "email"}
+
+// deliveryPII - pointers to the encrypted fields of a delivery, in piiFields order
+func deliveryPII(d *model.Delivery) []*string {
+	return []*string{&d.Name, &d.Phone, &d.Address, &d.Email}
+}
+
+// documentKey - the key_id and dek columns of an audit entry or an archived order.
+// Delivery PII in the JSON of the row (snapshot and changes, or the archive document)
+// is encrypted under this key; both are NULL for plaintext rows.
+type documentKey struct {
+	keyID sql.NullString
+	dek   []byte
+}
+
+// keyOf - the columns to store for documents sealed with envelope (nil for plaintext)
+func keyOf(envelope *fieldcrypt.Envelope) documentKey {
+	if envelope == nil {
+		return documentKey{}
+	}
+	return documentKey{keyID: sql.NullString{String: envelope.KeyID, Valid: true}, dek: envelope.WrappedKey}
+}
+
+// wrappedKey - the dek column value, NULL for plaintext rows
+func (k documentKey) wrappedKey() any {
+	if k.dek == nil {
+		return nil
+	}
+	return k.dek
+}
+
+// documentEnvelope - a fresh data key for a document holding delivery PII;
+// nil without a cipher or when there is nothing to encrypt
+func (r *OrderRepository) documentEnvelope(ctx context.Context, hasPII bool) (*fieldcrypt.Envelope, error) {
+	if r.cipher == nil || !hasPII {
+		return nil, nil
+	}
+	return r.cipher.NewEnvelope(ctx)
+}
+
+// openDocumentKey - the envelope of a stored document, nil for plaintext rows
+func (r *OrderRepository) openDocumentKey(ctx context.Context, key documentKey) (*fieldcrypt.Envelope, error) {
+	if !key.keyID.Valid {
+		return nil, nil
+	}
+	if r.cipher == nil {
+		return nil, errFail("document is encrypted with key %q, but field encryption is not configured", key.keyID.String)
+	}
+	return r.cipher.OpenEnvelope(ctx, key.keyID.String, key.dek)
+}
+
+// encryptOrder - encrypts delivery PII of order in place; no-op for a nil envelope
+func encryptOrder(envelope *fieldcrypt.Envelope, order *model.Order) error {
+	if envelope == nil || order == nil || order.Delivery == nil {
+		return nil
+	}
+	var err error
+	for i, value := range deliveryPII(order.Delivery) {
+		if *value, err = envelope.Encrypt(piiFields[i], *value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decryptOrder - decrypts delivery PII of order in place; no-op for a nil envelope
+func decryptOrder(envelope *fieldcrypt.Envelope, order *model.Order) error {
+	if envelope == nil || order == nil || order.Delivery == nil {
+		return nil
+	}
+	var err error
+	for i, value := range deliveryPII(order.Delivery) {
+		if *value, err = envelope.Decrypt(piiFields[i], *value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// piiField - the encrypted field behind a change path such as "delivery.email"
+func piiField(path string) (string, bool) {
+	field, ok := strings.CutPrefix(path, "delivery.")
+	if !ok {
+		return "", false
+	}
+	for _, name := range piiFields {
+		if field == name {
+			return field, true
+		}
+	}
+	return "", false
+}
+
+// changesHavePII - whether the diff carries values of encrypted delivery fields
+func changesHavePII(diff *model.OrderDiff) bool {
+	for _, change := range diff.Fields {
+		if _, ok := piiField(change.Field); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// transformChanges - applies fn to the string values of encrypted delivery fields in diff
+func transformChanges(diff *model.OrderDiff, fn func(field, value string) (string, error)) error {
+	for i := range diff.Fields {
+		change := &diff.Fields[i]
+		field, ok := piiField(change.Field)
+		if !ok {
+			continue
+		}
+		for _, value := range []*any{&change.From, &change.To} {
+			text, ok := (*value).(string)
+			if !ok {
+				continue
+			}
+			transformed, err := fn(field, text)
+			if err != nil {
+				return err
+			}
+			*value = transformed
+		}
+	}
+	return nil
+}
+
+// encryptChanges - encrypts delivery PII values of diff in place; no-op for a nil envelope
+func encryptChanges(envelope *fieldcrypt.Envelope, diff *model.OrderDiff) error {
+	if envelope == nil || diff == nil {
+		return nil
+	}
+	return transformChanges(diff, envelope.Encrypt)
+}
+
+// decryptChanges - decrypts delivery PII values of diff in place; no-op for a nil envelope
+func decryptChanges(envelope *fieldcrypt.Envelope, diff *model.OrderDiff) error {
+	if envelope == nil || diff == nil {
+		return nil
+	}
+	return transformChanges(diff, envelope.Decrypt)
+}
+
+// rekeyDocument - the envelopes to re-encrypt a stored document with: from opens its JSON
+// (nil for plaintext), to seals the new JSON (nil to store plaintext). rewrapped reports
+// that only the key columns change and the JSON stays as it is.
+func (r *OrderRepository) rekeyDocument(ctx context.Context, key documentKey, decrypt bool) (from, to *fieldcrypt.Envelope, rewrapped bool, err error) {
+	switch {
+	case !key.keyID.Valid:
+		to, err = r.cipher.NewEnvelope(ctx)
+		return nil, to, false, err
+	case decrypt:
+		from, err = r.openDocumentKey(ctx, key)
+		return from, nil, false, err
+	default:
+		to, err = r.cipher.Rewrap(ctx, key.keyID.String, key.dek)
+		return nil, to, true, err
+	}
+}
+
+// reencryptOrderJSON - decrypts an order document with from and encrypts it with to;
+// also returns the plaintext delivery for blind indexes
+func reencryptOrderJSON(raw []byte, from, to *fieldcrypt.Envelope) (sql.NullString, *model.Delivery, error) {
+	if raw == nil {
+		return sql.NullString{}, nil, nil
+	}
+	var order model.Order
+	if err := decodeJSON(raw, &order); err != nil {
+		return sql.NullString{}, nil, err
+	}
+	if err := decryptOrder(from, &order); err != nil {
+		return sql.NullString{}, nil, err
+	}
+	var plaintext *model.Delivery
+	if order.Delivery != nil {
+		delivery := *order.Delivery
+		plaintext = &delivery
+	}
+	if err := encryptOrder(to, &order); err != nil {
+		return sql.NullString{}, nil, err
+	}
+	encoded, err := json.Marshal(&order)
+	if err != nil {
+		return sql.NullString{}, nil, err
+	}
+	return sql.NullString{String: string(encoded), Valid: true}, plaintext, nil
+}
+
+// reencryptChangesJSON - decrypts audit changes with from and encrypts them with to
+func reencryptChangesJSON(raw []byte, from, to *fieldcrypt.Envelope) (sql.NullString, error) {
+	if raw == nil {
+		return sql.NullString{}, nil
+	}
+	var diff model.OrderDiff
+	if err := decodeJSON(raw, &diff); err != nil {
+		return sql.NullString{}, err
+	}
+	if err := decryptChanges(from, &diff); err != nil {
+		return sql.NullString{}, err
+	}
+	if err := encryptChanges(to, &diff); err != nil {
+		return sql.NullString{}, err
+	}
+	encoded, err := json.Marshal(&diff)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(encoded), Valid: true}, nil
+}
+
+// decodeJSON - unmarshals keeping numbers as json.Number, so values in changes
+// are written back without losing precision
+func decodeJSON(raw []byte, v any) error {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// auditHasPII - audit entries holding delivery PII in the snapshot or the changes
+const auditHasPII = `(jsonb_typeof(snapshot->'delivery') = 'object'
+            OR jsonb_path_exists(changes, '$.fields[*] ? (@.field starts with "delivery.")'))`
+
+// reencryptAuditBatch - re-encrypts one batch of audit entries, see Reencrypt
+func (r *OrderRepository) reencryptAuditBatch(ctx context.Context, opts repositories.ReencryptOptions) (int, error) {
+	tx, err := r.begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Журнал аудита только дописывается, перешифрование - обслуживание
+	if _, err := tx.ExecContext(ctx, "SET LOCAL order_audit.maintenance = 'on'"); err != nil {
+		return 0, err
+	}
+
+	builder := &queryBuilder{}
+	if opts.Decrypt {
+		builder.add("key_id IS NOT NULL")
+	} else {
+		builder.add("key_id IS DISTINCT FROM %s", r.cipher.CurrentKeyID())
+		builder.add("(key_id IS NOT NULL OR " + auditHasPII + ")")
+	}
+	rows, err := tx.QueryContext(ctx, `
+        SELECT id, changes, snapshot, key_id, dek FROM order_audit`+builder.where()+
+		fmt.Sprintf(" ORDER BY id LIMIT %d FOR UPDATE SKIP LOCKED", opts.BatchSize),
+		builder.args...)
+	if err != nil {
+		return 0, err
+	}
+
+	type auditRow struct {
+		id                int64
+		changes, snapshot []byte
+		key               documentKey
+	}
+	var batch []auditRow
+	for rows.Next() {
+		var row auditRow
+		if err := rows.Scan(&row.id, &row.changes, &row.snapshot, &row.key.keyID, &row.key.dek); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		batch = append(batch, row)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(batch) == 0 {
+		return 0, nil
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `
+        UPDATE order_audit SET changes = $2, snapshot = $3, key_id = $4, dek = $5 WHERE id = $1`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	rewrap, err := tx.PrepareContext(ctx, `UPDATE order_audit SET key_id = $2, dek = $3 WHERE id = $1`)
+	if err != nil {
+		return 0, err
+	}
+	defer rewrap.Close()
+
+	for _, row := range batch {
+		from, to, rewrapped, err := r.rekeyDocument(ctx, row.key, opts.Decrypt)
+		if err != nil {
+			return 0, errFail("audit entry %d: %w", row.id, err)
+		}
+		key := keyOf(to)
+		if rewrapped {
+			_, err = rewrap.ExecContext(ctx, row.id, key.keyID, key.wrappedKey())
+		} else {
+			var changes, snapshot sql.NullString
+			changes, err = reencryptChangesJSON(row.changes, from, to)
+			if err == nil {
+				snapshot, _, err = reencryptOrderJSON(row.snapshot, from, to)
+			}
+			if err != nil {
+				return 0, errFail("audit entry %d: %w", row.id, err)
+			}
+			_, err = stmt.ExecContext(ctx, row.id, changes, snapshot, key.keyID, key.wrappedKey())
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(batch), nil
+}
+
+// reencryptArchiveBatch - re-encrypts one batch of archived orders, see Reencrypt
+func (r *OrderRepository) reencryptArchiveBatch(ctx context.Context, opts repositories.ReencryptOptions) (int, error) {
+	tx, err := r.begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	builder := &queryBuilder{}
+	if opts.Decrypt {
+		builder.add("key_id IS NOT NULL")
+	} else {
+		builder.add("key_id IS DISTINCT FROM %s", r.cipher.CurrentKeyID())
+		builder.add("(key_id IS NOT NULL OR jsonb_typeof(document->'delivery') = 'object')")
+	}
+	rows, err := tx.QueryContext(ctx, `
+        SELECT order_uid, date_created, document, key_id, dek FROM orders_archive`+builder.where()+
+		fmt.Sprintf(" ORDER BY order_uid, date_created LIMIT %d FOR UPDATE SKIP LOCKED", opts.BatchSize),
+		builder.args...)
+	if err != nil {
+		return 0, err
+	}
+
+	type archivedRow struct {
+		uid         string
+		dateCreated time.Time
+		document    []byte
+		key         documentKey
+	}
+	var batch []archivedRow
+	for rows.Next() {
+		var row archivedRow
+		if err := rows.Scan(&row.uid, &row.dateCreated, &row.document, &row.key.keyID, &row.key.dek); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		batch = append(batch, row)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(batch) == 0 {
+		return 0, nil
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `
+        UPDATE orders_archive SET document = $3, key_id = $4, dek = $5, email_bidx = $6, phone_bidx = $7
+        WHERE order_uid = $1 AND date_created = $2`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	rewrap, err := tx.PrepareContext(ctx, `
+        UPDATE orders_archive SET key_id = $3, dek = $4 WHERE order_uid = $1 AND date_created = $2`)
+	if err != nil {
+		return 0, err
+	}
+	defer rewrap.Close()
+
+	for _, row := range batch {
+		from, to, rewrapped, err := r.rekeyDocument(ctx, row.key, opts.Decrypt)
+		if err != nil {
+			return 0, errFail("archived order %s: %w", row.uid, err)
+		}
+		key := keyOf(to)
+		if rewrapped {
+			_, err = rewrap.ExecContext(ctx, row.uid, row.dateCreated, key.keyID, key.wrappedKey())
+		} else {
+			document, delivery, err := reencryptOrderJSON(row.document, from, to)
+			if err != nil {
+				return 0, errFail("archived order %s: %w", row.uid, err)
+			}
+			var emailIndex, phoneIndex sql.NullString
+			if to != nil && delivery != nil {
+				emailIndex = nullIfEmpty(r.cipher.BlindIndex("email", delivery.Email))
+				phoneIndex = nullIfEmpty(r.cipher.BlindIndex("phone", delivery.Phone))
+			}
+			_, err = stmt.ExecContext(ctx, row.uid, row.dateCreated, document, key.keyID, key.wrappedKey(),
+				emailIndex, phoneIndex)
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(batch), nil
+}
@@ -0,0 +1,236 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"shop-microservice/internal/domain/model"
+	"shop-microservice/internal/domain/repositories"
+	"shop-microservice/internal/infrastructure/fieldcrypt"
+)
+
+var _ repositories.DeliveryReencrypter = (*OrderRepository)(nil)
+
+// reencryptBatchSize - default number of deliveries re-encrypted per transaction
+const reencryptBatchSize = 500
+
+// storedDelivery - delivery PII columns as written to deliveries. With a cipher name,
+// phone, address and email hold ciphertext, key_id and dek the wrapped data key.
+type storedDelivery struct {
+	name, phone, address, email   string
+	keyID, emailIndex, phoneIndex sql.NullString
+	dek                           []byte
+}
+
+// wrappedKey - the dek column value, NULL for plaintext rows
+func (s storedDelivery) wrappedKey() any {
+	if s.dek == nil {
+		return nil
+	}
+	return s.dek
+}
+
+// sealDelivery - encrypts delivery PII under a fresh data key and builds blind indexes;
+// without a cipher the values are stored as they are
+func (r *OrderRepository) sealDelivery(ctx context.Context, d *model.Delivery) (storedDelivery, error) {
+	stored := storedDelivery{name: d.Name, phone: d.Phone, address: d.Address, email: d.Email}
+	if r.cipher == nil {
+		return stored, nil
+	}
+
+	envelope, err := r.cipher.NewEnvelope(ctx)
+	if err != nil {
+		return storedDelivery{}, err
+	}
+	if err := encryptFields(envelope, &stored); err != nil {
+		return storedDelivery{}, err
+	}
+	stored.keyID = sql.NullString{String: envelope.KeyID, Valid: true}
+	stored.dek = envelope.WrappedKey
+	stored.emailIndex = nullIfEmpty(r.cipher.BlindIndex("email", d.Email))
+	stored.phoneIndex = nullIfEmpty(r.cipher.BlindIndex("phone", d.Phone))
+	return stored, nil
+}
+
+// openDelivery - decrypts delivery PII read from deliveries; rows without key_id are plaintext
+func (r *OrderRepository) openDelivery(ctx context.Context, d *nullDelivery) (*model.Delivery, error) {
+	delivery := d.value()
+	if delivery == nil || !d.keyID.Valid {
+		return delivery, nil
+	}
+	if r.cipher == nil {
+		return nil, errFail("delivery is encrypted with key %q, but field encryption is not configured", d.keyID.String)
+	}
+
+	envelope, err := r.cipher.OpenEnvelope(ctx, d.keyID.String, d.dek)
+	if err != nil {
+		return nil, err
+	}
+	for i, value := range deliveryPII(delivery) {
+		if *value, err = envelope.Decrypt(piiFields[i], *value); err != nil {
+			return nil, err
+		}
+	}
+	return delivery, nil
+}
+
+// encryptFields - replaces plaintext PII of stored with ciphertext
+func encryptFields(envelope *fieldcrypt.Envelope, stored *storedDelivery) error {
+	var err error
+	for _, field := range []struct {
+		name  string
+		value *string
+	}{
+		{"name", &stored.name},
+		{"phone", &stored.phone},
+		{"address", &stored.address},
+		{"email", &stored.email},
+	} {
+		if *field.value, err = envelope.Encrypt(field.name, *field.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func nullIfEmpty(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
+
+// Reencrypt - brings deliveries, audit entries and archived orders to the current key in
+// batches: plaintext rows are encrypted, data keys wrapped by an older key are rewrapped
+// (the fields stay as they are). With opts.Decrypt every encrypted row is stored as
+// plaintext instead. Versions are not changed; caches are refreshed through LISTEN/NOTIFY.
+func (r *OrderRepository) Reencrypt(ctx context.Context, opts repositories.ReencryptOptions) (int, error) {
+	if r.cipher == nil {
+		return 0, errFail("Reencrypt: field encryption is not configured")
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = reencryptBatchSize
+	}
+
+	total := 0
+	for _, batch := range []func(context.Context, repositories.ReencryptOptions) (int, error){
+		r.reencryptBatch, r.reencryptAuditBatch, r.reencryptArchiveBatch,
+	} {
+		for {
+			n, err := batch(ctx, opts)
+			total += n
+			if err != nil {
+				return total, errFail("Reencrypt: %w", err)
+			}
+			if n == 0 {
+				break
+			}
+		}
+	}
+	return total, nil
+}
+
+// reencryptBatch - re-encrypts one batch of deliveries in its own transaction, rows
+// locked by concurrent writers are left for the next batch
+func (r *OrderRepository) reencryptBatch(ctx context.Context, opts repositories.ReencryptOptions) (int, error) {
+	tx, err := r.begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	builder := &queryBuilder{}
+	if opts.Decrypt {
+		builder.add("key_id IS NOT NULL")
+	} else {
+		builder.add("key_id IS DISTINCT FROM %s", r.cipher.CurrentKeyID())
+	}
+	rows, err := tx.QueryContext(ctx, `
+        SELECT order_uid, name, phone, address, email, key_id, dek, email_bidx, phone_bidx
+        FROM deliveries`+builder.where()+
+		fmt.Sprintf(" ORDER BY order_uid LIMIT %d FOR UPDATE SKIP LOCKED", opts.BatchSize),
+		builder.args...)
+	if err != nil {
+		return 0, err
+	}
+
+	uids := make([]string, 0, opts.BatchSize)
+	batch := make([]storedDelivery, 0, opts.BatchSize)
+	for rows.Next() {
+		var uid string
+		var name, phone, address, email sql.NullString
+		var stored storedDelivery
+		if err := rows.Scan(&uid, &name, &phone, &address, &email,
+			&stored.keyID, &stored.dek, &stored.emailIndex, &stored.phoneIndex); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		stored.name, stored.phone, stored.address, stored.email = name.String, phone.String, address.String, email.String
+		uids = append(uids, uid)
+		batch = append(batch, stored)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(batch) == 0 {
+		return 0, nil
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `
+        UPDATE deliveries SET
+            name = $2, phone = $3, address = $4, email = $5,
+            key_id = $6, dek = $7, email_bidx = $8, phone_bidx = $9
+        WHERE order_uid = $1`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	for i, stored := range batch {
+		updated, err := r.reencryptDelivery(ctx, stored, opts.Decrypt)
+		if err != nil {
+			return 0, errFail("order %s: %w", uids[i], err)
+		}
+		_, err = stmt.ExecContext(ctx, uids[i], updated.name, updated.phone, updated.address, updated.email,
+			updated.keyID, updated.wrappedKey(), updated.emailIndex, updated.phoneIndex)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(batch), nil
+}
+
+// reencryptDelivery - the new stored form of one delivery
+func (r *OrderRepository) reencryptDelivery(ctx context.Context, stored storedDelivery, decrypt bool) (storedDelivery, error) {
+	if !stored.keyID.Valid {
+		plaintext := &model.Delivery{Name: stored.name, Phone: stored.phone, Address: stored.address, Email: stored.email}
+		return r.sealDelivery(ctx, plaintext)
+	}
+
+	if decrypt {
+		opened, err := r.openDelivery(ctx, &nullDelivery{
+			present: true,
+			name:    sql.NullString{String: stored.name, Valid: true},
+			phone:   sql.NullString{String: stored.phone, Valid: true},
+			address: sql.NullString{String: stored.address, Valid: true},
+			email:   sql.NullString{String: stored.email, Valid: true},
+			keyID:   stored.keyID,
+			dek:     stored.dek,
+		})
+		if err != nil {
+			return storedDelivery{}, err
+		}
+		return storedDelivery{name: opened.Name, phone: opened.Phone, address: opened.Address, email: opened.Email}, nil
+	}
+
+	envelope, err := r.cipher.Rewrap(ctx, stored.keyID.String, stored.dek)
+	if err != nil {
+		return storedDelivery{}, err
+	}
+	stored.keyID = sql.NullString{String: envelope.KeyID, Valid: true}
+	stored.dek = envelope.WrappedKey
+	return stored, nil
+}
@@ -0,0 +1,260 @@
+package postgresql
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"shop-microservice/internal/domain/model"
+	"shop-microservice/internal/domain/repositories"
+	"shop-microservice/internal/infrastructure/fieldcrypt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCipher - шифратор с ключами keyIDs; текущий - последний
+func testCipher(t *testing.T, keyIDs ...string) *fieldcrypt.Cipher {
+	t.Helper()
+	keys := make([]string, len(keyIDs))
+	for i, id := range keyIDs {
+		keys[i] = fmt.Sprintf("%q: %q", id, base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{byte(i + 1)}, fieldcrypt.KeySize)))
+	}
+	data := fmt.Sprintf(`{"current": %q, "keys": {%s}, "index_key": %q}`, keyIDs[len(keyIDs)-1],
+		strings.Join(keys, ", "), base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{0xAA}, fieldcrypt.KeySize)))
+
+	keyFile, err := fieldcrypt.ParseKeyFile([]byte(data))
+	require.NoError(t, err)
+	c, err := fieldcrypt.New(keyFile)
+	require.NoError(t, err)
+	return c
+}
+
+// capturedArg запоминает значение аргумента запроса
+type capturedArg struct {
+	value driver.Value
+}
+
+func (a *capturedArg) Match(v driver.Value) bool {
+	a.value = v
+	return true
+}
+
+func TestOrderRepository_EncryptedDelivery_RoundTrip(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	cipher := testCipher(t, "k1")
+	repo := NewOrderRepository(db, WithDeliveryCipher(cipher))
+	order := createTestOrder()
+	d := order.Delivery
+
+	name, phone, address, email, dek := &capturedArg{}, &capturedArg{}, &capturedArg{}, &capturedArg{}, &capturedArg{}
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO deliveries").
+		WithArgs(order.OrderUID, order.DateCreated, name, phone, d.Zip, d.City, address, d.Region, email,
+			"k1", dek, cipher.BlindIndex("email", d.Email), cipher.BlindIndex("phone", d.Phone)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	tx, err := db.Begin()
+	require.NoError(t, err)
+	require.NoError(t, repo.saveDelivery(context.Background(), tx, order))
+	require.NoError(t, tx.Commit())
+
+	for _, arg := range []*capturedArg{name, phone, address, email} {
+		assert.NotContains(t, []any{d.Name, d.Phone, d.Address, d.Email}, arg.value, "PII is not stored in plaintext")
+	}
+
+	// Прочитанная строка расшифровывается
+	values := []driver.Value{
+		order.OrderUID, order.TrackNumber, order.Entry, order.Locale, order.InternalSignature,
+		order.CustomerID, order.DeliveryService, order.Shardkey, order.SmID, order.DateCreated, order.OofShard,
+		order.Status, order.Version, order.UpdatedAt, nil,
+		true, name.value, phone.value, d.Zip, d.City, address.value, d.Region, email.value, "k1", dek.value,
+		false, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil,
+	}
+	mock.ExpectQuery("SELECT o.order_uid").WillReturnRows(newOrderRows().AddRow(values...))
+	mock.ExpectQuery("SELECT order_uid, chrt_id").
+		WillReturnRows(sqlmock.NewRows([]string{
+			"order_uid", "chrt_id", "track_number", "price", "rid", "name", "sale", "size", "total_price", "nm_id", "brand", "status",
+		}))
+
+	page, err := repo.List(context.Background(), repositories.ListOptions{Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, page.Orders, 1)
+	assert.Equal(t, d, page.Orders[0].Delivery)
+
+	// Без ключей зашифрованная строка не читается
+	mock.ExpectQuery("SELECT o.order_uid").WillReturnRows(newOrderRows().AddRow(values...))
+	_, err = NewOrderRepository(db).List(context.Background(), repositories.ListOptions{Limit: 1})
+	assert.ErrorContains(t, err, "field encryption is not configured")
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_List_EmailBlindIndex(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	cipher := testCipher(t, "k1")
+	repo := NewOrderRepository(db, WithDeliveryCipher(cipher))
+
+	mock.ExpectQuery(`WHERE o.deleted_at IS NULL AND \(d.email_bidx = \$1 OR \(d.key_id IS NULL AND lower\(trim\(d.email\)\) = \$2\)\)`).
+		WithArgs(cipher.BlindIndex("email", "john@example.com"), "john@example.com").
+		WillReturnRows(newOrderRows())
+
+	_, err = repo.List(context.Background(), repositories.ListOptions{
+		Filter: repositories.OrderFilter{Email: " John@Example.com"},
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_Reencrypt(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	ctx := context.Background()
+	old := testCipher(t, "k1")
+	envelope, err := old.NewEnvelope(ctx)
+	require.NoError(t, err)
+	ciphertext, err := envelope.Encrypt("email", "john@example.com")
+	require.NoError(t, err)
+
+	rotated := testCipher(t, "k1", "k2")
+	repo := NewOrderRepository(db, WithDeliveryCipher(rotated))
+
+	columns := []string{"order_uid", "name", "phone", "address", "email", "key_id", "dek", "email_bidx", "phone_bidx"}
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM deliveries WHERE key_id IS DISTINCT FROM \$1 ORDER BY order_uid LIMIT 10 FOR UPDATE SKIP LOCKED`).
+		WithArgs("k2").
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow("encrypted", "", "", "", ciphertext, "k1", envelope.WrappedKey, "bidx", nil).
+			AddRow("plain", "John", "+100", "Street 1", "plain@example.com", nil, nil, nil, nil))
+	update := mock.ExpectPrepare("UPDATE deliveries SET")
+	rewrapped := &capturedArg{}
+	update.ExpectExec().
+		WithArgs("encrypted", "", "", "", ciphertext, "k2", rewrapped, "bidx", nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	update.ExpectExec().
+		WithArgs("plain", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "k2", sqlmock.AnyArg(),
+			rotated.BlindIndex("email", "plain@example.com"), rotated.BlindIndex("phone", "+100")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectQuery("FROM deliveries WHERE key_id IS DISTINCT FROM").
+		WillReturnRows(sqlmock.NewRows(columns))
+	mock.ExpectRollback()
+	expectNoDocumentsToReencrypt(mock)
+
+	n, err := repo.Reencrypt(ctx, repositories.ReencryptOptions{BatchSize: 10})
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	// Поле читается переобернутым ключом без перешифрования
+	opened, err := rotated.OpenEnvelope(ctx, "k2", rewrapped.value.([]byte))
+	require.NoError(t, err)
+	email, err := opened.Decrypt("email", ciphertext)
+	require.NoError(t, err)
+	assert.Equal(t, "john@example.com", email)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+// expectNoDocumentsToReencrypt ожидает пустые проходы по журналу аудита и архиву
+func expectNoDocumentsToReencrypt(mock sqlmock.Sqlmock) {
+	mock.ExpectBegin()
+	mock.ExpectExec("SET LOCAL order_audit.maintenance = 'on'").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("FROM order_audit WHERE").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "changes", "snapshot", "key_id", "dek"}))
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectQuery("FROM orders_archive WHERE").
+		WillReturnRows(sqlmock.NewRows([]string{"order_uid", "date_created", "document", "key_id", "dek"}))
+	mock.ExpectRollback()
+}
+
+func TestOrderRepository_Reencrypt_Documents(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	ctx := context.Background()
+	old := testCipher(t, "k1")
+	envelope, err := old.NewEnvelope(ctx)
+	require.NoError(t, err)
+
+	rotated := testCipher(t, "k1", "k2")
+	repo := NewOrderRepository(db, WithDeliveryCipher(rotated))
+
+	snapshot := `{"order_uid":"a","version":2,"delivery":{"name":"John","phone":"+100","email":"john@example.com"}}`
+	changes := `{"fields":[{"field":"delivery.email","from":"old@example.com","to":"john@example.com"},{"field":"version","from":1,"to":2}]}`
+	created := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("FROM deliveries").WillReturnRows(sqlmock.NewRows([]string{"order_uid"}))
+	mock.ExpectRollback()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("SET LOCAL order_audit.maintenance = 'on'").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`FROM order_audit WHERE key_id IS DISTINCT FROM \$1 AND \(key_id IS NOT NULL OR`).
+		WithArgs("k2").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "changes", "snapshot", "key_id", "dek"}).
+			AddRow(7, changes, snapshot, nil, nil))
+	update := mock.ExpectPrepare("UPDATE order_audit SET changes")
+	mock.ExpectPrepare("UPDATE order_audit SET key_id")
+	sealedChanges, sealedSnapshot, auditKey := &capturedArg{}, &capturedArg{}, &capturedArg{}
+	update.ExpectExec().
+		WithArgs(int64(7), sealedChanges, sealedSnapshot, "k2", auditKey).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec("SET LOCAL order_audit.maintenance = 'on'").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("FROM order_audit").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectRollback()
+
+	// Архивный документ, зашифрованный старым ключом, только переоборачивается
+	mock.ExpectBegin()
+	mock.ExpectQuery("FROM orders_archive WHERE").
+		WillReturnRows(sqlmock.NewRows([]string{"order_uid", "date_created", "document", "key_id", "dek"}).
+			AddRow("b", created, `{"order_uid":"b"}`, "k1", envelope.WrappedKey))
+	mock.ExpectPrepare("UPDATE orders_archive SET document")
+	rewrap := mock.ExpectPrepare("UPDATE orders_archive SET key_id")
+	rewrap.ExpectExec().
+		WithArgs("b", created, "k2", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectQuery("FROM orders_archive").WillReturnRows(sqlmock.NewRows([]string{"order_uid"}))
+	mock.ExpectRollback()
+
+	n, err := repo.Reencrypt(ctx, repositories.ReencryptOptions{BatchSize: 10})
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	for _, sealed := range []*capturedArg{sealedChanges, sealedSnapshot} {
+		assert.NotContains(t, sealed.value, "john@example.com")
+		assert.NotContains(t, sealed.value, "John")
+	}
+	assert.Contains(t, sealedChanges.value, `"from":1`)
+
+	opened, err := rotated.OpenEnvelope(ctx, "k2", auditKey.value.([]byte))
+	require.NoError(t, err)
+	var order model.Order
+	require.NoError(t, json.Unmarshal([]byte(sealedSnapshot.value.(string)), &order))
+	require.NoError(t, decryptOrder(opened, &order))
+	assert.Equal(t, "john@example.com", order.Delivery.Email)
+	assert.Equal(t, "John", order.Delivery.Name)
+}
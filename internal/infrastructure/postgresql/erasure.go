@@ -0,0 +1,186 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"shop-microservice/internal/domain/model"
+	"shop-microservice/internal/domain/repositories"
+)
+
+var _ repositories.CustomerEraser = (*OrderRepository)(nil)
+
+// maxErasureAttempts - failed attempts after which an erasure job is marked failed
+const maxErasureAttempts = 5
+
+// Delay before the first retry of a failed erasure job, doubled for every next one
+const (
+	erasureRetryDelay    = 30 * time.Second
+	maxErasureRetryDelay = time.Hour
+)
+
+// selectedErasureJobColumns - columns scanned by scanErasureJob
+const selectedErasureJobColumns = `id, customer_id, status, requested_by, requested_at, finished_at, orders,
+            attempts, next_attempt_at, COALESCE(error, '')`
+
+const selectErasureJob = `
+        SELECT ` + selectedErasureJobColumns + `
+        FROM erasure_jobs`
+
+// RequestErasure - queues an erasure of the customer's personal data. While a job for
+// the customer is pending, the pending job is returned instead of a new one.
+func (r *OrderRepository) RequestErasure(ctx context.Context, customerID string) (*repositories.ErasureJob, error) {
+	query := `
+        WITH inserted AS (
+            INSERT INTO erasure_jobs (customer_id, requested_by) VALUES ($1, $2)
+            ON CONFLICT (customer_id) WHERE status = 'pending' DO NOTHING
+            RETURNING ` + selectedErasureJobColumns + `
+        )
+        SELECT * FROM inserted
+        UNION ALL
+        SELECT ` + selectedErasureJobColumns + `
+        FROM erasure_jobs WHERE customer_id = $1 AND status = 'pending'
+        LIMIT 1
+    `
+
+	job, err := scanErasureJob(r.db.QueryRowContext(ctx, query, customerID, repositories.ActorFromContext(ctx)))
+	if err != nil {
+		return nil, errFail("Request Erasure: %w", err)
+	}
+	return job, nil
+}
+
+// ErasureJob - returns an erasure job by id
+func (r *OrderRepository) ErasureJob(ctx context.Context, id int64) (*repositories.ErasureJob, error) {
+	job, err := scanErasureJob(r.db.QueryRowContext(ctx, selectErasureJob+" WHERE id = $1", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, repositories.ErrErasureJobNotFound
+	}
+	if err != nil {
+		return nil, errFail("Erasure Job: %w", err)
+	}
+	return job, nil
+}
+
+// ProcessErasure - runs the oldest pending erasure job that is due. The job row stays
+// locked in the erasing transaction, so concurrent instances skip it and a crash leaves
+// it pending. Delivery PII of the customer's orders is erased in the working tables, the
+// archive and the audit log under the requester's name; payments and items are kept.
+// A failed attempt is retried after an exponential delay; after maxErasureAttempts
+// the job is marked failed.
+func (r *OrderRepository) ProcessErasure(ctx context.Context) (*repositories.ErasureJob, []string, error) {
+	fail := func(err error) (*repositories.ErasureJob, []string, error) {
+		return nil, nil, fmt.Errorf("Process Erasure: %w", err)
+	}
+
+	tx, err := r.begin(ctx)
+	if err != nil {
+		return fail(err)
+	}
+	defer tx.Rollback()
+
+	job, err := scanErasureJob(tx.QueryRowContext(ctx, selectErasureJob+`
+        WHERE status = 'pending' AND next_attempt_at <= now()
+        ORDER BY id LIMIT 1 FOR UPDATE SKIP LOCKED`))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return fail(err)
+	}
+
+	uids, eraseErr := eraseCustomer(repositories.WithActor(ctx, job.RequestedBy), tx, job.CustomerID)
+	if eraseErr != nil {
+		tx.Rollback()
+		if err := r.retryErasure(ctx, job, eraseErr); err != nil {
+			return fail(err)
+		}
+		return job, nil, fmt.Errorf("Process Erasure: job %d, attempt %d: %w", job.ID, job.Attempts, eraseErr)
+	}
+
+	job.Status, job.Orders = repositories.ErasureDone, len(uids)
+	err = tx.QueryRowContext(ctx, `
+        UPDATE erasure_jobs SET status = 'done', orders = $2, finished_at = now()
+        WHERE id = $1 RETURNING finished_at`, job.ID, job.Orders).Scan(&job.FinishedAt)
+	if err != nil {
+		return fail(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fail(err)
+	}
+	return job, uids, nil
+}
+
+// retryErasure - records a failed attempt of the job: it is postponed, or marked failed
+// when the attempts are used up
+func (r *OrderRepository) retryErasure(ctx context.Context, job *repositories.ErasureJob, cause error) error {
+	job.Attempts++
+	job.Error = cause.Error()
+	if job.Attempts >= maxErasureAttempts {
+		job.Status, job.NextAttemptAt = repositories.ErasureFailed, nil
+		return r.db.QueryRowContext(ctx, `
+            UPDATE erasure_jobs SET status = 'failed', attempts = $2, error = $3, finished_at = now()
+            WHERE id = $1 RETURNING finished_at`, job.ID, job.Attempts, job.Error).Scan(&job.FinishedAt)
+	}
+
+	delay := min(erasureRetryDelay<<(job.Attempts-1), maxErasureRetryDelay)
+	return r.db.QueryRowContext(ctx, `
+        UPDATE erasure_jobs SET attempts = $2, error = $3, next_attempt_at = now() + $4 * interval '1 millisecond'
+        WHERE id = $1 RETURNING next_attempt_at`, job.ID, job.Attempts, job.Error, delay.Milliseconds()).Scan(&job.NextAttemptAt)
+}
+
+// customerOrders - uids of the customer's orders, including archived and purged ones
+// that are only left in the audit log
+const customerOrders = `
+        SELECT order_uid FROM orders WHERE customer_id = $1
+        UNION
+        SELECT order_uid FROM orders_archive WHERE customer_id = $1
+        UNION
+        SELECT order_uid FROM order_audit WHERE snapshot->>'customer_id' = $1
+        ORDER BY order_uid
+`
+
+// eraseCustomer - erases delivery PII of the customer's orders the same way retention
+// does and returns the uids of all the customer's orders
+func eraseCustomer(ctx context.Context, tx *sql.Tx, customerID string) ([]string, error) {
+	// Журнал аудита только дописывается, стирание данных в нем - обслуживание
+	if _, err := tx.ExecContext(ctx, "SET LOCAL order_audit.maintenance = 'on'"); err != nil {
+		return nil, err
+	}
+
+	_, err := queryUIDs(ctx, tx, anonymizeDeliveriesWhere("customer_id = $1"),
+		customerID, repositories.ActorFromContext(ctx), repositories.ChannelFromContext(ctx),
+		anonymousDelivery, string(model.AuditAnonymize))
+	if err != nil {
+		return nil, err
+	}
+
+	uids, err := queryUIDs(ctx, tx, customerOrders, customerID)
+	if err != nil {
+		return nil, err
+	}
+	if err := scrubAudit(ctx, tx, uids, false); err != nil {
+		return nil, err
+	}
+	return uids, nil
+}
+
+func scanErasureJob(row rowScanner) (*repositories.ErasureJob, error) {
+	var job repositories.ErasureJob
+	var status string
+	var nextAttemptAt time.Time
+	err := row.Scan(&job.ID, &job.CustomerID, &status, &job.RequestedBy, &job.RequestedAt,
+		&job.FinishedAt, &job.Orders, &job.Attempts, &nextAttemptAt, &job.Error)
+	if err != nil {
+		return nil, err
+	}
+	job.Status = repositories.ErasureStatus(status)
+	if job.Status == repositories.ErasurePending && job.Attempts > 0 {
+		job.NextAttemptAt = &nextAttemptAt
+	}
+	return &job, nil
+}
@@ -0,0 +1,165 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"shop-microservice/internal/domain/model"
+	"shop-microservice/internal/domain/repositories"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var erasureJobColumns = []string{
+	"id", "customer_id", "status", "requested_by", "requested_at", "finished_at", "orders", "attempts", "next_attempt_at", "error",
+}
+
+func TestOrderRepository_RequestErasure(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewOrderRepository(db)
+	requestedAt := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery("INSERT INTO erasure_jobs").
+		WithArgs("customer", "admin").
+		WillReturnRows(sqlmock.NewRows(erasureJobColumns).
+			AddRow(7, "customer", "pending", "admin", requestedAt, nil, 0, 0, requestedAt, ""))
+
+	job, err := repo.RequestErasure(repositories.WithActor(context.Background(), "admin"), "customer")
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), job.ID)
+	assert.Equal(t, repositories.ErasurePending, job.Status)
+	assert.Nil(t, job.FinishedAt)
+	assert.Nil(t, job.NextAttemptAt)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_ErasureJob_NotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("FROM erasure_jobs WHERE id = \\$1").
+		WithArgs(int64(7)).
+		WillReturnRows(sqlmock.NewRows(erasureJobColumns))
+
+	_, err = NewOrderRepository(db).ErasureJob(context.Background(), 7)
+	require.ErrorIs(t, err, repositories.ErrErasureJobNotFound)
+}
+
+// expectErasureJob ожидает выбор ждущей заявки покупателя customer с attempts неудачными попытками
+func expectErasureJob(mock sqlmock.Sqlmock, attempts int) {
+	mock.ExpectBegin()
+	mock.ExpectQuery("WHERE status = 'pending' AND next_attempt_at <= now\\(\\) ORDER BY id LIMIT 1 FOR UPDATE SKIP LOCKED").
+		WillReturnRows(sqlmock.NewRows(erasureJobColumns).
+			AddRow(7, "customer", "pending", "admin", time.Now(), nil, 0, attempts, time.Now(), ""))
+	mock.ExpectExec("SET LOCAL order_audit.maintenance = 'on'").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func TestOrderRepository_ProcessErasure(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	finishedAt := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	expectErasureJob(mock, 0)
+	mock.ExpectQuery("UPDATE deliveries d SET name = ''").
+		WithArgs("customer", "admin", repositories.ChannelSystem, anonymousDelivery, string(model.AuditAnonymize)).
+		WillReturnRows(sqlmock.NewRows([]string{"order_uid"}).AddRow("a"))
+	mock.ExpectQuery("SELECT order_uid FROM orders WHERE customer_id = \\$1").
+		WithArgs("customer").
+		WillReturnRows(sqlmock.NewRows([]string{"order_uid"}).AddRow("a").AddRow("purged"))
+	mock.ExpectExec("UPDATE order_audit SET").
+		WithArgs(sqlmock.AnyArg(), anonymousDelivery, false).
+		WillReturnResult(sqlmock.NewResult(0, 4))
+	mock.ExpectQuery("UPDATE erasure_jobs SET status = 'done'").
+		WithArgs(int64(7), 2).
+		WillReturnRows(sqlmock.NewRows([]string{"finished_at"}).AddRow(finishedAt))
+	mock.ExpectCommit()
+
+	ctx := repositories.WithChannel(context.Background(), repositories.ChannelSystem)
+	job, uids, err := NewOrderRepository(db).ProcessErasure(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, repositories.ErasureDone, job.Status)
+	assert.Equal(t, 2, job.Orders)
+	assert.Equal(t, &finishedAt, job.FinishedAt)
+	assert.Equal(t, []string{"a", "purged"}, uids)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_ProcessErasure_Retry(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	retryAt := time.Now().Add(time.Minute)
+
+	// Вторая неудачная попытка откладывает заявку на удвоенную паузу
+	expectErasureJob(mock, 1)
+	mock.ExpectQuery("UPDATE deliveries d SET name = ''").
+		WillReturnError(errors.New("deadlock detected"))
+	mock.ExpectRollback()
+	mock.ExpectQuery("UPDATE erasure_jobs SET attempts = \\$2, error = \\$3, next_attempt_at").
+		WithArgs(int64(7), 2, "deadlock detected", int64(60000)).
+		WillReturnRows(sqlmock.NewRows([]string{"next_attempt_at"}).AddRow(retryAt))
+
+	job, uids, err := NewOrderRepository(db).ProcessErasure(context.Background())
+	require.Error(t, err)
+	require.NotNil(t, job)
+	assert.Equal(t, repositories.ErasurePending, job.Status)
+	assert.Equal(t, 2, job.Attempts)
+	assert.Equal(t, &retryAt, job.NextAttemptAt)
+	assert.Equal(t, "deadlock detected", job.Error)
+	assert.Empty(t, uids)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_ProcessErasure_Failed(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	expectErasureJob(mock, maxErasureAttempts-1)
+	mock.ExpectQuery("UPDATE deliveries d SET name = ''").
+		WillReturnError(errors.New("deadlock detected"))
+	mock.ExpectRollback()
+	mock.ExpectQuery("UPDATE erasure_jobs SET status = 'failed'").
+		WithArgs(int64(7), maxErasureAttempts, "deadlock detected").
+		WillReturnRows(sqlmock.NewRows([]string{"finished_at"}).AddRow(time.Now()))
+
+	job, uids, err := NewOrderRepository(db).ProcessErasure(context.Background())
+	require.Error(t, err)
+	require.NotNil(t, job)
+	assert.Equal(t, repositories.ErasureFailed, job.Status)
+	assert.Equal(t, maxErasureAttempts, job.Attempts)
+	assert.Nil(t, job.NextAttemptAt)
+	assert.Empty(t, uids)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_ProcessErasure_NoPendingJobs(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("FOR UPDATE SKIP LOCKED").
+		WillReturnRows(sqlmock.NewRows(erasureJobColumns))
+	mock.ExpectRollback()
+
+	job, uids, err := NewOrderRepository(db).ProcessErasure(context.Background())
+	require.NoError(t, err)
+	assert.Nil(t, job)
+	assert.Nil(t, uids)
+}
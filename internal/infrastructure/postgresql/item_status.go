@@ -0,0 +1,303 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"shop-microservice/internal/domain/model"
+	"shop-microservice/internal/domain/repositories"
+	"slices"
+
+	"github.com/lib/pq"
+)
+
+// derivedStatusReason - reason recorded in history for order statuses derived from items
+const derivedStatusReason = "derived from item statuses"
+
+// UpdateItemStatuses - changes statuses of items, possibly across several orders, in one
+// transaction. Every change must follow the item transition graph. Affected orders get
+// a new version and, when the items define it, a derived order status.
+func (r *OrderRepository) UpdateItemStatuses(ctx context.Context, updates []repositories.ItemStatusUpdate, reason string) (*repositories.ItemStatusResult, error) {
+	fail := func(err error) (*repositories.ItemStatusResult, error) {
+		return nil, fmt.Errorf("Update Item Statuses: %w", err)
+	}
+
+	result := &repositories.ItemStatusResult{
+		Orders:  make([]*model.Order, 0),
+		Changes: make([]model.StatusChange, 0),
+	}
+	if len(updates) == 0 {
+		return result, nil
+	}
+
+	tx, err := r.begin(ctx)
+	if err != nil {
+		return fail(err)
+	}
+	defer tx.Rollback()
+
+	ridOrders, err := r.resolveItemOrders(ctx, tx, updates)
+	if err != nil {
+		return fail(err)
+	}
+	updates, err = r.resolveChrtOrders(ctx, tx, updates)
+	if err != nil {
+		return fail(err)
+	}
+
+	uids := make([]string, 0)
+	for _, update := range updates {
+		if update.Rid != "" {
+			uids = append(uids, ridOrders[update.Rid]...)
+		} else {
+			uids = append(uids, update.OrderUID)
+		}
+	}
+	slices.Sort(uids)
+	uids = slices.Compact(uids)
+
+	orders, err := r.lockAndLoadOrders(ctx, tx, uids)
+	if err != nil {
+		return fail(err)
+	}
+	before := make(map[string]*model.Order, len(orders))
+	for uid, order := range orders {
+		before[uid] = order.Clone()
+	}
+
+	for _, update := range updates {
+		if err := applyItemStatus(orders, ridOrders, update); err != nil {
+			return fail(err)
+		}
+
+		// Тот же rid может остаться у товаров удаленных заказов, их не трогаем
+		if update.Rid != "" {
+			_, err = tx.ExecContext(ctx, `
+                UPDATE items i SET status = $2
+                FROM orders o
+                WHERE o.order_uid = i.order_uid AND o.deleted_at IS NULL AND i.rid = $1
+			`, update.Rid, update.Status)
+		} else {
+			_, err = tx.ExecContext(ctx, "UPDATE items SET status = $3 WHERE order_uid = $1 AND chrt_id = $2",
+				update.OrderUID, update.ChrtID, update.Status)
+		}
+		if err != nil {
+			return fail(err)
+		}
+	}
+
+	actor := repositories.ActorFromContext(ctx)
+	for _, uid := range uids {
+		order := orders[uid]
+
+		derived, ok := model.DeriveOrderStatus(order.Items)
+		if ok && derived != order.Status && order.Status.CanTransitionTo(derived) {
+			change := &model.StatusChange{
+				OrderUID: uid,
+				From:     order.Status,
+				To:       derived,
+				Actor:    actor,
+				Reason:   derivedStatusReason,
+			}
+			if reason != "" {
+				change.Reason = derivedStatusReason + ": " + reason
+			}
+			if err := r.applyStatusChange(ctx, tx, change); err != nil {
+				return fail(err)
+			}
+			order.Status = change.To
+			order.Version = change.Version
+			order.UpdatedAt = change.ChangedAt
+			result.Changes = append(result.Changes, *change)
+		} else {
+			err := tx.QueryRowContext(ctx, `
+                UPDATE orders SET version = version + 1, updated_at = now()
+                WHERE order_uid = $1
+                RETURNING version, updated_at
+			`, uid).Scan(&order.Version, &order.UpdatedAt)
+			if err != nil {
+				return fail(err)
+			}
+		}
+
+		if err := r.recordAudit(ctx, tx, model.AuditUpdate, before[uid], order); err != nil {
+			return fail(err)
+		}
+
+		result.Orders = append(result.Orders, order)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fail(err)
+	}
+
+	return result, nil
+}
+
+// resolveItemOrders - finds live orders of the items selected by rid
+func (r *OrderRepository) resolveItemOrders(ctx context.Context, tx *sql.Tx, updates []repositories.ItemStatusUpdate) (map[string][]string, error) {
+	rids := make([]string, 0)
+	for _, update := range updates {
+		if update.Rid != "" {
+			rids = append(rids, update.Rid)
+		}
+	}
+
+	ridOrders := make(map[string][]string)
+	if len(rids) == 0 {
+		return ridOrders, nil
+	}
+
+	rows, err := tx.QueryContext(ctx,
+		`SELECT DISTINCT i.rid, i.order_uid FROM items i
+         JOIN orders o ON o.order_uid = i.order_uid AND o.deleted_at IS NULL
+         WHERE i.rid = ANY($1)`, pq.Array(rids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rid, uid string
+		if err := rows.Scan(&rid, &uid); err != nil {
+			return nil, err
+		}
+		ridOrders[rid] = append(ridOrders[rid], uid)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, rid := range rids {
+		if _, ok := ridOrders[rid]; !ok {
+			return nil, errFail("%w: rid %s", repositories.ErrItemNotFound, rid)
+		}
+	}
+	return ridOrders, nil
+}
+
+// resolveChrtOrders - fills in the order of updates selecting an item by chrt_id alone.
+// The chrt_id must belong to exactly one live order: several matches are ambiguous.
+func (r *OrderRepository) resolveChrtOrders(ctx context.Context, tx *sql.Tx, updates []repositories.ItemStatusUpdate) ([]repositories.ItemStatusUpdate, error) {
+	chrtIDs := make([]int64, 0)
+	for _, update := range updates {
+		if update.Rid == "" && update.OrderUID == "" {
+			chrtIDs = append(chrtIDs, int64(update.ChrtID))
+		}
+	}
+	if len(chrtIDs) == 0 {
+		return updates, nil
+	}
+
+	rows, err := tx.QueryContext(ctx,
+		`SELECT DISTINCT i.chrt_id, i.order_uid FROM items i
+         JOIN orders o ON o.order_uid = i.order_uid AND o.deleted_at IS NULL
+         WHERE i.chrt_id = ANY($1)`, pq.Array(chrtIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	chrtOrders := make(map[int][]string)
+	for rows.Next() {
+		var chrtID int
+		var uid string
+		if err := rows.Scan(&chrtID, &uid); err != nil {
+			return nil, err
+		}
+		chrtOrders[chrtID] = append(chrtOrders[chrtID], uid)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	resolved := slices.Clone(updates)
+	for i, update := range resolved {
+		if update.Rid != "" || update.OrderUID != "" {
+			continue
+		}
+		switch uids := chrtOrders[update.ChrtID]; len(uids) {
+		case 0:
+			return nil, errFail("%w: chrt_id %d", repositories.ErrItemNotFound, update.ChrtID)
+		case 1:
+			resolved[i].OrderUID = uids[0]
+		default:
+			return nil, errFail("%w: chrt_id %d is in %d orders, pass order_uid",
+				repositories.ErrAmbiguousItem, update.ChrtID, len(uids))
+		}
+	}
+	return resolved, nil
+}
+
+// lockAndLoadOrders - locks orders in uid order (to avoid deadlocks) and loads them
+func (r *OrderRepository) lockAndLoadOrders(ctx context.Context, tx *sql.Tx, uids []string) (map[string]*model.Order, error) {
+	rows, err := tx.QueryContext(ctx,
+		`SELECT order_uid FROM orders WHERE order_uid = ANY($1) AND deleted_at IS NULL
+         ORDER BY order_uid FOR UPDATE`, pq.Array(uids))
+	if err != nil {
+		return nil, err
+	}
+	locked := make(map[string]bool, len(uids))
+	for rows.Next() {
+		var uid string
+		if err := rows.Scan(&uid); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		locked[uid] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	orders := make(map[string]*model.Order, len(uids))
+	for _, uid := range uids {
+		if !locked[uid] {
+			return nil, errFail("%w: %s", repositories.ErrOrderNotFound, uid)
+		}
+		order, err := r.loadOrder(ctx, tx, uid)
+		if err != nil {
+			return nil, err
+		}
+		orders[uid] = order
+	}
+	return orders, nil
+}
+
+// applyItemStatus - changes the status of the selected items in loaded orders
+func applyItemStatus(orders map[string]*model.Order, ridOrders map[string][]string, update repositories.ItemStatusUpdate) error {
+	uids := []string{update.OrderUID}
+	if update.Rid != "" {
+		uids = ridOrders[update.Rid]
+	}
+
+	matched := false
+	for _, uid := range uids {
+		order := orders[uid]
+		for i := range order.Items {
+			item := &order.Items[i]
+			if update.Rid != "" && item.Rid != update.Rid {
+				continue
+			}
+			if update.Rid == "" && item.ChrtID != update.ChrtID {
+				continue
+			}
+
+			matched = true
+			if item.Status == update.Status {
+				continue
+			}
+			if !item.Status.CanTransitionTo(update.Status) {
+				return errFail("%w: item %s of order %s: %s -> %s",
+					repositories.ErrInvalidStatusTransition, item.Rid, uid, item.Status, update.Status)
+			}
+			item.Status = update.Status
+		}
+	}
+
+	if !matched {
+		return errFail("%w: order %s, chrt_id %d", repositories.ErrItemNotFound, update.OrderUID, update.ChrtID)
+	}
+	return nil
+}
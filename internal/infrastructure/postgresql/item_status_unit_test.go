@@ -0,0 +1,173 @@
+package postgresql
+
+import (
+	"context"
+	"shop-microservice/internal/domain/model"
+	"shop-microservice/internal/domain/repositories"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func expectLoadOrderWithItems(mock sqlmock.Sqlmock, order *model.Order) {
+	mock.ExpectQuery("SELECT o.order_uid").
+		WithArgs(order.OrderUID).
+		WillReturnRows(addOrderRow(newOrderRows(), order))
+
+	itemRows := sqlmock.NewRows([]string{
+		"chrt_id", "track_number", "price", "rid", "name", "sale", "size", "total_price", "nm_id", "brand", "status",
+	})
+	for _, item := range order.Items {
+		itemRows.AddRow(item.ChrtID, item.TrackNumber, item.Price, item.Rid, item.Name,
+			item.Sale, item.Size, item.TotalPrice, item.NmID, item.Brand, item.Status)
+	}
+	mock.ExpectQuery("SELECT chrt_id").
+		WithArgs(order.OrderUID).
+		WillReturnRows(itemRows)
+}
+
+func TestOrderRepository_UpdateItemStatuses_Unit(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewOrderRepository(db)
+	order := createTestOrder()
+	order.Status = model.OrderStatusAssembling
+	order.Items[0].Status = model.ItemStatusReady
+	rid := order.Items[0].Rid
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT DISTINCT i.rid, i.order_uid FROM items i .* WHERE i.rid = ANY").
+		WithArgs(pq.Array([]string{rid})).
+		WillReturnRows(sqlmock.NewRows([]string{"rid", "order_uid"}).AddRow(rid, order.OrderUID))
+	mock.ExpectQuery("SELECT order_uid FROM orders WHERE order_uid = ANY\\(\\$1\\) AND deleted_at IS NULL\\s+ORDER BY order_uid FOR UPDATE").
+		WithArgs(pq.Array([]string{order.OrderUID})).
+		WillReturnRows(sqlmock.NewRows([]string{"order_uid"}).AddRow(order.OrderUID))
+	expectLoadOrderWithItems(mock, order)
+	mock.ExpectExec("UPDATE items i SET status = \\$2 FROM orders o WHERE o.order_uid = i.order_uid AND o.deleted_at IS NULL AND i.rid = \\$1").
+		WithArgs(rid, model.ItemStatusShipped).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("UPDATE orders SET status = \\$2").
+		WithArgs(order.OrderUID, model.OrderStatusShipped).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "updated_at"}).AddRow(5, time.Now()))
+	mock.ExpectExec("INSERT INTO order_status_history").
+		WithArgs(order.OrderUID, model.OrderStatusAssembling, model.OrderStatusShipped, "system",
+			"derived from item statuses", 5, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	expectAudit(mock, order.OrderUID, model.AuditUpdate)
+	mock.ExpectCommit()
+
+	result, err := repo.UpdateItemStatuses(context.Background(), []repositories.ItemStatusUpdate{
+		{Rid: rid, Status: model.ItemStatusShipped},
+	}, "")
+	require.NoError(t, err)
+
+	require.Len(t, result.Orders, 1)
+	assert.Equal(t, model.OrderStatusShipped, result.Orders[0].Status)
+	assert.Equal(t, model.ItemStatusShipped, result.Orders[0].Items[0].Status)
+	assert.Equal(t, int64(5), result.Orders[0].Version)
+	require.Len(t, result.Changes, 1)
+	assert.Equal(t, model.OrderStatusAssembling, result.Changes[0].From)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_UpdateItemStatuses_InvalidTransition(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewOrderRepository(db)
+	order := createTestOrder()
+	order.Items[0].Status = model.ItemStatusDelivered
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT order_uid FROM orders WHERE order_uid = ANY").
+		WithArgs(pq.Array([]string{order.OrderUID})).
+		WillReturnRows(sqlmock.NewRows([]string{"order_uid"}).AddRow(order.OrderUID))
+	expectLoadOrderWithItems(mock, order)
+	mock.ExpectRollback()
+
+	_, err = repo.UpdateItemStatuses(context.Background(), []repositories.ItemStatusUpdate{
+		{OrderUID: order.OrderUID, ChrtID: order.Items[0].ChrtID, Status: model.ItemStatusCancelled},
+	}, "")
+	require.ErrorIs(t, err, repositories.ErrInvalidStatusTransition)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_UpdateItemStatuses_UnknownRid(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewOrderRepository(db)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT DISTINCT i.rid, i.order_uid FROM items").
+		WithArgs(pq.Array([]string{"missing"})).
+		WillReturnRows(sqlmock.NewRows([]string{"rid", "order_uid"}))
+	mock.ExpectRollback()
+
+	_, err = repo.UpdateItemStatuses(context.Background(), []repositories.ItemStatusUpdate{
+		{Rid: "missing", Status: model.ItemStatusShipped},
+	}, "")
+	require.ErrorIs(t, err, repositories.ErrItemNotFound)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_UpdateItemStatuses_ChrtIDOnly(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewOrderRepository(db)
+	order := createTestOrder()
+	order.Items[0].Status = model.ItemStatusDelivered
+	chrtID := order.Items[0].ChrtID
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT DISTINCT i.chrt_id, i.order_uid FROM items i .*deleted_at IS NULL WHERE i.chrt_id = ANY").
+		WithArgs(pq.Array([]int64{int64(chrtID)})).
+		WillReturnRows(sqlmock.NewRows([]string{"chrt_id", "order_uid"}).AddRow(chrtID, order.OrderUID))
+	mock.ExpectQuery("SELECT order_uid FROM orders WHERE order_uid = ANY").
+		WithArgs(pq.Array([]string{order.OrderUID})).
+		WillReturnRows(sqlmock.NewRows([]string{"order_uid"}).AddRow(order.OrderUID))
+	expectLoadOrderWithItems(mock, order)
+	mock.ExpectRollback()
+
+	// Заказ найден по chrt_id: дальше действует обычная проверка перехода
+	_, err = repo.UpdateItemStatuses(context.Background(), []repositories.ItemStatusUpdate{
+		{ChrtID: chrtID, Status: model.ItemStatusCancelled},
+	}, "")
+	require.ErrorIs(t, err, repositories.ErrInvalidStatusTransition)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_UpdateItemStatuses_AmbiguousChrtID(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewOrderRepository(db)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT DISTINCT i.chrt_id, i.order_uid FROM items").
+		WithArgs(pq.Array([]int64{42})).
+		WillReturnRows(sqlmock.NewRows([]string{"chrt_id", "order_uid"}).AddRow(42, "a").AddRow(42, "b"))
+	mock.ExpectRollback()
+
+	_, err = repo.UpdateItemStatuses(context.Background(), []repositories.ItemStatusUpdate{
+		{ChrtID: 42, Status: model.ItemStatusShipped},
+	}, "")
+	require.ErrorIs(t, err, repositories.ErrAmbiguousItem)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,295 @@
+package postgresql
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"shop-microservice/internal/domain/model"
+	"shop-microservice/internal/domain/repositories"
+	"shop-microservice/internal/infrastructure/fieldcrypt"
+
+	"github.com/lib/pq"
+)
+
+const selectOrdersWithDeliveryAndPayment = `
+        SELECT o.order_uid, o.track_number, o.entry, o.locale, o.internal_signature,
+               o.customer_id, o.delivery_service, o.shardkey, o.sm_id, o.date_created, o.oof_shard,
+               o.status, o.version, o.updated_at, o.deleted_at,
+               d.order_uid IS NOT NULL, d.name, d.phone, d.zip, d.city, d.address, d.region, d.email,
+               d.key_id, d.dek,
+               p.order_uid IS NOT NULL, p.transaction, p.request_id, p.currency, p.provider, p.amount, p.payment_dt,
+               p.bank, p.delivery_cost, p.goods_total, p.custom_fee
+        FROM orders o
+        LEFT JOIN deliveries d ON o.order_uid = d.order_uid
+        LEFT JOIN payments p ON o.order_uid = p.order_uid`
+
+// listCursor - позиция последнего заказа страницы в выбранной сортировке
+type listCursor struct {
+	Sort        repositories.OrderSort `json:"s"`
+	DateCreated time.Time              `json:"d,omitzero"`
+	OrderUID    string                 `json:"u"`
+}
+
+func encodeCursor(sort repositories.OrderSort, order *model.Order) string {
+	cursor := listCursor{Sort: sort, OrderUID: order.OrderUID}
+	if sort == repositories.SortDateCreatedAsc || sort == repositories.SortDateCreatedDesc {
+		cursor.DateCreated = order.DateCreated
+	}
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(raw string, sort repositories.OrderSort) (*listCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, repositories.ErrInvalidCursor
+	}
+	var cursor listCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.Sort != sort || cursor.OrderUID == "" {
+		return nil, repositories.ErrInvalidCursor
+	}
+	return &cursor, nil
+}
+
+// queryBuilder собирает условия WHERE с нумерованными плейсхолдерами
+type queryBuilder struct {
+	conditions []string
+	args       []any
+}
+
+func (b *queryBuilder) add(condition string, args ...any) {
+	placeholders := make([]any, len(args))
+	for i, arg := range args {
+		b.args = append(b.args, arg)
+		placeholders[i] = fmt.Sprintf("$%d", len(b.args))
+	}
+	b.conditions = append(b.conditions, fmt.Sprintf(condition, placeholders...))
+}
+
+func (b *queryBuilder) where() string {
+	if len(b.conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(b.conditions, " AND ")
+}
+
+// applyOrderFilter - adds filter conditions; email and phone are matched by blind
+// index when the repository encrypts deliveries (rows not yet encrypted by plaintext)
+func applyOrderFilter(b *queryBuilder, filter repositories.OrderFilter, cipher *fieldcrypt.Cipher) {
+	if !filter.IncludeDeleted {
+		b.add("o.deleted_at IS NULL")
+	}
+	if len(filter.OrderUIDs) > 0 {
+		b.add("o.order_uid = ANY(%s)", pq.Array(filter.OrderUIDs))
+	}
+	if filter.CustomerID != "" {
+		b.add("o.customer_id = %s", filter.CustomerID)
+	}
+	if filter.TrackNumber != "" {
+		b.add("o.track_number = %s", filter.TrackNumber)
+	}
+	if !filter.CreatedFrom.IsZero() {
+		b.add("o.date_created >= %s", filter.CreatedFrom)
+	}
+	if !filter.CreatedTo.IsZero() {
+		b.add("o.date_created < %s", filter.CreatedTo)
+	}
+	if filter.DeliveryService != "" {
+		b.add("o.delivery_service = %s", filter.DeliveryService)
+	}
+	if filter.Currency != "" {
+		b.add("p.currency = %s", filter.Currency)
+	}
+	if filter.Status != "" {
+		b.add("o.status = %s", string(filter.Status))
+	}
+	if filter.ItemStatus != nil {
+		b.add("EXISTS (SELECT 1 FROM items i WHERE i.order_uid = o.order_uid AND i.status = %s)", *filter.ItemStatus)
+	}
+	if filter.Brand != "" {
+		b.add("EXISTS (SELECT 1 FROM items i WHERE i.order_uid = o.order_uid AND i.brand = %s)", filter.Brand)
+	}
+	if filter.Email != "" {
+		email := fieldcrypt.Normalize("email", filter.Email)
+		if cipher != nil {
+			b.add("(d.email_bidx = %s OR (d.key_id IS NULL AND lower(trim(d.email)) = %s))",
+				cipher.BlindIndex("email", email), email)
+		} else {
+			b.add("lower(trim(d.email)) = %s", email)
+		}
+	}
+	if filter.Phone != "" {
+		phone := fieldcrypt.Normalize("phone", filter.Phone)
+		if cipher != nil {
+			b.add("(d.phone_bidx = %s OR (d.key_id IS NULL AND regexp_replace(d.phone, '\\D', '', 'g') = %s))",
+				cipher.BlindIndex("phone", phone), phone)
+		} else {
+			b.add("regexp_replace(d.phone, '\\D', '', 'g') = %s", phone)
+		}
+	}
+}
+
+func applyCursor(b *queryBuilder, sort repositories.OrderSort, cursor *listCursor) {
+	switch sort {
+	case repositories.SortDateCreatedDesc:
+		b.add("(o.date_created, o.order_uid) < (%s, %s)", cursor.DateCreated, cursor.OrderUID)
+	case repositories.SortDateCreatedAsc:
+		b.add("(o.date_created, o.order_uid) > (%s, %s)", cursor.DateCreated, cursor.OrderUID)
+	case repositories.SortOrderUIDAsc:
+		b.add("o.order_uid > %s", cursor.OrderUID)
+	case repositories.SortOrderUIDDesc:
+		b.add("o.order_uid < %s", cursor.OrderUID)
+	}
+}
+
+func orderByClause(sort repositories.OrderSort) string {
+	switch sort {
+	case repositories.SortDateCreatedAsc:
+		return " ORDER BY o.date_created ASC, o.order_uid ASC"
+	case repositories.SortOrderUIDAsc:
+		return " ORDER BY o.order_uid ASC"
+	case repositories.SortOrderUIDDesc:
+		return " ORDER BY o.order_uid DESC"
+	default:
+		return " ORDER BY o.date_created DESC, o.order_uid DESC"
+	}
+}
+
+// List - returns one page of orders matching the filter, using keyset pagination
+func (r *OrderRepository) List(ctx context.Context, opts repositories.ListOptions) (*repositories.OrderPage, error) {
+	page, err := r.readPage(ctx, opts.Normalize())
+	if err != nil {
+		return nil, errFail("List: %w", err)
+	}
+	return page, nil
+}
+
+// readPage - loads a page from a replica or the primary, see read
+func (r *OrderRepository) readPage(ctx context.Context, opts repositories.ListOptions) (*repositories.OrderPage, error) {
+	var page *repositories.OrderPage
+	err := r.read(ctx, func(q queryer) error {
+		var err error
+		page, err = r.listOrders(ctx, q, opts)
+		return err
+	})
+	return page, err
+}
+
+func (r *OrderRepository) listOrders(ctx context.Context, q queryer, opts repositories.ListOptions) (*repositories.OrderPage, error) {
+	if !opts.Sort.Valid() {
+		return nil, fmt.Errorf("unknown sort %q", opts.Sort)
+	}
+
+	var cursor *listCursor
+	if opts.Cursor != "" {
+		var err error
+		if cursor, err = decodeCursor(opts.Cursor, opts.Sort); err != nil {
+			return nil, err
+		}
+	}
+
+	orders, err := r.queryLiveOrders(ctx, q, opts, cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	// Архив сортируется по тем же ключам, страница собирается слиянием двух выборок
+	if opts.Filter.IncludeArchived {
+		archived, err := r.queryArchivedOrders(ctx, q, opts, cursor)
+		if err != nil {
+			return nil, err
+		}
+		orders = mergeOrders(orders, archived, opts.Sort)
+	}
+
+	page := &repositories.OrderPage{Orders: []*model.Order{}}
+	if len(orders) > opts.Limit {
+		orders = orders[:opts.Limit]
+		page.NextCursor = encodeCursor(opts.Sort, &orders[len(orders)-1])
+	}
+
+	itemsByOrder, err := r.getItemsForOrders(ctx, q, extractOrderUIDs(orders))
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range orders {
+		// У архивных заказов товары уже прочитаны из документа
+		if items, ok := itemsByOrder[orders[i].OrderUID]; ok {
+			orders[i].Items = items
+		}
+		page.Orders = append(page.Orders, &orders[i])
+	}
+
+	return page, nil
+}
+
+// queryLiveOrders - reads up to opts.Limit+1 orders from the working tables without items;
+// the extra row tells whether there is a next page
+func (r *OrderRepository) queryLiveOrders(ctx context.Context, q queryer, opts repositories.ListOptions, cursor *listCursor) ([]model.Order, error) {
+	builder := &queryBuilder{}
+	applyOrderFilter(builder, opts.Filter, r.cipher)
+	if cursor != nil {
+		applyCursor(builder, opts.Sort, cursor)
+	}
+
+	query := selectOrdersWithDeliveryAndPayment + builder.where() + orderByClause(opts.Sort) +
+		fmt.Sprintf(" LIMIT %d", opts.Limit+1)
+
+	rows, err := q.QueryContext(ctx, query, builder.args...)
+	if err != nil {
+		return nil, errFail("failed to query orders: %w", err)
+	}
+	defer rows.Close()
+
+	var orders []model.Order
+	for rows.Next() {
+		order, err := r.scanOrderWithDeliveryAndPayment(ctx, rows)
+		if err != nil {
+			return nil, errFail("failed to scan order: %w", err)
+		}
+		orders = append(orders, *order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errFail("rows iteration error: %w", err)
+	}
+	return orders, nil
+}
+
+// mergeOrders - merges two pages sorted by sort into one sorted page
+func mergeOrders(a, b []model.Order, sort repositories.OrderSort) []model.Order {
+	merged := make([]model.Order, 0, len(a)+len(b))
+	for len(a) > 0 && len(b) > 0 {
+		if orderBefore(&b[0], &a[0], sort) {
+			merged, b = append(merged, b[0]), b[1:]
+		} else {
+			merged, a = append(merged, a[0]), a[1:]
+		}
+	}
+	merged = append(merged, a...)
+	return append(merged, b...)
+}
+
+// orderBefore reports whether x goes before y in the sort order
+func orderBefore(x, y *model.Order, sort repositories.OrderSort) bool {
+	switch sort {
+	case repositories.SortDateCreatedAsc:
+		if !x.DateCreated.Equal(y.DateCreated) {
+			return x.DateCreated.Before(y.DateCreated)
+		}
+		return x.OrderUID < y.OrderUID
+	case repositories.SortOrderUIDAsc:
+		return x.OrderUID < y.OrderUID
+	case repositories.SortOrderUIDDesc:
+		return x.OrderUID > y.OrderUID
+	default:
+		if !x.DateCreated.Equal(y.DateCreated) {
+			return x.DateCreated.After(y.DateCreated)
+		}
+		return x.OrderUID > y.OrderUID
+	}
+}
@@ -0,0 +1,67 @@
+package postgresql
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// OrderChangesChannel - канал NOTIFY, в который триггеры пишут order_uid измененного заказа
+const OrderChangesChannel = "order_changes"
+
+const (
+	listenerMinReconnect = 1 * time.Second
+	listenerMaxReconnect = 1 * time.Minute
+	listenerPingInterval = 90 * time.Second
+)
+
+// ChangeListener - subscribes to order change notifications from Postgres
+type ChangeListener struct {
+	connInfo string
+}
+
+func NewChangeListener(connInfo string) *ChangeListener {
+	return &ChangeListener{connInfo: connInfo}
+}
+
+// Listen - blocks until ctx is done, calling onChange for every changed order.
+// onResync is called once the subscription is established and after every
+// reconnect, because notifications sent while disconnected are lost.
+func (l *ChangeListener) Listen(ctx context.Context, onChange func(uid string), onResync func()) error {
+	listener := pq.NewListener(l.connInfo, listenerMinReconnect, listenerMaxReconnect,
+		func(event pq.ListenerEventType, err error) {
+			if err != nil {
+				log.Printf("Order change listener: %v", err)
+			}
+		})
+	defer listener.Close()
+
+	if err := listener.Listen(OrderChangesChannel); err != nil {
+		return fmt.Errorf("Listen order changes: %w", err)
+	}
+	onResync()
+
+	ticker := time.NewTicker(listenerPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case notification := <-listener.Notify:
+			// nil приходит после переподключения
+			if notification == nil {
+				log.Printf("Order change listener reconnected, resyncing cache")
+				onResync()
+				continue
+			}
+			onChange(notification.Extra)
+		case <-ticker.C:
+			// Ping обнаруживает разрыв соединения, если уведомлений долго нет
+			go listener.Ping()
+		}
+	}
+}
@@ -1,41 +1,27 @@
 package postgresql
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
-	"os"
-	"path/filepath"
+	"shop-microservice/migrations"
 
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
 )
 
+// RunMigrations - applies all embedded migrations that are not applied yet
 func RunMigrations(db *sql.DB) error {
-	driver, err := postgres.WithInstance(db, &postgres.Config{})
+	m, err := NewMigrate(context.Background(), db)
 	if err != nil {
-		return fmt.Errorf("could not create migration driver: %w", err)
+		return err
 	}
+	defer m.Close()
 
-	projectRoot, err := getProjectRoot()
-	if err != nil {
-		return fmt.Errorf("could not get project root: %w", err)
-	}
-
-	migrationsPath := fmt.Sprintf("file://%s/migrations", projectRoot)
-
-	m, err := migrate.NewWithDatabaseInstance(
-		migrationsPath,
-		"postgres",
-		driver,
-	)
-
-	if err != nil {
-		return fmt.Errorf("could not create migration instance: %w", err)
-	}
-
-	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
 		return fmt.Errorf("could not run migrations: %w", err)
 	}
 
@@ -43,42 +29,44 @@ func RunMigrations(db *sql.DB) error {
 	return nil
 }
 
-func getProjectRoot() (string, error) {
-	containerPaths := []string{
-		"/app",
-		"/migrations",
+// NewMigrate - returns a migrator over the migrations embedded in the binary.
+// It holds one connection of db; Close releases it and leaves db open.
+func NewMigrate(ctx context.Context, db *sql.DB) (*migrate.Migrate, error) {
+	source, err := iofs.New(migrations.FS, ".")
+	if err != nil {
+		return nil, fmt.Errorf("could not open embedded migrations: %w", err)
 	}
 
-	for _, path := range containerPaths {
-		migrationsDir := path
-		if path != "/migrations" {
-			migrationsDir = filepath.Join(path, "migrations")
-		}
-
-		if _, err := os.Stat(migrationsDir); err == nil {
-			if path == "/migrations" {
-				return "/", nil
-			}
-			return path, nil
-		}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not create migration driver: %w", err)
 	}
 
-	currentDir, err := os.Getwd()
+	driver, err := postgres.WithConnection(ctx, conn, &postgres.Config{})
 	if err != nil {
-		return "", err
+		conn.Close()
+		return nil, fmt.Errorf("could not create migration driver: %w", err)
 	}
 
-	possibleLocalPaths := []string{
-		currentDir,
-		filepath.Join(currentDir, "..", ".."),
+	m, err := migrate.NewWithInstance("iofs", source, "postgres", driver)
+	if err != nil {
+		driver.Close()
+		return nil, fmt.Errorf("could not create migration instance: %w", err)
 	}
+	return m, nil
+}
 
-	for _, path := range possibleLocalPaths {
-		migrationsDir := filepath.Join(path, "migrations")
-		if _, err := os.Stat(migrationsDir); err == nil {
-			return path, nil
-		}
+// SchemaVersion - returns the last applied migration and whether it left the schema dirty.
+// A database without migrations has version 0.
+func SchemaVersion(ctx context.Context, db *sql.DB) (uint, bool, error) {
+	var version int64
+	var dirty bool
+	err := db.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
 	}
-
-	return "", fmt.Errorf("migrations directory not found")
+	if err != nil {
+		return 0, false, errFail("SchemaVersion: %w", err)
+	}
+	return uint(version), dirty, nil
 }
@@ -0,0 +1,132 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"shop-microservice/internal/domain/model"
+
+	"github.com/lib/pq"
+)
+
+// execer is implemented by both *sql.DB and *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// partitionMonth - the first moment of the UTC month containing t; orders, items and
+// orders_archive are partitioned by these months
+func partitionMonth(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// createPartition - DDL creating the monthly partition of table if it is missing
+func createPartition(table string, month time.Time) string {
+	name := pq.QuoteIdentifier(fmt.Sprintf("%s_%04d_%02d", table, month.Year(), int(month.Month())))
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s PARTITION OF %s FOR VALUES FROM ('%s') TO ('%s')",
+		name, table, month.Format(time.RFC3339), month.AddDate(0, 1, 0).Format(time.RFC3339))
+}
+
+// ensureOrderPartitions - creates the orders and items partitions for the months of dates.
+// Creating a partition locks the parent table exclusively, so write paths call it on the
+// pool before their transaction and the lock is released right away. A concurrent writer
+// creating the same partition makes IF NOT EXISTS fail with duplicate_table, the second
+// attempt on the pool then finds the partition.
+func ensureOrderPartitions(ctx context.Context, db execer, dates ...time.Time) error {
+	months := make(map[time.Time]bool)
+	for _, date := range dates {
+		month := partitionMonth(date)
+		if months[month] {
+			continue
+		}
+		months[month] = true
+
+		ddl := createPartition("orders", month) + ";\n" + createPartition("items", month)
+		_, err := db.ExecContext(ctx, ddl)
+		var pqErr *pq.Error
+		if _, pool := db.(*sql.DB); pool && errors.As(err, &pqErr) && (pqErr.Code == "42P07" || pqErr.Code == "23505") {
+			_, err = db.ExecContext(ctx, ddl)
+		}
+		if err != nil {
+			return errFail("partitions for %s: %w", month.Format("2006-01"), err)
+		}
+	}
+	return nil
+}
+
+// orderDates - date_created of every order, for ensureOrderPartitions
+func orderDates(orders []*model.Order) []time.Time {
+	dates := make([]time.Time, len(orders))
+	for i, order := range orders {
+		dates[i] = order.DateCreated
+	}
+	return dates
+}
+
+// orderUIDs - uid of every order, for lockOrderUIDs
+func orderUIDs(orders []*model.Order) []string {
+	uids := make([]string, len(orders))
+	for i, order := range orders {
+		uids[i] = order.OrderUID
+	}
+	return uids
+}
+
+// lockOrderUIDs - takes transaction advisory locks on the uids of orders about to be
+// written. The primary key of partitioned orders includes date_created and does not keep
+// order_uid unique by itself, so writers that insert or move an order are serialized by
+// uid here. It is the first statement of the transaction and locks uids in sorted order,
+// so writers cannot deadlock on each other.
+func lockOrderUIDs(ctx context.Context, tx execer, uids ...string) error {
+	sorted := slices.Clone(uids)
+	slices.Sort(sorted)
+	sorted = slices.Compact(sorted)
+	_, err := tx.ExecContext(ctx,
+		"SELECT pg_advisory_xact_lock(hashtext('orders'), hashtext(uid)) FROM unnest($1::text[]) AS uid",
+		pq.Array(sorted))
+	return err
+}
+
+// moveOrders - moves the stored orders listed in source as t(order_uid, date_created)
+// to the partition of their new date_created before they are written. A row referenced
+// by foreign keys cannot be moved by an UPDATE of its partition key, so the order is
+// copied under the new date, its delivery, payment and items are repointed to the copy
+// and the old row is deleted, all in one statement.
+func moveOrders(source string) string {
+	return `
+        WITH target AS (
+            SELECT o.order_uid, o.date_created AS stored, t.date_created
+            FROM ` + source + `
+            JOIN orders o ON o.order_uid = t.order_uid AND o.date_created <> t.date_created
+        ), copied AS (
+            INSERT INTO orders
+            SELECT moved.*
+            FROM orders o
+            JOIN target ON target.order_uid = o.order_uid AND target.stored = o.date_created,
+            LATERAL jsonb_populate_record(o, jsonb_build_object('date_created', target.date_created)) moved
+        ), moved_deliveries AS (
+            UPDATE deliveries d SET date_created = target.date_created
+            FROM target WHERE d.order_uid = target.order_uid
+        ), moved_payments AS (
+            UPDATE payments p SET date_created = target.date_created
+            FROM target WHERE p.order_uid = target.order_uid
+        ), moved_items AS (
+            UPDATE items i SET date_created = target.date_created
+            FROM target WHERE i.order_uid = target.order_uid
+        )
+        DELETE FROM orders o USING target
+        WHERE o.order_uid = target.order_uid AND o.date_created = target.stored`
+}
+
+// moveOrder - moveOrders for a single order about to be written
+func moveOrder(ctx context.Context, tx execer, order *model.Order) error {
+	_, err := tx.ExecContext(ctx,
+		moveOrders("(SELECT $1::varchar AS order_uid, $2::timestamptz AS date_created) t"),
+		order.OrderUID, order.DateCreated)
+	return err
+}
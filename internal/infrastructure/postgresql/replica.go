@@ -0,0 +1,148 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"shop-microservice/internal/domain/repositories"
+)
+
+// DefaultMaxReplicaLag - replicas lagging behind the primary for longer are not read from
+const DefaultMaxReplicaLag = 5 * time.Second
+
+// replicaCheckTimeout - time limit for one replica health check
+const replicaCheckTimeout = 2 * time.Second
+
+// replicaLagQuery - replay lag of a standby in seconds; zero when it has replayed
+// everything it received or when the server is not a standby
+const replicaLagQuery = `
+        SELECT CASE
+            WHEN NOT pg_is_in_recovery() OR pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+            ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+        END
+`
+
+type replica struct {
+	db      *sql.DB
+	healthy atomic.Bool
+}
+
+// ReplicaSet - read replicas of the primary database. A replica serves reads only
+// after a health check found it reachable and within maxLag; a failed read takes
+// it out until the next check.
+type ReplicaSet struct {
+	replicas []*replica
+	maxLag   time.Duration
+	next     atomic.Uint64
+}
+
+// NewReplicaSet - creates a replica set; replicas are unused until the first Check
+func NewReplicaSet(maxLag time.Duration, dbs ...*sql.DB) *ReplicaSet {
+	if maxLag <= 0 {
+		maxLag = DefaultMaxReplicaLag
+	}
+	s := &ReplicaSet{maxLag: maxLag}
+	for _, db := range dbs {
+		s.replicas = append(s.replicas, &replica{db: db})
+	}
+	return s
+}
+
+// Check - measures the lag of every replica and returns how many can serve reads
+func (s *ReplicaSet) Check(ctx context.Context) int {
+	healthy := 0
+	for i, rep := range s.replicas {
+		lag, err := replicaLag(ctx, rep.db)
+		ok := err == nil && lag <= s.maxLag
+		if rep.healthy.Swap(ok) != ok {
+			if ok {
+				log.Printf("Replica %d is back in rotation", i)
+			} else {
+				log.Printf("Replica %d is out of rotation (lag %v): %v", i, lag, err)
+			}
+		}
+		if ok {
+			healthy++
+		}
+	}
+	return healthy
+}
+
+// Run - checks replicas every interval until ctx is cancelled
+func (s *ReplicaSet) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.Check(ctx)
+		}
+	}
+}
+
+func replicaLag(ctx context.Context, db *sql.DB) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, replicaCheckTimeout)
+	defer cancel()
+
+	var seconds float64
+	if err := db.QueryRowContext(ctx, replicaLagQuery).Scan(&seconds); err != nil {
+		return 0, err
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// pick - next healthy replica in round-robin order, nil when there is none
+func (s *ReplicaSet) pick() *replica {
+	n := len(s.replicas)
+	start := int(s.next.Add(1))
+	for i := range n {
+		rep := s.replicas[(start+i)%n]
+		if rep.healthy.Load() {
+			return rep
+		}
+	}
+	return nil
+}
+
+// WithReplicas - routes FindByID, FindAll, List and Stream to healthy replicas.
+// Writes, transactions and reads in a context that already wrote
+// (repositories.ReadFromPrimary) stay on the primary.
+func WithReplicas(replicas *ReplicaSet) Option {
+	return func(r *OrderRepository) {
+		r.replicas = replicas
+	}
+}
+
+// read - runs fn on a replica when one is available, otherwise on the primary.
+// When the replica fails, it is taken out of rotation and fn is retried on the primary.
+func (r *OrderRepository) read(ctx context.Context, fn func(q queryer) error) error {
+	if r.replicas == nil || repositories.ReadFromPrimary(ctx) {
+		return fn(r.db)
+	}
+	rep := r.replicas.pick()
+	if rep == nil {
+		return fn(r.db)
+	}
+
+	err := fn(rep.db)
+	if err == nil || errors.Is(err, repositories.ErrOrderNotFound) || ctx.Err() != nil {
+		return err
+	}
+	rep.healthy.Store(false)
+	log.Printf("Replica read failed, falling back to primary: %v", err)
+	return fn(r.db)
+}
+
+// begin - starts a write transaction on the primary; later reads in the same
+// session go to the primary as well
+func (r *OrderRepository) begin(ctx context.Context) (*sql.Tx, error) {
+	repositories.MarkWritten(ctx)
+	return r.db.BeginTx(ctx, nil)
+}
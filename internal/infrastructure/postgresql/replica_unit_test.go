@@ -0,0 +1,132 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"shop-microservice/internal/domain/repositories"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// expectFindByID ожидает чтение заказа без товаров
+func expectFindByID(mock sqlmock.Sqlmock, uid string) {
+	order := createTestOrder()
+	order.OrderUID = uid
+	mock.ExpectQuery("SELECT o.order_uid").
+		WithArgs(uid).
+		WillReturnRows(addOrderRow(newOrderRows(), order))
+	mock.ExpectQuery("FROM items WHERE order_uid").
+		WithArgs(uid).
+		WillReturnRows(sqlmock.NewRows([]string{"chrt_id"}))
+}
+
+// expectReplicaLag ожидает проверку отставания реплики
+func expectReplicaLag(mock sqlmock.Sqlmock, lag time.Duration) {
+	mock.ExpectQuery("pg_last_wal_replay_lsn").
+		WillReturnRows(sqlmock.NewRows([]string{"lag"}).AddRow(lag.Seconds()))
+}
+
+func newReplicaMocks(t *testing.T) (*sql.DB, sqlmock.Sqlmock, *sql.DB, sqlmock.Sqlmock) {
+	primary, primaryMock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { primary.Close() })
+	replica, replicaMock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { replica.Close() })
+	return primary, primaryMock, replica, replicaMock
+}
+
+func TestOrderRepository_Replicas_ReadYourWrites(t *testing.T) {
+	primary, primaryMock, replica, replicaMock := newReplicaMocks(t)
+
+	replicas := NewReplicaSet(time.Second, replica)
+	expectReplicaLag(replicaMock, 0)
+	require.Equal(t, 1, replicas.Check(context.Background()))
+	repo := NewOrderRepository(primary, WithReplicas(replicas))
+
+	ctx := repositories.WithSession(context.Background())
+	expectFindByID(replicaMock, "a")
+	_, err := repo.FindByID(ctx, "a")
+	require.NoError(t, err)
+
+	// После изменения в той же сессии чтения идут в основную базу
+	primaryMock.ExpectBegin()
+	primaryMock.ExpectRollback()
+	tx, err := repo.begin(ctx)
+	require.NoError(t, err)
+	require.NoError(t, tx.Rollback())
+
+	expectFindByID(primaryMock, "a")
+	_, err = repo.FindByID(ctx, "a")
+	require.NoError(t, err)
+
+	// Другая сессия снова читает из реплики
+	replicaMock.ExpectQuery("SELECT o.order_uid").
+		WillReturnRows(newOrderRows())
+	_, err = repo.List(repositories.WithSession(context.Background()), repositories.ListOptions{})
+	require.NoError(t, err)
+
+	require.NoError(t, primaryMock.ExpectationsWereMet())
+	require.NoError(t, replicaMock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_Replicas_LaggingReplica(t *testing.T) {
+	primary, primaryMock, replica, replicaMock := newReplicaMocks(t)
+
+	replicas := NewReplicaSet(time.Second, replica)
+	expectReplicaLag(replicaMock, 30*time.Second)
+	require.Zero(t, replicas.Check(context.Background()))
+	repo := NewOrderRepository(primary, WithReplicas(replicas))
+
+	expectFindByID(primaryMock, "a")
+	_, err := repo.FindByID(context.Background(), "a")
+	require.NoError(t, err)
+
+	// Догнавшая реплика возвращается после следующей проверки
+	expectReplicaLag(replicaMock, 100*time.Millisecond)
+	require.Equal(t, 1, replicas.Check(context.Background()))
+	expectFindByID(replicaMock, "a")
+	_, err = repo.FindByID(context.Background(), "a")
+	require.NoError(t, err)
+
+	require.NoError(t, primaryMock.ExpectationsWereMet())
+	require.NoError(t, replicaMock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_Replicas_FallbackWhenReplicaFails(t *testing.T) {
+	primary, primaryMock, replica, replicaMock := newReplicaMocks(t)
+
+	replicas := NewReplicaSet(0, replica)
+	expectReplicaLag(replicaMock, 0)
+	require.Equal(t, 1, replicas.Check(context.Background()))
+	repo := NewOrderRepository(primary, WithReplicas(replicas))
+
+	replicaMock.ExpectQuery("SELECT o.order_uid").
+		WillReturnError(errors.New("connection refused"))
+	expectFindByID(primaryMock, "a")
+
+	order, err := repo.FindByID(context.Background(), "a")
+	require.NoError(t, err)
+	assert.Equal(t, "a", order.OrderUID)
+
+	// Отказавшая реплика выведена из ротации до следующей проверки
+	expectFindByID(primaryMock, "b")
+	_, err = repo.FindByID(context.Background(), "b")
+	require.NoError(t, err)
+
+	// Заказа нет и в реплике: основная база не опрашивается
+	expectReplicaLag(replicaMock, 0)
+	replicas.Check(context.Background())
+	replicaMock.ExpectQuery("SELECT o.order_uid").
+		WillReturnError(sql.ErrNoRows)
+	_, err = repo.FindByID(context.Background(), "missing")
+	require.ErrorIs(t, err, repositories.ErrOrderNotFound)
+
+	require.NoError(t, primaryMock.ExpectationsWereMet())
+	require.NoError(t, replicaMock.ExpectationsWereMet())
+}
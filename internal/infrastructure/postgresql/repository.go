@@ -3,36 +3,280 @@ package postgresql
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"strings"
 
 	"shop-microservice/internal/domain/model"
+	"shop-microservice/internal/domain/repositories"
+	"shop-microservice/internal/infrastructure/fieldcrypt"
+
+	"github.com/lib/pq"
 )
 
+// streamBatchSize - default number of orders loaded per query when streaming
+const streamBatchSize = 500
+
+// queryer is implemented by both *sql.DB and *sql.Tx
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
 type OrderRepository struct {
-	db *sql.DB
+	db       *sql.DB
+	replicas *ReplicaSet
+	cipher   *fieldcrypt.Cipher
+}
+
+// Option - optional repository setting
+type Option func(*OrderRepository)
+
+// WithDeliveryCipher - encrypts delivery name, phone, address and email in deliveries,
+// audit entries and archive documents
+func WithDeliveryCipher(cipher *fieldcrypt.Cipher) Option {
+	return func(r *OrderRepository) {
+		r.cipher = cipher
+	}
+}
+
+func NewOrderRepository(db *sql.DB, opts ...Option) *OrderRepository {
+	r := &OrderRepository{db: db}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Ping - checks database connection
+func (r *OrderRepository) Ping(ctx context.Context) error {
+	return r.db.PingContext(ctx)
+}
+
+// fingerprintQuery - version and updated_at of every order. Every write through the
+// service bumps both (000004), so the periodic reconcile compares them instead of
+// reading whole orders
+const fingerprintQuery = `
+        SELECT order_uid, concat(version, '@', extract(epoch FROM updated_at))
+        FROM orders
+        WHERE deleted_at IS NULL
+    `
+
+// contentFingerprintQuery hashes orders, deliveries, payments and items rows,
+// so any change to an order (including manual SQL) changes its fingerprint.
+// It reads every row of the four tables and is only run on demand.
+const contentFingerprintQuery = `
+        SELECT o.order_uid,
+               md5(concat_ws('|', o::text, d::text, p::text, i.items))
+        FROM orders o
+        LEFT JOIN deliveries d ON o.order_uid = d.order_uid
+        LEFT JOIN payments p ON o.order_uid = p.order_uid
+        LEFT JOIN (
+            SELECT order_uid,
+                   string_agg(
+                       ROW(chrt_id, track_number, price, rid, name, sale, size,
+                           total_price, nm_id, brand, status)::text,
+                       ',' ORDER BY chrt_id, rid
+                   ) AS items
+            FROM items
+            GROUP BY order_uid
+        ) i ON o.order_uid = i.order_uid
+        WHERE o.deleted_at IS NULL
+    `
+
+// Fingerprints - returns the version fingerprint of every order keyed by order uid
+func (r *OrderRepository) Fingerprints(ctx context.Context) (map[string]string, error) {
+	fingerprints, err := r.queryFingerprints(ctx, fingerprintQuery)
+	if err != nil {
+		return nil, errFail("Fingerprints: %w", err)
+	}
+	return fingerprints, nil
+}
+
+// ContentFingerprints - returns content hash of every order keyed by order uid
+func (r *OrderRepository) ContentFingerprints(ctx context.Context) (map[string]string, error) {
+	fingerprints, err := r.queryFingerprints(ctx, contentFingerprintQuery)
+	if err != nil {
+		return nil, errFail("Content Fingerprints: %w", err)
+	}
+	return fingerprints, nil
 }
 
-func NewOrderRepository(db *sql.DB) *OrderRepository {
-	return &OrderRepository{db: db}
+// queryFingerprints - runs a query returning (order_uid, fingerprint) pairs on the primary
+func (r *OrderRepository) queryFingerprints(ctx context.Context, query string) (map[string]string, error) {
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	fingerprints := make(map[string]string)
+	for rows.Next() {
+		var uid, fingerprint string
+		if err := rows.Scan(&uid, &fingerprint); err != nil {
+			return nil, errFail("failed to scan: %w", err)
+		}
+		fingerprints[uid] = fingerprint
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errFail("rows iteration error: %w", err)
+	}
+
+	return fingerprints, nil
 }
 
 func errFail(format string, args ...any) error {
 	return fmt.Errorf(format, args...)
 }
 
-// Save - saves order, delivery, payment, items
+// Create - inserts a new order, delivery, payment and items.
+// If the order already exists nothing is written and *repositories.ConflictError
+// with the version of the stored order is returned. A soft-deleted order is replaced.
+func (r *OrderRepository) Create(ctx context.Context, order *model.Order) error {
+	fail := func(err error) error {
+		return fmt.Errorf("Create Order: %w", err)
+	}
+
+	if err := ensureOrderPartitions(ctx, r.db, order.DateCreated); err != nil {
+		return fail(err)
+	}
+
+	tx, err := r.begin(ctx)
+	if err != nil {
+		return fail(err)
+	}
+	defer tx.Rollback()
+
+	if err := lockOrderUIDs(ctx, tx, order.OrderUID); err != nil {
+		return fail(err)
+	}
+
+	// Заказ с другой date_created сначала переносится в свою секцию, дальше
+	// конфликт с ним разбирается как обычно
+	if err := moveOrder(ctx, tx, order); err != nil {
+		return fail(err)
+	}
+
+	created, err := r.insertOrder(ctx, tx, order)
+	if err != nil {
+		return fail(err)
+	}
+	if !created {
+		var version int64
+		err := tx.QueryRowContext(ctx, "SELECT version FROM orders WHERE order_uid = $1", order.OrderUID).Scan(&version)
+		if err != nil {
+			return fail(err)
+		}
+		return &repositories.ConflictError{OrderUID: order.OrderUID, Version: version}
+	}
+
+	if err := r.saveDelivery(ctx, tx, order); err != nil {
+		return fail(err)
+	}
+
+	if err := r.savePayment(ctx, tx, order); err != nil {
+		return fail(err)
+	}
+
+	if err := r.saveItems(ctx, tx, order); err != nil {
+		return fail(err)
+	}
+
+	if err := r.recordAudit(ctx, tx, model.AuditCreate, nil, order); err != nil {
+		return fail(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fail(err)
+	}
+
+	return nil
+}
+
+func (r *OrderRepository) insertOrder(ctx context.Context, tx *sql.Tx, order *model.Order) (bool, error) {
+	query := `
+        INSERT INTO orders (
+            order_uid, track_number, entry, locale, internal_signature, 
+            customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard,
+            version, updated_at
+        ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, 1, now())
+        ON CONFLICT (order_uid, date_created) DO UPDATE SET
+            track_number = EXCLUDED.track_number,
+            entry = EXCLUDED.entry,
+            locale = EXCLUDED.locale,
+            internal_signature = EXCLUDED.internal_signature,
+            customer_id = EXCLUDED.customer_id,
+            delivery_service = EXCLUDED.delivery_service,
+            shardkey = EXCLUDED.shardkey,
+            sm_id = EXCLUDED.sm_id,
+            oof_shard = EXCLUDED.oof_shard,
+            status = DEFAULT,
+            status_changed_at = now(),
+            version = orders.version + 1,
+            updated_at = now(),
+            deleted_at = NULL
+        WHERE orders.deleted_at IS NOT NULL
+        RETURNING status, version, updated_at
+	`
+	err := tx.QueryRowContext(ctx, query,
+		order.OrderUID,
+		order.TrackNumber,
+		order.Entry,
+		order.Locale,
+		order.InternalSignature,
+		order.CustomerID,
+		order.DeliveryService,
+		order.Shardkey,
+		order.SmID,
+		order.DateCreated,
+		order.OofShard,
+	).Scan(&order.Status, &order.Version, &order.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Save - saves order, delivery, payment, items, replacing an existing order.
+// Intended for trusted ingestion paths, use Create for client requests.
+// If order.Version is set, the stored order must have the same version,
+// otherwise repositories.ErrVersionConflict is returned. A soft-deleted order is
+// replaced the same way Create does it: it starts over in status created.
 func (r *OrderRepository) Save(ctx context.Context, order *model.Order) error {
 	fail := func(err error) error {
 		return fmt.Errorf("Save Order: %w", err)
 	}
 
-	tx, err := r.db.BeginTx(ctx, nil)
+	if err := ensureOrderPartitions(ctx, r.db, order.DateCreated); err != nil {
+		return fail(err)
+	}
+
+	tx, err := r.begin(ctx)
 	if err != nil {
 		return fail(err)
 	}
 	defer tx.Rollback()
 
+	if err := lockOrderUIDs(ctx, tx, order.OrderUID); err != nil {
+		return fail(err)
+	}
+
+	// Текущее состояние нужно для проверки версии и журнала аудита
+	before, err := r.lockCurrentOrder(ctx, tx, order.OrderUID, order.Version)
+	if err != nil {
+		return fail(err)
+	}
+	if order.Version > 0 && before == nil {
+		return fail(repositories.ErrVersionConflict)
+	}
+
+	if err := moveOrder(ctx, tx, order); err != nil {
+		return fail(err)
+	}
+
 	if err := r.saveOrder(ctx, tx, order); err != nil {
 		return fail(err)
 	}
@@ -49,6 +293,14 @@ func (r *OrderRepository) Save(ctx context.Context, order *model.Order) error {
 		return fail(err)
 	}
 
+	action := model.AuditUpdate
+	if before == nil {
+		action = model.AuditCreate
+	}
+	if err := r.recordAudit(ctx, tx, action, before, order); err != nil {
+		return fail(err)
+	}
+
 	if err := tx.Commit(); err != nil {
 		return fail(err)
 	}
@@ -60,9 +312,10 @@ func (r *OrderRepository) saveOrder(ctx context.Context, tx *sql.Tx, order *mode
 	query := `
         INSERT INTO orders (
             order_uid, track_number, entry, locale, internal_signature, 
-            customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard
-        ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
-        ON CONFLICT (order_uid) DO UPDATE SET
+            customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard,
+            version, updated_at
+        ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, 1, now())
+        ON CONFLICT (order_uid, date_created) DO UPDATE SET
             track_number = EXCLUDED.track_number,
             entry = EXCLUDED.entry,
             locale = EXCLUDED.locale,
@@ -71,10 +324,15 @@ func (r *OrderRepository) saveOrder(ctx context.Context, tx *sql.Tx, order *mode
             delivery_service = EXCLUDED.delivery_service,
             shardkey = EXCLUDED.shardkey,
             sm_id = EXCLUDED.sm_id,
-            date_created = EXCLUDED.date_created,
-            oof_shard = EXCLUDED.oof_shard
+            oof_shard = EXCLUDED.oof_shard,
+            status = CASE WHEN orders.deleted_at IS NOT NULL THEN 'created' ELSE orders.status END,
+            status_changed_at = CASE WHEN orders.deleted_at IS NOT NULL THEN now() ELSE orders.status_changed_at END,
+            version = orders.version + 1,
+            updated_at = now(),
+            deleted_at = NULL
+        RETURNING status, version, updated_at
 	`
-	_, err := tx.ExecContext(ctx, query,
+	return tx.QueryRowContext(ctx, query,
 		order.OrderUID,
 		order.TrackNumber,
 		order.Entry,
@@ -86,15 +344,25 @@ func (r *OrderRepository) saveOrder(ctx context.Context, tx *sql.Tx, order *mode
 		order.SmID,
 		order.DateCreated,
 		order.OofShard,
-	)
-	return err
+	).Scan(&order.Status, &order.Version, &order.UpdatedAt)
 }
 
 func (r *OrderRepository) saveDelivery(ctx context.Context, tx *sql.Tx, order *model.Order) error {
+	if order.Delivery == nil {
+		_, err := tx.ExecContext(ctx, "DELETE FROM deliveries WHERE order_uid = $1", order.OrderUID)
+		return err
+	}
+
+	stored, err := r.sealDelivery(ctx, order.Delivery)
+	if err != nil {
+		return err
+	}
+
 	query := `
         INSERT INTO deliveries (
-            order_uid, name, phone, zip, city, address, region, email
-        ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+            order_uid, date_created, name, phone, zip, city, address, region, email,
+            key_id, dek, email_bidx, phone_bidx
+        ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
         ON CONFLICT (order_uid) DO UPDATE SET
             name = EXCLUDED.name,
             phone = EXCLUDED.phone,
@@ -102,28 +370,42 @@ func (r *OrderRepository) saveDelivery(ctx context.Context, tx *sql.Tx, order *m
             city = EXCLUDED.city,
             address = EXCLUDED.address,
             region = EXCLUDED.region,
-            email = EXCLUDED.email
+            email = EXCLUDED.email,
+            key_id = EXCLUDED.key_id,
+            dek = EXCLUDED.dek,
+            email_bidx = EXCLUDED.email_bidx,
+            phone_bidx = EXCLUDED.phone_bidx
     `
 
-	_, err := tx.ExecContext(ctx, query,
+	_, err = tx.ExecContext(ctx, query,
 		order.OrderUID,
-		order.Delivery.Name,
-		order.Delivery.Phone,
+		order.DateCreated,
+		stored.name,
+		stored.phone,
 		order.Delivery.Zip,
 		order.Delivery.City,
-		order.Delivery.Address,
+		stored.address,
 		order.Delivery.Region,
-		order.Delivery.Email,
+		stored.email,
+		stored.keyID,
+		stored.wrappedKey(),
+		stored.emailIndex,
+		stored.phoneIndex,
 	)
 	return err
 }
 
 func (r *OrderRepository) savePayment(ctx context.Context, tx *sql.Tx, order *model.Order) error {
+	if order.Payment == nil {
+		_, err := tx.ExecContext(ctx, "DELETE FROM payments WHERE order_uid = $1", order.OrderUID)
+		return err
+	}
+
 	query := `
         INSERT INTO payments (
-            order_uid, transaction, request_id, currency, provider, 
+            order_uid, date_created, transaction, request_id, currency, provider, 
             amount, payment_dt, bank, delivery_cost, goods_total, custom_fee
-        ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+        ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
         ON CONFLICT (order_uid) DO UPDATE SET
             transaction = EXCLUDED.transaction,
             request_id = EXCLUDED.request_id,
@@ -139,6 +421,7 @@ func (r *OrderRepository) savePayment(ctx context.Context, tx *sql.Tx, order *mo
 
 	_, err := tx.ExecContext(ctx, query,
 		order.OrderUID,
+		order.DateCreated,
 		order.Payment.Transaction,
 		order.Payment.RequestID,
 		order.Payment.Currency,
@@ -165,9 +448,9 @@ func (r *OrderRepository) saveItems(ctx context.Context, tx *sql.Tx, order *mode
 
 	stmt, err := tx.PrepareContext(ctx, `
         INSERT INTO items (
-            order_uid, chrt_id, track_number, price, rid, name, 
+            order_uid, date_created, chrt_id, track_number, price, rid, name, 
             sale, size, total_price, nm_id, brand, status
-        ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+        ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
     `)
 	if err != nil {
 		return err
@@ -177,6 +460,7 @@ func (r *OrderRepository) saveItems(ctx context.Context, tx *sql.Tx, order *mode
 	for _, item := range order.Items {
 		_, err := stmt.ExecContext(ctx,
 			order.OrderUID,
+			order.DateCreated,
 			item.ChrtID,
 			item.TrackNumber,
 			item.Price,
@@ -197,6 +481,150 @@ func (r *OrderRepository) saveItems(ctx context.Context, tx *sql.Tx, order *mode
 	return nil
 }
 
+// Update - applies mutate to the current state of the order and saves the result.
+// The order row is locked for the duration of the transaction. A non-zero
+// expectedVersion must match the stored version (compare-and-swap).
+func (r *OrderRepository) Update(ctx context.Context, uid string, expectedVersion int64, mutate func(order *model.Order) error) (*model.Order, error) {
+	fail := func(err error) (*model.Order, error) {
+		return nil, fmt.Errorf("Update Order: %w", err)
+	}
+
+	tx, err := r.begin(ctx)
+	if err != nil {
+		return fail(err)
+	}
+	defer tx.Rollback()
+
+	if err := lockOrderUIDs(ctx, tx, uid); err != nil {
+		return fail(err)
+	}
+
+	current, err := r.lockOrder(ctx, tx, uid)
+	if err != nil {
+		return fail(err)
+	}
+	if expectedVersion > 0 && current != expectedVersion {
+		return fail(repositories.ErrVersionConflict)
+	}
+
+	order, err := r.loadOrder(ctx, tx, uid)
+	if err != nil {
+		return fail(err)
+	}
+
+	before := order.Clone()
+	if err := mutate(order); err != nil {
+		return fail(err)
+	}
+	if order.OrderUID != uid {
+		return fail(errFail("order uid cannot be changed"))
+	}
+	order.Version = current
+
+	// Новая date_created известна только здесь, поэтому секция создается внутри
+	// транзакции и ее блокировка держится до фиксации
+	if !order.DateCreated.Equal(before.DateCreated) {
+		if partitionMonth(order.DateCreated) != partitionMonth(before.DateCreated) {
+			if err := ensureOrderPartitions(ctx, tx, order.DateCreated); err != nil {
+				return fail(err)
+			}
+		}
+		if err := moveOrder(ctx, tx, order); err != nil {
+			return fail(err)
+		}
+	}
+
+	if err := r.saveOrder(ctx, tx, order); err != nil {
+		return fail(err)
+	}
+
+	if err := r.saveDelivery(ctx, tx, order); err != nil {
+		return fail(err)
+	}
+
+	if err := r.savePayment(ctx, tx, order); err != nil {
+		return fail(err)
+	}
+
+	if err := r.saveItems(ctx, tx, order); err != nil {
+		return fail(err)
+	}
+
+	if err := r.recordAudit(ctx, tx, model.AuditUpdate, before, order); err != nil {
+		return fail(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fail(err)
+	}
+
+	return order, nil
+}
+
+// lockOrder locks the order row and returns its current version.
+// A soft-deleted order is reported as not found.
+func (r *OrderRepository) lockOrder(ctx context.Context, tx *sql.Tx, uid string) (int64, error) {
+	var version int64
+	err := tx.QueryRowContext(ctx,
+		"SELECT version FROM orders WHERE order_uid = $1 AND deleted_at IS NULL FOR UPDATE", uid).Scan(&version)
+	if err == sql.ErrNoRows {
+		return 0, errFail("%w: %w", repositories.ErrOrderNotFound, err)
+	}
+	return version, err
+}
+
+// lockCurrentOrder locks the order row and loads the order; nil if it does not exist.
+// A non-zero expectedVersion must match the stored version.
+func (r *OrderRepository) lockCurrentOrder(ctx context.Context, tx *sql.Tx, uid string, expectedVersion int64) (*model.Order, error) {
+	current, err := r.lockOrder(ctx, tx, uid)
+	if errors.Is(err, repositories.ErrOrderNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if expectedVersion > 0 && current != expectedVersion {
+		return nil, repositories.ErrVersionConflict
+	}
+	return r.loadOrder(ctx, tx, uid)
+}
+
+// Delete - soft deletes the order: it is hidden from reads but kept with its delivery,
+// payment and items until archived. A non-zero expectedVersion must match the stored version.
+func (r *OrderRepository) Delete(ctx context.Context, uid string, expectedVersion int64) error {
+	fail := func(err error) error {
+		return fmt.Errorf("Delete Order: %w", err)
+	}
+
+	tx, err := r.begin(ctx)
+	if err != nil {
+		return fail(err)
+	}
+	defer tx.Rollback()
+
+	before, err := r.lockCurrentOrder(ctx, tx, uid, expectedVersion)
+	if err != nil {
+		return fail(err)
+	}
+	if before == nil {
+		return fail(repositories.ErrOrderNotFound)
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE orders SET deleted_at = now() WHERE order_uid = $1", uid); err != nil {
+		return fail(err)
+	}
+
+	if err := r.recordAudit(ctx, tx, model.AuditDelete, before, nil); err != nil {
+		return fail(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fail(err)
+	}
+
+	return nil
+}
+
 // FindByID - finds orders by uid
 func (r *OrderRepository) FindByID(ctx context.Context, uid string) (*model.Order, error) {
 	order, err := r.findOrderByID(ctx, uid)
@@ -208,12 +636,23 @@ func (r *OrderRepository) FindByID(ctx context.Context, uid string) (*model.Orde
 }
 
 func (r *OrderRepository) findOrderByID(ctx context.Context, uid string) (*model.Order, error) {
-	order, err := r.queryOrderWithDeliveryAndPayment(ctx, uid)
+	var order *model.Order
+	err := r.read(ctx, func(q queryer) error {
+		var err error
+		order, err = r.loadOrder(ctx, q, uid)
+		return err
+	})
+	return order, err
+}
+
+// loadOrder reads the order through q, so it works both on db and inside a transaction
+func (r *OrderRepository) loadOrder(ctx context.Context, q queryer, uid string) (*model.Order, error) {
+	order, err := r.queryOrderWithDeliveryAndPayment(ctx, q, uid)
 	if err != nil {
 		return nil, err
 	}
 
-	items, err := r.queryOrderItems(ctx, uid)
+	items, err := r.queryOrderItems(ctx, q, uid)
 	if err != nil {
 		return nil, err
 	}
@@ -222,51 +661,27 @@ func (r *OrderRepository) findOrderByID(ctx context.Context, uid string) (*model
 	return order, nil
 }
 
-func (r *OrderRepository) queryOrderWithDeliveryAndPayment(ctx context.Context, uid string) (*model.Order, error) {
-	query := `
-        SELECT o.order_uid, o.track_number, o.entry, o.locale, o.internal_signature,
-               o.customer_id, o.delivery_service, o.shardkey, o.sm_id, o.date_created, o.oof_shard,
-               d.name, d.phone, d.zip, d.city, d.address, d.region, d.email,
-               p.transaction, p.request_id, p.currency, p.provider, p.amount, p.payment_dt,
-               p.bank, p.delivery_cost, p.goods_total, p.custom_fee
-        FROM orders o
-        LEFT JOIN deliveries d ON o.order_uid = d.order_uid
-        LEFT JOIN payments p ON o.order_uid = p.order_uid
-        WHERE o.order_uid = $1
-    `
-
-	order := &model.Order{}
-	var delivery model.Delivery
-	var payment model.Payment
-
-	err := r.db.QueryRowContext(ctx, query, uid).Scan(
-		&order.OrderUID, &order.TrackNumber, &order.Entry, &order.Locale, &order.InternalSignature,
-		&order.CustomerID, &order.DeliveryService, &order.Shardkey, &order.SmID, &order.DateCreated, &order.OofShard,
-		&delivery.Name, &delivery.Phone, &delivery.Zip, &delivery.City, &delivery.Address, &delivery.Region, &delivery.Email,
-		&payment.Transaction, &payment.RequestID, &payment.Currency, &payment.Provider, &payment.Amount, &payment.PaymentDt,
-		&payment.Bank, &payment.DeliveryCost, &payment.GoodsTotal, &payment.CustomFee,
-	)
+func (r *OrderRepository) queryOrderWithDeliveryAndPayment(ctx context.Context, q queryer, uid string) (*model.Order, error) {
+	query := selectOrdersWithDeliveryAndPayment + " WHERE o.order_uid = $1 AND o.deleted_at IS NULL"
 
+	order, err := r.scanOrderWithDeliveryAndPayment(ctx, q.QueryRowContext(ctx, query, uid))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, errFail("order not found: %w", err)
+			return nil, errFail("%w: %w", repositories.ErrOrderNotFound, err)
 		}
 		return nil, errFail("failed to query order: %w", err)
 	}
 
-	order.Delivery = delivery
-	order.Payment = payment
-
 	return order, nil
 }
 
-func (r *OrderRepository) queryOrderItems(ctx context.Context, uid string) ([]model.Item, error) {
+func (r *OrderRepository) queryOrderItems(ctx context.Context, q queryer, uid string) ([]model.Item, error) {
 	query := `
         SELECT chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status
         FROM items WHERE order_uid = $1
     `
 
-	rows, err := r.db.QueryContext(ctx, query, uid)
+	rows, err := q.QueryContext(ctx, query, uid)
 	if err != nil {
 		return nil, errFail("failed to query items: %w", err)
 	}
@@ -312,36 +727,49 @@ func (r *OrderRepository) scanSingleItem(rows *sql.Rows) (model.Item, error) {
 
 // FindAll - finds all orders
 func (r *OrderRepository) FindAll(ctx context.Context) ([]*model.Order, error) {
-	orders, err := r.findAllOrders(ctx)
+	var result []*model.Order
+	err := r.stream(ctx, repositories.OrderFilter{}, repositories.SortDateCreatedDesc, streamBatchSize,
+		func(batch []*model.Order) error {
+			result = append(result, batch...)
+			return nil
+		})
 	if err != nil {
 		return nil, errFail("FindAll: %w", err)
 	}
-	// Конвертируем []model.Order в []*model.Order
-	result := make([]*model.Order, len(orders))
-	for i := range orders {
-		result[i] = &orders[i]
-	}
 	return result, nil
 }
 
-func (r *OrderRepository) findAllOrders(ctx context.Context) ([]model.Order, error) {
-	orders, err := r.getOrdersWithDeliveryAndPayment(ctx)
-	if err != nil {
-		return nil, err
+// Stream - passes orders matching the filter to fn in batches of batchSize.
+// Only one batch is held in memory, items are loaded per batch.
+func (r *OrderRepository) Stream(ctx context.Context, filter repositories.OrderFilter, batchSize int, fn func(batch []*model.Order) error) error {
+	if batchSize <= 0 {
+		batchSize = streamBatchSize
 	}
+	if err := r.stream(ctx, filter, repositories.SortOrderUIDAsc, batchSize, fn); err != nil {
+		return errFail("Stream: %w", err)
+	}
+	return nil
+}
 
-	orderUIDs := extractOrderUIDs(orders)
+func (r *OrderRepository) stream(ctx context.Context, filter repositories.OrderFilter, sort repositories.OrderSort, batchSize int, fn func(batch []*model.Order) error) error {
+	opts := repositories.ListOptions{Filter: filter, Sort: sort, Limit: batchSize}
+	for {
+		page, err := r.readPage(ctx, opts)
+		if err != nil {
+			return err
+		}
 
-	itemsByOrder, err := r.getItemsForOrders(ctx, orderUIDs)
-	if err != nil {
-		return nil, err
-	}
+		if len(page.Orders) > 0 {
+			if err := fn(page.Orders); err != nil {
+				return err
+			}
+		}
 
-	for i := range orders {
-		orders[i].Items = itemsByOrder[orders[i].OrderUID]
+		if page.NextCursor == "" {
+			return nil
+		}
+		opts.Cursor = page.NextCursor
 	}
-
-	return orders, nil
 }
 
 func extractOrderUIDs(orders []model.Order) []string {
@@ -352,29 +780,22 @@ func extractOrderUIDs(orders []model.Order) []string {
 	return uids
 }
 
-func (r *OrderRepository) getItemsForOrders(ctx context.Context, orderUIDs []string) (map[string][]model.Item, error) {
+func (r *OrderRepository) getItemsForOrders(ctx context.Context, q queryer, orderUIDs []string) (map[string][]model.Item, error) {
 	if len(orderUIDs) == 0 {
 		return make(map[string][]model.Item), nil
 	}
 
-	placeholders := make([]string, len(orderUIDs))
-	args := make([]interface{}, len(orderUIDs))
-	for i, uid := range orderUIDs {
-		placeholders[i] = fmt.Sprintf("$%d", i+1)
-		args[i] = uid
-	}
-	// Убедимся что запрос использует индекс
-	// EXPLAIN ANALYZE SELECT * FROM items WHERE order_uid IN (...);
-	// first query
-	query := fmt.Sprintf(`
+	// Массив передается одним параметром, поэтому размер пачки
+	// не упирается в лимит Postgres на число параметров
+	query := `
         SELECT order_uid, chrt_id, track_number, price, rid, name, 
                sale, size, total_price, nm_id, brand, status
         FROM items 
-        WHERE order_uid IN (%s)
+        WHERE order_uid = ANY($1)
         ORDER BY order_uid
-    `, strings.Join(placeholders, ","))
+    `
 
-	rows, err := r.db.QueryContext(ctx, query, args...)
+	rows, err := q.QueryContext(ctx, query, pq.Array(orderUIDs))
 	if err != nil {
 		return nil, errFail("failed to query items for orders: %w", err)
 	}
@@ -404,69 +825,94 @@ func (r *OrderRepository) getItemsForOrders(ctx context.Context, orderUIDs []str
 	return itemsByOrder, nil
 }
 
-func (r *OrderRepository) getOrdersWithDeliveryAndPayment(ctx context.Context) ([]model.Order, error) {
-	//second query
-	rows, err := r.queryAllOrdersWithDeliveryAndPayment(ctx)
-	if err != nil {
-		return nil, err
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func (r *OrderRepository) scanOrderWithDeliveryAndPayment(ctx context.Context, row rowScanner) (*model.Order, error) {
+	var order model.Order
+	var delivery nullDelivery
+	var payment nullPayment
+
+	dest := []any{
+		&order.OrderUID, &order.TrackNumber, &order.Entry, &order.Locale, &order.InternalSignature,
+		&order.CustomerID, &order.DeliveryService, &order.Shardkey, &order.SmID, &order.DateCreated, &order.OofShard,
+		&order.Status, &order.Version, &order.UpdatedAt, &order.DeletedAt,
 	}
-	defer rows.Close()
+	dest = append(dest, delivery.dest()...)
+	dest = append(dest, payment.dest()...)
 
-	var orders []model.Order
-	for rows.Next() {
-		order, err := r.scanOrderWithDeliveryAndPayment(rows)
-		if err != nil {
-			return nil, errFail("failed to scan order: %w", err)
-		}
-		orders = append(orders, *order)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
 	}
 
-	if err = rows.Err(); err != nil {
-		return nil, errFail("rows iteration error: %w", err)
+	var err error
+	if order.Delivery, err = r.openDelivery(ctx, &delivery); err != nil {
+		return nil, err
 	}
+	order.Payment = payment.value()
 
-	return orders, nil
+	return &order, nil
 }
 
-func (r *OrderRepository) queryAllOrdersWithDeliveryAndPayment(ctx context.Context) (*sql.Rows, error) {
-	query := `
-        SELECT o.order_uid, o.track_number, o.entry, o.locale, o.internal_signature,
-               o.customer_id, o.delivery_service, o.shardkey, o.sm_id, o.date_created, o.oof_shard,
-               d.name, d.phone, d.zip, d.city, d.address, d.region, d.email,
-               p.transaction, p.request_id, p.currency, p.provider, p.amount, p.payment_dt,
-               p.bank, p.delivery_cost, p.goods_total, p.custom_fee
-        FROM orders o
-        LEFT JOIN deliveries d ON o.order_uid = d.order_uid
-        LEFT JOIN payments p ON o.order_uid = p.order_uid
-        ORDER BY o.date_created DESC
-    `
+// nullDelivery - delivery columns of the LEFT JOIN; the row is missing for drafts
+// and single columns may be NULL. keyID and dek are set for encrypted rows.
+type nullDelivery struct {
+	present                                        bool
+	name, phone, zip, city, address, region, email sql.NullString
+	keyID                                          sql.NullString
+	dek                                            []byte
+}
 
-	rows, err := r.db.QueryContext(ctx, query)
-	if err != nil {
-		return nil, errFail("failed to query orders: %w", err)
-	}
-	return rows, nil
+func (d *nullDelivery) dest() []any {
+	return []any{&d.present, &d.name, &d.phone, &d.zip, &d.city, &d.address, &d.region, &d.email, &d.keyID, &d.dek}
 }
 
-func (r *OrderRepository) scanOrderWithDeliveryAndPayment(rows *sql.Rows) (*model.Order, error) {
-	var order model.Order
-	var delivery model.Delivery
-	var payment model.Payment
+func (d *nullDelivery) value() *model.Delivery {
+	if !d.present {
+		return nil
+	}
+	return &model.Delivery{
+		Name:    d.name.String,
+		Phone:   d.phone.String,
+		Zip:     d.zip.String,
+		City:    d.city.String,
+		Address: d.address.String,
+		Region:  d.region.String,
+		Email:   d.email.String,
+	}
+}
 
-	err := rows.Scan(
-		&order.OrderUID, &order.TrackNumber, &order.Entry, &order.Locale, &order.InternalSignature,
-		&order.CustomerID, &order.DeliveryService, &order.Shardkey, &order.SmID, &order.DateCreated, &order.OofShard,
-		&delivery.Name, &delivery.Phone, &delivery.Zip, &delivery.City, &delivery.Address, &delivery.Region, &delivery.Email,
-		&payment.Transaction, &payment.RequestID, &payment.Currency, &payment.Provider, &payment.Amount, &payment.PaymentDt,
-		&payment.Bank, &payment.DeliveryCost, &payment.GoodsTotal, &payment.CustomFee,
-	)
+// nullPayment - payment columns of the LEFT JOIN; the row is missing for drafts
+// and single columns may be NULL
+type nullPayment struct {
+	present                                                bool
+	transaction, requestID, currency, provider, bank       sql.NullString
+	amount, paymentDt, deliveryCost, goodsTotal, customFee sql.NullInt64
+}
 
-	if err != nil {
-		return nil, err
+func (p *nullPayment) dest() []any {
+	return []any{
+		&p.present, &p.transaction, &p.requestID, &p.currency, &p.provider, &p.amount, &p.paymentDt,
+		&p.bank, &p.deliveryCost, &p.goodsTotal, &p.customFee,
 	}
+}
 
-	order.Delivery = delivery
-	order.Payment = payment
-
-	return &order, nil
+func (p *nullPayment) value() *model.Payment {
+	if !p.present {
+		return nil
+	}
+	return &model.Payment{
+		Transaction:  p.transaction.String,
+		RequestID:    p.requestID.String,
+		Currency:     p.currency.String,
+		Provider:     p.provider.String,
+		Amount:       int(p.amount.Int64),
+		PaymentDt:    p.paymentDt.Int64,
+		Bank:         p.bank.String,
+		DeliveryCost: int(p.deliveryCost.Int64),
+		GoodsTotal:   int(p.goodsTotal.Int64),
+		CustomFee:    int(p.customFee.Int64),
+	}
 }
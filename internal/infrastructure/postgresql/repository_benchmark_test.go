@@ -18,6 +18,7 @@ func BenchmarkOrderRepository_Save(b *testing.B) {
 
 	for i := 0; b.Loop(); i++ {
 		order.OrderUID = fmt.Sprintf("benchmark-order-%d", i)
+		order.Version = 0 // новый заказ, без проверки версии
 		err := repo.Save(ctx, order)
 		if err != nil {
 			b.Fatalf("Save failed: %v", err)
@@ -7,6 +7,7 @@ import (
 	"log"
 	"os"
 	"shop-microservice/internal/domain/model"
+	"shop-microservice/internal/domain/repositories"
 	"testing"
 	"time"
 
@@ -83,7 +84,7 @@ func setup() error {
 
 func teardown() {
 	if testDB != nil {
-		tables := []string{"items", "payments", "deliveries", "orders"}
+		tables := []string{"items", "payments", "deliveries", "orders", "order_audit", "orders_archive", "erasure_jobs"}
 		for _, table := range tables {
 			testDB.Exec("DELETE FROM " + table)
 		}
@@ -95,11 +96,15 @@ func setupTestSchema(db *sql.DB) error {
 	schema := `
 	DROP TABLE IF EXISTS items;
 	DROP TABLE IF EXISTS payments;
+	DROP TABLE IF EXISTS order_status_history;
 	DROP TABLE IF EXISTS deliveries;
 	DROP TABLE IF EXISTS orders;
+	DROP TABLE IF EXISTS order_audit;
+	DROP TABLE IF EXISTS orders_archive;
+	DROP TABLE IF EXISTS erasure_jobs;
 
 	CREATE TABLE orders (
-		order_uid VARCHAR(255) PRIMARY KEY,
+		order_uid VARCHAR(255) NOT NULL,
 		track_number VARCHAR(255),
 		entry VARCHAR(255),
 		locale VARCHAR(10),
@@ -108,23 +113,76 @@ func setupTestSchema(db *sql.DB) error {
 		delivery_service VARCHAR(255),
 		shardkey VARCHAR(255),
 		sm_id INTEGER,
-		date_created TIMESTAMP,
-		oof_shard VARCHAR(255)
+		date_created TIMESTAMPTZ NOT NULL,
+		oof_shard VARCHAR(255),
+		status VARCHAR(32) NOT NULL DEFAULT 'created',
+		status_changed_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		version BIGINT NOT NULL DEFAULT 1,
+		updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		deleted_at TIMESTAMPTZ,
+		PRIMARY KEY (order_uid, date_created)
+	) PARTITION BY RANGE (date_created);
+
+	CREATE TABLE orders_archive (
+		order_uid VARCHAR(255) NOT NULL,
+		date_created TIMESTAMPTZ NOT NULL,
+		customer_id VARCHAR(255),
+		status VARCHAR(32) NOT NULL,
+		deleted_at TIMESTAMPTZ,
+		archived_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		document JSONB NOT NULL,
+		key_id VARCHAR(64),
+		dek BYTEA,
+		email_bidx VARCHAR(64),
+		phone_bidx VARCHAR(64),
+		PRIMARY KEY (order_uid, date_created)
+	) PARTITION BY RANGE (date_created);
+
+	CREATE TABLE order_audit (
+		id BIGSERIAL PRIMARY KEY,
+		order_uid VARCHAR(255) NOT NULL,
+		version BIGINT NOT NULL,
+		action VARCHAR(32) NOT NULL,
+		actor VARCHAR(255) NOT NULL,
+		channel VARCHAR(32) NOT NULL,
+		changed_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		changes JSONB,
+		snapshot JSONB,
+		key_id VARCHAR(64),
+		dek BYTEA
+	);
+
+	CREATE TABLE order_status_history (
+		id BIGSERIAL PRIMARY KEY,
+		order_uid VARCHAR(255) NOT NULL,
+		from_status VARCHAR(32) NOT NULL,
+		to_status VARCHAR(32) NOT NULL,
+		actor VARCHAR(255) NOT NULL,
+		reason TEXT NOT NULL DEFAULT '',
+		version BIGINT NOT NULL,
+		changed_at TIMESTAMPTZ NOT NULL DEFAULT now()
 	);
 
 	CREATE TABLE deliveries (
-		order_uid VARCHAR(255) PRIMARY KEY REFERENCES orders(order_uid) ON DELETE CASCADE,
-		name VARCHAR(255),
-		phone VARCHAR(255),
+		order_uid VARCHAR(255) PRIMARY KEY,
+		date_created TIMESTAMPTZ NOT NULL,
+		name TEXT,
+		phone TEXT,
 		zip VARCHAR(255),
 		city VARCHAR(255),
-		address VARCHAR(255),
+		address TEXT,
 		region VARCHAR(255),
-		email VARCHAR(255)
+		email TEXT,
+		key_id VARCHAR(64),
+		dek BYTEA,
+		email_bidx VARCHAR(64),
+		phone_bidx VARCHAR(64),
+		FOREIGN KEY (order_uid, date_created) REFERENCES orders (order_uid, date_created) ON DELETE CASCADE
 	);
 
 	CREATE TABLE payments (
-		order_uid VARCHAR(255) PRIMARY KEY REFERENCES orders(order_uid) ON DELETE CASCADE,
+		order_uid VARCHAR(255) PRIMARY KEY,
+		date_created TIMESTAMPTZ NOT NULL,
 		transaction VARCHAR(255),
 		request_id VARCHAR(255),
 		currency VARCHAR(10),
@@ -134,11 +192,13 @@ func setupTestSchema(db *sql.DB) error {
 		bank VARCHAR(255),
 		delivery_cost INTEGER,
 		goods_total INTEGER,
-		custom_fee INTEGER
+		custom_fee INTEGER,
+		FOREIGN KEY (order_uid, date_created) REFERENCES orders (order_uid, date_created) ON DELETE CASCADE
 	);
 
 	CREATE TABLE items (
-		order_uid VARCHAR(255) REFERENCES orders(order_uid) ON DELETE CASCADE,
+		order_uid VARCHAR(255) NOT NULL,
+		date_created TIMESTAMPTZ NOT NULL,
 		chrt_id INTEGER,
 		track_number VARCHAR(255),
 		price INTEGER,
@@ -150,8 +210,23 @@ func setupTestSchema(db *sql.DB) error {
 		nm_id INTEGER,
 		brand VARCHAR(255),
 		status INTEGER,
-		PRIMARY KEY (order_uid, chrt_id)
+		PRIMARY KEY (order_uid, chrt_id, date_created),
+		FOREIGN KEY (order_uid, date_created) REFERENCES orders (order_uid, date_created) ON DELETE CASCADE
+	) PARTITION BY RANGE (date_created);
+
+	CREATE TABLE erasure_jobs (
+		id BIGSERIAL PRIMARY KEY,
+		customer_id VARCHAR(50) NOT NULL,
+		status VARCHAR(20) NOT NULL DEFAULT 'pending',
+		requested_by VARCHAR(100) NOT NULL,
+		requested_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		finished_at TIMESTAMPTZ,
+		orders INTEGER NOT NULL DEFAULT 0,
+		error TEXT,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now()
 	);
+	CREATE UNIQUE INDEX idx_erasure_jobs_pending ON erasure_jobs (customer_id) WHERE status = 'pending';
 	`
 
 	_, err := db.Exec(schema)
@@ -175,7 +250,7 @@ func createTestOrder() *model.Order {
 		SmID:              1,
 		DateCreated:       time.Now(),
 		OofShard:          "test-oof",
-		Delivery: model.Delivery{
+		Delivery: &model.Delivery{
 			Name:    "John Doe",
 			Phone:   "+1234567890",
 			Zip:     "123456",
@@ -184,7 +259,7 @@ func createTestOrder() *model.Order {
 			Region:  "Moscow",
 			Email:   "john@example.com",
 		},
-		Payment: model.Payment{
+		Payment: &model.Payment{
 			Transaction:  "test-transaction",
 			RequestID:    "test-request",
 			Currency:     "USD",
@@ -338,9 +413,416 @@ func TestOrderRepository_Save_UpdateExisting(t *testing.T) {
 	found, err := repo.FindByID(ctx, order.OrderUID)
 	require.NoError(t, err)
 
+	assert.Equal(t, int64(2), found.Version)
 	assert.Equal(t, "updated-track", found.TrackNumber)
 	assert.Equal(t, "Updated Name", found.Delivery.Name)
 	assert.Equal(t, 999, found.Items[0].Price)
+
+	history, err := repo.AuditHistory(ctx, order.OrderUID)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, len(history), 2)
+	last := history[len(history)-1]
+	assert.Equal(t, model.AuditUpdate, last.Action)
+	assert.Equal(t, found.Version, last.Version)
+	require.NotNil(t, last.Changes)
+	assert.Contains(t, last.Changes.Fields, model.FieldChange{Field: "track_number", From: "test-track", To: "updated-track"})
+
+	previous, err := repo.OrderAtVersion(ctx, order.OrderUID, found.Version-1)
+	require.NoError(t, err)
+	assert.Equal(t, "test-track", previous.TrackNumber)
+
+	asOf, err := repo.OrderAsOf(ctx, order.OrderUID, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, found.Version, asOf.Version)
+}
+
+func TestOrderRepository_OrderAsOf_AfterAnonymize(t *testing.T) {
+	repo := NewOrderRepository(testDB)
+	ctx := context.Background()
+
+	order := createTestOrder()
+	order.OrderUID = "as-of-anonymized"
+	order.DateCreated = time.Date(2023, 1, 10, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, repo.Save(ctx, order))
+
+	// Срок хранения задевает только заказы, созданные до февраля 2023
+	now := time.Now()
+	policy := repositories.RetentionPolicy{AnonymizeDeliveryAfter: now.Sub(time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC))}
+	report, err := repo.Purge(ctx, policy, now, false)
+	require.NoError(t, err)
+	assert.Contains(t, report.Anonymized, order.OrderUID)
+
+	asOf, err := repo.OrderAsOf(ctx, order.OrderUID, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, order.TrackNumber, asOf.TrackNumber)
+	assert.Empty(t, asOf.Delivery.Email)
+	assert.Empty(t, asOf.Delivery.Phone)
+	assert.Equal(t, order.Delivery.City, asOf.Delivery.City)
+}
+
+func TestOrderRepository_Import(t *testing.T) {
+	repo := NewOrderRepository(testDB)
+	ctx := context.Background()
+
+	existing := createTestOrder()
+	require.NoError(t, repo.Save(ctx, existing))
+
+	updated := createTestOrder()
+	updated.TrackNumber = "imported-track"
+	updated.Items[0].Price = 777
+
+	fresh := createTestOrder()
+	fresh.OrderUID = "imported-order"
+
+	require.NoError(t, repo.Import(ctx, []*model.Order{updated, fresh}))
+
+	found, err := repo.FindByID(ctx, updated.OrderUID)
+	require.NoError(t, err)
+	assert.Equal(t, existing.Version+1, found.Version)
+	assert.Equal(t, "imported-track", found.TrackNumber)
+	require.Len(t, found.Items, 1)
+	assert.Equal(t, 777, found.Items[0].Price)
+
+	found, err = repo.FindByID(ctx, fresh.OrderUID)
+	require.NoError(t, err)
+	assert.Equal(t, model.OrderStatusCreated, found.Status)
+	assert.Equal(t, fresh.Payment.Transaction, found.Payment.Transaction)
+}
+
+func TestOrderRepository_Restore(t *testing.T) {
+	repo := NewOrderRepository(testDB)
+	ctx := context.Background()
+
+	backup := createTestOrder()
+	backup.OrderUID = "restored-order"
+	backup.Status = model.OrderStatusShipped
+	backup.Version = 12
+	backup.UpdatedAt = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	restored, err := repo.Restore(ctx, []*model.Order{backup}, repositories.RestoreFail)
+	require.NoError(t, err)
+	assert.Equal(t, 1, restored)
+
+	found, err := repo.FindByID(ctx, backup.OrderUID)
+	require.NoError(t, err)
+	assert.Equal(t, model.OrderStatusShipped, found.Status)
+	assert.Equal(t, int64(12), found.Version)
+	assert.True(t, backup.UpdatedAt.Equal(found.UpdatedAt))
+
+	_, err = repo.Restore(ctx, []*model.Order{backup}, repositories.RestoreFail)
+	require.ErrorIs(t, err, repositories.ErrOrderExists)
+
+	restored, err = repo.Restore(ctx, []*model.Order{backup}, repositories.RestoreSkip)
+	require.NoError(t, err)
+	assert.Equal(t, 0, restored)
+
+	backup.Payment = nil
+	restored, err = repo.Restore(ctx, []*model.Order{backup}, repositories.RestoreOverwrite)
+	require.NoError(t, err)
+	assert.Equal(t, 1, restored)
+
+	// Перезапись не откатывает версию назад, даже если в копии она старее
+	found, err = repo.FindByID(ctx, backup.OrderUID)
+	require.NoError(t, err)
+	assert.Nil(t, found.Payment)
+	require.Len(t, found.Items, 1)
+	assert.Equal(t, int64(13), found.Version)
+
+	backup.Version = 1
+	_, err = repo.Restore(ctx, []*model.Order{backup}, repositories.RestoreOverwrite)
+	require.NoError(t, err)
+	found, err = repo.FindByID(ctx, backup.OrderUID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(14), found.Version)
+
+	history, err := repo.AuditHistory(ctx, backup.OrderUID)
+	require.NoError(t, err)
+	last := history[len(history)-1]
+	assert.Equal(t, model.AuditRestore, last.Action)
+	assert.Equal(t, int64(14), last.Version)
+}
+
+func TestOrderRepository_SoftDeleteAndArchive(t *testing.T) {
+	repo := NewOrderRepository(testDB)
+	ctx := context.Background()
+
+	old := createTestOrder()
+	old.OrderUID = "archived-order"
+	old.DateCreated = time.Date(2020, 3, 15, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, repo.Save(ctx, old))
+	_, _, err := repo.ChangeStatus(ctx, old.OrderUID, repositories.StatusTransition{To: model.OrderStatusPaid})
+	require.NoError(t, err)
+
+	deleted := createTestOrder()
+	deleted.OrderUID = "soft-deleted-order"
+	require.NoError(t, repo.Save(ctx, deleted))
+	require.NoError(t, repo.Delete(ctx, deleted.OrderUID, 0))
+
+	_, err = repo.FindByID(ctx, deleted.OrderUID)
+	require.ErrorIs(t, err, repositories.ErrOrderNotFound)
+
+	page, err := repo.List(ctx, repositories.ListOptions{
+		Filter: repositories.OrderFilter{OrderUIDs: []string{deleted.OrderUID}, IncludeDeleted: true},
+	})
+	require.NoError(t, err)
+	require.Len(t, page.Orders, 1)
+	assert.NotNil(t, page.Orders[0].DeletedAt)
+
+	archived, err := repo.Archive(ctx, repositories.ArchiveOptions{Before: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)})
+	require.NoError(t, err)
+	assert.Equal(t, 1, archived)
+
+	_, err = repo.FindByID(ctx, old.OrderUID)
+	require.ErrorIs(t, err, repositories.ErrOrderNotFound)
+
+	page, err = repo.List(ctx, repositories.ListOptions{
+		Filter: repositories.OrderFilter{OrderUIDs: []string{old.OrderUID}, IncludeArchived: true},
+	})
+	require.NoError(t, err)
+	require.Len(t, page.Orders, 1)
+	assert.Equal(t, old.TrackNumber, page.Orders[0].TrackNumber)
+	require.Len(t, page.Orders[0].Items, 1)
+
+	// История статусов уходит в архив вместе с заказом
+	statuses, err := repo.StatusHistory(ctx, old.OrderUID)
+	require.NoError(t, err)
+	require.Len(t, statuses, 1)
+	assert.Equal(t, model.OrderStatusPaid, statuses[0].To)
+
+	// Повторное создание удаленного заказа возвращает его
+	require.NoError(t, repo.Create(ctx, deleted))
+	found, err := repo.FindByID(ctx, deleted.OrderUID)
+	require.NoError(t, err)
+	assert.Nil(t, found.DeletedAt)
+}
+
+func TestOrderRepository_ArchiveReplacesPreviousCopy(t *testing.T) {
+	repo := NewOrderRepository(testDB)
+	ctx := context.Background()
+	opts := repositories.ArchiveOptions{Before: time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	order := createTestOrder()
+	order.OrderUID = "rearchived-order"
+	order.DateCreated = time.Date(2017, 3, 10, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, repo.Save(ctx, order))
+	archived, err := repo.Archive(ctx, opts)
+	require.NoError(t, err)
+	require.Equal(t, 1, archived)
+
+	// Заказ создан заново с другой датой и снова уходит в архив
+	order.DateCreated = time.Date(2017, 5, 20, 0, 0, 0, 0, time.UTC)
+	order.TrackNumber = "re-created"
+	order.Version = 0
+	require.NoError(t, repo.Save(ctx, order))
+	archived, err = repo.Archive(ctx, opts)
+	require.NoError(t, err)
+	require.Equal(t, 1, archived)
+
+	var copies int
+	require.NoError(t, testDB.QueryRow("SELECT count(*) FROM orders_archive WHERE order_uid = $1", order.OrderUID).Scan(&copies))
+	assert.Equal(t, 1, copies)
+
+	page, err := repo.List(ctx, repositories.ListOptions{
+		Filter: repositories.OrderFilter{OrderUIDs: []string{order.OrderUID}, IncludeArchived: true},
+	})
+	require.NoError(t, err)
+	require.Len(t, page.Orders, 1)
+	assert.Equal(t, "re-created", page.Orders[0].TrackNumber)
+}
+
+func TestOrderRepository_SaveMovesOrderToNewMonth(t *testing.T) {
+	repo := NewOrderRepository(testDB)
+	ctx := context.Background()
+
+	order := createTestOrder()
+	order.OrderUID = "moved-order"
+	order.DateCreated = time.Date(2023, 2, 14, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, repo.Save(ctx, order))
+
+	// Новая date_created переносит заказ с доставкой, оплатой и товарами в секцию другого месяца
+	order.DateCreated = time.Date(2023, 4, 2, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, repo.Save(ctx, order))
+
+	var orders, items int
+	require.NoError(t, testDB.QueryRow("SELECT count(*) FROM orders WHERE order_uid = $1", order.OrderUID).Scan(&orders))
+	require.NoError(t, testDB.QueryRow("SELECT count(*) FROM items_2023_04 WHERE order_uid = $1", order.OrderUID).Scan(&items))
+	assert.Equal(t, 1, orders)
+	assert.Equal(t, len(order.Items), items)
+
+	found, err := repo.FindByID(ctx, order.OrderUID)
+	require.NoError(t, err)
+	assert.True(t, order.DateCreated.Equal(found.DateCreated))
+	require.NotNil(t, found.Delivery)
+	require.NotNil(t, found.Payment)
+	assert.Equal(t, int64(2), found.Version)
+}
+
+func TestOrderRepository_SaveRevivesDeletedOrder(t *testing.T) {
+	repo := NewOrderRepository(testDB)
+	ctx := context.Background()
+
+	order := createTestOrder()
+	order.OrderUID = "saved-after-delete"
+	require.NoError(t, repo.Save(ctx, order))
+	_, _, err := repo.ChangeStatus(ctx, order.OrderUID, repositories.StatusTransition{To: model.OrderStatusPaid})
+	require.NoError(t, err)
+	require.NoError(t, repo.Delete(ctx, order.OrderUID, 0))
+
+	// Save заменяет удаленный заказ так же, как Create: статус начинается заново
+	order.Version = 0
+	require.NoError(t, repo.Save(ctx, order))
+	found, err := repo.FindByID(ctx, order.OrderUID)
+	require.NoError(t, err)
+	assert.Equal(t, model.OrderStatusCreated, found.Status)
+	assert.Nil(t, found.DeletedAt)
+
+	history, err := repo.AuditHistory(ctx, order.OrderUID)
+	require.NoError(t, err)
+	assert.Equal(t, model.AuditCreate, history[len(history)-1].Action)
+}
+
+func TestOrderRepository_EncryptedDeliveries(t *testing.T) {
+	ctx := context.Background()
+	plain := createTestOrder()
+	plain.OrderUID = "plaintext-delivery"
+	require.NoError(t, NewOrderRepository(testDB).Save(ctx, plain))
+
+	repo := NewOrderRepository(testDB, WithDeliveryCipher(testCipher(t, "k1")))
+	order := createTestOrder()
+	order.OrderUID = "encrypted-delivery"
+	order.Delivery.Email = "Secret@Example.com"
+	require.NoError(t, repo.Save(ctx, order))
+
+	var storedEmail, keyID string
+	err := testDB.QueryRow("SELECT email, key_id FROM deliveries WHERE order_uid = $1", order.OrderUID).
+		Scan(&storedEmail, &keyID)
+	require.NoError(t, err)
+	assert.NotContains(t, storedEmail, "Secret")
+	assert.Equal(t, "k1", keyID)
+
+	found, err := repo.FindByID(ctx, order.OrderUID)
+	require.NoError(t, err)
+	assert.Equal(t, order.Delivery, found.Delivery)
+
+	uids := []string{plain.OrderUID, order.OrderUID}
+	page, err := repo.List(ctx, repositories.ListOptions{
+		Filter: repositories.OrderFilter{OrderUIDs: uids, Email: "secret@example.com"},
+	})
+	require.NoError(t, err)
+	require.Len(t, page.Orders, 1)
+	assert.Equal(t, order.OrderUID, page.Orders[0].OrderUID)
+
+	// Ротация: открытая запись шифруется, ключ данных зашифрованной переоборачивается
+	rotated := NewOrderRepository(testDB, WithDeliveryCipher(testCipher(t, "k1", "k2")))
+	n, err := rotated.Reencrypt(ctx, repositories.ReencryptOptions{})
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, n, 2)
+
+	page, err = rotated.List(ctx, repositories.ListOptions{
+		Filter: repositories.OrderFilter{OrderUIDs: uids, Phone: plain.Delivery.Phone},
+	})
+	require.NoError(t, err)
+	require.Len(t, page.Orders, 2)
+	for _, found := range page.Orders {
+		require.NotNil(t, found.Delivery)
+		assert.Equal(t, plain.Delivery.Name, found.Delivery.Name)
+	}
+
+	n, err = rotated.Reencrypt(ctx, repositories.ReencryptOptions{Decrypt: true})
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, n, 2)
+	found, err = NewOrderRepository(testDB).FindByID(ctx, order.OrderUID)
+	require.NoError(t, err)
+	assert.Equal(t, order.Delivery, found.Delivery)
+}
+
+func TestOrderRepository_EncryptedDocuments(t *testing.T) {
+	ctx := context.Background()
+	repo := NewOrderRepository(testDB, WithDeliveryCipher(testCipher(t, "k1")))
+
+	order := createTestOrder()
+	order.OrderUID = "encrypted-documents"
+	order.DateCreated = time.Date(2018, 1, 15, 0, 0, 0, 0, time.UTC)
+	order.Delivery.Email = "first-secret@example.com"
+	require.NoError(t, repo.Save(ctx, order))
+	order.Delivery.Email = "second-secret@example.com"
+	require.NoError(t, repo.Save(ctx, order))
+
+	// containsSecret - есть ли адрес в открытом виде в строках журнала или архива
+	containsSecret := func(query string) bool {
+		var found bool
+		require.NoError(t, testDB.QueryRow(query, order.OrderUID, "%secret@example.com%").Scan(&found))
+		return found
+	}
+	assert.False(t, containsSecret(`
+		SELECT EXISTS (SELECT 1 FROM order_audit WHERE order_uid = $1
+			AND (snapshot::text ILIKE $2 OR changes::text ILIKE $2))`))
+
+	history, err := repo.AuditHistory(ctx, order.OrderUID)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	require.NotNil(t, history[1].Changes)
+	assert.Contains(t, history[1].Changes.Fields, model.FieldChange{
+		Field: "delivery.email", From: "first-secret@example.com", To: "second-secret@example.com",
+	})
+
+	archived, err := repo.Archive(ctx, repositories.ArchiveOptions{Before: time.Date(2018, 2, 1, 0, 0, 0, 0, time.UTC)})
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, archived, 1)
+	assert.False(t, containsSecret(`
+		SELECT EXISTS (SELECT 1 FROM orders_archive WHERE order_uid = $1 AND document::text ILIKE $2)`))
+
+	page, err := repo.List(ctx, repositories.ListOptions{Filter: repositories.OrderFilter{
+		OrderUIDs: []string{order.OrderUID}, Email: "second-secret@example.com", IncludeArchived: true,
+	}})
+	require.NoError(t, err)
+	require.Len(t, page.Orders, 1)
+	assert.Equal(t, order.Delivery, page.Orders[0].Delivery)
+
+	// Без расшифровки документы не читаются, после reencrypt -decrypt они открыты
+	n, err := repo.Reencrypt(ctx, repositories.ReencryptOptions{Decrypt: true})
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, n, 3)
+	assert.True(t, containsSecret(`
+		SELECT EXISTS (SELECT 1 FROM orders_archive WHERE order_uid = $1 AND document::text ILIKE $2)`))
+}
+
+func TestOrderRepository_CustomerErasure(t *testing.T) {
+	repo := NewOrderRepository(testDB)
+	ctx := repositories.WithActor(context.Background(), "dpo")
+
+	order := createTestOrder()
+	order.OrderUID = "erasure-order"
+	order.CustomerID = "erasure-customer"
+	require.NoError(t, repo.Save(ctx, order))
+
+	job, err := repo.RequestErasure(ctx, order.CustomerID)
+	require.NoError(t, err)
+	assert.Equal(t, repositories.ErasurePending, job.Status)
+
+	again, err := repo.RequestErasure(ctx, order.CustomerID)
+	require.NoError(t, err)
+	assert.Equal(t, job.ID, again.ID)
+
+	processed, uids, err := repo.ProcessErasure(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, processed)
+	assert.Equal(t, job.ID, processed.ID)
+	assert.Equal(t, []string{order.OrderUID}, uids)
+
+	found, err := repo.FindByID(ctx, order.OrderUID)
+	require.NoError(t, err)
+	assert.Empty(t, found.Delivery.Name)
+	assert.Empty(t, found.Delivery.Email)
+	assert.Equal(t, order.Payment.Amount, found.Payment.Amount)
+	assert.Len(t, found.Items, len(order.Items))
+
+	stored, err := repo.ErasureJob(ctx, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, repositories.ErasureDone, stored.Status)
+	assert.Equal(t, 1, stored.Orders)
+	assert.Equal(t, "dpo", stored.RequestedBy)
+	assert.NotNil(t, stored.FinishedAt)
 }
 
 func TestOrderRepository_WithExampleJSON(t *testing.T) {
@@ -359,7 +841,7 @@ func TestOrderRepository_WithExampleJSON(t *testing.T) {
 		SmID:              99,
 		DateCreated:       time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC),
 		OofShard:          "1",
-		Delivery: model.Delivery{
+		Delivery: &model.Delivery{
 			Name:    "Test Testov",
 			Phone:   "+9720000000",
 			Zip:     "2639809",
@@ -368,7 +850,7 @@ func TestOrderRepository_WithExampleJSON(t *testing.T) {
 			Region:  "Kraiot",
 			Email:   "test@gmail.com",
 		},
-		Payment: model.Payment{
+		Payment: &model.Payment{
 			Transaction:  "b563feb7b2b84b6test",
 			RequestID:    "",
 			Currency:     "USD",
@@ -420,3 +902,31 @@ func TestOrderRepository_WithExampleJSON(t *testing.T) {
 	assert.Equal(t, 453, found.Items[0].Price)
 	assert.Equal(t, "Vivienne Sabo", found.Items[0].Brand)
 }
+
+func TestOrderRepository_PurgeCountsFromCancellation(t *testing.T) {
+	repo := NewOrderRepository(testDB)
+	ctx := context.Background()
+	now := time.Now()
+
+	order := createTestOrder()
+	order.OrderUID = "cancelled-then-anonymized"
+	order.DateCreated = time.Date(2016, 1, 10, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, repo.Save(ctx, order))
+	_, _, err := repo.ChangeStatus(ctx, order.OrderUID, repositories.StatusTransition{To: model.OrderStatusCancelled})
+	require.NoError(t, err)
+	_, err = testDB.Exec("UPDATE orders SET status_changed_at = $2 WHERE order_uid = $1",
+		order.OrderUID, now.Add(-10*24*time.Hour))
+	require.NoError(t, err)
+
+	// Обезличивание сдвигает updated_at, но срок хранения считается от отмены
+	report, err := repo.Purge(ctx, repositories.RetentionPolicy{
+		AnonymizeDeliveryAfter: now.Sub(time.Date(2016, 6, 1, 0, 0, 0, 0, time.UTC)),
+		DeleteCancelledAfter:   7 * 24 * time.Hour,
+	}, now, false)
+	require.NoError(t, err)
+	assert.Contains(t, report.Anonymized, order.OrderUID)
+	assert.Contains(t, report.Deleted, order.OrderUID)
+
+	_, err = repo.FindByID(ctx, order.OrderUID)
+	assert.ErrorIs(t, err, repositories.ErrOrderNotFound)
+}
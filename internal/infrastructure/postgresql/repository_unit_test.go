@@ -3,12 +3,16 @@ package postgresql
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"errors"
+	"regexp"
 	"shop-microservice/internal/domain/model"
+	"shop-microservice/internal/domain/repositories"
 	"testing"
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -23,26 +27,31 @@ func TestOrderRepository_Save_Unit(t *testing.T) {
 	order := createTestOrder()
 	ctx := context.Background()
 
+	expectPartitions(mock, order.DateCreated)
 	mock.ExpectBegin()
+	expectUIDLock(mock, order.OrderUID)
 
-	mock.ExpectExec("INSERT INTO orders").
+	expectLockMissing(mock, order.OrderUID)
+	expectMove(mock, order)
+	mock.ExpectQuery("INSERT INTO orders").
 		WithArgs(
 			order.OrderUID, order.TrackNumber, order.Entry, order.Locale, order.InternalSignature,
 			order.CustomerID, order.DeliveryService, order.Shardkey, order.SmID, order.DateCreated, order.OofShard,
 		).
-		WillReturnResult(sqlmock.NewResult(1, 1))
+		WillReturnRows(sqlmock.NewRows([]string{"status", "version", "updated_at"}).AddRow("created", 1, time.Now()))
 
 	mock.ExpectExec("INSERT INTO deliveries").
 		WithArgs(
-			order.OrderUID,
+			order.OrderUID, order.DateCreated,
 			order.Delivery.Name, order.Delivery.Phone, order.Delivery.Zip, order.Delivery.City,
 			order.Delivery.Address, order.Delivery.Region, order.Delivery.Email,
+			nil, nil, nil, nil,
 		).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	mock.ExpectExec("INSERT INTO payments").
 		WithArgs(
-			order.OrderUID,
+			order.OrderUID, order.DateCreated,
 			order.Payment.Transaction, order.Payment.RequestID, order.Payment.Currency, order.Payment.Provider,
 			order.Payment.Amount, order.Payment.PaymentDt, order.Payment.Bank, order.Payment.DeliveryCost,
 			order.Payment.GoodsTotal, order.Payment.CustomFee,
@@ -54,17 +63,19 @@ func TestOrderRepository_Save_Unit(t *testing.T) {
 	mock.ExpectPrepare("INSERT INTO items")
 	mock.ExpectExec("INSERT INTO items").
 		WithArgs(
-			order.OrderUID,
+			order.OrderUID, order.DateCreated,
 			order.Items[0].ChrtID, order.Items[0].TrackNumber, order.Items[0].Price, order.Items[0].Rid,
 			order.Items[0].Name, order.Items[0].Sale, order.Items[0].Size, order.Items[0].TotalPrice,
 			order.Items[0].NmID, order.Items[0].Brand, order.Items[0].Status,
 		).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
+	expectAudit(mock, order.OrderUID, model.AuditCreate)
 	mock.ExpectCommit()
 
 	err = repo.Save(ctx, order)
 	require.NoError(t, err)
+	assert.Equal(t, int64(1), order.Version)
 
 	require.NoError(t, mock.ExpectationsWereMet())
 }
@@ -79,8 +90,12 @@ func TestOrderRepository_Save_TransactionRollbackOnError(t *testing.T) {
 	order := createTestOrder()
 	ctx := context.Background()
 
+	expectPartitions(mock, order.DateCreated)
 	mock.ExpectBegin()
-	mock.ExpectExec("INSERT INTO orders").
+	expectUIDLock(mock, order.OrderUID)
+	expectLockMissing(mock, order.OrderUID)
+	expectMove(mock, order)
+	mock.ExpectQuery("INSERT INTO orders").
 		WithArgs(
 			order.OrderUID, order.TrackNumber, order.Entry, order.Locale, order.InternalSignature,
 			order.CustomerID, order.DeliveryService, order.Shardkey, order.SmID, order.DateCreated, order.OofShard,
@@ -109,14 +124,16 @@ func TestOrderRepository_FindByID_Unit(t *testing.T) {
 	rows := sqlmock.NewRows([]string{
 		"order_uid", "track_number", "entry", "locale", "internal_signature",
 		"customer_id", "delivery_service", "shardkey", "sm_id", "date_created", "oof_shard",
-		"name", "phone", "zip", "city", "address", "region", "email",
-		"transaction", "request_id", "currency", "provider", "amount", "payment_dt",
+		"status", "version", "updated_at", "deleted_at",
+		"has_delivery", "name", "phone", "zip", "city", "address", "region", "email", "key_id", "dek",
+		"has_payment", "transaction", "request_id", "currency", "provider", "amount", "payment_dt",
 		"bank", "delivery_cost", "goods_total", "custom_fee",
 	}).AddRow(
 		expectedOrder.OrderUID, expectedOrder.TrackNumber, expectedOrder.Entry, expectedOrder.Locale, expectedOrder.InternalSignature,
 		expectedOrder.CustomerID, expectedOrder.DeliveryService, expectedOrder.Shardkey, expectedOrder.SmID, expectedOrder.DateCreated, expectedOrder.OofShard,
-		expectedOrder.Delivery.Name, expectedOrder.Delivery.Phone, expectedOrder.Delivery.Zip, expectedOrder.Delivery.City, expectedOrder.Delivery.Address, expectedOrder.Delivery.Region, expectedOrder.Delivery.Email,
-		expectedOrder.Payment.Transaction, expectedOrder.Payment.RequestID, expectedOrder.Payment.Currency, expectedOrder.Payment.Provider, expectedOrder.Payment.Amount, expectedOrder.Payment.PaymentDt,
+		expectedOrder.Status, expectedOrder.Version, expectedOrder.UpdatedAt, nil,
+		true, expectedOrder.Delivery.Name, expectedOrder.Delivery.Phone, expectedOrder.Delivery.Zip, expectedOrder.Delivery.City, expectedOrder.Delivery.Address, expectedOrder.Delivery.Region, expectedOrder.Delivery.Email, nil, nil,
+		true, expectedOrder.Payment.Transaction, expectedOrder.Payment.RequestID, expectedOrder.Payment.Currency, expectedOrder.Payment.Provider, expectedOrder.Payment.Amount, expectedOrder.Payment.PaymentDt,
 		expectedOrder.Payment.Bank, expectedOrder.Payment.DeliveryCost, expectedOrder.Payment.GoodsTotal, expectedOrder.Payment.CustomFee,
 	)
 
@@ -183,14 +200,16 @@ func TestOrderRepository_FindAll_Unit(t *testing.T) {
 	orderRows := sqlmock.NewRows([]string{
 		"order_uid", "track_number", "entry", "locale", "internal_signature",
 		"customer_id", "delivery_service", "shardkey", "sm_id", "date_created", "oof_shard",
-		"name", "phone", "zip", "city", "address", "region", "email",
-		"transaction", "request_id", "currency", "provider", "amount", "payment_dt",
+		"status", "version", "updated_at", "deleted_at",
+		"has_delivery", "name", "phone", "zip", "city", "address", "region", "email", "key_id", "dek",
+		"has_payment", "transaction", "request_id", "currency", "provider", "amount", "payment_dt",
 		"bank", "delivery_cost", "goods_total", "custom_fee",
 	}).AddRow(
 		expectedOrder.OrderUID, expectedOrder.TrackNumber, expectedOrder.Entry, expectedOrder.Locale, expectedOrder.InternalSignature,
 		expectedOrder.CustomerID, expectedOrder.DeliveryService, expectedOrder.Shardkey, expectedOrder.SmID, expectedOrder.DateCreated, expectedOrder.OofShard,
-		expectedOrder.Delivery.Name, expectedOrder.Delivery.Phone, expectedOrder.Delivery.Zip, expectedOrder.Delivery.City, expectedOrder.Delivery.Address, expectedOrder.Delivery.Region, expectedOrder.Delivery.Email,
-		expectedOrder.Payment.Transaction, expectedOrder.Payment.RequestID, expectedOrder.Payment.Currency, expectedOrder.Payment.Provider, expectedOrder.Payment.Amount, expectedOrder.Payment.PaymentDt,
+		expectedOrder.Status, expectedOrder.Version, expectedOrder.UpdatedAt, nil,
+		true, expectedOrder.Delivery.Name, expectedOrder.Delivery.Phone, expectedOrder.Delivery.Zip, expectedOrder.Delivery.City, expectedOrder.Delivery.Address, expectedOrder.Delivery.Region, expectedOrder.Delivery.Email, nil, nil,
+		true, expectedOrder.Payment.Transaction, expectedOrder.Payment.RequestID, expectedOrder.Payment.Currency, expectedOrder.Payment.Provider, expectedOrder.Payment.Amount, expectedOrder.Payment.PaymentDt,
 		expectedOrder.Payment.Bank, expectedOrder.Payment.DeliveryCost, expectedOrder.Payment.GoodsTotal, expectedOrder.Payment.CustomFee,
 	)
 
@@ -205,8 +224,8 @@ func TestOrderRepository_FindAll_Unit(t *testing.T) {
 		expectedOrder.Items[0].Sale, expectedOrder.Items[0].Size, expectedOrder.Items[0].TotalPrice, expectedOrder.Items[0].NmID, expectedOrder.Items[0].Brand, expectedOrder.Items[0].Status,
 	)
 
-	mock.ExpectQuery("SELECT order_uid, chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status FROM items WHERE order_uid IN").
-		WithArgs(expectedOrder.OrderUID).
+	mock.ExpectQuery(`SELECT order_uid, chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status FROM items WHERE order_uid = ANY\(\$1\)`).
+		WithArgs(pq.Array([]string{expectedOrder.OrderUID})).
 		WillReturnRows(itemRows)
 
 	result, err := repo.FindAll(ctx)
@@ -232,8 +251,9 @@ func TestOrderRepository_FindAll_NoOrders(t *testing.T) {
 	orderRows := sqlmock.NewRows([]string{
 		"order_uid", "track_number", "entry", "locale", "internal_signature",
 		"customer_id", "delivery_service", "shardkey", "sm_id", "date_created", "oof_shard",
-		"name", "phone", "zip", "city", "address", "region", "email",
-		"transaction", "request_id", "currency", "provider", "amount", "payment_dt",
+		"status", "version", "updated_at", "deleted_at",
+		"has_delivery", "name", "phone", "zip", "city", "address", "region", "email", "key_id", "dek",
+		"has_payment", "transaction", "request_id", "currency", "provider", "amount", "payment_dt",
 		"bank", "delivery_cost", "goods_total", "custom_fee",
 	})
 
@@ -282,3 +302,544 @@ func TestExtractOrderUIDs_Empty(t *testing.T) {
 	result := extractOrderUIDs(orders)
 	assert.Empty(t, result)
 }
+
+func TestOrderRepository_Fingerprints_Unit(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewOrderRepository(db)
+
+	rows := sqlmock.NewRows([]string{"order_uid", "concat"}).
+		AddRow("order1", "3@1700000000").
+		AddRow("order2", "1@1700000100")
+
+	// Дешевая сверка читает только orders, без доставки, оплаты и товаров
+	mock.ExpectQuery("SELECT order_uid, concat\\(version, '@', extract\\(epoch FROM updated_at\\)\\) FROM orders WHERE deleted_at IS NULL$").
+		WillReturnRows(rows)
+
+	result, err := repo.Fingerprints(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"order1": "3@1700000000", "order2": "1@1700000100"}, result)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_ContentFingerprints_Unit(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewOrderRepository(db)
+
+	rows := sqlmock.NewRows([]string{"order_uid", "md5"}).
+		AddRow("order1", "hash1").
+		AddRow("order2", "hash2")
+
+	mock.ExpectQuery("SELECT o.order_uid, md5").WillReturnRows(rows)
+
+	result, err := repo.ContentFingerprints(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"order1": "hash1", "order2": "hash2"}, result)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func newOrderRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{
+		"order_uid", "track_number", "entry", "locale", "internal_signature",
+		"customer_id", "delivery_service", "shardkey", "sm_id", "date_created", "oof_shard",
+		"status", "version", "updated_at", "deleted_at",
+		"has_delivery", "name", "phone", "zip", "city", "address", "region", "email", "key_id", "dek",
+		"has_payment", "transaction", "request_id", "currency", "provider", "amount", "payment_dt",
+		"bank", "delivery_cost", "goods_total", "custom_fee",
+	})
+}
+
+func addOrderRow(rows *sqlmock.Rows, order *model.Order) *sqlmock.Rows {
+	values := []driver.Value{
+		order.OrderUID, order.TrackNumber, order.Entry, order.Locale, order.InternalSignature,
+		order.CustomerID, order.DeliveryService, order.Shardkey, order.SmID, order.DateCreated, order.OofShard,
+		order.Status, order.Version, order.UpdatedAt, nil,
+	}
+	if order.DeletedAt != nil {
+		values[len(values)-1] = *order.DeletedAt
+	}
+
+	if d := order.Delivery; d != nil {
+		values = append(values, true, d.Name, d.Phone, d.Zip, d.City, d.Address, d.Region, d.Email, nil, nil)
+	} else {
+		values = append(values, false, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+	}
+
+	if p := order.Payment; p != nil {
+		values = append(values, true, p.Transaction, p.RequestID, p.Currency, p.Provider, p.Amount, p.PaymentDt,
+			p.Bank, p.DeliveryCost, p.GoodsTotal, p.CustomFee)
+	} else {
+		values = append(values, false, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+	}
+
+	return rows.AddRow(values...)
+}
+
+// expectPartitions ожидает создание секций orders и items для месяца date
+func expectPartitions(mock sqlmock.Sqlmock, date time.Time) {
+	month := partitionMonth(date)
+	mock.ExpectExec(regexp.QuoteMeta(createPartition("orders", month) + "; " + createPartition("items", month))).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+// expectUIDLock ожидает рекомендательные блокировки uid в порядке сортировки
+func expectUIDLock(mock sqlmock.Sqlmock, uids ...string) {
+	mock.ExpectExec("SELECT pg_advisory_xact_lock").
+		WithArgs(pq.Array(uids)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+// expectMove ожидает перенос заказа в секцию его date_created
+func expectMove(mock sqlmock.Sqlmock, order *model.Order) {
+	mock.ExpectExec("WITH target AS .* INSERT INTO orders .* DELETE FROM orders o USING target").
+		WithArgs(order.OrderUID, order.DateCreated).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+// expectLockMissing ожидает блокировку заказа, которого нет в базе
+func expectLockMissing(mock sqlmock.Sqlmock, uid string) {
+	mock.ExpectQuery("SELECT version FROM orders WHERE order_uid = \\$1 AND deleted_at IS NULL FOR UPDATE").
+		WithArgs(uid).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}))
+}
+
+// expectLoadOrder ожидает блокировку и чтение заказа без товаров
+func expectLoadOrder(mock sqlmock.Sqlmock, order *model.Order) {
+	mock.ExpectQuery("SELECT version FROM orders WHERE order_uid = \\$1 AND deleted_at IS NULL FOR UPDATE").
+		WithArgs(order.OrderUID).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(order.Version))
+	mock.ExpectQuery("SELECT o.order_uid").
+		WithArgs(order.OrderUID).
+		WillReturnRows(addOrderRow(newOrderRows(), order))
+	mock.ExpectQuery("SELECT chrt_id").
+		WithArgs(order.OrderUID).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"chrt_id", "track_number", "price", "rid", "name", "sale", "size", "total_price", "nm_id", "brand", "status",
+		}))
+}
+
+// expectAudit ожидает запись журнала аудита
+func expectAudit(mock sqlmock.Sqlmock, uid string, action model.AuditAction) {
+	mock.ExpectExec("INSERT INTO order_audit").
+		WithArgs(uid, sqlmock.AnyArg(), string(action), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), nil, nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+}
+
+func TestOrderRepository_List_Unit(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewOrderRepository(db)
+	ctx := context.Background()
+
+	order1 := createTestOrder()
+	order1.OrderUID = "order-2"
+	order2 := createTestOrder()
+	order2.OrderUID = "order-1"
+
+	mock.ExpectQuery(`WHERE o.deleted_at IS NULL AND o.customer_id = \$1 ORDER BY o.date_created DESC, o.order_uid DESC LIMIT 2`).
+		WithArgs("test-customer").
+		WillReturnRows(addOrderRow(addOrderRow(newOrderRows(), order1), order2))
+
+	mock.ExpectQuery("SELECT order_uid, chrt_id").
+		WithArgs(pq.Array([]string{order1.OrderUID})).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"order_uid", "chrt_id", "track_number", "price", "rid", "name", "sale", "size", "total_price", "nm_id", "brand", "status",
+		}))
+
+	page, err := repo.List(ctx, repositories.ListOptions{
+		Filter: repositories.OrderFilter{CustomerID: "test-customer"},
+		Limit:  1,
+	})
+	require.NoError(t, err)
+	require.Len(t, page.Orders, 1)
+	assert.Equal(t, "order-2", page.Orders[0].OrderUID)
+	require.NotEmpty(t, page.NextCursor)
+
+	// Следующая страница продолжается после последнего заказа
+	mock.ExpectQuery(`WHERE o.deleted_at IS NULL AND \(o.date_created, o.order_uid\) < \(\$1, \$2\)`).
+		WithArgs(sqlmock.AnyArg(), "order-2").
+		WillReturnRows(addOrderRow(newOrderRows(), order2))
+
+	mock.ExpectQuery("SELECT order_uid, chrt_id").
+		WithArgs(pq.Array([]string{order2.OrderUID})).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"order_uid", "chrt_id", "track_number", "price", "rid", "name", "sale", "size", "total_price", "nm_id", "brand", "status",
+		}))
+
+	page, err = repo.List(ctx, repositories.ListOptions{Limit: 1, Cursor: page.NextCursor})
+	require.NoError(t, err)
+	require.Len(t, page.Orders, 1)
+	assert.Equal(t, "order-1", page.Orders[0].OrderUID)
+	assert.Empty(t, page.NextCursor)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_List_InvalidCursor(t *testing.T) {
+	db, _, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewOrderRepository(db)
+
+	_, err = repo.List(context.Background(), repositories.ListOptions{Cursor: "not-a-cursor"})
+	require.ErrorIs(t, err, repositories.ErrInvalidCursor)
+
+	cursor := encodeCursor(repositories.SortOrderUIDAsc, createTestOrder())
+	_, err = repo.List(context.Background(), repositories.ListOptions{Cursor: cursor})
+	require.ErrorIs(t, err, repositories.ErrInvalidCursor)
+}
+
+func TestOrderRepository_Stream_Unit(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewOrderRepository(db)
+
+	order1 := createTestOrder()
+	order1.OrderUID = "order-1"
+	order2 := createTestOrder()
+	order2.OrderUID = "order-2"
+
+	itemColumns := []string{
+		"order_uid", "chrt_id", "track_number", "price", "rid", "name", "sale", "size", "total_price", "nm_id", "brand", "status",
+	}
+
+	mock.ExpectQuery(`ORDER BY o.order_uid ASC LIMIT 2`).
+		WillReturnRows(addOrderRow(addOrderRow(newOrderRows(), order1), order2))
+	mock.ExpectQuery("SELECT order_uid, chrt_id").
+		WithArgs(pq.Array([]string{"order-1"})).
+		WillReturnRows(sqlmock.NewRows(itemColumns).AddRow(
+			"order-1", 1, "track", 100, "rid-1", "item", 0, "M", 100, 123, "brand", 202,
+		))
+
+	mock.ExpectQuery(`WHERE o.deleted_at IS NULL AND o.order_uid > \$1 ORDER BY o.order_uid ASC LIMIT 2`).
+		WithArgs("order-1").
+		WillReturnRows(addOrderRow(newOrderRows(), order2))
+	mock.ExpectQuery("SELECT order_uid, chrt_id").
+		WithArgs(pq.Array([]string{"order-2"})).
+		WillReturnRows(sqlmock.NewRows(itemColumns))
+
+	var batches [][]string
+	err = repo.Stream(context.Background(), repositories.OrderFilter{}, 1, func(batch []*model.Order) error {
+		var uids []string
+		for _, order := range batch {
+			uids = append(uids, order.OrderUID)
+		}
+		batches = append(batches, uids)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"order-1"}, {"order-2"}}, batches)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_Update_Unit(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewOrderRepository(db)
+	order := createTestOrder()
+	ctx := context.Background()
+
+	order.Version = 3
+
+	mock.ExpectBegin()
+	expectUIDLock(mock, order.OrderUID)
+	mock.ExpectQuery("SELECT version FROM orders WHERE order_uid = \\$1 AND deleted_at IS NULL FOR UPDATE").
+		WithArgs(order.OrderUID).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(3))
+	mock.ExpectQuery("SELECT o.order_uid").
+		WithArgs(order.OrderUID).
+		WillReturnRows(addOrderRow(newOrderRows(), order))
+	mock.ExpectQuery("SELECT chrt_id").
+		WithArgs(order.OrderUID).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"chrt_id", "track_number", "price", "rid", "name", "sale", "size", "total_price", "nm_id", "brand", "status",
+		}))
+	mock.ExpectQuery("INSERT INTO orders .* version = orders.version \\+ 1").
+		WillReturnRows(sqlmock.NewRows([]string{"status", "version", "updated_at"}).AddRow("created", 4, time.Now()))
+	mock.ExpectExec("INSERT INTO deliveries").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO payments").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("DELETE FROM items").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectAudit(mock, order.OrderUID, model.AuditUpdate)
+	mock.ExpectCommit()
+
+	updated, err := repo.Update(ctx, order.OrderUID, 3, func(order *model.Order) error {
+		order.TrackNumber = "updated-track"
+		order.Items = nil
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "updated-track", updated.TrackNumber)
+	assert.Equal(t, int64(4), updated.Version)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_Update_MovesToNewMonth(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewOrderRepository(db)
+	order := createTestOrder()
+	order.Items = nil
+	order.Version = 3
+	moved := order.Clone()
+	moved.DateCreated = order.DateCreated.AddDate(0, 2, 0)
+
+	mock.ExpectBegin()
+	expectUIDLock(mock, order.OrderUID)
+	expectLoadOrder(mock, order)
+	// Секция нового месяца создается в той же транзакции, заказ переносится до записи
+	expectPartitions(mock, moved.DateCreated)
+	expectMove(mock, moved)
+	mock.ExpectQuery("INSERT INTO orders .* ON CONFLICT \\(order_uid, date_created\\)").
+		WithArgs(
+			moved.OrderUID, moved.TrackNumber, moved.Entry, moved.Locale, moved.InternalSignature,
+			moved.CustomerID, moved.DeliveryService, moved.Shardkey, moved.SmID, moved.DateCreated, moved.OofShard,
+		).
+		WillReturnRows(sqlmock.NewRows([]string{"status", "version", "updated_at"}).AddRow("created", 4, time.Now()))
+	mock.ExpectExec("INSERT INTO deliveries").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO payments").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("DELETE FROM items").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectAudit(mock, order.OrderUID, model.AuditUpdate)
+	mock.ExpectCommit()
+
+	updated, err := repo.Update(context.Background(), order.OrderUID, 3, func(order *model.Order) error {
+		order.DateCreated = moved.DateCreated
+		return nil
+	})
+	require.NoError(t, err)
+	assert.True(t, moved.DateCreated.Equal(updated.DateCreated))
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_Update_NotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewOrderRepository(db)
+
+	mock.ExpectBegin()
+	expectUIDLock(mock, "missing")
+	mock.ExpectQuery("SELECT version FROM orders").
+		WithArgs("missing").
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	_, err = repo.Update(context.Background(), "missing", 0, func(order *model.Order) error { return nil })
+	require.ErrorIs(t, err, repositories.ErrOrderNotFound)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_Update_VersionConflict(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewOrderRepository(db)
+
+	mock.ExpectBegin()
+	expectUIDLock(mock, "test-order-uid")
+	mock.ExpectQuery("SELECT version FROM orders").
+		WithArgs("test-order-uid").
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(5))
+	mock.ExpectRollback()
+
+	_, err = repo.Update(context.Background(), "test-order-uid", 4, func(order *model.Order) error {
+		t.Fatal("mutate must not be called on version conflict")
+		return nil
+	})
+	require.ErrorIs(t, err, repositories.ErrVersionConflict)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_Save_VersionConflict(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewOrderRepository(db)
+	order := createTestOrder()
+	order.Version = 2
+
+	expectPartitions(mock, order.DateCreated)
+	mock.ExpectBegin()
+	expectUIDLock(mock, order.OrderUID)
+	mock.ExpectQuery("SELECT version FROM orders WHERE order_uid = \\$1 AND deleted_at IS NULL FOR UPDATE").
+		WithArgs(order.OrderUID).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(3))
+	mock.ExpectRollback()
+
+	err = repo.Save(context.Background(), order)
+	require.ErrorIs(t, err, repositories.ErrVersionConflict)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_Delete_Unit(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewOrderRepository(db)
+	order := createTestOrder()
+	order.Version = 2
+
+	mock.ExpectBegin()
+	expectLoadOrder(mock, order)
+	mock.ExpectExec("UPDATE orders SET deleted_at = now\\(\\) WHERE order_uid = \\$1").
+		WithArgs(order.OrderUID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectAudit(mock, order.OrderUID, model.AuditDelete)
+	mock.ExpectCommit()
+
+	mock.ExpectBegin()
+	expectLockMissing(mock, "missing")
+	mock.ExpectRollback()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT version FROM orders WHERE order_uid = \\$1 AND deleted_at IS NULL FOR UPDATE").
+		WithArgs("stale").
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(3))
+	mock.ExpectRollback()
+
+	require.NoError(t, repo.Delete(context.Background(), order.OrderUID, 2))
+
+	err = repo.Delete(context.Background(), "missing", 0)
+	require.ErrorIs(t, err, repositories.ErrOrderNotFound)
+
+	err = repo.Delete(context.Background(), "stale", 2)
+	require.ErrorIs(t, err, repositories.ErrVersionConflict)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_Create_Unit(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewOrderRepository(db)
+	order := createTestOrder()
+	order.Items = nil
+
+	expectPartitions(mock, order.DateCreated)
+	mock.ExpectBegin()
+	expectUIDLock(mock, order.OrderUID)
+	expectMove(mock, order)
+	mock.ExpectQuery("INSERT INTO orders .* ON CONFLICT \\(order_uid, date_created\\) DO UPDATE .* WHERE orders.deleted_at IS NOT NULL").
+		WillReturnRows(sqlmock.NewRows([]string{"status", "version", "updated_at"}).AddRow("created", 1, time.Now()))
+	mock.ExpectExec("INSERT INTO deliveries").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO payments").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("DELETE FROM items").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectAudit(mock, order.OrderUID, model.AuditCreate)
+	mock.ExpectCommit()
+
+	require.NoError(t, repo.Create(context.Background(), order))
+	assert.Equal(t, int64(1), order.Version)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_Create_Conflict(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewOrderRepository(db)
+	order := createTestOrder()
+
+	expectPartitions(mock, order.DateCreated)
+	mock.ExpectBegin()
+	expectUIDLock(mock, order.OrderUID)
+	expectMove(mock, order)
+	mock.ExpectQuery("INSERT INTO orders").WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery("SELECT version FROM orders WHERE order_uid = \\$1").
+		WithArgs(order.OrderUID).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(7))
+	mock.ExpectRollback()
+
+	err = repo.Create(context.Background(), order)
+
+	var conflict *repositories.ConflictError
+	require.ErrorAs(t, err, &conflict)
+	assert.Equal(t, int64(7), conflict.Version)
+	assert.ErrorIs(t, err, repositories.ErrOrderExists)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_FindByID_Draft(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewOrderRepository(db)
+	draft := createTestOrder()
+	draft.Delivery = nil
+	draft.Payment = nil
+
+	mock.ExpectQuery("SELECT o.order_uid").
+		WithArgs(draft.OrderUID).
+		WillReturnRows(addOrderRow(newOrderRows(), draft))
+	mock.ExpectQuery("SELECT chrt_id").
+		WithArgs(draft.OrderUID).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"chrt_id", "track_number", "price", "rid", "name", "sale", "size", "total_price", "nm_id", "brand", "status",
+		}))
+
+	result, err := repo.FindByID(context.Background(), draft.OrderUID)
+	require.NoError(t, err)
+	assert.Nil(t, result.Delivery)
+	assert.Nil(t, result.Payment)
+	assert.True(t, result.IsDraft())
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_Save_Draft(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewOrderRepository(db)
+	draft := createTestOrder()
+	draft.Payment = nil
+	draft.Items = nil
+
+	expectPartitions(mock, draft.DateCreated)
+	mock.ExpectBegin()
+	expectUIDLock(mock, draft.OrderUID)
+	expectLockMissing(mock, draft.OrderUID)
+	expectMove(mock, draft)
+	mock.ExpectQuery("INSERT INTO orders").
+		WillReturnRows(sqlmock.NewRows([]string{"status", "version", "updated_at"}).AddRow("created", 1, time.Now()))
+	mock.ExpectExec("INSERT INTO deliveries").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("DELETE FROM payments WHERE order_uid = \\$1").
+		WithArgs(draft.OrderUID).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM items").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectAudit(mock, draft.OrderUID, model.AuditCreate)
+	mock.ExpectCommit()
+
+	require.NoError(t, repo.Save(context.Background(), draft))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
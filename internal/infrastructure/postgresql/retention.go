@@ -0,0 +1,212 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"shop-microservice/internal/domain/model"
+	"shop-microservice/internal/domain/repositories"
+
+	"github.com/lib/pq"
+)
+
+var _ repositories.OrderPurger = (*OrderRepository)(nil)
+
+// anonymousDelivery - values of the delivery fields erased by retention, merged into
+// JSON documents; city and region are kept for statistics
+const anonymousDelivery = `{"name": "", "phone": "", "zip": "", "address": "", "email": ""}`
+
+// Purge - applies the retention policy in one transaction: erases delivery PII of old
+// orders, hard deletes expired cancelled and soft-deleted orders, does the same in the
+// archive and scrubs the affected audit entries. Every touched order gets an audit entry.
+// With dryRun the transaction is rolled back, so the report is exactly what would be done.
+// Other service instances learn about the changes through LISTEN/NOTIFY.
+func (r *OrderRepository) Purge(ctx context.Context, policy repositories.RetentionPolicy, now time.Time, dryRun bool) (*repositories.PurgeReport, error) {
+	fail := func(err error) (*repositories.PurgeReport, error) {
+		return nil, fmt.Errorf("Purge: %w", err)
+	}
+
+	tx, err := r.begin(ctx)
+	if err != nil {
+		return fail(err)
+	}
+	defer tx.Rollback()
+
+	// Журнал аудита только дописывается, стирание данных в нем - обслуживание
+	if _, err := tx.ExecContext(ctx, "SET LOCAL order_audit.maintenance = 'on'"); err != nil {
+		return fail(err)
+	}
+
+	report := &repositories.PurgeReport{DryRun: dryRun, Anonymized: []string{}, Deleted: []string{}}
+	actor := repositories.ActorFromContext(ctx)
+	channel := repositories.ChannelFromContext(ctx)
+
+	if policy.AnonymizeDeliveryAfter > 0 {
+		cutoff := now.Add(-policy.AnonymizeDeliveryAfter)
+		uids, err := queryUIDs(ctx, tx, anonymizeDeliveriesWhere("date_created < $1"),
+			cutoff, actor, channel, anonymousDelivery, string(model.AuditAnonymize))
+		if err != nil {
+			return fail(errFail("anonymize: %w", err))
+		}
+		if err := scrubAudit(ctx, tx, uids, false); err != nil {
+			return fail(errFail("anonymize: %w", err))
+		}
+		report.Anonymized = append(report.Anonymized, uids...)
+	}
+
+	cancelledCutoff := retentionCutoff(now, policy.DeleteCancelledAfter)
+	deletedCutoff := retentionCutoff(now, policy.PurgeDeletedAfter)
+	if cancelledCutoff.Valid || deletedCutoff.Valid {
+		uids, err := queryUIDs(ctx, tx, purgeOrders,
+			cancelledCutoff, deletedCutoff, actor, channel, string(model.AuditPurge))
+		if err != nil {
+			return fail(errFail("purge: %w", err))
+		}
+		if err := scrubAudit(ctx, tx, uids, true); err != nil {
+			return fail(errFail("purge: %w", err))
+		}
+		report.Deleted = append(report.Deleted, uids...)
+	}
+
+	if dryRun {
+		return report, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return fail(err)
+	}
+	return report, nil
+}
+
+// retentionCutoff - the moment before which a rule applies; NULL for a disabled rule
+func retentionCutoff(now time.Time, after time.Duration) sql.NullTime {
+	if after <= 0 {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: now.Add(-after), Valid: true}
+}
+
+// anonymizeDeliveriesWhere builds a statement erasing delivery PII of the orders matching
+// condition (a column of both orders and orders_archive compared with $1) in the working
+// tables and the archive. Working orders get a new version, so caches and ETags notice.
+// Already erased deliveries are skipped. Audit entries of archived orders carry the
+// erased document as their snapshot; entries of working orders have none, OrderAsOf
+// falls back to the previous snapshot scrubbed by scrubAudit.
+func anonymizeDeliveriesWhere(condition string) string {
+	return `
+        WITH erased AS (
+            UPDATE deliveries d
+            SET name = '', phone = '', zip = '', address = '', email = '',
+                email_bidx = NULL, phone_bidx = NULL
+            FROM orders o
+            WHERE o.order_uid = d.order_uid AND o.` + condition + `
+              AND (d.name, d.phone, d.zip, d.address, d.email) IS DISTINCT FROM ('', '', '', '', '')
+            RETURNING d.order_uid
+        ), bumped AS (
+            UPDATE orders o SET version = o.version + 1, updated_at = now()
+            FROM erased e WHERE o.order_uid = e.order_uid
+            RETURNING o.order_uid, o.version
+        ), archived AS (
+            UPDATE orders_archive a
+            SET document = jsonb_set(a.document, '{delivery}', (a.document->'delivery') || $4::jsonb),
+                email_bidx = NULL, phone_bidx = NULL
+            WHERE a.` + condition + ` AND jsonb_typeof(a.document->'delivery') = 'object'
+              AND (a.document->'delivery') || $4::jsonb <> a.document->'delivery'
+            RETURNING a.order_uid, (a.document->>'version')::bigint AS version, a.document, a.key_id, a.dek
+        ), touched AS (
+            SELECT order_uid, version, NULL::jsonb AS snapshot, NULL::varchar AS key_id, NULL::bytea AS dek FROM bumped
+            UNION ALL
+            SELECT order_uid, version, document, key_id, dek FROM archived
+        ), audited AS (
+            INSERT INTO order_audit (order_uid, version, action, actor, channel, snapshot, key_id, dek)
+            SELECT order_uid, version, $5, $2, $3, snapshot, key_id, dek FROM touched
+        )
+        SELECT order_uid FROM touched ORDER BY order_uid
+`
+}
+
+// purgeOrders hard deletes orders cancelled before $1 and orders soft-deleted before $2,
+// both in the working tables (parts are deleted by cascade) and the archive, together
+// with their status history. A NULL cutoff disables its rule. The cancellation time is
+// status_changed_at, not updated_at, which anonymization moves forward. Archived
+// documents have no such field, so the last history row into cancelled is used,
+// falling back to the document updated_at for orders restored already cancelled.
+const purgeOrders = `
+        WITH purged AS (
+            DELETE FROM orders
+            WHERE (status = 'cancelled' AND status_changed_at < $1) OR deleted_at < $2
+            RETURNING order_uid, version
+        ), archived AS (
+            DELETE FROM orders_archive a
+            WHERE (a.status = 'cancelled' AND COALESCE(
+                       (SELECT max(h.changed_at) FROM order_status_history h
+                        WHERE h.order_uid = a.order_uid AND h.to_status = 'cancelled'),
+                       (a.document->>'updated_at')::timestamptz
+                   ) < $1)
+               OR a.deleted_at < $2
+            RETURNING a.order_uid, (a.document->>'version')::bigint AS version
+        ), touched AS (
+            SELECT order_uid, version FROM purged
+            UNION ALL
+            SELECT order_uid, version FROM archived
+        ), history AS (
+            DELETE FROM order_status_history WHERE order_uid IN (SELECT order_uid FROM touched)
+        ), audited AS (
+            INSERT INTO order_audit (order_uid, version, action, actor, channel)
+            SELECT order_uid, version, $5, $3, $4 FROM touched
+        )
+        SELECT order_uid FROM touched ORDER BY order_uid
+`
+
+// scrubAuditEntries erases delivery values from audit snapshots and change lists of the
+// orders in $1. With $3 the snapshots are dropped entirely (the order is purged).
+const scrubAuditEntries = `
+        UPDATE order_audit SET
+            snapshot = CASE
+                WHEN $3 THEN NULL
+                WHEN jsonb_typeof(snapshot->'delivery') = 'object'
+                    THEN jsonb_set(snapshot, '{delivery}', (snapshot->'delivery') || $2::jsonb)
+                ELSE snapshot
+            END,
+            changes = CASE
+                WHEN jsonb_typeof(changes->'fields') = 'array' THEN jsonb_set(changes, '{fields}', (
+                    SELECT COALESCE(jsonb_agg(CASE
+                        WHEN f->>'field' = 'delivery' OR f->>'field' LIKE 'delivery.%'
+                            THEN f || '{"from": null, "to": null}'
+                        ELSE f
+                    END), '[]'::jsonb)
+                    FROM jsonb_array_elements(changes->'fields') f
+                ))
+                ELSE changes
+            END
+        WHERE order_uid = ANY($1)
+`
+
+// scrubAudit - erases delivery data of the orders from their audit entries
+func scrubAudit(ctx context.Context, tx *sql.Tx, uids []string, dropSnapshots bool) error {
+	if len(uids) == 0 {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, scrubAuditEntries, pq.Array(uids), anonymousDelivery, dropSnapshots)
+	return err
+}
+
+// queryUIDs - runs a statement returning order uids
+func queryUIDs(ctx context.Context, tx *sql.Tx, query string, args ...any) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	uids := make([]string, 0)
+	for rows.Next() {
+		var uid string
+		if err := rows.Scan(&uid); err != nil {
+			return nil, err
+		}
+		uids = append(uids, uid)
+	}
+	return uids, rows.Err()
+}
@@ -0,0 +1,92 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"shop-microservice/internal/domain/model"
+	"shop-microservice/internal/domain/repositories"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// expectPurge ожидает оба шага правил хранения с чисткой журнала аудита
+func expectPurge(mock sqlmock.Sqlmock, now time.Time, anonymized, deleted []string) {
+	anonymizedRows := sqlmock.NewRows([]string{"order_uid"})
+	for _, uid := range anonymized {
+		anonymizedRows.AddRow(uid)
+	}
+	deletedRows := sqlmock.NewRows([]string{"order_uid"})
+	for _, uid := range deleted {
+		deletedRows.AddRow(uid)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("SET LOCAL order_audit.maintenance = 'on'").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("UPDATE deliveries d SET name = ''").
+		WithArgs(now.Add(-30*24*time.Hour), repositories.DefaultActor, repositories.ChannelSystem,
+			anonymousDelivery, string(model.AuditAnonymize)).
+		WillReturnRows(anonymizedRows)
+	mock.ExpectExec("UPDATE order_audit SET").
+		WithArgs(sqlmock.AnyArg(), anonymousDelivery, false).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectQuery("DELETE FROM orders WHERE \\(status = 'cancelled'").
+		WithArgs(sql.NullTime{Time: now.Add(-7 * 24 * time.Hour), Valid: true}, sql.NullTime{},
+			repositories.DefaultActor, repositories.ChannelSystem, string(model.AuditPurge)).
+		WillReturnRows(deletedRows)
+	mock.ExpectExec("UPDATE order_audit SET").
+		WithArgs(sqlmock.AnyArg(), anonymousDelivery, true).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+}
+
+func TestOrderRepository_Purge(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewOrderRepository(db)
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	policy := repositories.RetentionPolicy{
+		AnonymizeDeliveryAfter: 30 * 24 * time.Hour,
+		DeleteCancelledAfter:   7 * 24 * time.Hour,
+	}
+
+	expectPurge(mock, now, []string{"a", "b"}, []string{"c"})
+	mock.ExpectCommit()
+
+	report, err := repo.Purge(context.Background(), policy, now, false)
+	require.NoError(t, err)
+	assert.False(t, report.DryRun)
+	assert.Equal(t, []string{"a", "b"}, report.Anonymized)
+	assert.Equal(t, []string{"c"}, report.Deleted)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_Purge_DryRun(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewOrderRepository(db)
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	policy := repositories.RetentionPolicy{
+		AnonymizeDeliveryAfter: 30 * 24 * time.Hour,
+		DeleteCancelledAfter:   7 * 24 * time.Hour,
+	}
+
+	expectPurge(mock, now, []string{"a"}, []string{"c"})
+	mock.ExpectRollback()
+
+	report, err := repo.Purge(context.Background(), policy, now, true)
+	require.NoError(t, err)
+	assert.True(t, report.DryRun)
+	assert.Equal(t, []string{"a"}, report.Anonymized)
+	assert.Equal(t, []string{"c"}, report.Deleted)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
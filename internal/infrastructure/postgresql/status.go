@@ -0,0 +1,148 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"shop-microservice/internal/domain/model"
+	"shop-microservice/internal/domain/repositories"
+)
+
+// ChangeStatus - moves the order to a new status if the transition graph allows it,
+// bumps the version and records the change in order_status_history and order_audit
+func (r *OrderRepository) ChangeStatus(ctx context.Context, uid string, transition repositories.StatusTransition) (*model.Order, *model.StatusChange, error) {
+	fail := func(err error) (*model.Order, *model.StatusChange, error) {
+		return nil, nil, fmt.Errorf("Change Order Status: %w", err)
+	}
+
+	if !transition.To.Valid() {
+		return fail(errFail("%w: unknown status %q", repositories.ErrInvalidStatusTransition, transition.To))
+	}
+
+	tx, err := r.begin(ctx)
+	if err != nil {
+		return fail(err)
+	}
+	defer tx.Rollback()
+
+	var version int64
+	var current model.OrderStatus
+	var complete bool
+	err = tx.QueryRowContext(ctx, `
+        SELECT version, status,
+               EXISTS (SELECT 1 FROM deliveries d WHERE d.order_uid = orders.order_uid)
+               AND EXISTS (SELECT 1 FROM payments p WHERE p.order_uid = orders.order_uid)
+        FROM orders WHERE order_uid = $1 AND deleted_at IS NULL FOR UPDATE
+	`, uid).Scan(&version, &current, &complete)
+	if err == sql.ErrNoRows {
+		return fail(errFail("%w: %w", repositories.ErrOrderNotFound, err))
+	}
+	if err != nil {
+		return fail(err)
+	}
+	if transition.ExpectedVersion > 0 && version != transition.ExpectedVersion {
+		return fail(repositories.ErrVersionConflict)
+	}
+	if !current.CanTransitionTo(transition.To) {
+		return fail(errFail("%w: %s -> %s", repositories.ErrInvalidStatusTransition, current, transition.To))
+	}
+	// Черновик можно только отменить, пока к нему не привязаны доставка и оплата
+	if !complete && transition.To != model.OrderStatusCancelled {
+		return fail(errFail("%w: draft order needs delivery and payment", repositories.ErrInvalidStatusTransition))
+	}
+
+	change := &model.StatusChange{
+		OrderUID: uid,
+		From:     current,
+		To:       transition.To,
+		Actor:    repositories.ActorFromContext(ctx),
+		Reason:   transition.Reason,
+	}
+
+	if err := r.applyStatusChange(ctx, tx, change); err != nil {
+		return fail(err)
+	}
+
+	order, err := r.loadOrder(ctx, tx, uid)
+	if err != nil {
+		return fail(err)
+	}
+
+	before := order.Clone()
+	before.Status = change.From
+	if err := r.recordAudit(ctx, tx, model.AuditStatus, before, order); err != nil {
+		return fail(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fail(err)
+	}
+
+	return order, change, nil
+}
+
+// applyStatusChange - sets the new status, bumps the version and writes the history row
+func (r *OrderRepository) applyStatusChange(ctx context.Context, tx *sql.Tx, change *model.StatusChange) error {
+	err := tx.QueryRowContext(ctx, `
+        UPDATE orders SET status = $2, status_changed_at = now(), version = version + 1, updated_at = now()
+        WHERE order_uid = $1
+        RETURNING version, updated_at
+	`, change.OrderUID, change.To).Scan(&change.Version, &change.ChangedAt)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+        INSERT INTO order_status_history (
+            order_uid, from_status, to_status, actor, reason, version, changed_at
+        ) VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, change.OrderUID, change.From, change.To, change.Actor, change.Reason, change.Version, change.ChangedAt)
+	return err
+}
+
+// StatusHistory - returns status changes of the order, oldest first. The history is kept
+// when the order is moved to the archive.
+func (r *OrderRepository) StatusHistory(ctx context.Context, uid string) ([]model.StatusChange, error) {
+	query := `
+        SELECT order_uid, from_status, to_status, actor, reason, version, changed_at
+        FROM order_status_history
+        WHERE order_uid = $1
+        ORDER BY changed_at, id
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, uid)
+	if err != nil {
+		return nil, errFail("Status History: %w", err)
+	}
+	defer rows.Close()
+
+	history := make([]model.StatusChange, 0)
+	for rows.Next() {
+		var change model.StatusChange
+		if err := rows.Scan(
+			&change.OrderUID, &change.From, &change.To, &change.Actor, &change.Reason, &change.Version, &change.ChangedAt,
+		); err != nil {
+			return nil, errFail("Status History: %w", err)
+		}
+		history = append(history, change)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errFail("Status History: %w", err)
+	}
+
+	if len(history) == 0 {
+		var exists bool
+		err := r.db.QueryRowContext(ctx, `
+            SELECT EXISTS (SELECT 1 FROM orders WHERE order_uid = $1)
+                OR EXISTS (SELECT 1 FROM orders_archive WHERE order_uid = $1)
+		`, uid).Scan(&exists)
+		if err != nil {
+			return nil, errFail("Status History: %w", err)
+		}
+		if !exists {
+			return nil, errFail("Status History: %w", repositories.ErrOrderNotFound)
+		}
+	}
+
+	return history, nil
+}
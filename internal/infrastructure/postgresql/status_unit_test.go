@@ -0,0 +1,148 @@
+package postgresql
+
+import (
+	"context"
+	"shop-microservice/internal/domain/model"
+	"shop-microservice/internal/domain/repositories"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrderRepository_ChangeStatus_Unit(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewOrderRepository(db)
+	order := createTestOrder()
+	order.Status = model.OrderStatusPaid
+	order.Version = 3
+	ctx := repositories.WithActor(context.Background(), "warehouse")
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT version, status,.* FROM orders WHERE order_uid = \\$1 AND deleted_at IS NULL FOR UPDATE").
+		WithArgs(order.OrderUID).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "status", "complete"}).AddRow(2, "created", true))
+	mock.ExpectQuery("UPDATE orders SET status = \\$2").
+		WithArgs(order.OrderUID, model.OrderStatusPaid).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "updated_at"}).AddRow(3, time.Now()))
+	mock.ExpectExec("INSERT INTO order_status_history").
+		WithArgs(order.OrderUID, model.OrderStatusCreated, model.OrderStatusPaid, "warehouse", "paid by card", 3, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery("SELECT o.order_uid").
+		WithArgs(order.OrderUID).
+		WillReturnRows(addOrderRow(newOrderRows(), order))
+	mock.ExpectQuery("SELECT chrt_id").
+		WithArgs(order.OrderUID).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"chrt_id", "track_number", "price", "rid", "name", "sale", "size", "total_price", "nm_id", "brand", "status",
+		}))
+	mock.ExpectExec("INSERT INTO order_audit").
+		WithArgs(order.OrderUID, 3, "status", "warehouse", repositories.ChannelSystem,
+			`{"fields":[{"field":"status","from":"created","to":"paid"}]}`, sqlmock.AnyArg(), nil, nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	updated, change, err := repo.ChangeStatus(ctx, order.OrderUID, repositories.StatusTransition{
+		To:              model.OrderStatusPaid,
+		Reason:          "paid by card",
+		ExpectedVersion: 2,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, model.OrderStatusPaid, updated.Status)
+	assert.Equal(t, model.OrderStatusCreated, change.From)
+	assert.Equal(t, "warehouse", change.Actor)
+	assert.Equal(t, int64(3), change.Version)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_ChangeStatus_InvalidTransition(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewOrderRepository(db)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT version, status").
+		WithArgs("test-order-uid").
+		WillReturnRows(sqlmock.NewRows([]string{"version", "status", "complete"}).AddRow(5, "cancelled", true))
+	mock.ExpectRollback()
+
+	_, _, err = repo.ChangeStatus(context.Background(), "test-order-uid", repositories.StatusTransition{
+		To: model.OrderStatusShipped,
+	})
+	require.ErrorIs(t, err, repositories.ErrInvalidStatusTransition)
+
+	// Неизвестный статус отклоняется без обращения к базе
+	_, _, err = repo.ChangeStatus(context.Background(), "test-order-uid", repositories.StatusTransition{
+		To: model.OrderStatus("lost"),
+	})
+	require.ErrorIs(t, err, repositories.ErrInvalidStatusTransition)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_ChangeStatus_Draft(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewOrderRepository(db)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT version, status").
+		WithArgs("draft-order").
+		WillReturnRows(sqlmock.NewRows([]string{"version", "status", "complete"}).AddRow(1, "created", false))
+	mock.ExpectRollback()
+
+	_, _, err = repo.ChangeStatus(context.Background(), "draft-order", repositories.StatusTransition{
+		To: model.OrderStatusPaid,
+	})
+	require.ErrorIs(t, err, repositories.ErrInvalidStatusTransition)
+	assert.Contains(t, err.Error(), "draft")
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_StatusHistory_Unit(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewOrderRepository(db)
+	now := time.Now()
+
+	mock.ExpectQuery("FROM order_status_history").
+		WithArgs("test-order-uid").
+		WillReturnRows(sqlmock.NewRows([]string{
+			"order_uid", "from_status", "to_status", "actor", "reason", "version", "changed_at",
+		}).
+			AddRow("test-order-uid", "created", "paid", "api", "", 2, now).
+			AddRow("test-order-uid", "paid", "assembling", "warehouse", "", 3, now))
+
+	mock.ExpectQuery("FROM order_status_history").
+		WithArgs("missing").
+		WillReturnRows(sqlmock.NewRows([]string{
+			"order_uid", "from_status", "to_status", "actor", "reason", "version", "changed_at",
+		}))
+	mock.ExpectQuery("SELECT EXISTS").
+		WithArgs("missing").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+	history, err := repo.StatusHistory(context.Background(), "test-order-uid")
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, model.OrderStatusAssembling, history[1].To)
+	assert.Equal(t, "warehouse", history[1].Actor)
+
+	_, err = repo.StatusHistory(context.Background(), "missing")
+	require.ErrorIs(t, err, repositories.ErrOrderNotFound)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
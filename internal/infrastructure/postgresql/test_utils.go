@@ -73,7 +73,7 @@ func CreateBenchmarkOrder() *model.Order {
 			TotalPrice:  100 + i - (i % 30),
 			NmID:        123 + i,
 			Brand:       "Test Brand",
-			Status:      (i % 3) + 1,
+			Status:      model.ItemStatus((i % 3) + 1),
 		})
 	}
 
@@ -93,7 +93,7 @@ func createTestOrderDifferent() *model.Order {
 		SmID:              1,
 		DateCreated:       time.Now(),
 		OofShard:          "test-oof",
-		Delivery: model.Delivery{
+		Delivery: &model.Delivery{
 			Name:    "John Doe",
 			Phone:   "+1234567890",
 			Zip:     "123456",
@@ -102,7 +102,7 @@ func createTestOrderDifferent() *model.Order {
 			Region:  "Moscow",
 			Email:   "john@example.com",
 		},
-		Payment: model.Payment{
+		Payment: &model.Payment{
 			Transaction:  "test-transaction",
 			RequestID:    "test-request",
 			Currency:     "USD",
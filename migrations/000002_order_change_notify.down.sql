@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS items_notify_change ON items;
+DROP TRIGGER IF EXISTS payments_notify_change ON payments;
+DROP TRIGGER IF EXISTS deliveries_notify_change ON deliveries;
+DROP TRIGGER IF EXISTS orders_notify_change ON orders;
+DROP FUNCTION IF EXISTS notify_order_change();
@@ -0,0 +1,30 @@
+-- Уведомляем другие экземпляры сервиса об изменении заказа.
+-- Payload - только order_uid, поэтому несколько изменений одного заказа
+-- в одной транзакции схлопываются в одно уведомление.
+CREATE OR REPLACE FUNCTION notify_order_change() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        PERFORM pg_notify('order_changes', OLD.order_uid);
+    END IF;
+    IF TG_OP IN ('INSERT', 'UPDATE') THEN
+        PERFORM pg_notify('order_changes', NEW.order_uid);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER orders_notify_change
+    AFTER INSERT OR UPDATE OR DELETE ON orders
+    FOR EACH ROW EXECUTE FUNCTION notify_order_change();
+
+CREATE TRIGGER deliveries_notify_change
+    AFTER INSERT OR UPDATE OR DELETE ON deliveries
+    FOR EACH ROW EXECUTE FUNCTION notify_order_change();
+
+CREATE TRIGGER payments_notify_change
+    AFTER INSERT OR UPDATE OR DELETE ON payments
+    FOR EACH ROW EXECUTE FUNCTION notify_order_change();
+
+CREATE TRIGGER items_notify_change
+    AFTER INSERT OR UPDATE OR DELETE ON items
+    FOR EACH ROW EXECUTE FUNCTION notify_order_change();
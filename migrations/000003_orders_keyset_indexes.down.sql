@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_items_order_uid_status;
+DROP INDEX IF EXISTS idx_orders_delivery_service;
+DROP INDEX IF EXISTS idx_orders_track_number;
+DROP INDEX IF EXISTS idx_orders_date_created_uid;
+ALTER TABLE orders ALTER COLUMN date_created DROP NOT NULL;
@@ -0,0 +1,8 @@
+-- Курсорная пагинация сравнивает (date_created, order_uid), NULL в ней недопустим
+UPDATE orders SET date_created = to_timestamp(0) WHERE date_created IS NULL;
+ALTER TABLE orders ALTER COLUMN date_created SET NOT NULL;
+
+CREATE INDEX idx_orders_date_created_uid ON orders(date_created, order_uid);
+CREATE INDEX idx_orders_track_number ON orders(track_number);
+CREATE INDEX idx_orders_delivery_service ON orders(delivery_service);
+CREATE INDEX idx_items_order_uid_status ON items(order_uid, status);
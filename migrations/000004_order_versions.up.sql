@@ -0,0 +1,3 @@
+-- Версия заказа для optimistic concurrency: увеличивается при каждой записи
+ALTER TABLE orders ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE orders ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
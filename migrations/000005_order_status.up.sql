@@ -0,0 +1,20 @@
+-- Статус заказа целиком; меняется только через граф переходов приложения
+ALTER TABLE orders ADD COLUMN status VARCHAR(32) NOT NULL DEFAULT 'created';
+ALTER TABLE orders ADD CONSTRAINT orders_status_check CHECK (
+    status IN ('created', 'paid', 'assembling', 'shipped', 'delivered', 'cancelled', 'returned')
+);
+
+CREATE INDEX IF NOT EXISTS idx_orders_status ON orders (status);
+
+CREATE TABLE IF NOT EXISTS order_status_history (
+    id BIGSERIAL PRIMARY KEY,
+    order_uid VARCHAR(255) NOT NULL REFERENCES orders(order_uid) ON DELETE CASCADE,
+    from_status VARCHAR(32) NOT NULL,
+    to_status VARCHAR(32) NOT NULL,
+    actor VARCHAR(255) NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    version BIGINT NOT NULL,
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_status_history_order ON order_status_history (order_uid, changed_at);
@@ -0,0 +1,2 @@
+-- Поиск товаров по rid при массовой смене статусов
+CREATE INDEX IF NOT EXISTS idx_items_rid ON items (rid);
@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS order_audit_append_only ON order_audit;
+DROP FUNCTION IF EXISTS order_audit_append_only();
+DROP TABLE IF EXISTS order_audit;
@@ -0,0 +1,32 @@
+-- Журнал аудита заказов. Без внешнего ключа: записи переживают удаление заказа
+CREATE TABLE IF NOT EXISTS order_audit (
+    id BIGSERIAL PRIMARY KEY,
+    order_uid VARCHAR(255) NOT NULL,
+    version BIGINT NOT NULL,
+    action VARCHAR(32) NOT NULL CHECK (
+        action IN ('create', 'update', 'delete', 'status', 'import', 'restore')
+    ),
+    actor VARCHAR(255) NOT NULL,
+    channel VARCHAR(32) NOT NULL,
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    changes JSONB,
+    snapshot JSONB
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_audit_order ON order_audit (order_uid, id);
+CREATE INDEX IF NOT EXISTS idx_order_audit_changed_at ON order_audit (changed_at);
+
+-- Журнал только дописывается. Задачи хранения и удаления персональных данных
+-- включают SET LOCAL order_audit.maintenance = 'on' в своей транзакции
+CREATE OR REPLACE FUNCTION order_audit_append_only() RETURNS trigger AS $$
+BEGIN
+    IF current_setting('order_audit.maintenance', true) = 'on' THEN
+        RETURN COALESCE(NEW, OLD);
+    END IF;
+    RAISE EXCEPTION 'order_audit is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER order_audit_append_only
+    BEFORE UPDATE OR DELETE ON order_audit
+    FOR EACH ROW EXECUTE FUNCTION order_audit_append_only();
@@ -0,0 +1,4 @@
+-- Секции архива удаляются вместе с родительской таблицей
+DROP TABLE IF EXISTS orders_archive;
+DROP INDEX IF EXISTS idx_orders_deleted_at;
+ALTER TABLE orders DROP COLUMN IF EXISTS deleted_at;
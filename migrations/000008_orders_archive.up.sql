@@ -0,0 +1,23 @@
+-- Мягкое удаление: заказ скрыт из чтения, но остается в базе до архивации
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_orders_deleted_at ON orders (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- Архив заказов, секционированный по месяцам date_created. Заказ хранится целиком
+-- документом JSONB, в архиве он только читается. Рабочие таблицы не секционируются:
+-- первичный ключ секционированной таблицы обязан включать date_created, а на
+-- orders(order_uid) ссылаются внешние ключи и по нему идут upsert-ы.
+-- Секции месяцев создает задача архивации по мере надобности.
+CREATE TABLE IF NOT EXISTS orders_archive (
+    order_uid VARCHAR(50) NOT NULL,
+    date_created TIMESTAMPTZ NOT NULL,
+    customer_id VARCHAR(50),
+    status VARCHAR(32) NOT NULL,
+    deleted_at TIMESTAMPTZ,
+    archived_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    document JSONB NOT NULL,
+    PRIMARY KEY (order_uid, date_created)
+) PARTITION BY RANGE (date_created);
+
+CREATE INDEX IF NOT EXISTS idx_orders_archive_date_created_uid ON orders_archive (date_created, order_uid);
+CREATE INDEX IF NOT EXISTS idx_orders_archive_customer_id ON orders_archive (customer_id);
@@ -0,0 +1,14 @@
+BEGIN;
+
+DROP INDEX IF EXISTS idx_orders_cancelled_updated_at;
+
+-- Журнал только дописывается, удаление новых записей идет в режиме обслуживания
+SET LOCAL order_audit.maintenance = 'on';
+DELETE FROM order_audit WHERE action IN ('anonymize', 'purge');
+
+ALTER TABLE order_audit DROP CONSTRAINT IF EXISTS order_audit_action_check;
+ALTER TABLE order_audit ADD CONSTRAINT order_audit_action_check CHECK (
+    action IN ('create', 'update', 'delete', 'status', 'import', 'restore')
+);
+
+COMMIT;
@@ -0,0 +1,8 @@
+-- Записи журнала о стирании данных по сроку хранения
+ALTER TABLE order_audit DROP CONSTRAINT IF EXISTS order_audit_action_check;
+ALTER TABLE order_audit ADD CONSTRAINT order_audit_action_check CHECK (
+    action IN ('create', 'update', 'delete', 'status', 'import', 'restore', 'anonymize', 'purge')
+);
+
+-- Поиск отмененных заказов с истекшим сроком хранения
+CREATE INDEX IF NOT EXISTS idx_orders_cancelled_updated_at ON orders (updated_at) WHERE status = 'cancelled';
@@ -0,0 +1,22 @@
+-- Шифртекст не помещается в прежние колонки и без ключей не читается:
+-- перед откатом данные нужно расшифровать (reencrypt -decrypt)
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM deliveries WHERE key_id IS NOT NULL) THEN
+        RAISE EXCEPTION 'deliveries contain encrypted rows, run reencrypt -decrypt first';
+    END IF;
+END $$;
+
+DROP INDEX IF EXISTS idx_deliveries_key_id;
+DROP INDEX IF EXISTS idx_deliveries_phone_bidx;
+DROP INDEX IF EXISTS idx_deliveries_email_bidx;
+
+ALTER TABLE deliveries
+    DROP COLUMN IF EXISTS phone_bidx,
+    DROP COLUMN IF EXISTS email_bidx,
+    DROP COLUMN IF EXISTS dek,
+    DROP COLUMN IF EXISTS key_id,
+    ALTER COLUMN name TYPE VARCHAR(100),
+    ALTER COLUMN phone TYPE VARCHAR(20),
+    ALTER COLUMN address TYPE VARCHAR(200),
+    ALTER COLUMN email TYPE VARCHAR(100);
@@ -0,0 +1,19 @@
+-- Шифрование персональных данных получателя: name, phone, address и email хранят
+-- шифртекст (base64), key_id и dek - ключ провайдера и обернутый им ключ данных записи.
+-- У записей без key_id поля открыты (сервис без ключей или до перешифрования).
+ALTER TABLE deliveries
+    ALTER COLUMN name TYPE TEXT,
+    ALTER COLUMN phone TYPE TEXT,
+    ALTER COLUMN address TYPE TEXT,
+    ALTER COLUMN email TYPE TEXT,
+    ADD COLUMN IF NOT EXISTS key_id VARCHAR(64),
+    ADD COLUMN IF NOT EXISTS dek BYTEA,
+    ADD COLUMN IF NOT EXISTS email_bidx VARCHAR(64),
+    ADD COLUMN IF NOT EXISTS phone_bidx VARCHAR(64);
+
+-- Слепые индексы для поиска заказов по email и телефону
+CREATE INDEX IF NOT EXISTS idx_deliveries_email_bidx ON deliveries (email_bidx) WHERE email_bidx IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_deliveries_phone_bidx ON deliveries (phone_bidx) WHERE phone_bidx IS NOT NULL;
+
+-- Перешифрование ищет записи, зашифрованные не текущим ключом
+CREATE INDEX IF NOT EXISTS idx_deliveries_key_id ON deliveries (key_id);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_order_audit_customer_id;
+DROP TABLE IF EXISTS erasure_jobs;
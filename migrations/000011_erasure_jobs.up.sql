@@ -0,0 +1,20 @@
+-- Заявки на стирание персональных данных покупателя; выполненные остаются
+-- как подтверждение обработки запроса
+CREATE TABLE IF NOT EXISTS erasure_jobs (
+    id BIGSERIAL PRIMARY KEY,
+    customer_id VARCHAR(50) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'done', 'failed')),
+    requested_by VARCHAR(100) NOT NULL,
+    requested_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    finished_at TIMESTAMPTZ,
+    orders INTEGER NOT NULL DEFAULT 0,
+    error TEXT
+);
+
+-- Одна ждущая заявка на покупателя
+CREATE UNIQUE INDEX IF NOT EXISTS idx_erasure_jobs_pending ON erasure_jobs (customer_id) WHERE status = 'pending';
+
+CREATE INDEX IF NOT EXISTS idx_erasure_jobs_customer_id ON erasure_jobs (customer_id);
+
+-- Поиск записей журнала об удаленных заказах покупателя
+CREATE INDEX IF NOT EXISTS idx_order_audit_customer_id ON order_audit ((snapshot->>'customer_id'));
@@ -0,0 +1,24 @@
+-- Без ключей зашифрованные документы не читаются:
+-- перед откатом данные нужно расшифровать (reencrypt -decrypt)
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM order_audit WHERE key_id IS NOT NULL)
+        OR EXISTS (SELECT 1 FROM orders_archive WHERE key_id IS NOT NULL) THEN
+        RAISE EXCEPTION 'audit log or archive contain encrypted rows, run reencrypt -decrypt first';
+    END IF;
+END $$;
+
+DROP INDEX IF EXISTS idx_orders_archive_key_id;
+DROP INDEX IF EXISTS idx_order_audit_key_id;
+DROP INDEX IF EXISTS idx_orders_archive_phone_bidx;
+DROP INDEX IF EXISTS idx_orders_archive_email_bidx;
+
+ALTER TABLE orders_archive
+    DROP COLUMN IF EXISTS phone_bidx,
+    DROP COLUMN IF EXISTS email_bidx,
+    DROP COLUMN IF EXISTS dek,
+    DROP COLUMN IF EXISTS key_id;
+
+ALTER TABLE order_audit
+    DROP COLUMN IF EXISTS dek,
+    DROP COLUMN IF EXISTS key_id;
@@ -0,0 +1,20 @@
+-- Данные получателя в снимках и изменениях журнала аудита и в документах архива
+-- шифруются так же, как в deliveries: name, phone, address и email хранят шифртекст,
+-- key_id и dek - ключ записи. У записей без key_id документы открыты.
+ALTER TABLE order_audit
+    ADD COLUMN IF NOT EXISTS key_id VARCHAR(64),
+    ADD COLUMN IF NOT EXISTS dek BYTEA;
+
+ALTER TABLE orders_archive
+    ADD COLUMN IF NOT EXISTS key_id VARCHAR(64),
+    ADD COLUMN IF NOT EXISTS dek BYTEA,
+    ADD COLUMN IF NOT EXISTS email_bidx VARCHAR(64),
+    ADD COLUMN IF NOT EXISTS phone_bidx VARCHAR(64);
+
+-- Поиск архивных заказов по email и телефону
+CREATE INDEX IF NOT EXISTS idx_orders_archive_email_bidx ON orders_archive (email_bidx) WHERE email_bidx IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_orders_archive_phone_bidx ON orders_archive (phone_bidx) WHERE phone_bidx IS NOT NULL;
+
+-- Перешифрование ищет записи, зашифрованные не текущим ключом
+CREATE INDEX IF NOT EXISTS idx_order_audit_key_id ON order_audit (key_id);
+CREATE INDEX IF NOT EXISTS idx_orders_archive_key_id ON orders_archive (key_id);
@@ -0,0 +1,14 @@
+-- Внешний ключ нельзя вернуть, пока есть история архивных заказов
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM order_status_history h
+        WHERE NOT EXISTS (SELECT 1 FROM orders o WHERE o.order_uid = h.order_uid)
+    ) THEN
+        RAISE EXCEPTION 'order_status_history has rows of archived or purged orders';
+    END IF;
+END $$;
+
+ALTER TABLE order_status_history
+    ADD CONSTRAINT order_status_history_order_uid_fkey
+    FOREIGN KEY (order_uid) REFERENCES orders(order_uid) ON DELETE CASCADE;
@@ -0,0 +1,4 @@
+-- История статусов переживает перенос заказа в архив, как и журнал аудита:
+-- каскадное удаление по внешнему ключу стирало ее при архивации.
+-- Окончательное удаление по сроку хранения чистит историю само.
+ALTER TABLE order_status_history DROP CONSTRAINT IF EXISTS order_status_history_order_uid_fkey;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_erasure_jobs_next_attempt;
+
+ALTER TABLE erasure_jobs
+    DROP COLUMN IF EXISTS next_attempt_at,
+    DROP COLUMN IF EXISTS attempts;
@@ -0,0 +1,7 @@
+-- Неудачная заявка на стирание повторяется с растущей паузой и помечается failed
+-- только после нескольких попыток
+ALTER TABLE erasure_jobs
+    ADD COLUMN IF NOT EXISTS attempts INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+CREATE INDEX IF NOT EXISTS idx_erasure_jobs_next_attempt ON erasure_jobs (next_attempt_at) WHERE status = 'pending';
@@ -0,0 +1,98 @@
+-- Обратно к несекционированным orders и items с ключом order_uid
+ALTER TABLE deliveries DROP CONSTRAINT IF EXISTS deliveries_order_fkey;
+ALTER TABLE payments DROP CONSTRAINT IF EXISTS payments_order_fkey;
+
+ALTER TABLE orders RENAME TO orders_partitioned;
+ALTER TABLE items RENAME TO items_partitioned;
+ALTER SEQUENCE items_id_seq OWNED BY NONE;
+
+CREATE TABLE orders (
+    order_uid VARCHAR(50) NOT NULL,
+    track_number VARCHAR(50),
+    entry VARCHAR(10),
+    locale VARCHAR(10),
+    internal_signature VARCHAR(100),
+    customer_id VARCHAR(50),
+    delivery_service VARCHAR(50),
+    shardkey VARCHAR(10),
+    sm_id INTEGER,
+    date_created TIMESTAMPTZ NOT NULL,
+    oof_shard VARCHAR(10),
+    version BIGINT NOT NULL DEFAULT 1,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    status VARCHAR(32) NOT NULL DEFAULT 'created',
+    deleted_at TIMESTAMPTZ
+);
+
+CREATE TABLE items (
+    id INTEGER NOT NULL DEFAULT nextval('items_id_seq'),
+    order_uid VARCHAR(50),
+    chrt_id INTEGER,
+    track_number VARCHAR(50),
+    price INTEGER,
+    rid VARCHAR(100),
+    name VARCHAR(250),
+    sale INTEGER,
+    size VARCHAR(10),
+    total_price INTEGER,
+    nm_id INTEGER,
+    brand VARCHAR(100),
+    status INTEGER
+);
+
+INSERT INTO orders (
+    order_uid, track_number, entry, locale, internal_signature, customer_id, delivery_service,
+    shardkey, sm_id, date_created, oof_shard, version, updated_at, status, deleted_at
+)
+SELECT order_uid, track_number, entry, locale, internal_signature, customer_id, delivery_service,
+       shardkey, sm_id, date_created, oof_shard, version, updated_at, status, deleted_at
+FROM orders_partitioned;
+
+INSERT INTO items (
+    id, order_uid, chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status
+)
+SELECT id, order_uid, chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status
+FROM items_partitioned;
+
+-- Секции уходят вместе с родительскими таблицами
+DROP TABLE items_partitioned;
+DROP TABLE orders_partitioned;
+ALTER SEQUENCE items_id_seq OWNED BY items.id;
+
+ALTER TABLE orders ADD CONSTRAINT orders_pkey PRIMARY KEY (order_uid);
+ALTER TABLE orders ADD CONSTRAINT orders_status_check CHECK (
+    status IN ('created', 'paid', 'assembling', 'shipped', 'delivered', 'cancelled', 'returned')
+);
+ALTER TABLE items ADD CONSTRAINT items_pkey PRIMARY KEY (id);
+
+ALTER TABLE items ADD CONSTRAINT items_order_uid_fkey FOREIGN KEY (order_uid)
+    REFERENCES orders (order_uid) ON DELETE CASCADE;
+ALTER TABLE deliveries DROP COLUMN IF EXISTS date_created;
+ALTER TABLE deliveries ADD CONSTRAINT deliveries_order_uid_fkey FOREIGN KEY (order_uid)
+    REFERENCES orders (order_uid) ON DELETE CASCADE;
+ALTER TABLE payments DROP COLUMN IF EXISTS date_created;
+ALTER TABLE payments ADD CONSTRAINT payments_order_uid_fkey FOREIGN KEY (order_uid)
+    REFERENCES orders (order_uid) ON DELETE CASCADE;
+
+CREATE INDEX idx_orders_order_uid ON orders (order_uid);
+CREATE INDEX idx_orders_customer_id ON orders (customer_id);
+CREATE INDEX idx_orders_date_created ON orders (date_created DESC);
+CREATE INDEX idx_orders_date_created_uid ON orders (date_created, order_uid);
+CREATE INDEX idx_orders_track_number ON orders (track_number);
+CREATE INDEX idx_orders_delivery_service ON orders (delivery_service);
+CREATE INDEX idx_orders_status ON orders (status);
+CREATE INDEX idx_orders_deleted_at ON orders (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX idx_orders_cancelled_updated_at ON orders (updated_at) WHERE status = 'cancelled';
+
+CREATE INDEX idx_items_order_uid ON items (order_uid);
+CREATE INDEX idx_items_order_uid_status ON items (order_uid, status);
+CREATE INDEX idx_items_track_number ON items (track_number);
+CREATE INDEX idx_items_rid ON items (rid);
+
+CREATE TRIGGER orders_notify_change
+    AFTER INSERT OR UPDATE OR DELETE ON orders
+    FOR EACH ROW EXECUTE FUNCTION notify_order_change();
+
+CREATE TRIGGER items_notify_change
+    AFTER INSERT OR UPDATE OR DELETE ON items
+    FOR EACH ROW EXECUTE FUNCTION notify_order_change();
@@ -0,0 +1,133 @@
+-- Рабочие таблицы orders и items секционируются по месяцам date_created, как и
+-- orders_archive: чтения за период затрагивают только свои секции, а архивация
+-- освобождает старые. Первичный ключ секционированной таблицы обязан включать
+-- date_created, поэтому заказ определяет пара (order_uid, date_created), и по ней
+-- на него ссылаются deliveries, payments и items. Уникальность order_uid между
+-- секциями держит приложение: запись заказа берет рекомендательную блокировку
+-- по order_uid, создает недостающие секции и переносит заказ при смене date_created.
+
+ALTER TABLE deliveries DROP CONSTRAINT IF EXISTS deliveries_order_uid_fkey;
+ALTER TABLE payments DROP CONSTRAINT IF EXISTS payments_order_uid_fkey;
+
+ALTER TABLE orders RENAME TO orders_unpartitioned;
+ALTER TABLE items RENAME TO items_unpartitioned;
+ALTER SEQUENCE items_id_seq OWNED BY NONE;
+
+CREATE TABLE orders (
+    order_uid VARCHAR(50) NOT NULL,
+    track_number VARCHAR(50),
+    entry VARCHAR(10),
+    locale VARCHAR(10),
+    internal_signature VARCHAR(100),
+    customer_id VARCHAR(50),
+    delivery_service VARCHAR(50),
+    shardkey VARCHAR(10),
+    sm_id INTEGER,
+    date_created TIMESTAMPTZ NOT NULL,
+    oof_shard VARCHAR(10),
+    version BIGINT NOT NULL DEFAULT 1,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    status VARCHAR(32) NOT NULL DEFAULT 'created',
+    deleted_at TIMESTAMPTZ
+) PARTITION BY RANGE (date_created);
+
+CREATE TABLE items (
+    id INTEGER NOT NULL DEFAULT nextval('items_id_seq'),
+    order_uid VARCHAR(50) NOT NULL,
+    date_created TIMESTAMPTZ NOT NULL,
+    chrt_id INTEGER,
+    track_number VARCHAR(50),
+    price INTEGER,
+    rid VARCHAR(100),
+    name VARCHAR(250),
+    sale INTEGER,
+    size VARCHAR(10),
+    total_price INTEGER,
+    nm_id INTEGER,
+    brand VARCHAR(100),
+    status INTEGER
+) PARTITION BY RANGE (date_created);
+
+-- Секции месяцев, в которых уже есть заказы; новые создает приложение
+DO $$
+DECLARE
+    month TIMESTAMP;
+    suffix TEXT;
+BEGIN
+    FOR month IN
+        SELECT DISTINCT date_trunc('month', date_created AT TIME ZONE 'UTC') FROM orders_unpartitioned
+    LOOP
+        suffix := to_char(month, 'YYYY_MM');
+        EXECUTE format('CREATE TABLE %I PARTITION OF orders FOR VALUES FROM (%L) TO (%L)',
+            'orders_' || suffix, month AT TIME ZONE 'UTC', (month + interval '1 month') AT TIME ZONE 'UTC');
+        EXECUTE format('CREATE TABLE %I PARTITION OF items FOR VALUES FROM (%L) TO (%L)',
+            'items_' || suffix, month AT TIME ZONE 'UTC', (month + interval '1 month') AT TIME ZONE 'UTC');
+    END LOOP;
+END $$;
+
+INSERT INTO orders (
+    order_uid, track_number, entry, locale, internal_signature, customer_id, delivery_service,
+    shardkey, sm_id, date_created, oof_shard, version, updated_at, status, deleted_at
+)
+SELECT order_uid, track_number, entry, locale, internal_signature, customer_id, delivery_service,
+       shardkey, sm_id, date_created, oof_shard, version, updated_at, status, deleted_at
+FROM orders_unpartitioned;
+
+INSERT INTO items (
+    id, order_uid, date_created, chrt_id, track_number, price, rid, name, sale, size,
+    total_price, nm_id, brand, status
+)
+SELECT i.id, i.order_uid, o.date_created, i.chrt_id, i.track_number, i.price, i.rid, i.name, i.sale, i.size,
+       i.total_price, i.nm_id, i.brand, i.status
+FROM items_unpartitioned i
+JOIN orders_unpartitioned o ON o.order_uid = i.order_uid;
+
+ALTER TABLE deliveries ADD COLUMN date_created TIMESTAMPTZ;
+UPDATE deliveries d SET date_created = o.date_created
+FROM orders_unpartitioned o WHERE o.order_uid = d.order_uid;
+ALTER TABLE deliveries ALTER COLUMN date_created SET NOT NULL;
+
+ALTER TABLE payments ADD COLUMN date_created TIMESTAMPTZ;
+UPDATE payments p SET date_created = o.date_created
+FROM orders_unpartitioned o WHERE o.order_uid = p.order_uid;
+ALTER TABLE payments ALTER COLUMN date_created SET NOT NULL;
+
+-- Вместе со старыми таблицами уходят их индексы и триггеры
+DROP TABLE items_unpartitioned;
+DROP TABLE orders_unpartitioned;
+ALTER SEQUENCE items_id_seq OWNED BY items.id;
+
+ALTER TABLE orders ADD CONSTRAINT orders_pkey PRIMARY KEY (order_uid, date_created);
+ALTER TABLE orders ADD CONSTRAINT orders_status_check CHECK (
+    status IN ('created', 'paid', 'assembling', 'shipped', 'delivered', 'cancelled', 'returned')
+);
+ALTER TABLE items ADD CONSTRAINT items_pkey PRIMARY KEY (id, date_created);
+
+ALTER TABLE items ADD CONSTRAINT items_order_fkey FOREIGN KEY (order_uid, date_created)
+    REFERENCES orders (order_uid, date_created) ON DELETE CASCADE;
+ALTER TABLE deliveries ADD CONSTRAINT deliveries_order_fkey FOREIGN KEY (order_uid, date_created)
+    REFERENCES orders (order_uid, date_created) ON DELETE CASCADE;
+ALTER TABLE payments ADD CONSTRAINT payments_order_fkey FOREIGN KEY (order_uid, date_created)
+    REFERENCES orders (order_uid, date_created) ON DELETE CASCADE;
+
+CREATE INDEX idx_orders_customer_id ON orders (customer_id);
+CREATE INDEX idx_orders_date_created ON orders (date_created DESC);
+CREATE INDEX idx_orders_date_created_uid ON orders (date_created, order_uid);
+CREATE INDEX idx_orders_track_number ON orders (track_number);
+CREATE INDEX idx_orders_delivery_service ON orders (delivery_service);
+CREATE INDEX idx_orders_status ON orders (status);
+CREATE INDEX idx_orders_deleted_at ON orders (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX idx_orders_cancelled_updated_at ON orders (updated_at) WHERE status = 'cancelled';
+
+CREATE INDEX idx_items_order_uid ON items (order_uid);
+CREATE INDEX idx_items_order_uid_status ON items (order_uid, status);
+CREATE INDEX idx_items_track_number ON items (track_number);
+CREATE INDEX idx_items_rid ON items (rid);
+
+CREATE TRIGGER orders_notify_change
+    AFTER INSERT OR UPDATE OR DELETE ON orders
+    FOR EACH ROW EXECUTE FUNCTION notify_order_change();
+
+CREATE TRIGGER items_notify_change
+    AFTER INSERT OR UPDATE OR DELETE ON items
+    FOR EACH ROW EXECUTE FUNCTION notify_order_change();
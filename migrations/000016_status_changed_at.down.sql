@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_orders_cancelled_status_changed_at;
+ALTER TABLE orders DROP COLUMN IF EXISTS status_changed_at;
+
+CREATE INDEX IF NOT EXISTS idx_orders_cancelled_updated_at ON orders (updated_at) WHERE status = 'cancelled';
@@ -0,0 +1,18 @@
+-- Момент последней смены статуса: срок хранения отмененных заказов отсчитывается
+-- от отмены, а не от updated_at, который сдвигают и служебные изменения вроде
+-- обезличивания доставки. Для старых заказов берется последняя запись истории
+-- о переходе в текущий статус, без нее - updated_at.
+ALTER TABLE orders ADD COLUMN status_changed_at TIMESTAMPTZ;
+
+UPDATE orders o SET status_changed_at = COALESCE(
+    (SELECT max(h.changed_at) FROM order_status_history h
+     WHERE h.order_uid = o.order_uid AND h.to_status = o.status),
+    o.updated_at
+);
+
+ALTER TABLE orders ALTER COLUMN status_changed_at SET DEFAULT now();
+ALTER TABLE orders ALTER COLUMN status_changed_at SET NOT NULL;
+
+DROP INDEX IF EXISTS idx_orders_cancelled_updated_at;
+CREATE INDEX IF NOT EXISTS idx_orders_cancelled_status_changed_at ON orders (status_changed_at)
+    WHERE status = 'cancelled';
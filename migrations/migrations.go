@@ -0,0 +1,9 @@
+// Package migrations - SQL-миграции схемы заказов, встроенные в бинарник
+package migrations
+
+import "embed"
+
+// FS содержит файлы NNNNNN_name.up.sql / NNNNNN_name.down.sql в корне
+//
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,41 @@
+package migrations
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Каждая миграция имеет up и down, номера идут подряд с 1
+func TestEmbeddedMigrations(t *testing.T) {
+	source, err := iofs.New(FS, ".")
+	require.NoError(t, err)
+	defer source.Close()
+
+	version, err := source.First()
+	require.NoError(t, err)
+	assert.Equal(t, uint(1), version)
+
+	for {
+		up, _, err := source.ReadUp(version)
+		require.NoError(t, err, "up migration %d", version)
+		up.Close()
+
+		down, _, err := source.ReadDown(version)
+		require.NoError(t, err, "down migration %d", version)
+		down.Close()
+
+		next, err := source.Next(version)
+		if errors.Is(err, os.ErrNotExist) || errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		require.NoError(t, err)
+		assert.Equal(t, version+1, next, "gap after migration %d", version)
+		version = next
+	}
+}